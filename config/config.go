@@ -3,12 +3,10 @@ package config
 import (
 	"log"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/facebook"
-	"golang.org/x/oauth2/google"
 )
 
 type Config struct {
@@ -33,6 +31,35 @@ type Config struct {
 	GoogleClientSecret           string `envconfig:"google_client_secret"`
 	GoogleRedirectURL            string `envconfig:"google_redirect_url"`
 	GoogleApplicationCredentials string `envconfig:"google_application_credentials"`
+	RefillReminderDays           int    `envconfig:"refill_reminder_days"`
+	ArchiveRetentionDays         int    `envconfig:"archive_retention_days"`
+	InteractionsFile             string `envconfig:"interactions_file"`
+	DrugCatalogFile              string `envconfig:"drug_catalog_file"`
+	MissedDoseGraceMinutes       int    `envconfig:"missed_dose_grace_minutes"`
+	DigestLowAdherencePercent    int    `envconfig:"digest_low_adherence_percent"`
+	LoginFreeAttempts            int    `envconfig:"login_free_attempts"`
+	LoginLockoutAttempts         int    `envconfig:"login_lockout_attempts"`
+	IPLoginLockoutAttempts       int    `envconfig:"ip_login_lockout_attempts"`
+	LoginLockoutMinutes          int    `envconfig:"login_lockout_minutes"`
+	AuthRateLimit                int    `envconfig:"auth_rate_limit"`
+	APIRateLimit                 int    `envconfig:"api_rate_limit"`
+	AdminEmails                  string `envconfig:"admin_emails"`    // comma separated, these users are made admins at startup
+	OIDCProviders                string `envconfig:"oidc_providers"`  // comma separated names, each set up by MEDDLE_OIDC_<NAME>_*
+	TrustedProxies               string `envconfig:"trusted_proxies"` // comma separated addresses or CIDRs of the proxies in front of the API
+
+	// OIDC sets up the providers of OIDCProviders, Load reads them
+	OIDC []OIDCProviderConfig `ignored:"true"`
+}
+
+// OIDCProviderConfig sets up an OpenID Connect provider users can sign in
+// with, like a company SSO
+type OIDCProviderConfig struct {
+	Name         string `ignored:"true"`
+	Issuer       string `envconfig:"issuer"`
+	ClientID     string `envconfig:"client_id"`
+	ClientSecret string `envconfig:"client_secret"`
+	RedirectURL  string `envconfig:"redirect_url"`
+	Scopes       string `envconfig:"scopes"` // space separated, on top of openid, email and profile
 }
 
 func Load() (*Config, error) {
@@ -48,28 +75,15 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	return c, nil
-}
-
-func GetFacebookOAuthConfig(clientID, clientSecret, redirectURL string) *oauth2.Config {
-	return &oauth2.Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURL:  redirectURL,
-		Endpoint:     facebook.Endpoint,
-		Scopes:       []string{"email"},
-	}
-}
-
-func GetGoogleOAuthConfig(clientID, clientSecret, redirectURL string) *oauth2.Config {
-	return &oauth2.Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURL:  redirectURL,
-		Endpoint:     google.Endpoint,
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
+	for _, name := range strings.Split(c.OIDCProviders, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		provider := OIDCProviderConfig{Name: name}
+		if err := envconfig.Process("meddle_oidc_"+name, &provider); err != nil {
+			return nil, err
+		}
+		c.OIDC = append(c.OIDC, provider)
 	}
+	return c, nil
 }
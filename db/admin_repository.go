@@ -0,0 +1,145 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/admin_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db AdminRepository
+
+type AdminRepository interface {
+	ListUsers(filter *models.UserFilter) ([]models.User, error)
+	GetUser(userID uint) (*models.User, error)
+	CountMedications(userIDs []uint) (map[uint]models.MedicationCounts, error)
+	SetDeactivatedAt(userID uint, deactivatedAt int64) error
+	RequirePasswordReset(userID uint) error
+	SetRole(userID uint, role models.Role) error
+	PromoteAdmins(emails []string) (int64, error)
+}
+
+type adminRepo struct {
+	DB *gorm.DB
+}
+
+func NewAdminRepo(db *GormDB) AdminRepository {
+	return &adminRepo{db.DB}
+}
+
+// ListUsers returns a page of the users matching the filter
+func (a *adminRepo) ListUsers(filter *models.UserFilter) ([]models.User, error) {
+	var users []models.User
+	db := a.DB.Scopes(paginate("users", filter.Page))
+	if filter.Query != "" {
+		like := "%" + filter.Query + "%"
+		db = db.Where("name ILIKE ? OR email ILIKE ? OR phone_number ILIKE ?", like, like, like)
+	}
+	if filter.Role != "" {
+		db = db.Where("role = ?", filter.Role)
+	}
+	switch filter.Page.Status {
+	case "active":
+		db = db.Where("deactivated_at = 0 AND is_email_active = true")
+	case "deactivated":
+		db = db.Where("deactivated_at > 0")
+	case "unverified":
+		db = db.Where("is_email_active = false")
+	}
+	if err := db.Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("could not list users: %v", err)
+	}
+	return users, nil
+}
+
+func (a *adminRepo) GetUser(userID uint) (*models.User, error) {
+	var user models.User
+	if err := a.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("could not get user: %w", err)
+	}
+	return &user, nil
+}
+
+// CountMedications counts the medications of the users by status, with the
+// archived ones
+func (a *adminRepo) CountMedications(userIDs []uint) (map[uint]models.MedicationCounts, error) {
+	var rows []struct {
+		UserID   uint
+		Status   models.MedicationStatus
+		Done     bool
+		Archived bool
+		Count    int64
+	}
+	err := a.DB.Unscoped().Model(&models.Medication{}).
+		Select("user_id, status, is_medication_done AS done, deleted_at IS NOT NULL AS archived, count(*) AS count").
+		Where("user_id IN ?", userIDs).
+		Group("user_id, status, is_medication_done, deleted_at IS NOT NULL").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not count medications: %v", err)
+	}
+	counts := make(map[uint]models.MedicationCounts, len(userIDs))
+	for _, row := range rows {
+		userCounts := counts[row.UserID]
+		medication := models.Medication{Status: row.Status, IsMedicationDone: row.Done}
+		status := medication.EffectiveStatus()
+		switch {
+		case row.Archived:
+			userCounts.Archived += row.Count
+		case status == models.MedicationPaused:
+			userCounts.Paused += row.Count
+		case status == models.MedicationDiscontinued:
+			userCounts.Discontinued += row.Count
+		case status == models.MedicationCompleted:
+			userCounts.Completed += row.Count
+		default:
+			userCounts.Active += row.Count
+		}
+		counts[row.UserID] = userCounts
+	}
+	return counts, nil
+}
+
+// SetDeactivatedAt deactivates the user, or reactivates them with 0
+func (a *adminRepo) SetDeactivatedAt(userID uint, deactivatedAt int64) error {
+	result := a.DB.Model(&models.User{}).Where("id = ?", userID).Update("deactivated_at", deactivatedAt)
+	if result.Error != nil {
+		return fmt.Errorf("could not update deactivation: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not update deactivation: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (a *adminRepo) RequirePasswordReset(userID uint) error {
+	result := a.DB.Model(&models.User{}).Where("id = ?", userID).Update("password_reset_required", true)
+	if result.Error != nil {
+		return fmt.Errorf("could not require password reset: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not require password reset: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (a *adminRepo) SetRole(userID uint, role models.Role) error {
+	result := a.DB.Model(&models.User{}).Where("id = ?", userID).Update("role", role)
+	if result.Error != nil {
+		return fmt.Errorf("could not set role: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not set role: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// PromoteAdmins makes the users of the emails admins, returning how many
+// weren't already
+func (a *adminRepo) PromoteAdmins(emails []string) (int64, error) {
+	result := a.DB.Model(&models.User{}).Where("email IN ? AND role <> ?", emails, models.RoleAdmin).Update("role", models.RoleAdmin)
+	if result.Error != nil {
+		return 0, fmt.Errorf("could not promote admins: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
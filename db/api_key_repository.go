@@ -0,0 +1,84 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/api_key_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db APIKeyRepository
+
+type APIKeyRepository interface {
+	CreateAPIKey(key *models.APIKey) (*models.APIKey, error)
+	GetActiveAPIKeys(userID uint, now int64) ([]models.APIKey, error)
+	FindAPIKey(keyHash string) (*models.APIKey, error)
+	TouchAPIKey(keyID uint, now int64) error
+	RevokeAPIKey(keyID uint, userID uint, now int64) error
+	RevokeAPIKeys(userID uint, now int64) error
+}
+
+type apiKeyRepo struct {
+	DB *gorm.DB
+}
+
+func NewAPIKeyRepo(db *GormDB) APIKeyRepository {
+	return &apiKeyRepo{db.DB}
+}
+
+func (a *apiKeyRepo) CreateAPIKey(key *models.APIKey) (*models.APIKey, error) {
+	if err := a.DB.Create(key).Error; err != nil {
+		return nil, fmt.Errorf("could not create api key: %v", err)
+	}
+	return key, nil
+}
+
+func (a *apiKeyRepo) GetActiveAPIKeys(userID uint, now int64) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := a.DB.Where("user_id = ? AND revoked_at = 0 AND expires_at > ?", userID, now).
+		Order("created_at DESC").Find(&keys).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get api keys: %v", err)
+	}
+	return keys, nil
+}
+
+// FindAPIKey finds the key with its user, revoked or expired or not
+func (a *apiKeyRepo) FindAPIKey(keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := a.DB.Preload("User").Where("key_hash = ?", keyHash).First(&key).Error; err != nil {
+		return nil, fmt.Errorf("could not find api key: %w", err)
+	}
+	if key.User == nil {
+		return nil, fmt.Errorf("could not find user of api key: %w", gorm.ErrRecordNotFound)
+	}
+	return &key, nil
+}
+
+func (a *apiKeyRepo) TouchAPIKey(keyID uint, now int64) error {
+	err := a.DB.Model(&models.APIKey{}).Where("id = ?", keyID).Update("last_used_at", now).Error
+	if err != nil {
+		return fmt.Errorf("could not update last use of api key: %v", err)
+	}
+	return nil
+}
+
+func (a *apiKeyRepo) RevokeAPIKey(keyID uint, userID uint, now int64) error {
+	result := a.DB.Model(&models.APIKey{}).Where("id = ? AND user_id = ? AND revoked_at = 0", keyID, userID).Update("revoked_at", now)
+	if result.Error != nil {
+		return fmt.Errorf("could not revoke api key: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not revoke api key: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// RevokeAPIKeys revokes every key of the user that isn't revoked yet
+func (a *apiKeyRepo) RevokeAPIKeys(userID uint, now int64) error {
+	err := a.DB.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at = 0", userID).Update("revoked_at", now).Error
+	if err != nil {
+		return fmt.Errorf("could not revoke api keys: %v", err)
+	}
+	return nil
+}
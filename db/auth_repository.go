@@ -17,11 +17,12 @@ type AuthRepository interface {
 	IsPhoneExist(email string) error
 	FindUserByUsername(username string) (*models.User, error)
 	FindUserByEmail(email string) (*models.User, error)
-	UpdateUser(user *models.User) error
+	UpdateUser(user *models.User, rescheduled []models.Medication) error
+	SetPendingEmail(userID uint, email string) error
+	ChangeEmail(userID uint, email string) error
 	AddToBlackList(blacklist *models.BlackList) error
 	TokenInBlacklist(token string) bool
-	VerifyEmail(email string, token string) error
-	IsTokenInBlacklist(token string) error
+	VerifyEmail(userID uint, email string) error
 	UpdatePassword(password string, email string) error
 	DeleteUserByEmail(email string) error
 }
@@ -85,7 +86,50 @@ func (a *authRepo) FindUserByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
-func (a *authRepo) UpdateUser(user *models.User) error {
+// UpdateUser saves the fields of the user they can change on their profile,
+// with the next doses of the medications rescheduled for a new time zone
+func (a *authRepo) UpdateUser(user *models.User, rescheduled []models.Medication) error {
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).
+			Select("name", "phone_number", "time_zone", "locale", "notify_dose_reminders_off", "notify_refill_reminders_off").
+			Updates(user).Error
+		if err != nil {
+			return err
+		}
+		for _, medication := range rescheduled {
+			err := tx.Model(&models.Medication{}).Where("id = ? AND user_id = ?", medication.ID, user.ID).
+				Update("next_dosage_time", medication.NextDosageTime).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not update user: %v", err)
+	}
+	return nil
+}
+
+func (a *authRepo) SetPendingEmail(userID uint, email string) error {
+	err := a.DB.Model(&models.User{}).Where("id = ?", userID).Update("pending_email", email).Error
+	if err != nil {
+		return fmt.Errorf("could not set pending email: %v", err)
+	}
+	return nil
+}
+
+// ChangeEmail makes email the address of the user when it is still the one
+// they are changing to
+func (a *authRepo) ChangeEmail(userID uint, email string) error {
+	result := a.DB.Model(&models.User{}).Where("id = ? AND pending_email = ?", userID, email).
+		Updates(map[string]interface{}{"email": email, "pending_email": ""})
+	if result.Error != nil {
+		return fmt.Errorf("could not change email: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not change email: %w", gorm.ErrRecordNotFound)
+	}
 	return nil
 }
 
@@ -99,58 +143,102 @@ func (a *authRepo) TokenInBlacklist(token string) bool {
 	return result.Error != nil
 }
 
-func (a *authRepo) VerifyEmail(email string, token string) error {
-	err := a.DB.Model(&models.User{}).Where("email = ?", email).Updates(models.User{IsEmailActive: true}).Error
-	if err != nil {
-		return err
+// VerifyEmail verifies the email of the user when it is still email
+func (a *authRepo) VerifyEmail(userID uint, email string) error {
+	result := a.DB.Model(&models.User{}).Where("id = ? AND email = ?", userID, email).Update("is_email_active", true)
+	if result.Error != nil {
+		return fmt.Errorf("could not verify email: %v", result.Error)
 	}
-
-	err = a.AddToBlackList(&models.BlackList{Token: token})
-	return err
-}
-
-func (a *authRepo) IsTokenInBlacklist(token string) error {
-	var count int64
-	err := a.DB.Model(&models.BlackList{}).Where("token = ?", token).Count(&count).Error
-	if err != nil {
-		return errors.Wrap(err, "gorm.count error")
-	}
-	if count > 0 {
-		return fmt.Errorf("token expired, request a new link")
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not verify email: %w", gorm.ErrRecordNotFound)
 	}
 	return nil
 }
 
+// UpdatePassword sets the password of the user, who no longer needs to reset it
 func (a *authRepo) UpdatePassword(password string, email string) error {
-	err := a.DB.Model(&models.User{}).Where("email = ?", email).Updates(models.User{HashedPassword: password}).Error
+	err := a.DB.Model(&models.User{}).Where("email = ?", email).
+		Updates(map[string]interface{}{"hashed_password": password, "password_reset_required": false}).Error
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// DeleteUserByEmail deletes the user with everything they own, all of it or
+// none of it
 func (a *authRepo) DeleteUserByEmail(email string) error {
-	user := &models.User{}
-	err := a.DB.Where("email = ?", email).Find(user).Error
-	if err != nil {
-		return fmt.Errorf("could not find user to delete: %v", err)
-	}
-	err = a.DB.Delete(&models.Medication{}, "user_id = ?", user.ID).Error
-	if err != nil {
-		return fmt.Errorf("could not delete user's medication: %v", err)
-	}
-	err = a.DB.Delete(&models.MedicationHistory{}, "user_id = ?", user.ID).Error
-	if err != nil {
-		return fmt.Errorf("could not delete user's medication history: %v", err)
-	}
-	err = a.DB.Delete(&models.BlackList{}, "email = ?", user.Email).Error
-	if err != nil {
-		return fmt.Errorf("could not delete user's medication: %v", err)
-	}
-
-	err = a.DB.Delete(&models.User{}, "email = ?", email).Error
-	if err != nil {
-		return fmt.Errorf("could not delete user: %v", err)
-	}
-	return nil
+	return a.DB.Transaction(func(tx *gorm.DB) error {
+		user := &models.User{}
+		err := tx.Where("email = ?", email).Find(user).Error
+		if err != nil {
+			return fmt.Errorf("could not find user to delete: %v", err)
+		}
+		err = tx.Where("medication_id IN (?)", tx.Unscoped().Model(&models.Medication{}).Select("id").Where("user_id = ?", user.ID)).
+			Delete(&models.MedicationPhase{}).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's medication phases: %v", err)
+		}
+		err = tx.Delete(&models.MedicationRefill{}, "user_id = ?", user.ID).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's medication refills: %v", err)
+		}
+		// the medications of a deleted user don't go to the archive
+		err = tx.Unscoped().Delete(&models.Medication{}, "user_id = ?", user.ID).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's medication: %v", err)
+		}
+		err = tx.Unscoped().Delete(&models.MedicationHistory{}, "user_id = ?", user.ID).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's medication history: %v", err)
+		}
+		err = tx.Delete(&models.Profile{}, "user_id = ?", user.ID).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's dependent profiles: %v", err)
+		}
+		err = tx.Where("session_id IN (?)", tx.Model(&models.Session{}).Select("id").Where("user_id = ?", user.ID)).
+			Delete(&models.RefreshToken{}).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's refresh tokens: %v", err)
+		}
+		err = tx.Delete(&models.Session{}, "user_id = ?", user.ID).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's sessions: %v", err)
+		}
+		err = tx.Delete(&models.RecoveryCode{}, "user_id = ?", user.ID).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's recovery codes: %v", err)
+		}
+		err = tx.Delete(&models.APIKey{}, "user_id = ?", user.ID).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's api keys: %v", err)
+		}
+		err = tx.Delete(&models.OneTimeToken{}, "user_id = ?", user.ID).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's one-time tokens: %v", err)
+		}
+		err = tx.Delete(&models.UserIdentity{}, "user_id = ?", user.ID).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's identities: %v", err)
+		}
+		// the user's caregivers and the patients they care for lose the link
+		err = tx.Delete(&models.CaregiverLink{}, "patient_id = ? OR caregiver_id = ?", user.ID, user.ID).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's caregiver links: %v", err)
+		}
+		err = tx.Delete(&models.LoginThrottle{}, "key = ?", models.AccountThrottleKey(user.Email)).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's login throttle: %v", err)
+		}
+		err = tx.Delete(&models.BlackList{}, "email = ?", user.Email).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user's medication: %v", err)
+		}
+
+		err = tx.Delete(&models.User{}, "email = ?", email).Error
+		if err != nil {
+			return fmt.Errorf("could not delete user: %v", err)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/caregiver_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db CaregiverRepository
+
+type CaregiverRepository interface {
+	CreateCaregiverLink(link *models.CaregiverLink) (*models.CaregiverLink, error)
+	GetCaregiverLinksByPatient(patientID uint) ([]models.CaregiverLink, error)
+	GetCaregiverLink(linkID uint, patientID uint) (*models.CaregiverLink, error)
+	UpdateCaregiverLink(link *models.CaregiverLink) error
+	DeleteCaregiverLink(linkID uint, patientID uint) error
+	GetInvitations(email string) ([]models.CaregiverLink, error)
+	AcceptInvitation(linkID uint, caregiver *models.User) (*models.CaregiverLink, error)
+	DeclineInvitation(linkID uint, email string) error
+	GetPatients(caregiverID uint) ([]models.CaregiverLink, error)
+	GetAcceptedLink(patientID uint, caregiverID uint) (*models.CaregiverLink, error)
+	LeavePatient(patientID uint, caregiverID uint) error
+	GetCaregiversToNotify(patientIDs []uint) ([]models.CaregiverLink, error)
+}
+
+type caregiverRepo struct {
+	DB *gorm.DB
+}
+
+func NewCaregiverRepo(db *GormDB) CaregiverRepository {
+	return &caregiverRepo{db.DB}
+}
+
+func (r *caregiverRepo) CreateCaregiverLink(link *models.CaregiverLink) (*models.CaregiverLink, error) {
+	if err := r.DB.Create(link).Error; err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("could not create caregiver link: %w", ErrAlreadyExists)
+		}
+		return nil, fmt.Errorf("could not create caregiver link: %v", err)
+	}
+	return link, nil
+}
+
+func (r *caregiverRepo) GetCaregiverLinksByPatient(patientID uint) ([]models.CaregiverLink, error) {
+	var links []models.CaregiverLink
+	err := r.DB.Preload("Caregiver").Where("patient_id = ?", patientID).Order("id").Find(&links).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get caregivers: %v", err)
+	}
+	return links, nil
+}
+
+func (r *caregiverRepo) GetCaregiverLink(linkID uint, patientID uint) (*models.CaregiverLink, error) {
+	var link models.CaregiverLink
+	err := r.DB.Preload("Caregiver").Where("id = ? AND patient_id = ?", linkID, patientID).First(&link).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get caregiver: %w", err)
+	}
+	return &link, nil
+}
+
+func (r *caregiverRepo) UpdateCaregiverLink(link *models.CaregiverLink) error {
+	err := r.DB.Model(link).Where("patient_id = ?", link.PatientID).
+		Updates(map[string]interface{}{"permission": link.Permission, "notify_missed_doses": link.NotifyMissedDoses}).Error
+	if err != nil {
+		return fmt.Errorf("could not update caregiver: %v", err)
+	}
+	return nil
+}
+
+func (r *caregiverRepo) DeleteCaregiverLink(linkID uint, patientID uint) error {
+	result := r.DB.Where("id = ? AND patient_id = ?", linkID, patientID).Delete(&models.CaregiverLink{})
+	if result.Error != nil {
+		return fmt.Errorf("could not delete caregiver: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not delete caregiver: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// GetInvitations returns the pending invitations sent to the email
+func (r *caregiverRepo) GetInvitations(email string) ([]models.CaregiverLink, error) {
+	var links []models.CaregiverLink
+	err := r.DB.Preload("Patient").Where("caregiver_email = ? AND status = ?", email, models.CaregiverPending).
+		Order("id").Find(&links).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get invitations: %v", err)
+	}
+	return links, nil
+}
+
+// AcceptInvitation links the caregiver to the pending invitation sent to their
+// email
+func (r *caregiverRepo) AcceptInvitation(linkID uint, caregiver *models.User) (*models.CaregiverLink, error) {
+	result := r.DB.Model(&models.CaregiverLink{}).
+		Where("id = ? AND caregiver_email = ? AND status = ?", linkID, models.NormalizeEmail(caregiver.Email), models.CaregiverPending).
+		Updates(map[string]interface{}{"caregiver_id": caregiver.ID, "status": models.CaregiverAccepted})
+	if result.Error != nil {
+		return nil, fmt.Errorf("could not accept invitation: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("could not accept invitation: %w", gorm.ErrRecordNotFound)
+	}
+	var link models.CaregiverLink
+	if err := r.DB.Preload("Patient").First(&link, linkID).Error; err != nil {
+		return nil, fmt.Errorf("could not accept invitation: %w", err)
+	}
+	return &link, nil
+}
+
+func (r *caregiverRepo) DeclineInvitation(linkID uint, email string) error {
+	result := r.DB.Where("id = ? AND caregiver_email = ? AND status = ?", linkID, email, models.CaregiverPending).
+		Delete(&models.CaregiverLink{})
+	if result.Error != nil {
+		return fmt.Errorf("could not decline invitation: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not decline invitation: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// GetPatients returns the accepted links of the caregiver
+func (r *caregiverRepo) GetPatients(caregiverID uint) ([]models.CaregiverLink, error) {
+	var links []models.CaregiverLink
+	err := r.DB.Preload("Patient").Where("caregiver_id = ? AND status = ?", caregiverID, models.CaregiverAccepted).
+		Order("id").Find(&links).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get patients: %v", err)
+	}
+	return links, nil
+}
+
+// GetAcceptedLink returns the link of the caregiver to the patient, with the
+// patient and their time zone
+func (r *caregiverRepo) GetAcceptedLink(patientID uint, caregiverID uint) (*models.CaregiverLink, error) {
+	var link models.CaregiverLink
+	err := r.DB.Preload("Patient").
+		Where("patient_id = ? AND caregiver_id = ? AND status = ?", patientID, caregiverID, models.CaregiverAccepted).
+		First(&link).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get caregiver link: %w", err)
+	}
+	return &link, nil
+}
+
+// LeavePatient removes the link of the caregiver to the patient
+func (r *caregiverRepo) LeavePatient(patientID uint, caregiverID uint) error {
+	result := r.DB.Where("patient_id = ? AND caregiver_id = ?", patientID, caregiverID).Delete(&models.CaregiverLink{})
+	if result.Error != nil {
+		return fmt.Errorf("could not leave patient: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not leave patient: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// GetCaregiversToNotify returns the accepted links of the patients whose
+// caregivers want to know about missed doses
+func (r *caregiverRepo) GetCaregiversToNotify(patientIDs []uint) ([]models.CaregiverLink, error) {
+	var links []models.CaregiverLink
+	err := r.DB.Preload("Patient").Preload("Caregiver").
+		Where("patient_id IN ? AND status = ? AND notify_missed_doses = ?", patientIDs, models.CaregiverAccepted, true).
+		Find(&links).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get caregivers to notify: %v", err)
+	}
+	return links, nil
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -17,6 +18,16 @@ type GormDB struct {
 	DB *gorm.DB
 }
 
+// ErrAlreadyExists is returned when a row would break a unique index
+var ErrAlreadyExists = errors.New("record already exists")
+
+// isUniqueViolation tells whether err is postgres refusing a duplicate of a
+// unique index
+func isUniqueViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+	return errors.As(err, &pgErr) && pgErr.SQLState() == "23505"
+}
+
 func GetDB(c *config.Config) *GormDB {
 	gormDB := &GormDB{}
 	gormDB.Init(c)
@@ -33,7 +44,7 @@ func (g *GormDB) Init(c *config.Config) {
 
 func getPostgresDB(c *config.Config) *gorm.DB {
 	log.Printf("Connecting to postgres: %+v", c)
-	postgresDSN := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d TimeZone=Africa/Lagos",
+	postgresDSN := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d TimeZone=UTC",
 		c.PostgresHost, c.PostgresUser, c.PostgresPassword, c.PostgresDB, c.PostgresPort)
 	newLogger := logger.New(
 		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
@@ -58,10 +69,56 @@ func getPostgresDB(c *config.Config) *gorm.DB {
 }
 
 func migrate(db *gorm.DB) error {
-	err := db.AutoMigrate(&models.User{}, &models.BlackList{}, &models.Medication{}, &models.FCMNotificationToken{}, &models.MedicationHistory{})
+	for _, table := range []string{"medications", "medication_histories"} {
+		if err := migrateSoftDelete(db, table); err != nil {
+			return fmt.Errorf("migrations error: %v", err)
+		}
+	}
+	err := db.AutoMigrate(&models.User{}, &models.BlackList{}, &models.Medication{}, &models.FCMNotificationToken{}, &models.MedicationHistory{}, &models.MedicationPhase{}, &models.MedicationRefill{}, &models.Drug{}, &models.CaregiverLink{}, &models.Profile{}, &models.Session{}, &models.RefreshToken{}, &models.RecoveryCode{}, &models.LoginThrottle{}, &models.APIKey{}, &models.UserIdentity{}, &models.OneTimeToken{})
 	if err != nil {
 		return fmt.Errorf("migrations error: %v", err)
 	}
+	if err := migrateDoseStatus(db); err != nil {
+		return fmt.Errorf("migrations error: %v", err)
+	}
+
+	return nil
+}
+
+// migrateDoseStatus replaces the YES/NO was_medication_missed column of the
+// medication history with the status of the dose
+func migrateDoseStatus(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("medication_histories", "was_medication_missed") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`UPDATE medication_histories SET
+			status = CASE WHEN has_medication_been_taken THEN ? WHEN was_medication_missed = 'YES' THEN ? ELSE ? END,
+			taken_at = CASE WHEN has_medication_been_taken THEN to_timestamp(updated_at) END`,
+			models.DoseOnTime, models.DoseMissed, models.DosePending).Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn("medication_histories", "was_medication_missed")
+	})
+}
 
+// migrateSoftDelete turns the unix time deleted_at column of table into the
+// timestamp GORM soft deletes with. Rows with a zero deleted_at weren't deleted
+func migrateSoftDelete(db *gorm.DB, table string) error {
+	if !db.Migrator().HasTable(table) {
+		return nil
+	}
+	columnTypes, err := db.Migrator().ColumnTypes(table)
+	if err != nil {
+		return err
+	}
+	for _, column := range columnTypes {
+		if column.Name() != "deleted_at" || column.DatabaseTypeName() != "int8" {
+			continue
+		}
+		return db.Exec(fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN deleted_at TYPE timestamptz
+			USING CASE WHEN deleted_at = 0 THEN NULL ELSE to_timestamp(deleted_at) END`, table)).Error
+	}
 	return nil
 }
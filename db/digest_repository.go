@@ -0,0 +1,72 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/digest_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db DigestRepository
+
+type DigestRepository interface {
+	GetUsersDueDigest(now time.Time) ([]models.User, error)
+	UpdateDigestSettings(userID uint, settings *models.DigestSettings) error
+	MarkDigestSent(userID uint, sentAt time.Time) error
+	FindUserByUnsubscribeToken(token string) (*models.User, error)
+}
+
+type digestRepo struct {
+	DB *gorm.DB
+}
+
+func NewDigestRepo(db *GormDB) DigestRepository {
+	return &digestRepo{db.DB}
+}
+
+// GetUsersDueDigest returns the verified users who get their digest at the
+// day and hour now is in their time zone, and didn't get it in the last day
+func (d *digestRepo) GetUsersDueDigest(now time.Time) ([]models.User, error) {
+	var users []models.User
+	localNow := "(?::timestamptz AT TIME ZONE COALESCE(NULLIF(time_zone, ''), 'UTC'))"
+	err := d.DB.Where("is_email_active = ? AND digest_opt_out = ?", true, false).
+		Where("EXTRACT(DOW FROM "+localNow+") = digest_day", now).
+		Where("EXTRACT(HOUR FROM "+localNow+") = digest_hour", now).
+		Where("digest_last_sent_at < ?", now.Add(-24*time.Hour).Unix()).
+		Find(&users).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get users due digest: %v", err)
+	}
+	return users, nil
+}
+
+func (d *digestRepo) UpdateDigestSettings(userID uint, settings *models.DigestSettings) error {
+	err := d.DB.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"digest_opt_out":           settings.OptOut,
+		"digest_day":               settings.Day,
+		"digest_hour":              settings.Hour,
+		"digest_unsubscribe_token": settings.UnsubscribeToken,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("could not update digest settings: %v", err)
+	}
+	return nil
+}
+
+func (d *digestRepo) MarkDigestSent(userID uint, sentAt time.Time) error {
+	err := d.DB.Model(&models.User{}).Where("id = ?", userID).Update("digest_last_sent_at", sentAt.Unix()).Error
+	if err != nil {
+		return fmt.Errorf("could not mark digest sent: %v", err)
+	}
+	return nil
+}
+
+func (d *digestRepo) FindUserByUnsubscribeToken(token string) (*models.User, error) {
+	var user models.User
+	err := d.DB.Where("digest_unsubscribe_token = ?", token).First(&user).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not find user: %w", err)
+	}
+	return &user, nil
+}
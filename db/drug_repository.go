@@ -0,0 +1,67 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//go:generate mockgen -destination=../mocks/drug_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db DrugRepository
+
+type DrugRepository interface {
+	UpsertDrugs(drugs []models.Drug) error
+	SearchDrugs(prefix string, limit int) ([]models.Drug, error)
+	GetDrug(id uint) (*models.Drug, error)
+}
+
+type drugRepo struct {
+	DB *gorm.DB
+}
+
+func NewDrugRepo(db *GormDB) DrugRepository {
+	return &drugRepo{db.DB}
+}
+
+// UpsertDrugs adds the drugs to the catalog, drugs already in it by name are
+// replaced so that importing a file twice doesn't duplicate it
+func (d *drugRepo) UpsertDrugs(drugs []models.Drug) error {
+	err := d.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"synonyms", "strengths", "forms", "class_code", "icon", "updated_at"}),
+	}).CreateInBatches(drugs, 100).Error
+	if err != nil {
+		return fmt.Errorf("could not import drugs: %v", err)
+	}
+	return nil
+}
+
+// SearchDrugs returns the drugs whose name or one of their synonyms starts
+// with prefix, the ones matching by name first
+func (d *drugRepo) SearchDrugs(prefix string, limit int) ([]models.Drug, error) {
+	var drugs []models.Drug
+	pattern := escapeLike(prefix) + "%"
+	err := d.DB.Where("name LIKE ? OR synonyms LIKE ?", pattern, `%"`+pattern).
+		Order(clause.Expr{SQL: "CASE WHEN name LIKE ? THEN 0 ELSE 1 END, name", Vars: []interface{}{pattern}, WithoutParentheses: true}).
+		Limit(limit).Find(&drugs).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not search drugs: %v", err)
+	}
+	return drugs, nil
+}
+
+func (d *drugRepo) GetDrug(id uint) (*models.Drug, error) {
+	var drug models.Drug
+	err := d.DB.Where("id = ?", id).First(&drug).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get drug: %w", err)
+	}
+	return &drug, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
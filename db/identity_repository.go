@@ -0,0 +1,80 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/identity_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db IdentityRepository
+
+type IdentityRepository interface {
+	FindIdentity(provider, subject string) (*models.UserIdentity, error)
+	GetIdentities(userID uint) ([]models.UserIdentity, error)
+	CreateIdentity(identity *models.UserIdentity) error
+	CreateUserWithIdentity(user *models.User, identity *models.UserIdentity) error
+	DeleteIdentity(provider string, userID uint) error
+}
+
+type identityRepo struct {
+	DB *gorm.DB
+}
+
+func NewIdentityRepo(db *GormDB) IdentityRepository {
+	return &identityRepo{db.DB}
+}
+
+// FindIdentity finds the identity with its user
+func (i *identityRepo) FindIdentity(provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	if err := i.DB.Preload("User").Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, fmt.Errorf("could not find identity: %w", err)
+	}
+	if identity.User == nil {
+		return nil, fmt.Errorf("could not find user of identity: %w", gorm.ErrRecordNotFound)
+	}
+	return &identity, nil
+}
+
+func (i *identityRepo) GetIdentities(userID uint) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	if err := i.DB.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		return nil, fmt.Errorf("could not get identities: %v", err)
+	}
+	return identities, nil
+}
+
+func (i *identityRepo) CreateIdentity(identity *models.UserIdentity) error {
+	if err := i.DB.Create(identity).Error; err != nil {
+		return fmt.Errorf("could not create identity: %v", err)
+	}
+	return nil
+}
+
+// CreateUserWithIdentity creates the user signing up with the identity, both
+// or neither
+func (i *identityRepo) CreateUserWithIdentity(user *models.User, identity *models.UserIdentity) error {
+	err := i.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not create user with identity: %v", err)
+	}
+	return nil
+}
+
+func (i *identityRepo) DeleteIdentity(provider string, userID uint) error {
+	result := i.DB.Where("provider = ? AND user_id = ?", provider, userID).Delete(&models.UserIdentity{})
+	if result.Error != nil {
+		return fmt.Errorf("could not delete identity: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not delete identity: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
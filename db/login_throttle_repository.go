@@ -0,0 +1,74 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//go:generate mockgen -destination=../mocks/login_throttle_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db LoginThrottleRepository
+
+type LoginThrottleRepository interface {
+	GetLoginThrottles(keys []string) ([]models.LoginThrottle, error)
+	RecordLoginFailure(key string, now, forgetBefore int64) (*models.LoginThrottle, error)
+	LockLogins(key string, until int64) error
+	ResetLoginThrottle(key string) error
+}
+
+type loginThrottleRepo struct {
+	DB *gorm.DB
+}
+
+func NewLoginThrottleRepo(db *GormDB) LoginThrottleRepository {
+	return &loginThrottleRepo{db.DB}
+}
+
+func (l *loginThrottleRepo) GetLoginThrottles(keys []string) ([]models.LoginThrottle, error) {
+	var throttles []models.LoginThrottle
+	if err := l.DB.Where("key IN ?", keys).Find(&throttles).Error; err != nil {
+		return nil, fmt.Errorf("could not get login throttles: %v", err)
+	}
+	return throttles, nil
+}
+
+// RecordLoginFailure counts a failed login for the key in a single statement,
+// so that concurrent failures all count, and returns the updated count. When
+// the last failure was before forgetBefore, the count starts again from one
+func (l *loginThrottleRepo) RecordLoginFailure(key string, now, forgetBefore int64) (*models.LoginThrottle, error) {
+	throttle := &models.LoginThrottle{Key: key, Failures: 1, LastFailedAt: now}
+	err := l.DB.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"failures":       gorm.Expr("CASE WHEN login_throttles.last_failed_at < ? THEN 1 ELSE login_throttles.failures + 1 END", forgetBefore),
+				"last_failed_at": now,
+				"updated_at":     now,
+			}),
+		},
+		clause.Returning{},
+	).Create(throttle).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not record login failure: %v", err)
+	}
+	return throttle, nil
+}
+
+// LockLogins locks the logins of the key until then, counting the failures
+// from zero again after it
+func (l *loginThrottleRepo) LockLogins(key string, until int64) error {
+	err := l.DB.Model(&models.LoginThrottle{}).Where("key = ?", key).
+		Updates(map[string]interface{}{"locked_until": until, "failures": 0}).Error
+	if err != nil {
+		return fmt.Errorf("could not lock logins: %v", err)
+	}
+	return nil
+}
+
+func (l *loginThrottleRepo) ResetLoginThrottle(key string) error {
+	if err := l.DB.Where("key = ?", key).Delete(&models.LoginThrottle{}).Error; err != nil {
+		return fmt.Errorf("could not reset login throttle: %v", err)
+	}
+	return nil
+}
@@ -2,14 +2,28 @@ package db
 
 import (
 	"fmt"
+	"time"
+
 	"github.com/decagonhq/meddle-api/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MedicationHistoryRepository interface {
 	CreateMedicationHistory(medicationHistory *models.MedicationHistory) (*models.MedicationHistory, error)
-	UpdateMedicationHistory(hasMedicationBeenTaken bool, wasMedicationMissed string, medicationHistoryID uint, userID uint) error
-	GetAllMedicationHistoryByUserID(userID uint) ([]models.MedicationHistory, error)
+	GetMedicationHistory(medicationHistoryID uint, userID uint, profileID uint) (*models.MedicationHistory, error)
+	UpdateMedicationHistory(medicationHistory *models.MedicationHistory) error
+	MarkMissedDoses(now time.Time, defaultGrace time.Duration) ([]models.MedicationHistory, error)
+	GetAllMedicationHistoryByUserID(userID uint, page *models.Page) ([]models.MedicationHistory, error)
+	CountMedicationHistoryBetween(medicationID uint, from, to time.Time) (int64, error)
+	DeleteMedicationHistory(medicationHistoryID uint, userID uint, profileID uint) error
+	RestoreMedicationHistory(medicationHistoryID uint, userID uint, profileID uint) error
+	PurgeDeletedMedicationHistory(before time.Time) (int64, error)
+	GetAdherence(userID uint, adherenceRange *models.AdherenceRange) (*models.AdherenceStats, error)
+	GetAdherenceByMedication(userID uint, adherenceRange *models.AdherenceRange) ([]models.MedicationAdherence, error)
+	GetAdherenceByPeriod(userID uint, adherenceRange *models.AdherenceRange) ([]models.PeriodAdherence, error)
+	GetAdherenceStreaks(userID uint, adherenceRange *models.AdherenceRange) (*models.AdherenceStreaks, error)
+	GetMostMissedTimeSlots(userID uint, adherenceRange *models.AdherenceRange, limit int) ([]models.TimeSlotMisses, error)
 }
 
 type medicationHistoryRepo struct {
@@ -21,28 +35,234 @@ func NewMedicationHistoryRepo(db *GormDB) MedicationHistoryRepository {
 }
 
 func (m *medicationHistoryRepo) CreateMedicationHistory(medicationHistory *models.MedicationHistory) (*models.MedicationHistory, error) {
-	err := m.DB.Create(medicationHistory).Error
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(medicationHistory).Error; err != nil {
+			return err
+		}
+		if !medicationHistory.HasMedicationBeenTaken {
+			return nil
+		}
+		return takeFromStock(tx, medicationHistory.MedicationID, medicationHistory.EffectiveDose().Amount)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("could not create medication: %v", err)
 	}
 	return medicationHistory, nil
 }
 
-func (m *medicationHistoryRepo) UpdateMedicationHistory(hasMedicationBeenTaken bool, wasMedicationMissed string, medicationHistoryID uint, userID uint) error {
-	err := m.DB.Model(&models.MedicationHistory{}).Select("has_medication_been_taken", "was_medication_missed").
-		Where("user_id = ? AND id = ?", userID, medicationHistoryID).
-		Updates(models.MedicationHistory{HasMedicationBeenTaken: hasMedicationBeenTaken, WasMedicationMissed: wasMedicationMissed}).Error
+func (m *medicationHistoryRepo) GetMedicationHistory(medicationHistoryID uint, userID uint, profileID uint) (*models.MedicationHistory, error) {
+	var medicationHistory models.MedicationHistory
+	err := m.DB.Scopes(withUserTimeZone("medication_histories")).
+		Where("id = ? AND user_id = ? AND profile_id = ?", medicationHistoryID, userID, profileID).First(&medicationHistory).Error
 	if err != nil {
-		return fmt.Errorf("could not update medication history: %v", err)
+		return nil, fmt.Errorf("could not get medication history: %w", err)
+	}
+	return &medicationHistory, nil
+}
+
+// UpdateMedicationHistory saves what happened to a dose, taking the dose from
+// the stock of the medication or putting it back when whether it was taken
+// changes
+func (m *medicationHistoryRepo) UpdateMedicationHistory(medicationHistory *models.MedicationHistory) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var previous models.MedicationHistory
+		err := tx.Where("user_id = ? AND profile_id = ? AND id = ?", medicationHistory.UserID, medicationHistory.ProfileID, medicationHistory.ID).First(&previous).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&previous).Select("has_medication_been_taken", "status", "taken_at").
+			Updates(medicationHistory).Error
+		if err != nil || previous.HasMedicationBeenTaken == medicationHistory.HasMedicationBeenTaken {
+			return err
+		}
+		amount := previous.EffectiveDose().Amount
+		if !medicationHistory.HasMedicationBeenTaken {
+			amount = -amount
+		}
+		return takeFromStock(tx, previous.MedicationID, amount)
+	})
+	if err != nil {
+		return fmt.Errorf("could not update medication history: %w", err)
 	}
 	return nil
 }
 
-func (m *medicationHistoryRepo) GetAllMedicationHistoryByUserID(userID uint) ([]models.MedicationHistory, error) {
+// MarkMissedDoses marks the pending doses whose grace window ended as missed
+// and returns them with the names of their dependents. Doses recorded before
+// grace windows get the default one
+func (m *medicationHistoryRepo) MarkMissedDoses(now time.Time, defaultGrace time.Duration) ([]models.MedicationHistory, error) {
+	var missed []models.MedicationHistory
+	returning := clause.Returning{Columns: []clause.Column{
+		{Name: "medication_histories.*", Raw: true},
+		{Name: profileNameColumn("medication_histories"), Raw: true},
+	}}
+	err := m.DB.Model(&missed).Clauses(returning).
+		Where("status = ?", models.DosePending).
+		Where("COALESCE(grace_ends_at, medication_time + make_interval(secs => ?)) < ?", defaultGrace.Seconds(), now).
+		Updates(map[string]interface{}{"status": models.DoseMissed}).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not mark missed doses: %v", err)
+	}
+	return missed, nil
+}
+
+func (m *medicationHistoryRepo) GetAllMedicationHistoryByUserID(userID uint, page *models.Page) ([]models.MedicationHistory, error) {
 	var medicationHistories []models.MedicationHistory
-	err := m.DB.Order("medication_time desc").Where("user_id = ?", userID).Find(&medicationHistories).Error
+	err := m.DB.Scopes(withUserTimeZone("medication_histories"), withHistoryStatus(page.Status), paginate("medication_histories", page)).
+		Where("user_id = ? AND profile_id = ?", userID, page.ProfileID).Find(&medicationHistories).Error
 	if err != nil {
 		return nil, fmt.Errorf("could not get medication history: %v", err)
 	}
 	return medicationHistories, nil
 }
+
+func (m *medicationHistoryRepo) CountMedicationHistoryBetween(medicationID uint, from, to time.Time) (int64, error) {
+	var count int64
+	err := m.DB.Model(&models.MedicationHistory{}).
+		Where("medication_id = ? AND medication_time >= ? AND medication_time < ?", medicationID, from, to).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("could not count medication history: %v", err)
+	}
+	return count, nil
+}
+
+func (m *medicationHistoryRepo) DeleteMedicationHistory(medicationHistoryID uint, userID uint, profileID uint) error {
+	result := m.DB.Where("id = ? AND user_id = ? AND profile_id = ?", medicationHistoryID, userID, profileID).Delete(&models.MedicationHistory{})
+	if result.Error != nil {
+		return fmt.Errorf("could not delete medication history: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not delete medication history: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (m *medicationHistoryRepo) RestoreMedicationHistory(medicationHistoryID uint, userID uint, profileID uint) error {
+	result := m.DB.Unscoped().Model(&models.MedicationHistory{}).
+		Where("id = ? AND user_id = ? AND profile_id = ? AND deleted_at IS NOT NULL", medicationHistoryID, userID, profileID).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("could not restore medication history: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not restore medication history: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// PurgeDeletedMedicationHistory permanently deletes the history deleted before
+// the given time
+func (m *medicationHistoryRepo) PurgeDeletedMedicationHistory(before time.Time) (int64, error) {
+	result := m.DB.Unscoped().Where("deleted_at < ?", before).Delete(&models.MedicationHistory{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("could not purge deleted medication history: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// localDoseTime is the time of a dose in the time zone of its user
+const localDoseTime = "(h.medication_time AT TIME ZONE COALESCE(NULLIF(u.time_zone, ''), 'UTC'))"
+
+// adherenceStatsColumns selects the models.AdherenceStats of the doses
+const adherenceStatsColumns = `COUNT(*) FILTER (WHERE h.status IN ('on_time', 'late')) AS taken,
+	COUNT(*) FILTER (WHERE h.status = 'on_time') AS on_time,
+	COUNT(*) FILTER (WHERE h.status = 'late') AS late,
+	COUNT(*) FILTER (WHERE h.status = 'missed') AS missed,
+	COUNT(*) FILTER (WHERE h.status = 'skipped') AS skipped,
+	COALESCE(ROUND(100.0 * COUNT(*) FILTER (WHERE h.status IN ('on_time', 'late'))
+		/ NULLIF(COUNT(*) FILTER (WHERE h.status <> 'skipped'), 0), 1), 0)::float8 AS adherence,
+	COALESCE(ROUND((AVG(GREATEST(EXTRACT(EPOCH FROM h.taken_at - h.medication_time), 0) / 60)
+		FILTER (WHERE h.status IN ('on_time', 'late')))::numeric, 1), 0)::float8 AS average_lateness_minutes`
+
+// adherenceDoses selects, as h, the doses of the user, or of the dependent the
+// range selects, due in the range that aren't pending anymore, joined to the
+// user as u
+func (m *medicationHistoryRepo) adherenceDoses(userID uint, adherenceRange *models.AdherenceRange) *gorm.DB {
+	query := m.DB.Table("medication_histories AS h").
+		Joins("JOIN users u ON u.id = h.user_id").
+		Where("h.user_id = ? AND h.profile_id = ? AND h.deleted_at IS NULL", userID, adherenceRange.ProfileID).
+		Where("h.medication_time >= ? AND h.medication_time < ?", adherenceRange.From, adherenceRange.To).
+		Where("h.status IN ?", []string{string(models.DoseOnTime), string(models.DoseLate), string(models.DoseMissed), string(models.DoseSkipped)})
+	if adherenceRange.MedicationID != 0 {
+		query = query.Where("h.medication_id = ?", adherenceRange.MedicationID)
+	}
+	return query
+}
+
+func (m *medicationHistoryRepo) GetAdherence(userID uint, adherenceRange *models.AdherenceRange) (*models.AdherenceStats, error) {
+	var stats models.AdherenceStats
+	err := m.adherenceDoses(userID, adherenceRange).Select(adherenceStatsColumns).Scan(&stats).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get adherence: %v", err)
+	}
+	return &stats, nil
+}
+
+func (m *medicationHistoryRepo) GetAdherenceByMedication(userID uint, adherenceRange *models.AdherenceRange) ([]models.MedicationAdherence, error) {
+	var adherence []models.MedicationAdherence
+	err := m.adherenceDoses(userID, adherenceRange).
+		Select("h.medication_id, MAX(h.medication_name) AS medication_name, " + adherenceStatsColumns).
+		Group("h.medication_id").Order("medication_name, h.medication_id").
+		Scan(&adherence).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get adherence by medication: %v", err)
+	}
+	return adherence, nil
+}
+
+// GetAdherenceByPeriod breaks the adherence down by the day, week or month of
+// the range
+func (m *medicationHistoryRepo) GetAdherenceByPeriod(userID uint, adherenceRange *models.AdherenceRange) ([]models.PeriodAdherence, error) {
+	var adherence []models.PeriodAdherence
+	err := m.adherenceDoses(userID, adherenceRange).
+		Select("date_trunc(?, "+localDoseTime+") AS start, "+adherenceStatsColumns, adherenceRange.Period).
+		Group("start").Order("start").
+		Scan(&adherence).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get adherence by period: %v", err)
+	}
+	return adherence, nil
+}
+
+// GetAdherenceStreaks finds the runs of days without a missed dose. The
+// current streak is the one that runs to the last day with doses
+func (m *medicationHistoryRepo) GetAdherenceStreaks(userID uint, adherenceRange *models.AdherenceRange) (*models.AdherenceStreaks, error) {
+	days := m.adherenceDoses(userID, adherenceRange).
+		Where("h.status <> ?", models.DoseSkipped).
+		Select(localDoseTime + "::date AS day, bool_and(h.status <> 'missed') AS kept").
+		Group("day")
+	var streaks models.AdherenceStreaks
+	err := m.DB.Raw(`WITH days AS (?),
+runs AS (
+	SELECT day, kept, ROW_NUMBER() OVER (ORDER BY day) - ROW_NUMBER() OVER (PARTITION BY kept ORDER BY day) AS run
+	FROM days
+),
+streaks AS (
+	SELECT MAX(day) AS last_day, COUNT(*) AS length FROM runs WHERE kept GROUP BY run
+)
+SELECT COALESCE(MAX(length), 0) AS longest,
+	COALESCE(MAX(length) FILTER (WHERE last_day = (SELECT MAX(day) FROM days)), 0) AS "current"
+FROM streaks`, days).Scan(&streaks).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get adherence streaks: %v", err)
+	}
+	return &streaks, nil
+}
+
+// GetMostMissedTimeSlots counts the missed doses by the hour of the day they
+// were due, most missed first
+func (m *medicationHistoryRepo) GetMostMissedTimeSlots(userID uint, adherenceRange *models.AdherenceRange, limit int) ([]models.TimeSlotMisses, error) {
+	var slots []models.TimeSlotMisses
+	err := m.adherenceDoses(userID, adherenceRange).
+		Select("EXTRACT(HOUR FROM " + localDoseTime + ")::int AS hour, " +
+			"COUNT(*) FILTER (WHERE h.status = 'missed') AS missed, " +
+			"COUNT(*) FILTER (WHERE h.status <> 'skipped') AS due").
+		Group("hour").Having("COUNT(*) FILTER (WHERE h.status = 'missed') > 0").
+		Order("missed DESC, hour").Limit(limit).
+		Scan(&slots).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get most missed time slots: %v", err)
+	}
+	return slots, nil
+}
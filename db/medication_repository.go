@@ -12,14 +12,21 @@ import (
 
 type MedicationRepository interface {
 	CreateMedication(medication *models.Medication) (*models.Medication, error)
-	GetNextMedications(userID uint) ([]models.Medication, error)
+	GetNextMedications(userID uint, page *models.Page) ([]models.Medication, error)
 	UpdateMedicationDone(medication *models.Medication) error
 	GetAllNextMedicationsToUpdate() ([]models.Medication, error)
-	GetMedicationDetail(id uint, userId uint) (*models.Medication, error)
+	GetMedicationDetail(id uint, userId uint, profileID uint) (*models.Medication, error)
 	GetAllMedications(userID uint) ([]models.Medication, error)
+	ListMedications(userID uint, page *models.Page) ([]models.Medication, error)
 	UpdateNextMedicationTime(medication *models.Medication, nextDosageTime time.Time) error
-	UpdateMedication(medication *models.Medication, medicationID uint, userID uint) error
-	FindMedication(medicationName, by, purpose string, duration int, dosage int) (*[]models.Medication, error)
+	UpdateMedication(medication *models.Medication, medicationID uint, userID uint, profileID uint) error
+	SearchMedications(filter *models.MedicationFilter) ([]models.Medication, int64, error)
+	RecordRefill(refill *models.MedicationRefill, profileID uint) (*models.Medication, error)
+	UpdateMedicationStatus(medication *models.Medication) error
+	DeleteMedication(medicationID uint, userID uint, profileID uint) error
+	RestoreMedication(medicationID uint, userID uint, profileID uint) (*models.Medication, error)
+	GetArchivedMedications(userID uint, page *models.Page) ([]models.Medication, error)
+	PurgeDeletedMedications(before time.Time) (int64, error)
 }
 
 type medicationRepo struct {
@@ -38,9 +45,9 @@ func (m *medicationRepo) CreateMedication(medication *models.Medication) (*model
 	return medication, nil
 }
 
-func (m *medicationRepo) GetNextMedications(userID uint) ([]models.Medication, error) {
+func (m *medicationRepo) GetNextMedications(userID uint, page *models.Page) ([]models.Medication, error) {
 	var medications []models.Medication
-	err := m.DB.Where("user_id = ? AND next_dosage_time > ?", userID, time.Now().UTC()).Order("next_dosage_time ASC").Find(&medications).Error
+	err := m.DB.Scopes(withUserTimeZone("medications"), withPhases, paginate("medications", page)).Where("user_id = ? AND profile_id = ? AND next_dosage_time > ? AND status = ?", userID, page.ProfileID, time.Now().UTC(), models.MedicationActive).Find(&medications).Error
 	if err != nil {
 		return nil, fmt.Errorf("could not get next medication: %v", err)
 	}
@@ -50,9 +57,9 @@ func (m *medicationRepo) GetNextMedications(userID uint) ([]models.Medication, e
 func (m *medicationRepo) GetAllNextMedicationsToUpdate() ([]models.Medication, error) {
 	var medications []models.Medication
 
-	err := m.DB. //Where("date_trunc('hour', next_dosage_time) = date_trunc('hour', now())").
-			Where("date_trunc('minute', next_dosage_time) = date_trunc('minute', now())").
-			Where("is_medication_done = false").Find(&medications).Error
+	err := m.DB.Scopes(withUserTimeZone("medications"), withPhases).
+		Where("date_trunc('minute', next_dosage_time) = date_trunc('minute', now())").
+		Where("is_medication_done = false AND status = ?", models.MedicationActive).Find(&medications).Error
 	if err != nil {
 		return nil, fmt.Errorf("could not get next medication: %v", err)
 	}
@@ -60,7 +67,7 @@ func (m *medicationRepo) GetAllNextMedicationsToUpdate() ([]models.Medication, e
 }
 
 func (m *medicationRepo) UpdateMedicationDone(medication *models.Medication) error {
-	err := m.DB.Model(&medication).Where("user_id = ?", medication.UserID).Update("is_medication_done", true).Error
+	err := m.DB.Model(&medication).Where("user_id = ?", medication.UserID).Updates(map[string]interface{}{"is_medication_done": true, "status": models.MedicationCompleted}).Error
 	if err != nil {
 		return fmt.Errorf("could not update medication: %v", err)
 	}
@@ -75,39 +82,240 @@ func (m *medicationRepo) UpdateNextMedicationTime(medication *models.Medication,
 	return nil
 }
 
-func (m *medicationRepo) GetMedicationDetail(id uint, userId uint) (*models.Medication, error) {
+// GetMedicationDetail returns the medication of the user, or of the dependent
+// with profileID
+func (m *medicationRepo) GetMedicationDetail(id uint, userId uint, profileID uint) (*models.Medication, error) {
 	var medication models.Medication
-	err := m.DB.Where("id = ? AND user_id = ?", id, userId).First(&medication).Error
+	err := m.DB.Scopes(withUserTimeZone("medications"), withPhases).Where("id = ? AND user_id = ? AND profile_id = ?", id, userId, profileID).First(&medication).Error
 	if err != nil {
-		return nil, fmt.Errorf("could not get medication: %v", err)
+		return nil, fmt.Errorf("could not get medication: %w", err)
 	}
 	return &medication, nil
 }
 
 func (m *medicationRepo) GetAllMedications(userID uint) ([]models.Medication, error) {
 	var medications []models.Medication
-	err := m.DB.Where("user_id = ?", userID).Find(&medications).Error
+	err := m.DB.Scopes(withUserTimeZone("medications"), withPhases).Where("user_id = ?", userID).Find(&medications).Error
 	if err != nil {
 		return nil, fmt.Errorf("could not get medications: %v", err)
 	}
 	return medications, nil
 }
 
-func (m *medicationRepo) UpdateMedication(medication *models.Medication, medicationID uint, userID uint) error {
+// ListMedications returns a page of the medications of the user, or of the
+// dependent the page selects
+func (m *medicationRepo) ListMedications(userID uint, page *models.Page) ([]models.Medication, error) {
+	var medications []models.Medication
+	err := m.DB.Scopes(withUserTimeZone("medications"), withPhases, withMedicationStatus(page.Status), paginate("medications", page)).
+		Where("user_id = ? AND profile_id = ?", userID, page.ProfileID).Find(&medications).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get medications: %v", err)
+	}
+	return medications, nil
+}
+
+func (m *medicationRepo) UpdateMedication(medication *models.Medication, medicationID uint, userID uint, profileID uint) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Medication{}).Omit("Phases").
+			Where("user_id = ? AND profile_id = ? AND id = ?", userID, profileID, medicationID).
+			Updates(medication)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if medication.StockQuantity != nil {
+			// a new stock count gets its own low stock reminder
+			err := tx.Model(&models.Medication{}).Where("id = ?", medicationID).Update("low_stock_notified_at", 0).Error
+			if err != nil {
+				return err
+			}
+		}
+		if medication.Phases == nil {
+			return nil
+		}
+		// a new set of phases replaces the regimen of the medication
+		if err := tx.Where("medication_id = ?", medicationID).Delete(&models.MedicationPhase{}).Error; err != nil {
+			return err
+		}
+		for i := range medication.Phases {
+			medication.Phases[i].MedicationID = medicationID
+		}
+		return tx.Create(&medication.Phases).Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not update medication: %v", err)
+	}
+	return nil
+}
+
+// SearchMedications returns a page of the medications of the user matching
+// every filter set and how many match in all pages
+func (m *medicationRepo) SearchMedications(filter *models.MedicationFilter) ([]models.Medication, int64, error) {
+	query := m.DB.Model(&models.Medication{}).Where("user_id = ? AND profile_id = ?", filter.UserID, filter.Page.ProfileID)
+	if filter.Name != "" {
+		query = query.Where("name ILIKE ?", "%"+escapeLike(filter.Name)+"%")
+	}
+	if filter.MedicationPrescribedBy != "" {
+		query = query.Where("medication_prescribed_by ILIKE ?", "%"+escapeLike(filter.MedicationPrescribedBy)+"%")
+	}
+	if filter.PurposeOfMedication != "" {
+		query = query.Where("purpose_of_medication ILIKE ?", "%"+escapeLike(filter.PurposeOfMedication)+"%")
+	}
+	if filter.Dosage != 0 {
+		query = query.Where("dosage = ?", filter.Dosage)
+	}
+	if filter.Duration != 0 {
+		query = query.Where("duration = ?", filter.Duration)
+	}
+	query = query.Scopes(withMedicationStatus(filter.Page.Status))
+	if !filter.StartFrom.IsZero() {
+		query = query.Where("medication_start_date >= ?", filter.StartFrom)
+	}
+	if !filter.StartTo.IsZero() {
+		query = query.Where("medication_start_date <= ?", filter.StartTo)
+	}
+	if !filter.StopFrom.IsZero() {
+		query = query.Where("medication_stop_date >= ?", filter.StopFrom)
+	}
+	if !filter.StopTo.IsZero() {
+		query = query.Where("medication_stop_date <= ?", filter.StopTo)
+	}
+
+	// the count and the page share the filters
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("could not count medications: %v", err)
+	}
+	var medications []models.Medication
+	err := query.Scopes(withUserTimeZone("medications"), withPhases, paginate("medications", filter.Page)).Find(&medications).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not search medications: %v", err)
+	}
+	return medications, total, nil
+}
+
+// UpdateMedicationStatus saves a change of status of the medication with the
+// dates that go with it
+func (m *medicationRepo) UpdateMedicationStatus(medication *models.Medication) error {
 	err := m.DB.Model(&models.Medication{}).
-		Where("user_id = ? AND id = ?", userID, medicationID).
+		Select("status", "paused_at", "discontinued_at", "discontinued_reason", "is_medication_done", "medication_stop_date", "next_dosage_time").
+		Where("id = ? AND user_id = ? AND profile_id = ?", medication.ID, medication.UserID, medication.ProfileID).
 		Updates(medication).Error
 	if err != nil {
-		return fmt.Errorf("could not update medication: %v", err)
+		return fmt.Errorf("could not update medication status: %v", err)
 	}
 	return nil
 }
 
-func (m *medicationRepo) FindMedication(medicationName, by, purpose string, duration int, dosage int) (*[]models.Medication, error) {
-	var medications *[]models.Medication
-	err := m.DB.Where("name LIKE ?", "%"+medicationName+"%").Or("dosage = ?", dosage).Or("duration = ?", duration).Or("medication_prescribed_by LIKE ?", "%"+by+"%").Or("purpose_of_medication LIKE ?", "%"+purpose+"%").Find(&medications).Error
+// RecordRefill adds the refill to the stock of the medication and returns the
+// medication with its new stock
+func (m *medicationRepo) RecordRefill(refill *models.MedicationRefill, profileID uint) (*models.Medication, error) {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Medication{}).
+			Where("id = ? AND user_id = ? AND profile_id = ?", refill.MedicationID, refill.UserID, profileID).
+			Updates(map[string]interface{}{
+				"stock_quantity":        gorm.Expr("COALESCE(stock_quantity, 0) + ?", refill.Quantity),
+				"low_stock_notified_at": 0,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(refill).Error
+	})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("could not record refill: %w", err)
+	}
+	return m.GetMedicationDetail(refill.MedicationID, refill.UserID, profileID)
+}
+
+// takeFromStock removes amount from the stock of a medication tracking its
+// stock, a negative amount puts it back. The stock never goes below zero
+func takeFromStock(tx *gorm.DB, medicationID uint, amount float64) error {
+	return tx.Model(&models.Medication{}).
+		Where("id = ? AND stock_quantity IS NOT NULL", medicationID).
+		Update("stock_quantity", gorm.Expr("GREATEST(stock_quantity - ?, 0)", amount)).Error
+}
+
+// DeleteMedication soft deletes the medication with its history, moving them
+// to the archive
+func (m *medicationRepo) DeleteMedication(medicationID uint, userID uint, profileID uint) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var medication models.Medication
+		if err := tx.Where("id = ? AND user_id = ? AND profile_id = ?", medicationID, userID, profileID).First(&medication).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&medication).Error; err != nil {
+			return err
+		}
+		return tx.Where("medication_id = ?", medicationID).Delete(&models.MedicationHistory{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not delete medication: %w", err)
+	}
+	return nil
+}
+
+// RestoreMedication brings a medication back from the archive with the history
+// deleted along with it
+func (m *medicationRepo) RestoreMedication(medicationID uint, userID uint, profileID uint) (*models.Medication, error) {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var medication models.Medication
+		err := tx.Unscoped().Where("id = ? AND user_id = ? AND profile_id = ? AND deleted_at IS NOT NULL", medicationID, userID, profileID).First(&medication).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(&models.MedicationHistory{}).
+			Where("medication_id = ? AND deleted_at >= ?", medicationID, medication.DeletedAt.Time).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&medication).Update("deleted_at", nil).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not restore medication: %w", err)
+	}
+	return m.GetMedicationDetail(medicationID, userID, profileID)
+}
+
+func (m *medicationRepo) GetArchivedMedications(userID uint, page *models.Page) ([]models.Medication, error) {
+	var medications []models.Medication
+	err := m.DB.Unscoped().Scopes(withUserTimeZone("medications"), withPhases, paginate("medications", page)).
+		Where("user_id = ? AND profile_id = ? AND deleted_at IS NOT NULL", userID, page.ProfileID).Find(&medications).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get archived medications: %v", err)
 	}
 	return medications, nil
 }
+
+// PurgeDeletedMedications permanently deletes the medications deleted before
+// the given time with everything recorded about them
+func (m *medicationRepo) PurgeDeletedMedications(before time.Time) (int64, error) {
+	var purged int64
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		err := tx.Unscoped().Model(&models.Medication{}).Where("deleted_at < ?", before).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		if err := tx.Unscoped().Where("medication_id IN ?", ids).Delete(&models.MedicationHistory{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("medication_id IN ?", ids).Delete(&models.MedicationPhase{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("medication_id IN ?", ids).Delete(&models.MedicationRefill{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Medication{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not purge deleted medications: %v", err)
+	}
+	return purged, nil
+}
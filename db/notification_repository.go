@@ -2,6 +2,8 @@ package db
 
 import (
 	"fmt"
+	"time"
+
 	"github.com/decagonhq/meddle-api/models"
 	"gorm.io/gorm"
 )
@@ -12,6 +14,9 @@ type NotificationRepository interface {
 	AddNotificationToken(args *models.AddNotificationTokenArgs) (*models.FCMNotificationToken, error)
 	GetAllNextMedicationsToSendNotifications() ([]models.Medication, error)
 	GetSingleUserDeviceTokens(userId int) ([]string, error)
+	GetStockTrackedMedicationsToNotify() ([]models.Medication, error)
+	GetUserEmail(userId uint) (string, error)
+	MarkLowStockNotified(medicationID uint) error
 }
 
 type notificationRepo struct {
@@ -38,7 +43,9 @@ func (db *notificationRepo) AddNotificationToken(args *models.AddNotificationTok
 func (db *notificationRepo) GetAllNextMedicationsToSendNotifications() ([]models.Medication, error) {
 	var medications []models.Medication
 
-	err := db.DB.Where("date_trunc('hour', next_dosage_time) = date_trunc('hour', now())").Where("is_medication_done = false").Find(&medications).Error
+	err := db.DB.Scopes(withProfileName("medications"), withPhases).Where("date_trunc('hour', next_dosage_time) = date_trunc('hour', now())").Where("is_medication_done = false AND status = ?", models.MedicationActive).
+		Where("medications.user_id NOT IN (?)", db.DB.Model(&models.User{}).Select("id").Where("notify_dose_reminders_off = true")).
+		Find(&medications).Error
 	if err != nil {
 		return nil, fmt.Errorf("could not get next medication: %v", err)
 	}
@@ -56,3 +63,37 @@ func (db *notificationRepo) GetSingleUserDeviceTokens(userId int) ([]string, err
 
 	return tokens, nil
 }
+
+// GetStockTrackedMedicationsToNotify returns the running medications tracking
+// their stock that haven't had a low stock reminder since their last refill,
+// of the users who get refill reminders
+func (db *notificationRepo) GetStockTrackedMedicationsToNotify() ([]models.Medication, error) {
+	var medications []models.Medication
+
+	err := db.DB.Scopes(withProfileName("medications"), withPhases).
+		Where("stock_quantity IS NOT NULL AND low_stock_notified_at = 0").
+		Where("is_medication_done = false AND status = ?", models.MedicationActive).
+		Where("medications.user_id NOT IN (?)", db.DB.Model(&models.User{}).Select("id").Where("notify_refill_reminders_off = true")).
+		Find(&medications).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get stock tracked medications: %v", err)
+	}
+	return medications, nil
+}
+
+func (db *notificationRepo) GetUserEmail(userId uint) (string, error) {
+	var email string
+	err := db.DB.Model(&models.User{}).Where("id = ?", userId).Pluck("email", &email).Error
+	if err != nil {
+		return "", fmt.Errorf("could not get user email: %v", err)
+	}
+	return email, nil
+}
+
+func (db *notificationRepo) MarkLowStockNotified(medicationID uint) error {
+	err := db.DB.Model(&models.Medication{}).Where("id = ?", medicationID).Update("low_stock_notified_at", time.Now().Unix()).Error
+	if err != nil {
+		return fmt.Errorf("could not mark low stock reminder: %v", err)
+	}
+	return nil
+}
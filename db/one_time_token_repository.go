@@ -0,0 +1,84 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/one_time_token_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db OneTimeTokenRepository
+
+type OneTimeTokenRepository interface {
+	CreateOneTimeToken(token *models.OneTimeToken) error
+	FindOneTimeToken(tokenHash string, purpose models.TokenPurpose, now int64) (*models.OneTimeToken, error)
+	ConsumeOneTimeToken(tokenHash string, purpose models.TokenPurpose, now int64) (*models.OneTimeToken, error)
+	DeleteOneTimeTokens(userID uint, purpose models.TokenPurpose, data string) error
+}
+
+type oneTimeTokenRepo struct {
+	DB *gorm.DB
+}
+
+func NewOneTimeTokenRepo(db *GormDB) OneTimeTokenRepository {
+	return &oneTimeTokenRepo{db.DB}
+}
+
+func (o *oneTimeTokenRepo) CreateOneTimeToken(token *models.OneTimeToken) error {
+	if err := o.DB.Create(token).Error; err != nil {
+		return fmt.Errorf("could not create token: %v", err)
+	}
+	return nil
+}
+
+// FindOneTimeToken finds the unused, unexpired token of the purpose with its
+// user, without using it
+func (o *oneTimeTokenRepo) FindOneTimeToken(tokenHash string, purpose models.TokenPurpose, now int64) (*models.OneTimeToken, error) {
+	var token models.OneTimeToken
+	err := o.DB.Preload("User").
+		Where("token_hash = ? AND purpose = ? AND used_at = 0 AND expires_at > ?", tokenHash, purpose, now).
+		First(&token).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not find token: %w", err)
+	}
+	if token.User == nil {
+		return nil, fmt.Errorf("could not find user of token: %w", gorm.ErrRecordNotFound)
+	}
+	return &token, nil
+}
+
+// ConsumeOneTimeToken marks the unused, unexpired token of the purpose used
+// and returns it with its user. Of two requests using the same token, only
+// one marks it
+func (o *oneTimeTokenRepo) ConsumeOneTimeToken(tokenHash string, purpose models.TokenPurpose, now int64) (*models.OneTimeToken, error) {
+	var token models.OneTimeToken
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.OneTimeToken{}).
+			Where("token_hash = ? AND purpose = ? AND used_at = 0 AND expires_at > ?", tokenHash, purpose, now).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Preload("User").Where("token_hash = ?", tokenHash).First(&token).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not consume token: %w", err)
+	}
+	if token.User == nil {
+		return nil, fmt.Errorf("could not find user of token: %w", gorm.ErrRecordNotFound)
+	}
+	return &token, nil
+}
+
+// DeleteOneTimeTokens deletes the tokens issued to the user for the purpose
+// and data, used or not
+func (o *oneTimeTokenRepo) DeleteOneTimeTokens(userID uint, purpose models.TokenPurpose, data string) error {
+	err := o.DB.Where("user_id = ? AND purpose = ? AND data = ?", userID, purpose, data).Delete(&models.OneTimeToken{}).Error
+	if err != nil {
+		return fmt.Errorf("could not delete tokens: %v", err)
+	}
+	return nil
+}
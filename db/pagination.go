@@ -0,0 +1,71 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// paginate applies the date range, cursor, order and limit of a page to a
+// query of table. It fetches one row more than the limit to tell whether
+// there's a next page
+func paginate(table string, page *models.Page) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !page.From.IsZero() {
+			db = db.Where(fmt.Sprintf("%s.%s >= ?", table, page.DateColumn), page.From)
+		}
+		if !page.To.IsZero() {
+			db = db.Where(fmt.Sprintf("%s.%s <= ?", table, page.DateColumn), page.To)
+		}
+		if page.After != nil {
+			value, err := page.CursorValue()
+			if err != nil {
+				_ = db.AddError(fmt.Errorf("invalid cursor: %v", err))
+				return db
+			}
+			operator := ">"
+			if page.SortDescending {
+				operator = "<"
+			}
+			db = db.Where(fmt.Sprintf("(%[1]s.%[2]s, %[1]s.id) %[3]s (?, ?)", table, page.SortColumn, operator), value, page.After.ID)
+		}
+		return db.Order(clause.OrderByColumn{Column: clause.Column{Table: table, Name: page.SortColumn}, Desc: page.SortDescending}).
+			Order(clause.OrderByColumn{Column: clause.Column{Table: table, Name: "id"}, Desc: page.SortDescending}).
+			Limit(page.Limit + 1)
+	}
+}
+
+// withMedicationStatus filters medications by the status filter of a page
+func withMedicationStatus(status string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		switch status {
+		case "":
+			return db
+		case "done":
+			return db.Where("is_medication_done = true OR status IN ?", []models.MedicationStatus{models.MedicationCompleted, models.MedicationDiscontinued})
+		case string(models.MedicationActive):
+			return db.Where("is_medication_done = false AND status = ?", models.MedicationActive)
+		case string(models.MedicationCompleted):
+			// medications that ended before they had a status are completed
+			return db.Where("status = ? OR (is_medication_done = true AND status = ?)", models.MedicationCompleted, models.MedicationActive)
+		default:
+			return db.Where("status = ?", status)
+		}
+	}
+}
+
+// withHistoryStatus filters medication history by the status filter of a page
+func withHistoryStatus(status string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		switch status {
+		case "":
+			return db
+		case "taken":
+			return db.Where("status IN ?", []models.DoseStatus{models.DoseOnTime, models.DoseLate})
+		default:
+			return db.Where("status = ?", status)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/profile_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db ProfileRepository
+
+type ProfileRepository interface {
+	CreateProfile(profile *models.Profile) (*models.Profile, error)
+	GetProfiles(userID uint) ([]models.Profile, error)
+	GetProfile(profileID uint, userID uint) (*models.Profile, error)
+	UpdateProfile(profile *models.Profile) error
+	DeleteProfile(profileID uint, userID uint) error
+	CountProfileMedications(profileID uint, userID uint) (int64, error)
+}
+
+type profileRepo struct {
+	DB *gorm.DB
+}
+
+func NewProfileRepo(db *GormDB) ProfileRepository {
+	return &profileRepo{db.DB}
+}
+
+func (r *profileRepo) CreateProfile(profile *models.Profile) (*models.Profile, error) {
+	if err := r.DB.Create(profile).Error; err != nil {
+		return nil, fmt.Errorf("could not create profile: %v", err)
+	}
+	return profile, nil
+}
+
+func (r *profileRepo) GetProfiles(userID uint) ([]models.Profile, error) {
+	var profiles []models.Profile
+	if err := r.DB.Where("user_id = ?", userID).Order("id").Find(&profiles).Error; err != nil {
+		return nil, fmt.Errorf("could not get profiles: %v", err)
+	}
+	return profiles, nil
+}
+
+func (r *profileRepo) GetProfile(profileID uint, userID uint) (*models.Profile, error) {
+	var profile models.Profile
+	if err := r.DB.Where("id = ? AND user_id = ?", profileID, userID).First(&profile).Error; err != nil {
+		return nil, fmt.Errorf("could not get profile: %w", err)
+	}
+	return &profile, nil
+}
+
+func (r *profileRepo) UpdateProfile(profile *models.Profile) error {
+	err := r.DB.Model(profile).Where("user_id = ?", profile.UserID).
+		Updates(map[string]interface{}{"name": profile.Name, "date_of_birth": profile.DateOfBirth, "weight_kg": profile.WeightKg}).Error
+	if err != nil {
+		return fmt.Errorf("could not update profile: %v", err)
+	}
+	return nil
+}
+
+func (r *profileRepo) DeleteProfile(profileID uint, userID uint) error {
+	result := r.DB.Where("id = ? AND user_id = ?", profileID, userID).Delete(&models.Profile{})
+	if result.Error != nil {
+		return fmt.Errorf("could not delete profile: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not delete profile: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// CountProfileMedications counts the medications of the dependent, including
+// the ones in the archive
+func (r *profileRepo) CountProfileMedications(profileID uint, userID uint) (int64, error) {
+	var count int64
+	err := r.DB.Unscoped().Model(&models.Medication{}).Where("profile_id = ? AND user_id = ?", profileID, userID).Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("could not count profile medications: %v", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// withUserTimeZone selects the time zone of the user owning each row of table
+// into the read only TimeZone field of the model
+func withUserTimeZone(table string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Select(fmt.Sprintf("%[1]s.*, (SELECT users.time_zone FROM users WHERE users.id = %[1]s.user_id) AS time_zone", table))
+	}
+}
+
+// withProfileName selects, like withUserTimeZone, the time zone of the user
+// and the name of the dependent each row of table is for, empty for the
+// user's own rows, into the read only ProfileName field of the model
+func withProfileName(table string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Select(fmt.Sprintf(`%[1]s.*, (SELECT users.time_zone FROM users WHERE users.id = %[1]s.user_id) AS time_zone,
+			%[2]s`, table, profileNameColumn(table)))
+	}
+}
+
+// profileNameColumn is the name of the dependent a row of table is for, empty
+// for the user's own rows
+func profileNameColumn(table string) string {
+	return fmt.Sprintf("COALESCE((SELECT profiles.name FROM profiles WHERE profiles.id = %s.profile_id), '') AS profile_name", table)
+}
+
+// withUserEmail selects the email of the user of each session into the read
+// only Email field of the session
+func withUserEmail(db *gorm.DB) *gorm.DB {
+	return db.Select("sessions.*, (SELECT users.email FROM users WHERE users.id = sessions.user_id) AS email")
+}
+
+// withPhases preloads the phases of a medication in the order they run
+func withPhases(db *gorm.DB) *gorm.DB {
+	return db.Preload("Phases", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	})
+}
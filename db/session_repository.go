@@ -0,0 +1,119 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/session_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db SessionRepository
+
+type SessionRepository interface {
+	CreateSession(session *models.Session, tokenHash string) (*models.Session, error)
+	FindRefreshToken(tokenHash string) (*models.RefreshToken, error)
+	RotateRefreshToken(token *models.RefreshToken, newTokenHash string) error
+	GetSession(sessionID uint, userID uint) (*models.Session, error)
+	GetActiveSessions(userID uint, now int64) ([]models.Session, error)
+	RevokeSession(sessionID uint, userID uint, now int64) error
+	RevokeSessions(userID uint, now int64) error
+}
+
+type sessionRepo struct {
+	DB *gorm.DB
+}
+
+func NewSessionRepo(db *GormDB) SessionRepository {
+	return &sessionRepo{db.DB}
+}
+
+// CreateSession creates the session with its first refresh token
+func (s *sessionRepo) CreateSession(session *models.Session, tokenHash string) (*models.Session, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.RefreshToken{SessionID: session.ID, TokenHash: tokenHash}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create session: %v", err)
+	}
+	return session, nil
+}
+
+// FindRefreshToken finds the refresh token with its session, used up or not
+func (s *sessionRepo) FindRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := s.DB.Preload("Session", withUserEmail).Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not find refresh token: %w", err)
+	}
+	if token.Session == nil {
+		return nil, fmt.Errorf("could not find session of refresh token: %w", gorm.ErrRecordNotFound)
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken uses the token up and gives its session the new one, with
+// the device, address and expiry of token.Session. It returns
+// gorm.ErrRecordNotFound when the token was used up in the meantime
+func (s *sessionRepo) RotateRefreshToken(token *models.RefreshToken, newTokenHash string) error {
+	session := token.Session
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).Where("id = ? AND used_at = 0", token.ID).Update("used_at", session.LastSeenAt)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		err := tx.Model(&models.Session{}).Where("id = ?", session.ID).Updates(map[string]interface{}{
+			"device": session.Device, "ip": session.IP, "last_seen_at": session.LastSeenAt, "expires_at": session.ExpiresAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.RefreshToken{SessionID: session.ID, TokenHash: newTokenHash}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not rotate refresh token: %w", err)
+	}
+	return nil
+}
+
+func (s *sessionRepo) GetSession(sessionID uint, userID uint) (*models.Session, error) {
+	var session models.Session
+	if err := s.DB.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		return nil, fmt.Errorf("could not get session: %w", err)
+	}
+	return &session, nil
+}
+
+func (s *sessionRepo) GetActiveSessions(userID uint, now int64) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.DB.Where("user_id = ? AND revoked_at = 0 AND expires_at > ?", userID, now).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get sessions: %v", err)
+	}
+	return sessions, nil
+}
+
+func (s *sessionRepo) RevokeSession(sessionID uint, userID uint, now int64) error {
+	result := s.DB.Model(&models.Session{}).Where("id = ? AND user_id = ? AND revoked_at = 0", sessionID, userID).Update("revoked_at", now)
+	if result.Error != nil {
+		return fmt.Errorf("could not revoke session: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not revoke session: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (s *sessionRepo) RevokeSessions(userID uint, now int64) error {
+	err := s.DB.Model(&models.Session{}).Where("user_id = ? AND revoked_at = 0", userID).Update("revoked_at", now).Error
+	if err != nil {
+		return fmt.Errorf("could not revoke sessions: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/two_factor_repo_mock.go -package=mocks github.com/decagonhq/meddle-api/db TwoFactorRepository
+
+type TwoFactorRepository interface {
+	SaveTwoFactorSecret(userID uint, secret string) error
+	EnableTwoFactor(userID uint, step int64, codeHashes []string) error
+	DisableTwoFactor(userID uint) error
+	UseTwoFactorStep(userID uint, step int64) error
+	UseRecoveryCode(userID uint, codeHash string, now int64) error
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	CountRecoveryCodes(userID uint) (int64, error)
+}
+
+type twoFactorRepo struct {
+	DB *gorm.DB
+}
+
+func NewTwoFactorRepo(db *GormDB) TwoFactorRepository {
+	return &twoFactorRepo{db.DB}
+}
+
+// SaveTwoFactorSecret starts the enrolment of a user with two-factor
+// authentication disabled, replacing the secret of an unfinished one
+func (t *twoFactorRepo) SaveTwoFactorSecret(userID uint, secret string) error {
+	result := t.DB.Model(&models.User{}).Where("id = ? AND two_factor_enabled = ?", userID, false).
+		Updates(map[string]interface{}{"two_factor_secret": secret, "two_factor_last_step": 0})
+	if result.Error != nil {
+		return fmt.Errorf("could not save two-factor secret: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not save two-factor secret: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// EnableTwoFactor ends the enrolment with the code of period step, giving the
+// user the recovery codes in place of any older ones
+func (t *twoFactorRepo) EnableTwoFactor(userID uint, step int64, codeHashes []string) error {
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"two_factor_enabled": true, "two_factor_last_step": step}).Error
+		if err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+	if err != nil {
+		return fmt.Errorf("could not enable two-factor authentication: %v", err)
+	}
+	return nil
+}
+
+func (t *twoFactorRepo) DisableTwoFactor(userID uint) error {
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"two_factor_enabled": false, "two_factor_secret": "", "two_factor_last_step": 0}).Error
+		if err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, nil)
+	})
+	if err != nil {
+		return fmt.Errorf("could not disable two-factor authentication: %v", err)
+	}
+	return nil
+}
+
+// UseTwoFactorStep records the code of period step as used. It returns
+// gorm.ErrRecordNotFound when a code of that period or a later one was used
+func (t *twoFactorRepo) UseTwoFactorStep(userID uint, step int64) error {
+	result := t.DB.Model(&models.User{}).Where("id = ? AND two_factor_last_step < ?", userID, step).
+		Update("two_factor_last_step", step)
+	if result.Error != nil {
+		return fmt.Errorf("could not use two-factor code: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not use two-factor code: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// UseRecoveryCode uses up the recovery code. It returns gorm.ErrRecordNotFound
+// when the user has no such unused code
+func (t *twoFactorRepo) UseRecoveryCode(userID uint, codeHash string, now int64) error {
+	result := t.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND code_hash = ? AND used_at = 0", userID, codeHash).
+		Update("used_at", now)
+	if result.Error != nil {
+		return fmt.Errorf("could not use recovery code: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not use recovery code: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+func (t *twoFactorRepo) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	err := t.DB.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+	if err != nil {
+		return fmt.Errorf("could not replace recovery codes: %v", err)
+	}
+	return nil
+}
+
+// CountRecoveryCodes counts the unused recovery codes of the user
+func (t *twoFactorRepo) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	err := t.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at = 0", userID).Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("could not count recovery codes: %v", err)
+	}
+	return count, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string) error {
+	if err := tx.Delete(&models.RecoveryCode{}, "user_id = ?", userID).Error; err != nil {
+		return err
+	}
+	if len(codeHashes) == 0 {
+		return nil
+	}
+	codes := make([]models.RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	return tx.Create(&codes).Error
+}
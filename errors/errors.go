@@ -49,6 +49,8 @@ var ErrBadRequest = New("bad request", http.StatusBadRequest)
 // InValidPasswordError
 var ErrInvalidPassword = New("invalid password", http.StatusUnauthorized)
 
+var ErrAccountDeactivated = New("this account is deactivated", http.StatusForbidden)
+
 func GetUniqueContraintError(err error) *Error {
 	fields := strings.Split(err.Error(), "UNIQUE constraint failed: ")
 	return &Error{
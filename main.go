@@ -4,11 +4,13 @@ import (
 	"log"
 	"net/http"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/decagonhq/meddle-api/config"
 	"github.com/decagonhq/meddle-api/db"
 	"github.com/decagonhq/meddle-api/server"
 	"github.com/decagonhq/meddle-api/services"
+	"github.com/decagonhq/meddle-api/services/identity"
 )
 
 func main() {
@@ -22,26 +24,58 @@ func main() {
 	authRepo := db.NewAuthRepo(gormDB)
 	mail := services.NewMailService(conf)
 	notificationRepo := db.NewNotificationRepo(gormDB)
-	pushNotification, errr := services.NewFirebaseCloudMessaging(notificationRepo, conf)
+	pushNotification, errr := services.NewFirebaseCloudMessaging(notificationRepo, mail, conf)
 	if err != nil {
 		log.Fatalf("error retrieving client for push notification\n%v", errr)
 	}
-	authService := services.NewAuthService(authRepo, conf, mail, pushNotification)
+	sessionService := services.NewSessionService(db.NewSessionRepo(gormDB), conf)
+	apiKeyRepo := db.NewAPIKeyRepo(gormDB)
+	loginThrottle := services.NewLoginThrottleService(db.NewLoginThrottleRepo(gormDB), conf, mail)
+	oneTimeTokens := services.NewOneTimeTokenService(db.NewOneTimeTokenRepo(gormDB), conf)
+	authService := services.NewAuthService(authRepo, apiKeyRepo, sessionService, loginThrottle, oneTimeTokens, conf, mail, pushNotification)
+	adminService := services.NewAdminService(db.NewAdminRepo(gormDB), apiKeyRepo, sessionService, authService, conf)
+	if err := adminService.PromoteAdmins(conf.AdminEmails); err != nil {
+		log.Printf("error promoting admins: %v", err)
+	}
 
 	medicationHistoryRepo := db.NewMedicationHistoryRepo(gormDB)
 	medicationRepo := db.NewMedicationRepo(gormDB)
-	medicationService := services.NewMedicationService(medicationRepo, medicationHistoryRepo, conf)
+	drugRepo := db.NewDrugRepo(gormDB)
+	drugCatalogService := services.NewDrugCatalogService(drugRepo, conf)
+	if conf.DrugCatalogFile != "" {
+		count, err := drugCatalogService.ImportFile(conf.DrugCatalogFile)
+		if err != nil {
+			log.Printf("error importing drug catalog: %v", err)
+		} else {
+			log.Printf("imported %d drugs into the catalog", count)
+		}
+	}
+	medicationService := services.NewMedicationService(medicationRepo, medicationHistoryRepo, drugRepo, conf)
 	medicationHistoryService := services.NewMedicationHistoryService(medicationHistoryRepo, conf)
+	caregiverService := services.NewCaregiverService(db.NewCaregiverRepo(gormDB), oneTimeTokens, mail, conf)
+	digestService := services.NewDigestService(db.NewDigestRepo(gormDB), medicationRepo, medicationHistoryRepo, mail, conf)
 
 	s := &server.Server{
 		Config:                   conf,
 		AuthRepository:           authRepo,
 		AuthService:              authService,
+		SessionService:           sessionService,
+		TwoFactorService:         services.NewTwoFactorService(db.NewTwoFactorRepo(gormDB), authRepo, sessionService, loginThrottle, conf),
+		UserService:              services.NewUserService(authRepo, medicationRepo, sessionService, oneTimeTokens, conf, mail),
+		AdminService:             adminService,
+		APIKeyService:            services.NewAPIKeyService(apiKeyRepo, conf),
+		IdentityService:          services.NewIdentityService(db.NewIdentityRepo(gormDB), authRepo, sessionService, conf),
 		MedicationService:        medicationService,
 		MedicationHistoryService: medicationHistoryService,
+		DrugCatalogService:       drugCatalogService,
+		DigestService:            digestService,
+		CaregiverService:         caregiverService,
+		ProfileService:           services.NewProfileService(db.NewProfileRepo(gormDB), conf),
 		PushNotification:         pushNotification,
+		IdentityProviders:        identity.NewProviders(conf),
 	}
-	go services.UpdateMedicationCronJob(medicationService)
+	go services.UpdateMedicationCronJob(medicationService, caregiverService)
 	go pushNotification.NotificationsCronJob()
+	go services.DigestCronJob(digestService)
 	s.Start()
 }
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultAdherenceDays is how far back adherence goes when the query has no from
+	DefaultAdherenceDays = 30
+	// MaxAdherenceDays is the longest range adherence is computed for
+	MaxAdherenceDays = 366
+	// MostMissedTimeSlots is how many time slots the adherence report lists
+	MostMissedTimeSlots = 5
+)
+
+// AdherenceQuery selects the doses adherence is computed for
+type AdherenceQuery struct {
+	From         string `form:"from"` // RFC3339, defaults to 30 days before to
+	To           string `form:"to"`   // RFC3339, defaults to now
+	Period       string `form:"period" binding:"omitempty,oneof=day week month"`
+	MedicationID uint   `form:"medication_id"`
+	ProfileID    uint   `form:"-"` // the selected dependent, 0 for the user
+}
+
+// AdherenceRange is a validated AdherenceQuery
+type AdherenceRange struct {
+	From         time.Time
+	To           time.Time
+	Period       string
+	MedicationID uint
+	ProfileID    uint
+}
+
+// ToRange validates the query, now being the default end of the range
+func (q *AdherenceQuery) ToRange(now time.Time) (*AdherenceRange, error) {
+	to, err := parseOptionalDate("to", q.To)
+	if err != nil {
+		return nil, err
+	}
+	if to.IsZero() || to.After(now) {
+		to = now
+	}
+	from, err := parseOptionalDate("from", q.From)
+	if err != nil {
+		return nil, err
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -DefaultAdherenceDays)
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+	if to.Sub(from) > MaxAdherenceDays*24*time.Hour {
+		return nil, fmt.Errorf("the range can't be longer than %d days", MaxAdherenceDays)
+	}
+	period := q.Period
+	if period == "" {
+		period = "day"
+	}
+	return &AdherenceRange{From: from, To: to, Period: period, MedicationID: q.MedicationID, ProfileID: q.ProfileID}, nil
+}
+
+// AdherenceStats counts what happened to the doses that were due. Skipped
+// doses don't count against adherence
+type AdherenceStats struct {
+	Taken                  int64   `json:"taken"`
+	OnTime                 int64   `json:"on_time"`
+	Late                   int64   `json:"late"`
+	Missed                 int64   `json:"missed"`
+	Skipped                int64   `json:"skipped"`
+	Adherence              float64 `json:"adherence"`                // percentage of the doses not skipped that were taken
+	AverageLatenessMinutes float64 `json:"average_lateness_minutes"` // of the taken doses, after their time
+}
+
+type MedicationAdherence struct {
+	MedicationID   uint   `json:"medication_id"`
+	MedicationName string `json:"medication_name"`
+	AdherenceStats
+}
+
+// PeriodAdherence is the adherence of the day, week or month starting at Start
+// in the time zone of the user
+type PeriodAdherence struct {
+	Start time.Time `json:"-"`
+	AdherenceStats
+}
+
+// AdherenceStreaks counts the days in a row without a missed dose, days
+// without doses neither extend nor break a streak
+type AdherenceStreaks struct {
+	Current int64 `json:"current"`
+	Longest int64 `json:"longest"`
+}
+
+// TimeSlotMisses counts the doses due in an hour of the day in the time zone
+// of the user
+type TimeSlotMisses struct {
+	Hour   int   `json:"hour"`
+	Missed int64 `json:"missed"`
+	Due    int64 `json:"due"`
+}
+
+type PeriodAdherenceResponse struct {
+	Start string `json:"start"`
+	AdherenceStats
+}
+
+type AdherenceReport struct {
+	From                string                    `json:"from"`
+	To                  string                    `json:"to"`
+	Period              string                    `json:"period"`
+	Overall             AdherenceStats            `json:"overall"`
+	Medications         []MedicationAdherence     `json:"medications"`
+	Periods             []PeriodAdherenceResponse `json:"periods"`
+	Streaks             AdherenceStreaks          `json:"streaks"`
+	MostMissedTimeSlots []TimeSlotMisses          `json:"most_missed_time_slots"`
+}
+
+// PeriodsToResponse renders the start of the periods as dates
+func PeriodsToResponse(periods []PeriodAdherence) []PeriodAdherenceResponse {
+	responses := make([]PeriodAdherenceResponse, 0, len(periods))
+	for _, period := range periods {
+		responses = append(responses, PeriodAdherenceResponse{
+			Start:          period.Start.Format("2006-01-02"),
+			AdherenceStats: period.AdherenceStats,
+		})
+	}
+	return responses
+}
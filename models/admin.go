@@ -0,0 +1,87 @@
+package models
+
+import "strings"
+
+// userStatusFilters are the values the status filter of the admin user list
+// accepts
+var userStatusFilters = map[string]bool{
+	"active":      true,
+	"deactivated": true,
+	"unverified":  true,
+}
+
+var UserListSpec = ListSpec{
+	SortColumns: map[string]SortKind{"name": SortString, "email": SortString, "created_at": SortInt},
+	DefaultSort: "-created_at",
+	Statuses:    userStatusFilters,
+}
+
+// UserSearchQuery is the query string of the admin user list, q matches
+// anywhere in the name, email or phone number
+type UserSearchQuery struct {
+	PageQuery
+	Q    string `form:"q"`
+	Role string `form:"role" binding:"omitempty,oneof=patient caregiver clinician admin"`
+}
+
+// UserFilter is a validated UserSearchQuery the repository runs
+type UserFilter struct {
+	Query string
+	Role  Role
+	Page  *Page
+}
+
+func (q *UserSearchQuery) ToFilter() (*UserFilter, error) {
+	page, err := q.PageQuery.ToPage(UserListSpec)
+	if err != nil {
+		return nil, err
+	}
+	return &UserFilter{Query: strings.TrimSpace(q.Q), Role: Role(q.Role), Page: page}, nil
+}
+
+// SortValue returns the value of the column a list of users is sorted by
+func (u *User) SortValue(column string) interface{} {
+	switch column {
+	case "name":
+		return u.Name
+	case "email":
+		return u.Email
+	default:
+		return u.CreatedAt
+	}
+}
+
+// MedicationCounts counts the medications of a user by status, Archived
+// counts the deleted ones whatever their status
+type MedicationCounts struct {
+	Active       int64 `json:"active"`
+	Paused       int64 `json:"paused"`
+	Discontinued int64 `json:"discontinued"`
+	Completed    int64 `json:"completed"`
+	Archived     int64 `json:"archived"`
+}
+
+// AdminUserResponse is a user as admins see them
+type AdminUserResponse struct {
+	UserProfileResponse
+	Role                  Role             `json:"role"`
+	Deactivated           bool             `json:"deactivated"`
+	DeactivatedAt         int64            `json:"deactivated_at,omitempty"`
+	PasswordResetRequired bool             `json:"password_reset_required"`
+	Medications           MedicationCounts `json:"medications"`
+}
+
+type UpdateRoleRequest struct {
+	Role Role `json:"role" binding:"required,oneof=patient caregiver clinician admin"`
+}
+
+func (u *User) ToAdminResponse(counts MedicationCounts) *AdminUserResponse {
+	return &AdminUserResponse{
+		UserProfileResponse:   *u.ToProfileResponse(),
+		Role:                  u.Role,
+		Deactivated:           u.Deactivated(),
+		DeactivatedAt:         u.DeactivatedAt,
+		PasswordResetRequired: u.PasswordResetRequired,
+		Medications:           counts,
+	}
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every personal API key, it tells them apart from the
+// access tokens sent the same way
+const APIKeyPrefix = "mdl_"
+
+// Limits of the personal API keys of a user
+const (
+	DefaultAPIKeyValidityDays = 90
+	MaxActiveAPIKeys          = 10
+)
+
+// APIScope is what an API key may do, a route needs the read scope of its
+// resource for GET and the write scope otherwise
+type APIScope string
+
+const (
+	ScopeMedicationsRead  APIScope = "medications:read"
+	ScopeMedicationsWrite APIScope = "medications:write"
+	ScopeHistoryRead      APIScope = "history:read"
+	ScopeHistoryWrite     APIScope = "history:write"
+)
+
+// APIKey is a long lived key a user scripts against the API with, only its
+// hash is stored
+type APIKey struct {
+	Model
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // the start of the key, to tell the keys of a user apart
+	KeyHash    string     `json:"-" gorm:"uniqueIndex"`
+	Scopes     []APIScope `json:"scopes" gorm:"type:text;serializer:json"`
+	LastUsedAt int64      `json:"last_used_at"` // 0 until the key is used
+	ExpiresAt  int64      `json:"expires_at"`
+	RevokedAt  int64      `json:"revoked_at"` // 0 while the key is not revoked
+	User       *User      `json:"-"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string     `json:"name" binding:"required,max=100"`
+	Scopes        []APIScope `json:"scopes" binding:"required,min=1,dive,oneof=medications:read medications:write history:read history:write"`
+	ExpiresInDays int        `json:"expires_in_days" binding:"omitempty,gte=1,lte=365"` // defaults to DefaultAPIKeyValidityDays
+}
+
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []APIScope `json:"scopes"`
+	CreatedAt  string     `json:"created_at"`
+	LastUsedAt string     `json:"last_used_at,omitempty"`
+	ExpiresAt  string     `json:"expires_at"`
+}
+
+// CreatedAPIKeyResponse is a new API key with the key itself, which can't be
+// seen again
+type CreatedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+// IsAPIKey reports whether the bearer token of a request is an API key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// Active reports whether the key can still be used at now
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == 0 && k.ExpiresAt > now.Unix()
+}
+
+// Allows reports whether the key was given the scope, write scopes don't
+// include the read ones
+func (k *APIKey) Allows(scope APIScope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *APIKey) ToResponse() APIKeyResponse {
+	response := APIKeyResponse{
+		ID:        k.ID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Scopes:    k.Scopes,
+		CreatedAt: time.Unix(k.CreatedAt, 0).UTC().Format(time.RFC3339),
+		ExpiresAt: time.Unix(k.ExpiresAt, 0).UTC().Format(time.RFC3339),
+	}
+	if k.LastUsedAt != 0 {
+		response.LastUsedAt = time.Unix(k.LastUsedAt, 0).UTC().Format(time.RFC3339)
+	}
+	return response
+}
+
+func APIKeysToResponse(keys []APIKey) []APIKeyResponse {
+	responses := make([]APIKeyResponse, 0, len(keys))
+	for i := range keys {
+		responses = append(responses, keys[i].ToResponse())
+	}
+	return responses
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// CaregiverPermission is what a caregiver can do with the medications of
+// their patient
+type CaregiverPermission string
+
+const (
+	CaregiverRead   CaregiverPermission = "read"   // view medications and history
+	CaregiverManage CaregiverPermission = "manage" // also change medications and record doses
+)
+
+// Allows reports whether the permission covers the required one
+func (p CaregiverPermission) Allows(required CaregiverPermission) bool {
+	return p == CaregiverManage || p == required
+}
+
+type CaregiverLinkStatus string
+
+const (
+	CaregiverPending  CaregiverLinkStatus = "pending"
+	CaregiverAccepted CaregiverLinkStatus = "accepted"
+)
+
+// CaregiverLink gives the caregiver invited at CaregiverEmail access to the
+// medications of the patient once they accept it
+type CaregiverLink struct {
+	Model
+	PatientID         uint                `json:"patient_id" gorm:"uniqueIndex:idx_caregiver_links_patient_email"`
+	Patient           *User               `json:"-" gorm:"foreignKey:PatientID"`
+	CaregiverEmail    string              `json:"caregiver_email" gorm:"uniqueIndex:idx_caregiver_links_patient_email"`
+	CaregiverID       *uint               `json:"caregiver_id" gorm:"index"` // set when the invitation is accepted
+	Caregiver         *User               `json:"-" gorm:"foreignKey:CaregiverID"`
+	Permission        CaregiverPermission `json:"permission"`
+	Status            CaregiverLinkStatus `json:"status" gorm:"default:pending;index"`
+	NotifyMissedDoses bool                `json:"notify_missed_doses"`
+}
+
+type InviteCaregiverRequest struct {
+	Email             string `json:"email" binding:"required,email"`
+	Permission        string `json:"permission" binding:"required,oneof=read manage"`
+	NotifyMissedDoses bool   `json:"notify_missed_doses"`
+}
+
+type UpdateCaregiverRequest struct {
+	Permission        string `json:"permission" binding:"omitempty,oneof=read manage"`
+	NotifyMissedDoses *bool  `json:"notify_missed_doses"`
+}
+
+type CaregiverLinkResponse struct {
+	ID                uint                `json:"id"`
+	CreatedAt         string              `json:"created_at"`
+	PatientID         uint                `json:"patient_id"`
+	PatientName       string              `json:"patient_name,omitempty"`
+	CaregiverEmail    string              `json:"caregiver_email"`
+	CaregiverID       *uint               `json:"caregiver_id,omitempty"`
+	CaregiverName     string              `json:"caregiver_name,omitempty"`
+	Permission        CaregiverPermission `json:"permission"`
+	Status            CaregiverLinkStatus `json:"status"`
+	NotifyMissedDoses bool                `json:"notify_missed_doses"`
+}
+
+// NewCaregiverLink returns the pending invitation of the request
+func NewCaregiverLink(patientID uint, request *InviteCaregiverRequest) *CaregiverLink {
+	return &CaregiverLink{
+		PatientID:         patientID,
+		CaregiverEmail:    NormalizeEmail(request.Email),
+		Permission:        CaregiverPermission(request.Permission),
+		Status:            CaregiverPending,
+		NotifyMissedDoses: request.NotifyMissedDoses,
+	}
+}
+
+// Apply changes what the request sets
+func (l *CaregiverLink) Apply(request *UpdateCaregiverRequest) {
+	if request.Permission != "" {
+		l.Permission = CaregiverPermission(request.Permission)
+	}
+	if request.NotifyMissedDoses != nil {
+		l.NotifyMissedDoses = *request.NotifyMissedDoses
+	}
+}
+
+func (l *CaregiverLink) ToResponse() *CaregiverLinkResponse {
+	response := &CaregiverLinkResponse{
+		ID:                l.ID,
+		CreatedAt:         time.Unix(l.CreatedAt, 0).UTC().Format(time.RFC3339),
+		PatientID:         l.PatientID,
+		CaregiverEmail:    l.CaregiverEmail,
+		CaregiverID:       l.CaregiverID,
+		Permission:        l.Permission,
+		Status:            l.Status,
+		NotifyMissedDoses: l.NotifyMissedDoses,
+	}
+	if l.Patient != nil {
+		response.PatientName = l.Patient.Name
+	}
+	if l.Caregiver != nil {
+		response.CaregiverName = l.Caregiver.Name
+	}
+	return response
+}
+
+// CaregiverLinksToResponse returns the responses of the links, empty rather
+// than nil without links
+func CaregiverLinksToResponse(links []CaregiverLink) []CaregiverLinkResponse {
+	responses := make([]CaregiverLinkResponse, 0, len(links))
+	for i := range links {
+		responses = append(responses, *links[i].ToResponse())
+	}
+	return responses
+}
+
+// NormalizeEmail returns the email in the form it's compared in
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultLowAdherencePercent is the adherence under which the digest lists a
+// medication when the config doesn't set it
+const DefaultLowAdherencePercent = 80
+
+// DigestSettings says when the user gets the weekly adherence digest, in their
+// time zone. It's Monday at 8 until the user changes it
+type DigestSettings struct {
+	OptOut           bool   `json:"-"`
+	Day              int    `json:"-" gorm:"default:1"` // a time.Weekday
+	Hour             int    `json:"-" gorm:"default:8"`
+	LastSentAt       int64  `json:"-"`
+	UnsubscribeToken string `json:"-" gorm:"index"`
+}
+
+type UpdateDigestSettingsRequest struct {
+	Enabled *bool  `json:"enabled"`
+	Day     string `json:"day" binding:"omitempty,oneof=sunday monday tuesday wednesday thursday friday saturday"`
+	Hour    *int   `json:"hour" binding:"omitempty,gte=0,lte=23"`
+}
+
+type DigestSettingsResponse struct {
+	Enabled bool   `json:"enabled"`
+	Day     string `json:"day"`
+	Hour    int    `json:"hour"`
+}
+
+// Apply changes the settings set in the request
+func (d *DigestSettings) Apply(request *UpdateDigestSettingsRequest) {
+	if request.Enabled != nil {
+		d.OptOut = !*request.Enabled
+	}
+	if request.Day != "" {
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			if strings.EqualFold(day.String(), request.Day) {
+				d.Day = int(day)
+			}
+		}
+	}
+	if request.Hour != nil {
+		d.Hour = *request.Hour
+	}
+}
+
+func (d *DigestSettings) ToResponse() *DigestSettingsResponse {
+	return &DigestSettingsResponse{
+		Enabled: !d.OptOut,
+		Day:     strings.ToLower(time.Weekday(d.Day).String()),
+		Hour:    d.Hour,
+	}
+}
+
+// WeeklyDigest is what the weekly digest email tells the user
+type WeeklyDigest struct {
+	Name            string
+	From            time.Time
+	To              time.Time
+	Location        *time.Location
+	Adherence       AdherenceStats
+	LowAdherence    []MedicationAdherence
+	StoppingSoon    []Medication
+	UnsubscribeLink string
+}
+
+// IsEmpty reports whether the user had no doses and has no medication ending
+func (w *WeeklyDigest) IsEmpty() bool {
+	a := w.Adherence
+	return a.Taken+a.Missed+a.Skipped == 0 && len(w.StoppingSoon) == 0
+}
+
+// TemplateValues returns the variables of the weeklydigest mail template
+func (w *WeeklyDigest) TemplateValues() map[string]interface{} {
+	lowAdherence := make([]map[string]interface{}, 0, len(w.LowAdherence))
+	for _, medication := range w.LowAdherence {
+		lowAdherence = append(lowAdherence, map[string]interface{}{
+			"name":      medication.MedicationName,
+			"adherence": medication.Adherence,
+			"missed":    medication.Missed,
+		})
+	}
+	stoppingSoon := make([]map[string]interface{}, 0, len(w.StoppingSoon))
+	for _, medication := range w.StoppingSoon {
+		stoppingSoon = append(stoppingSoon, map[string]interface{}{
+			"name":      medication.Name,
+			"stop_date": medication.MedicationStopDate.In(w.Location).Format("Monday, 2 January"),
+		})
+	}
+	return map[string]interface{}{
+		"name":             w.Name,
+		"week_start":       w.From.In(w.Location).Format("Mon 2 Jan"),
+		"week_end":         w.To.In(w.Location).Format("Mon 2 Jan"),
+		"taken":            w.Adherence.Taken,
+		"missed":           w.Adherence.Missed,
+		"skipped":          w.Adherence.Skipped,
+		"adherence":        w.Adherence.Adherence,
+		"low_adherence":    lowAdherence,
+		"stopping_soon":    stoppingSoon,
+		"unsubscribe_link": w.UnsubscribeLink,
+	}
+}
+
+// Body is the plain text of the digest, for mail clients without HTML
+func (w *WeeklyDigest) Body() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From %s to %s you took %d doses and missed %d, %v%% adherence.\n",
+		w.From.In(w.Location).Format("Mon 2 Jan"), w.To.In(w.Location).Format("Mon 2 Jan"),
+		w.Adherence.Taken, w.Adherence.Missed, w.Adherence.Adherence)
+	for _, medication := range w.LowAdherence {
+		fmt.Fprintf(&b, "%s: %v%% adherence, %d missed.\n", medication.MedicationName, medication.Adherence, medication.Missed)
+	}
+	for _, medication := range w.StoppingSoon {
+		fmt.Fprintf(&b, "%s ends on %s.\n", medication.Name, medication.MedicationStopDate.In(w.Location).Format("Monday, 2 January"))
+	}
+	fmt.Fprintf(&b, "Unsubscribe: %s\n", w.UnsubscribeLink)
+	return b.String()
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type DoseUnit string
+
+const (
+	DoseUnitMilligram     DoseUnit = "mg"
+	DoseUnitMicrogram     DoseUnit = "mcg"
+	DoseUnitGram          DoseUnit = "g"
+	DoseUnitMillilitre    DoseUnit = "ml"
+	DoseUnitTablet        DoseUnit = "tablet"
+	DoseUnitCapsule       DoseUnit = "capsule"
+	DoseUnitPuff          DoseUnit = "puff"
+	DoseUnitDrop          DoseUnit = "drop"
+	DoseUnitPatch         DoseUnit = "patch"
+	DoseUnitSachet        DoseUnit = "sachet"
+	DoseUnitSpray         DoseUnit = "spray"
+	DoseUnitUnit          DoseUnit = "unit"
+	DoseUnitInternational DoseUnit = "iu"
+)
+
+// countableDoseUnits are units that are pluralized when rendered
+var countableDoseUnits = map[DoseUnit]bool{
+	DoseUnitTablet:  true,
+	DoseUnitCapsule: true,
+	DoseUnitPuff:    true,
+	DoseUnitDrop:    true,
+	DoseUnitPatch:   true,
+	DoseUnitSachet:  true,
+	DoseUnitSpray:   true,
+	DoseUnitUnit:    true,
+}
+
+// strengthUnits are the units the strength of a medication can be expressed in
+var strengthUnits = map[DoseUnit]bool{
+	DoseUnitMilligram:     true,
+	DoseUnitMicrogram:     true,
+	DoseUnitGram:          true,
+	DoseUnitMillilitre:    true,
+	DoseUnitUnit:          true,
+	DoseUnitInternational: true,
+}
+
+func (u DoseUnit) IsValid() bool {
+	return u == DoseUnitMilligram || u == DoseUnitMicrogram || u == DoseUnitGram ||
+		u == DoseUnitMillilitre || u == DoseUnitInternational || countableDoseUnits[u]
+}
+
+type DosageForm string
+
+const (
+	DosageFormTablet      DosageForm = "tablet"
+	DosageFormCapsule     DosageForm = "capsule"
+	DosageFormLiquid      DosageForm = "liquid"
+	DosageFormInjection   DosageForm = "injection"
+	DosageFormInhaler     DosageForm = "inhaler"
+	DosageFormDrops       DosageForm = "drops"
+	DosageFormCream       DosageForm = "cream"
+	DosageFormPatch       DosageForm = "patch"
+	DosageFormSuppository DosageForm = "suppository"
+	DosageFormSpray       DosageForm = "spray"
+	DosageFormPowder      DosageForm = "powder"
+)
+
+var dosageForms = map[DosageForm]bool{
+	DosageFormTablet: true, DosageFormCapsule: true, DosageFormLiquid: true, DosageFormInjection: true,
+	DosageFormInhaler: true, DosageFormDrops: true, DosageFormCream: true, DosageFormPatch: true,
+	DosageFormSuppository: true, DosageFormSpray: true, DosageFormPowder: true,
+}
+
+func (f DosageForm) IsValid() bool {
+	return f == "" || dosageForms[f]
+}
+
+// DoseQuantity is an amount of a medication, e.g. 0.5 tablet or 250 mg
+type DoseQuantity struct {
+	Amount float64  `json:"amount"`
+	Unit   DoseUnit `json:"unit,omitempty"`
+}
+
+func (q DoseQuantity) IsZero() bool {
+	return q.Amount == 0
+}
+
+// Validate checks that the amount is positive and the unit is known
+func (q DoseQuantity) Validate() error {
+	if q.Amount <= 0 {
+		return fmt.Errorf("dose amount must be greater than zero")
+	}
+	if !q.Unit.IsValid() {
+		return fmt.Errorf("invalid dose unit: %s", q.Unit)
+	}
+	return nil
+}
+
+// ValidateStrength checks the quantity as the strength of a medication
+func (q DoseQuantity) ValidateStrength() error {
+	if q.Amount <= 0 {
+		return fmt.Errorf("strength amount must be greater than zero")
+	}
+	if !strengthUnits[q.Unit] {
+		return fmt.Errorf("invalid strength unit: %s", q.Unit)
+	}
+	return nil
+}
+
+// String renders the quantity for people, e.g. "2 tablets" or "2.5 ml"
+func (q DoseQuantity) String() string {
+	amount := strconv.FormatFloat(q.Amount, 'f', -1, 64)
+	if q.Unit == "" {
+		return amount
+	}
+	unit := string(q.Unit)
+	if countableDoseUnits[q.Unit] && q.Amount > 1 {
+		unit += "s"
+	}
+	return amount + " " + unit
+}
+
+// legacyDose maps the integer dosage of medications created before doses had
+// units onto a quantity without unit
+func legacyDose(dosage int) DoseQuantity {
+	return DoseQuantity{Amount: float64(dosage)}
+}
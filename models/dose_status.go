@@ -0,0 +1,95 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// DoseStatus is what happened to a scheduled dose
+type DoseStatus string
+
+const (
+	DosePending DoseStatus = "pending" // due, still within its grace window
+	DoseOnTime  DoseStatus = "on_time" // taken before the end of its grace window
+	DoseLate    DoseStatus = "late"    // taken after the end of its grace window
+	DoseMissed  DoseStatus = "missed"  // not taken by the end of its grace window
+	DoseSkipped DoseStatus = "skipped" // not taken on purpose
+)
+
+// DefaultMissedDoseGrace is how long after its time a dose is missed when
+// neither the medication nor the config set it
+const DefaultMissedDoseGrace = time.Hour
+
+func (s DoseStatus) IsTaken() bool {
+	return s == DoseOnTime || s == DoseLate
+}
+
+// UpdateMedicationHistoryRequest records what happened to a dose. Requests
+// with only has_medication_been_taken mark the dose taken or missed
+type UpdateMedicationHistoryRequest struct {
+	Status                 string `json:"status" binding:"omitempty,oneof=taken skipped missed"`
+	TakenAt                string `json:"taken_at"` // RFC3339, defaults to now
+	HasMedicationBeenTaken *bool  `json:"has_medication_been_taken"`
+}
+
+// MissedDoseGrace returns how long after their time the doses of the
+// medication are missed
+func (m *Medication) MissedDoseGrace(defaultGrace time.Duration) time.Duration {
+	if m.MissedDoseGraceMinutes > 0 {
+		return time.Duration(m.MissedDoseGraceMinutes) * time.Minute
+	}
+	return defaultGrace
+}
+
+// Record applies the request to the dose, now being when it's recorded
+func (h *MedicationHistory) Record(request *UpdateMedicationHistoryRequest, now time.Time) error {
+	status := request.Status
+	if status == "" {
+		if request.HasMedicationBeenTaken == nil {
+			return fmt.Errorf("status is required")
+		}
+		status = "missed"
+		if *request.HasMedicationBeenTaken {
+			status = "taken"
+		}
+	}
+	if status != "taken" {
+		if request.TakenAt != "" {
+			return fmt.Errorf("taken_at is only for taken doses")
+		}
+		h.Status = DoseStatus(status)
+		h.TakenAt = time.Time{}
+		h.HasMedicationBeenTaken = false
+		return nil
+	}
+	takenAt := now
+	if request.TakenAt != "" {
+		var err error
+		if takenAt, err = time.Parse(time.RFC3339, request.TakenAt); err != nil {
+			return fmt.Errorf("taken_at must be an RFC3339 date")
+		}
+		if takenAt.After(now) {
+			return fmt.Errorf("taken_at is in the future")
+		}
+	}
+	h.TakenAt = takenAt
+	h.HasMedicationBeenTaken = true
+	h.Status = DoseOnTime
+	// doses recorded before grace windows have no end to be late after
+	if !h.GraceEndsAt.IsZero() && takenAt.After(h.GraceEndsAt) {
+		h.Status = DoseLate
+	}
+	return nil
+}
+
+// EffectiveStatus returns the status of the dose, mapping doses recorded
+// before they had a status onto one
+func (h *MedicationHistory) EffectiveStatus() DoseStatus {
+	if h.Status != "" {
+		return h.Status
+	}
+	if h.HasMedicationBeenTaken {
+		return DoseOnTime
+	}
+	return DosePending
+}
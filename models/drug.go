@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Drug is an entry of the drug catalog, medications can reference one to get
+// a normalized name and icon
+type Drug struct {
+	Model
+	Name      string         `json:"name" gorm:"uniqueIndex"` // generic name, lowercase
+	Synonyms  []string       `json:"synonyms" gorm:"type:text;serializer:json"`
+	Strengths []DoseQuantity `json:"strengths" gorm:"type:text;serializer:json"`
+	Forms     []DosageForm   `json:"forms" gorm:"type:text;serializer:json"`
+	ClassCode string         `json:"class_code" gorm:"index"` // ATC-like code, e.g. N02BE01
+	Icon      string         `json:"icon"`
+}
+
+// DrugCatalogFile is the format of the files the catalog is imported from
+type DrugCatalogFile struct {
+	Drugs []Drug `json:"drugs"`
+}
+
+type DrugResponse struct {
+	ID        uint           `json:"id"`
+	Name      string         `json:"name"`
+	Synonyms  []string       `json:"synonyms,omitempty"`
+	Strengths []DoseQuantity `json:"strengths,omitempty"`
+	Forms     []DosageForm   `json:"forms,omitempty"`
+	ClassCode string         `json:"class_code,omitempty"`
+	Icon      string         `json:"icon,omitempty"`
+}
+
+// Normalize lowercases the names and checks the strengths and forms of an
+// imported drug
+func (d *Drug) Normalize() error {
+	d.Name = strings.Join(strings.Fields(strings.ToLower(d.Name)), " ")
+	if d.Name == "" {
+		return fmt.Errorf("drug name is required")
+	}
+	synonyms := make([]string, 0, len(d.Synonyms))
+	for _, synonym := range d.Synonyms {
+		synonym = strings.Join(strings.Fields(strings.ToLower(synonym)), " ")
+		if synonym != "" && synonym != d.Name {
+			synonyms = append(synonyms, synonym)
+		}
+	}
+	d.Synonyms = synonyms
+	for _, strength := range d.Strengths {
+		if err := strength.ValidateStrength(); err != nil {
+			return fmt.Errorf("%s: %v", d.Name, err)
+		}
+	}
+	for _, form := range d.Forms {
+		if form == "" || !form.IsValid() {
+			return fmt.Errorf("%s: invalid dosage form: %s", d.Name, form)
+		}
+	}
+	d.ClassCode = strings.ToUpper(strings.TrimSpace(d.ClassCode))
+	return nil
+}
+
+// DisplayName is the name medications referencing the drug get
+func (d *Drug) DisplayName() string {
+	if d.Name == "" {
+		return ""
+	}
+	return strings.ToUpper(d.Name[:1]) + d.Name[1:]
+}
+
+func (d *Drug) DrugToResponse() *DrugResponse {
+	return &DrugResponse{
+		ID:        d.ID,
+		Name:      d.DisplayName(),
+		Synonyms:  d.Synonyms,
+		Strengths: d.Strengths,
+		Forms:     d.Forms,
+		ClassCode: d.ClassCode,
+		Icon:      d.Icon,
+	}
+}
@@ -0,0 +1,31 @@
+package models
+
+type InteractionSeverity string
+
+const (
+	SeverityMinor           InteractionSeverity = "minor"
+	SeverityModerate        InteractionSeverity = "moderate"
+	SeverityMajor           InteractionSeverity = "major"
+	SeverityContraindicated InteractionSeverity = "contraindicated"
+)
+
+type InteractionKind string
+
+const (
+	InteractionKindInteraction      InteractionKind = "interaction"
+	InteractionKindDuplicateTherapy InteractionKind = "duplicate_therapy"
+)
+
+// InteractionWarning warns that two drugs shouldn't be taken together
+type InteractionWarning struct {
+	Kind        InteractionKind     `json:"kind"`
+	Drugs       []string            `json:"drugs"`
+	Severity    InteractionSeverity `json:"severity"`
+	Description string              `json:"description"`
+}
+
+type InteractionCheckRequest struct {
+	Drugs                     []string `json:"drugs" binding:"required,min=1"`
+	IncludeCurrentMedications bool     `json:"include_current_medications"`
+	ProfileID                 uint     `json:"-"` // whose current medications are checked, 0 for the user
+}
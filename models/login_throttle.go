@@ -0,0 +1,73 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Defaults of the login throttling when the config doesn't set them
+const (
+	DefaultLoginFreeAttempts      = 3
+	DefaultLoginLockoutAttempts   = 10
+	DefaultIPLoginLockoutAttempts = 50
+	DefaultLoginLockout           = 15 * time.Minute
+
+	maxLoginDelay = time.Minute
+)
+
+// LoginThrottle counts the failed logins of an account, or from an address
+// across accounts, since the last successful login or lockout. A failure more
+// than a lockout after the one before it counts from one again
+type LoginThrottle struct {
+	Model
+	Key          string `json:"key" gorm:"uniqueIndex"` // from AccountThrottleKey or IPThrottleKey
+	Failures     int    `json:"failures"`
+	LastFailedAt int64  `json:"last_failed_at"`
+	LockedUntil  int64  `json:"locked_until"`
+}
+
+// LoginThrottlePolicy says how failed logins slow down the next ones
+type LoginThrottlePolicy struct {
+	FreeAttempts    int // failures after which each login waits longer
+	LockoutAttempts int // failures that lock the logins for Lockout
+	Lockout         time.Duration
+}
+
+func AccountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Delay is how long to wait after the last of the failures to try again, it
+// doubles from a second with every failure after the free attempts
+func (p LoginThrottlePolicy) Delay(failures int) time.Duration {
+	extra := failures - p.FreeAttempts
+	if extra <= 0 {
+		return 0
+	}
+	if extra > 6 {
+		return maxLoginDelay
+	}
+	delay := time.Second << (extra - 1)
+	if delay > maxLoginDelay {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+// ShouldLock reports whether the failures lock the logins
+func (p LoginThrottlePolicy) ShouldLock(failures int) bool {
+	return p.LockoutAttempts > 0 && failures >= p.LockoutAttempts
+}
+
+// RetryAt returns when a login can be tried again
+func (t *LoginThrottle) RetryAt(policy LoginThrottlePolicy) time.Time {
+	retryAt := t.LastFailedAt + int64(policy.Delay(t.Failures).Seconds())
+	if t.LockedUntil > retryAt {
+		retryAt = t.LockedUntil
+	}
+	return time.Unix(retryAt, 0)
+}
@@ -1,68 +1,123 @@
 package models
 
 import (
+	"fmt"
+	"math"
 	"time"
 )
 
 type Medication struct {
 	//base model goes here
-	Model
-	Name                   string    `json:"name"`
-	Dosage                 int       `json:"dosage"`
-	TimeInterval           int       `json:"time_interval"` // min hour daily
-	MedicationStartDate    time.Time `json:"medication_start_date"`
-	Duration               int       `json:"duration"`
-	MedicationPrescribedBy string    `json:"medication_prescribed_by"`
-	MedicationStopDate     time.Time `json:"medication_stop_date"`
-	MedicationStartTime    time.Time `json:"medication_start_time"`
-	NextDosageTime         time.Time `json:"next_dosage_time"`
-	PurposeOfMedication    string    `json:"purpose_of_medication"`
-	IsMedicationDone       bool      `json:"is_medication_done"`
-	MedicationIcon         string    `json:"medication_icon"`
-	UserID                 uint      `json:"user_id"`
+	SoftDeleteModel
+	Name                   string            `json:"name"`
+	DrugID                 *uint             `json:"drug_id" gorm:"index"` // catalog entry, nil for a free text name
+	Dosage                 int               `json:"dosage"`
+	TimeInterval           int               `json:"time_interval"` // min hour daily
+	MedicationStartDate    time.Time         `json:"medication_start_date"`
+	Duration               int               `json:"duration"`
+	MedicationPrescribedBy string            `json:"medication_prescribed_by"`
+	MedicationStopDate     time.Time         `json:"medication_stop_date"`
+	MedicationStartTime    time.Time         `json:"medication_start_time"`
+	NextDosageTime         time.Time         `json:"next_dosage_time"`
+	PurposeOfMedication    string            `json:"purpose_of_medication"`
+	IsMedicationDone       bool              `json:"is_medication_done"`
+	Status                 MedicationStatus  `json:"status" gorm:"default:active;index"`
+	PausedAt               time.Time         `json:"paused_at"`
+	DiscontinuedAt         time.Time         `json:"discontinued_at"`
+	DiscontinuedReason     string            `json:"discontinued_reason"`
+	MedicationIcon         string            `json:"medication_icon"`
+	UserID                 uint              `json:"user_id"`
+	ProfileID              uint              `json:"profile_id" gorm:"index;not null;default:0"` // dependent the medication is for, 0 for the user
+	Schedule               DosageSchedule    `json:"schedule" gorm:"embedded;embeddedPrefix:schedule_"`
+	Phases                 []MedicationPhase `json:"phases,omitempty" gorm:"foreignKey:MedicationID"`
+	Dose                   DoseQuantity      `json:"dose" gorm:"embedded;embeddedPrefix:dose_"`
+	Strength               DoseQuantity      `json:"strength" gorm:"embedded;embeddedPrefix:strength_"`
+	DosageForm             DosageForm        `json:"dosage_form"`
+	StockQuantity          *float64          `json:"stock_quantity"` // nil when the stock isn't tracked
+	LowStockNotifiedAt     int64             `json:"-"`
+	MissedDoseGraceMinutes int               `json:"missed_dose_grace_minutes"` // 0 uses the default grace window
+	RunOutTime             time.Time         `json:"-" gorm:"-"`                // projected by the services, zero when unknown
+	TimeZone               string            `json:"-" gorm:"->;-:migration"`   // time zone of the user, selected with the medication
+	ProfileName            string            `json:"-" gorm:"->;-:migration"`   // name of the dependent, selected for notifications
 }
 
 type UpdateMedicationRequest struct {
-	Name                   string `json:"name"`
-	Dosage                 int    `json:"dosage"`
-	TimeInterval           int    `json:"time_interval"` // min hour daily
-	MedicationStartDate    string `json:"medication_start_date"`
-	Duration               int    `json:"duration"`
-	MedicationPrescribedBy string `json:"medication_prescribed_by"`
-	MedicationStartTime    string `json:"medication_start_time"`
-	PurposeOfMedication    string `json:"purpose_of_medication"`
-	MedicationIcon         string `json:"medication_icon"`
+	Name                   string                   `json:"name"`
+	DrugID                 *uint                    `json:"drug_id"`
+	Dosage                 int                      `json:"dosage"`
+	Dose                   *DoseQuantity            `json:"dose"`
+	Strength               *DoseQuantity            `json:"strength"`
+	DosageForm             DosageForm               `json:"dosage_form"`
+	StockQuantity          *float64                 `json:"stock_quantity" binding:"omitempty,gte=0"`
+	MissedDoseGraceMinutes int                      `json:"missed_dose_grace_minutes" binding:"omitempty,gte=0,lte=1440"`
+	TimeInterval           int                      `json:"time_interval"` // min hour daily
+	MedicationStartDate    string                   `json:"medication_start_date"`
+	Duration               int                      `json:"duration"`
+	MedicationPrescribedBy string                   `json:"medication_prescribed_by"`
+	MedicationStartTime    string                   `json:"medication_start_time"`
+	PurposeOfMedication    string                   `json:"purpose_of_medication"`
+	MedicationIcon         string                   `json:"medication_icon"`
+	Schedule               *DosageSchedule          `json:"schedule"`
+	Phases                 []MedicationPhaseRequest `json:"phases"`
+	TimeZone               string                   `json:"-"`
 }
 
 type MedicationRequest struct {
-	Name                   string `json:"name" binding:"required"`
-	Dosage                 int    `json:"dosage" binding:"required"`
-	TimeInterval           int    `json:"time_interval" binding:"required"` // min hour daily
-	MedicationStartDate    string `json:"medication_start_date" binding:"required"`
-	Duration               int    `json:"duration" binding:"required"`
-	MedicationPrescribedBy string `json:"medication_prescribed_by" binding:"required"`
-	MedicationStartTime    string `json:"medication_start_time" binding:"required"`
-	PurposeOfMedication    string `json:"purpose_of_medication" binding:"required"`
-	MedicationIcon         string `json:"medication_icon" binding:"required"`
-	UserID                 uint   `json:"user_id"`
+	Name                   string                   `json:"name" binding:"required_without=DrugID"`
+	DrugID                 *uint                    `json:"drug_id"`
+	Dosage                 int                      `json:"dosage"`
+	Dose                   *DoseQuantity            `json:"dose"`
+	Strength               *DoseQuantity            `json:"strength"`
+	DosageForm             DosageForm               `json:"dosage_form"`
+	StockQuantity          *float64                 `json:"stock_quantity" binding:"omitempty,gte=0"`
+	MissedDoseGraceMinutes int                      `json:"missed_dose_grace_minutes" binding:"omitempty,gte=0,lte=1440"`
+	TimeInterval           int                      `json:"time_interval"` // min hour daily
+	MedicationStartDate    string                   `json:"medication_start_date" binding:"required"`
+	Duration               int                      `json:"duration" binding:"required"`
+	MedicationPrescribedBy string                   `json:"medication_prescribed_by" binding:"required"`
+	MedicationStartTime    string                   `json:"medication_start_time" binding:"required"`
+	PurposeOfMedication    string                   `json:"purpose_of_medication" binding:"required"`
+	MedicationIcon         string                   `json:"medication_icon" binding:"required_without=DrugID"`
+	UserID                 uint                     `json:"user_id"`
+	ProfileID              uint                     `json:"-"`
+	Schedule               *DosageSchedule          `json:"schedule"`
+	Phases                 []MedicationPhaseRequest `json:"phases"`
+	TimeZone               string                   `json:"-"`
 }
 
 type MedicationResponse struct {
-	ID                     uint   `json:"id"`
-	CreatedAt              string `json:"created_at"`
-	UpdatedAt              string `json:"updated_at"`
-	Name                   string `json:"name"`
-	Dosage                 int    `json:"dosage"`
-	TimeInterval           int    `json:"time_interval"` // min hour daily
-	MedicationStartDate    string `json:"medication_start_date"`
-	Duration               int    `json:"duration"`
-	MedicationPrescribedBy string `json:"medication_prescribed_by"`
-	MedicationStopDate     string `json:"medication_stop_date"`
-	MedicationStartTime    string `json:"medication_start_time"`
-	NextDosageTime         string `json:"next_dosage_time"`
-	PurposeOfMedication    string `json:"purpose_of_medication"`
-	MedicationIcon         string `json:"medication_icon"`
-	UserID                 uint   `json:"user_id"`
+	ID                     uint                      `json:"id"`
+	CreatedAt              string                    `json:"created_at"`
+	UpdatedAt              string                    `json:"updated_at"`
+	DeletedAt              string                    `json:"deleted_at,omitempty"`
+	Name                   string                    `json:"name"`
+	DrugID                 *uint                     `json:"drug_id,omitempty"`
+	Dosage                 int                       `json:"dosage"`
+	TimeInterval           int                       `json:"time_interval"` // min hour daily
+	MedicationStartDate    string                    `json:"medication_start_date"`
+	Duration               int                       `json:"duration"`
+	MedicationPrescribedBy string                    `json:"medication_prescribed_by"`
+	MedicationStopDate     string                    `json:"medication_stop_date"`
+	MedicationStartTime    string                    `json:"medication_start_time"`
+	NextDosageTime         string                    `json:"next_dosage_time"`
+	PurposeOfMedication    string                    `json:"purpose_of_medication"`
+	MedicationIcon         string                    `json:"medication_icon"`
+	UserID                 uint                      `json:"user_id"`
+	ProfileID              uint                      `json:"profile_id,omitempty"`
+	Schedule               DosageSchedule            `json:"schedule"`
+	Dose                   DoseQuantity              `json:"dose"`
+	Strength               *DoseQuantity             `json:"strength,omitempty"`
+	DosageForm             DosageForm                `json:"dosage_form,omitempty"`
+	StockQuantity          *float64                  `json:"stock_quantity,omitempty"`
+	MissedDoseGraceMinutes int                       `json:"missed_dose_grace_minutes,omitempty"`
+	RunOutDate             string                    `json:"run_out_date,omitempty"`
+	Status                 MedicationStatus          `json:"status"`
+	PausedAt               string                    `json:"paused_at,omitempty"`
+	DiscontinuedAt         string                    `json:"discontinued_at,omitempty"`
+	DiscontinuedReason     string                    `json:"discontinued_reason,omitempty"`
+	CurrentPhase           int                       `json:"current_phase,omitempty"`
+	Phases                 []MedicationPhaseResponse `json:"phases,omitempty"`
+	Warnings               []InteractionWarning      `json:"warnings,omitempty"`
 }
 
 type MedicationDetailResponse struct {
@@ -84,8 +139,9 @@ type MedicationDetailResponse struct {
 }
 
 func (m *MedicationRequest) ReqToMedicationModel() *Medication {
-	return &Medication{
+	medication := &Medication{
 		Name:                   m.Name,
+		DrugID:                 m.DrugID,
 		Dosage:                 m.Dosage,
 		TimeInterval:           m.TimeInterval,
 		Duration:               m.Duration,
@@ -93,25 +149,119 @@ func (m *MedicationRequest) ReqToMedicationModel() *Medication {
 		PurposeOfMedication:    m.PurposeOfMedication,
 		MedicationIcon:         m.MedicationIcon,
 		UserID:                 m.UserID,
+		ProfileID:              m.ProfileID,
+		TimeZone:               m.TimeZone,
+		StockQuantity:          m.StockQuantity,
+		MissedDoseGraceMinutes: m.MissedDoseGraceMinutes,
 	}
+	if m.Schedule != nil {
+		medication.Schedule = *m.Schedule
+	}
+	medication.SetDose(m.Dose, m.Strength, m.DosageForm)
+	return medication
 }
 
 func (m *Medication) MedicationToResponse() *MedicationResponse {
+	now := time.Now()
 	return &MedicationResponse{
 		ID:                     m.ID,
-		CreatedAt:              time.Unix(m.CreatedAt, 0).String(),
-		UpdatedAt:              time.Unix(m.UpdatedAt, 0).String(),
+		CreatedAt:              formatInTimeZone(time.Unix(m.CreatedAt, 0), m.TimeZone),
+		UpdatedAt:              formatInTimeZone(time.Unix(m.UpdatedAt, 0), m.TimeZone),
+		DeletedAt:              formatOptionalTime(m.DeletedAt.Time, m.TimeZone),
 		Name:                   m.Name,
-		Dosage:                 m.Dosage,
+		DrugID:                 m.DrugID,
+		Dosage:                 m.DosageAt(now),
 		TimeInterval:           m.TimeInterval,
-		MedicationStartDate:    m.MedicationStartDate.String(),
+		MedicationStartDate:    formatInTimeZone(m.MedicationStartDate, m.TimeZone),
 		Duration:               m.Duration,
 		MedicationPrescribedBy: m.MedicationPrescribedBy,
-		MedicationStopDate:     m.MedicationStopDate.String(),
-		MedicationStartTime:    m.MedicationStartTime.String(),
-		NextDosageTime:         m.NextDosageTime.String(),
+		MedicationStopDate:     formatInTimeZone(m.MedicationStopDate, m.TimeZone),
+		MedicationStartTime:    formatInTimeZone(m.MedicationStartTime, m.TimeZone),
+		NextDosageTime:         formatInTimeZone(m.NextDosageTime, m.TimeZone),
 		PurposeOfMedication:    m.PurposeOfMedication,
 		MedicationIcon:         m.MedicationIcon,
 		UserID:                 m.UserID,
+		ProfileID:              m.ProfileID,
+		Schedule:               m.EffectiveSchedule(),
+		Dose:                   m.DoseAt(now),
+		Strength:               m.strengthToResponse(),
+		DosageForm:             m.DosageForm,
+		StockQuantity:          m.StockQuantity,
+		MissedDoseGraceMinutes: m.MissedDoseGraceMinutes,
+		RunOutDate:             formatOptionalTime(m.RunOutTime, m.TimeZone),
+		Status:                 m.EffectiveStatus(),
+		PausedAt:               formatOptionalTime(m.PausedAt, m.TimeZone),
+		DiscontinuedAt:         formatOptionalTime(m.DiscontinuedAt, m.TimeZone),
+		DiscontinuedReason:     m.DiscontinuedReason,
+		CurrentPhase:           m.PhaseIndexAt(now) + 1,
+		Phases:                 m.phasesToResponse(),
+	}
+}
+
+// ValidateDose checks the dose of a medication request, a request without a
+// structured dose must at least have an integer dosage
+func ValidateDose(dosage int, dose, strength *DoseQuantity, form DosageForm) error {
+	if dose == nil && dosage <= 0 {
+		return fmt.Errorf("dosage or dose is required")
+	}
+	if dose != nil {
+		if err := dose.Validate(); err != nil {
+			return err
+		}
+	}
+	if strength != nil {
+		if err := strength.ValidateStrength(); err != nil {
+			return err
+		}
+	}
+	if !form.IsValid() {
+		return fmt.Errorf("invalid dosage form: %s", form)
+	}
+	return nil
+}
+
+// SetDose sets the structured dose of the medication, keeping the integer
+// dosage in line with it for older clients
+func (m *Medication) SetDose(dose, strength *DoseQuantity, form DosageForm) {
+	if dose != nil {
+		m.Dose = *dose
+		m.Dosage = int(math.Round(dose.Amount))
+	}
+	if strength != nil {
+		m.Strength = *strength
+	}
+	if form != "" {
+		m.DosageForm = form
+	}
+}
+
+// EffectiveDose returns the dose of the medication, mapping medications
+// created with only an integer dosage onto a quantity without unit
+func (m *Medication) EffectiveDose() DoseQuantity {
+	if m.Dose.IsZero() {
+		return legacyDose(m.Dosage)
+	}
+	return m.Dose
+}
+
+func (m *Medication) strengthToResponse() *DoseQuantity {
+	if m.Strength.IsZero() {
+		return nil
+	}
+	strength := m.Strength
+	return &strength
+}
+
+// Location returns the time zone the doses of the medication are scheduled in
+func (m *Medication) Location() *time.Location {
+	return LoadLocation(m.TimeZone)
+}
+
+// EffectiveSchedule returns the dosage schedule of the medication, mapping
+// medications created with only a time interval onto an interval schedule
+func (m *Medication) EffectiveSchedule() DosageSchedule {
+	if m.Schedule.IsZero() {
+		return DosageSchedule{Kind: ScheduleInterval, IntervalHours: m.TimeInterval}
 	}
+	return m.Schedule
 }
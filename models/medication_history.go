@@ -3,52 +3,102 @@ package models
 import "time"
 
 type MedicationHistory struct {
-	Model
-	MedicationName         string    `json:"medication_name"`
-	MedicationID           uint      `json:"medication_id"`
-	MedicationTime         time.Time `json:"medication_time"`
-	MedicationDosage       int       `json:"medication_dosage"`
-	UserID                 uint      `json:"user_id"`
-	HasMedicationBeenTaken bool      `json:"has_medication_been_taken"`
-	WasMedicationMissed    string    `json:"was_medication_missed"`
+	SoftDeleteModel
+	MedicationName         string       `json:"medication_name"`
+	MedicationID           uint         `json:"medication_id"`
+	MedicationTime         time.Time    `json:"medication_time"`
+	MedicationDosage       int          `json:"medication_dosage"`
+	Dose                   DoseQuantity `json:"dose" gorm:"embedded;embeddedPrefix:dose_"`
+	UserID                 uint         `json:"user_id"`
+	ProfileID              uint         `json:"profile_id" gorm:"index;not null;default:0"` // dependent the dose is for, 0 for the user
+	HasMedicationBeenTaken bool         `json:"has_medication_been_taken"`
+	Status                 DoseStatus   `json:"status" gorm:"default:pending;index"`
+	TakenAt                time.Time    `json:"taken_at"`
+	GraceEndsAt            time.Time    `json:"grace_ends_at"`           // the dose is missed when it's not taken by then
+	TimeZone               string       `json:"-" gorm:"->;-:migration"` // time zone of the user, selected with the history
+	ProfileName            string       `json:"-" gorm:"->;-:migration"` // name of the dependent, selected for notifications
 }
 
-func NewMedicationHistory(medication Medication) *MedicationHistory {
+// MedicationHistoryListSpec describes the filters and sorts of the medication
+// history list, taken matches the doses taken on time or late
+var MedicationHistoryListSpec = ListSpec{
+	SortColumns: map[string]SortKind{"medication_time": SortTime, "created_at": SortInt},
+	DefaultSort: "-medication_time",
+	DateColumn:  "medication_time",
+	Statuses: map[string]bool{
+		"taken": true, string(DosePending): true, string(DoseOnTime): true, string(DoseLate): true,
+		string(DoseMissed): true, string(DoseSkipped): true,
+	},
+}
+
+// SortValue returns the value of the column a list of history is sorted by
+func (h *MedicationHistory) SortValue(column string) interface{} {
+	if column == "medication_time" {
+		return h.MedicationTime
+	}
+	return h.CreatedAt
+}
+
+// NewMedicationHistory returns the pending history of the next dose of the
+// medication
+func NewMedicationHistory(medication Medication, defaultGrace time.Duration) *MedicationHistory {
 	return &MedicationHistory{
 		MedicationName:         medication.Name,
 		MedicationID:           medication.ID,
-		MedicationDosage:       medication.Dosage,
+		MedicationDosage:       medication.DosageAt(medication.NextDosageTime),
+		Dose:                   medication.DoseAt(medication.NextDosageTime),
 		MedicationTime:         medication.NextDosageTime,
 		UserID:                 medication.UserID,
+		ProfileID:              medication.ProfileID,
 		HasMedicationBeenTaken: false,
+		Status:                 DosePending,
+		GraceEndsAt:            medication.NextDosageTime.Add(medication.MissedDoseGrace(defaultGrace)),
+		TimeZone:               medication.TimeZone,
 	}
 
 }
 
 type MedicationHistoryResponse struct {
-	ID                     uint   `json:"id"`
-	CreatedAt              string `json:"created_at"`
-	UpdatedAt              string `json:"updated_at"`
-	MedicationName         string `json:"medication_name"`
-	MedicationID           uint   `json:"medication_id"`
-	MedicationTime         string `json:"medication_time"`
-	MedicationDosage       int    `json:"medication_dosage"`
-	UserID                 uint   `json:"user_id"`
-	HasMedicationBeenTaken bool   `json:"has_medication_been_taken"`
-	WasMedicationMissed    string `json:"was_medication_missed"`
+	ID                     uint         `json:"id"`
+	CreatedAt              string       `json:"created_at"`
+	UpdatedAt              string       `json:"updated_at"`
+	DeletedAt              string       `json:"deleted_at,omitempty"`
+	MedicationName         string       `json:"medication_name"`
+	MedicationID           uint         `json:"medication_id"`
+	MedicationTime         string       `json:"medication_time"`
+	MedicationDosage       int          `json:"medication_dosage"`
+	Dose                   DoseQuantity `json:"dose"`
+	UserID                 uint         `json:"user_id"`
+	ProfileID              uint         `json:"profile_id,omitempty"`
+	HasMedicationBeenTaken bool         `json:"has_medication_been_taken"`
+	Status                 DoseStatus   `json:"status"`
+	TakenAt                string       `json:"taken_at,omitempty"`
 }
 
 func (m *MedicationHistory) MedicationHistoryToResponse() *MedicationHistoryResponse {
 	return &MedicationHistoryResponse{
 		ID:                     m.ID,
-		CreatedAt:              time.Unix(m.CreatedAt, 0).String(),
-		UpdatedAt:              time.Unix(m.UpdatedAt, 0).String(),
+		CreatedAt:              formatInTimeZone(time.Unix(m.CreatedAt, 0), m.TimeZone),
+		UpdatedAt:              formatInTimeZone(time.Unix(m.UpdatedAt, 0), m.TimeZone),
+		DeletedAt:              formatOptionalTime(m.DeletedAt.Time, m.TimeZone),
 		MedicationName:         m.MedicationName,
 		MedicationID:           m.MedicationID,
-		MedicationTime:         m.MedicationTime.UTC().String(),
+		MedicationTime:         formatInTimeZone(m.MedicationTime.UTC(), m.TimeZone),
 		MedicationDosage:       m.MedicationDosage,
+		Dose:                   m.EffectiveDose(),
 		UserID:                 m.UserID,
+		ProfileID:              m.ProfileID,
 		HasMedicationBeenTaken: m.HasMedicationBeenTaken,
-		WasMedicationMissed:    m.WasMedicationMissed,
+		Status:                 m.EffectiveStatus(),
+		TakenAt:                formatOptionalTime(m.TakenAt, m.TimeZone),
+	}
+}
+
+// EffectiveDose returns the dose taken, mapping histories recorded before
+// doses had units onto a quantity without unit
+func (m *MedicationHistory) EffectiveDose() DoseQuantity {
+	if m.Dose.IsZero() {
+		return legacyDose(m.MedicationDosage)
 	}
+	return m.Dose
 }
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// MedicationPhase is one step of a tapering or step-dose regimen. Phases run
+// one after the other from the start of the medication
+type MedicationPhase struct {
+	Model
+	MedicationID uint           `json:"medication_id" gorm:"index"`
+	Position     int            `json:"position"`
+	Dosage       int            `json:"dosage"`
+	Dose         DoseQuantity   `json:"dose" gorm:"embedded;embeddedPrefix:dose_"`
+	DurationDays int            `json:"duration_days"`
+	Schedule     DosageSchedule `json:"schedule" gorm:"embedded;embeddedPrefix:schedule_"`
+}
+
+type MedicationPhaseRequest struct {
+	Dosage       int             `json:"dosage"`
+	Dose         *DoseQuantity   `json:"dose"`
+	DurationDays int             `json:"duration_days" binding:"required"`
+	Schedule     *DosageSchedule `json:"schedule"`
+}
+
+type MedicationPhaseResponse struct {
+	Position     int            `json:"position"`
+	Dosage       int            `json:"dosage"`
+	Dose         DoseQuantity   `json:"dose"`
+	DurationDays int            `json:"duration_days"`
+	StartDate    string         `json:"start_date"`
+	EndDate      string         `json:"end_date"`
+	Schedule     DosageSchedule `json:"schedule"`
+}
+
+// ReqToMedicationPhases converts the phases of a request, validating the
+// schedule of each phase
+func ReqToMedicationPhases(requests []MedicationPhaseRequest) ([]MedicationPhase, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	phases := make([]MedicationPhase, 0, len(requests))
+	for i, request := range requests {
+		if (request.Dosage <= 0 && request.Dose == nil) || request.DurationDays <= 0 {
+			return nil, fmt.Errorf("phase %d: dosage and duration_days must be greater than zero", i+1)
+		}
+		phase := MedicationPhase{
+			Position:     i + 1,
+			Dosage:       request.Dosage,
+			DurationDays: request.DurationDays,
+		}
+		if request.Dose != nil {
+			if err := request.Dose.Validate(); err != nil {
+				return nil, fmt.Errorf("phase %d: %v", i+1, err)
+			}
+			phase.Dose = *request.Dose
+			phase.Dosage = int(math.Round(request.Dose.Amount))
+		}
+		if request.Schedule != nil {
+			if err := request.Schedule.Validate(); err != nil {
+				return nil, fmt.Errorf("phase %d: %v", i+1, err)
+			}
+			phase.Schedule = *request.Schedule
+		}
+		phases = append(phases, phase)
+	}
+	return phases, nil
+}
+
+// TotalPhaseDays returns the number of days covered by the phases
+func TotalPhaseDays(phases []MedicationPhase) int {
+	days := 0
+	for _, phase := range phases {
+		days += phase.DurationDays
+	}
+	return days
+}
+
+// phaseStart returns the midnight, in the time zone of the medication, the
+// phase at index starts on
+func (m *Medication) phaseStart(index int) time.Time {
+	start := m.MedicationStartTime.In(m.Location())
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	return day.AddDate(0, 0, TotalPhaseDays(m.Phases[:index]))
+}
+
+// PhaseIndexAt returns the index of the phase running at t, or -1 when the
+// medication has no phases or t is outside of them
+func (m *Medication) PhaseIndexAt(t time.Time) int {
+	if len(m.Phases) == 0 || t.Before(m.phaseStart(0)) {
+		return -1
+	}
+	for i := range m.Phases {
+		if t.Before(m.phaseStart(i + 1)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// PhaseBounds returns the start and the end of the phase at index
+func (m *Medication) PhaseBounds(index int) (time.Time, time.Time) {
+	return m.phaseStart(index), m.phaseStart(index + 1)
+}
+
+// PhaseSchedule returns the schedule of the phase at index, phases without a
+// schedule of their own follow the schedule of the medication
+func (m *Medication) PhaseSchedule(index int) DosageSchedule {
+	if index < 0 || index >= len(m.Phases) || m.Phases[index].Schedule.IsZero() {
+		return m.EffectiveSchedule()
+	}
+	return m.Phases[index].Schedule
+}
+
+// DosageAt returns the dose due at t, following the phase running then
+func (m *Medication) DosageAt(t time.Time) int {
+	if i := m.PhaseIndexAt(t); i >= 0 {
+		return m.Phases[i].Dosage
+	}
+	return m.Dosage
+}
+
+// DoseAt returns the dose due at t with its unit, following the phase running
+// then
+func (m *Medication) DoseAt(t time.Time) DoseQuantity {
+	if i := m.PhaseIndexAt(t); i >= 0 {
+		return m.Phases[i].EffectiveDose(m.EffectiveDose().Unit)
+	}
+	return m.EffectiveDose()
+}
+
+// EffectiveDose returns the dose of the phase, phases with only an integer
+// dosage take the unit of the medication
+func (p *MedicationPhase) EffectiveDose(unit DoseUnit) DoseQuantity {
+	if p.Dose.IsZero() {
+		return DoseQuantity{Amount: float64(p.Dosage), Unit: unit}
+	}
+	return p.Dose
+}
+
+func (m *Medication) phasesToResponse() []MedicationPhaseResponse {
+	if len(m.Phases) == 0 {
+		return nil
+	}
+	phases := make([]MedicationPhaseResponse, 0, len(m.Phases))
+	for i, phase := range m.Phases {
+		start, end := m.PhaseBounds(i)
+		phases = append(phases, MedicationPhaseResponse{
+			Position:     phase.Position,
+			Dosage:       phase.Dosage,
+			Dose:         phase.EffectiveDose(m.EffectiveDose().Unit),
+			DurationDays: phase.DurationDays,
+			StartDate:    formatInTimeZone(start, m.TimeZone),
+			EndDate:      formatInTimeZone(end, m.TimeZone),
+			Schedule:     m.PhaseSchedule(i),
+		})
+	}
+	return phases
+}
@@ -0,0 +1,13 @@
+package models
+
+// MedicationRefill records stock added to a medication
+type MedicationRefill struct {
+	Model
+	MedicationID uint    `json:"medication_id" gorm:"index"`
+	UserID       uint    `json:"user_id"`
+	Quantity     float64 `json:"quantity"`
+}
+
+type RefillRequest struct {
+	Quantity float64 `json:"quantity" binding:"required,gt=0"`
+}
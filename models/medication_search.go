@@ -0,0 +1,138 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// medicationStatusFilters are the values the status filter of the medication
+// lists accepts, done matches the medications that ended
+var medicationStatusFilters = map[string]bool{
+	string(MedicationActive):       true,
+	string(MedicationPaused):       true,
+	string(MedicationDiscontinued): true,
+	string(MedicationCompleted):    true,
+	"done":                         true,
+}
+
+var medicationSortColumns = map[string]SortKind{
+	"name":                  SortString,
+	"medication_start_date": SortTime,
+	"medication_stop_date":  SortTime,
+	"next_dosage_time":      SortTime,
+	"created_at":            SortInt,
+}
+
+var (
+	MedicationListSpec = ListSpec{
+		SortColumns: medicationSortColumns,
+		DefaultSort: "-created_at",
+		DateColumn:  "medication_start_date",
+		Statuses:    medicationStatusFilters,
+	}
+	NextMedicationListSpec = ListSpec{
+		SortColumns: medicationSortColumns,
+		DefaultSort: "next_dosage_time",
+		DateColumn:  "next_dosage_time",
+	}
+	ArchivedMedicationListSpec = ListSpec{
+		SortColumns: map[string]SortKind{"name": SortString, "deleted_at": SortTime},
+		DefaultSort: "-deleted_at",
+		DateColumn:  "deleted_at",
+	}
+	MedicationSearchListSpec = ListSpec{
+		SortColumns: medicationSortColumns,
+		DefaultSort: "-created_at",
+		Statuses:    medicationStatusFilters,
+	}
+)
+
+// SortValue returns the value of the column a list of medications is sorted by
+func (m *Medication) SortValue(column string) interface{} {
+	switch column {
+	case "name":
+		return m.Name
+	case "medication_start_date":
+		return m.MedicationStartDate
+	case "medication_stop_date":
+		return m.MedicationStopDate
+	case "next_dosage_time":
+		return m.NextDosageTime
+	case "deleted_at":
+		return m.DeletedAt.Time
+	default:
+		return m.CreatedAt
+	}
+}
+
+// MedicationSearchQuery is the query string of a medication search, every
+// filter set must match. Text filters are case insensitive and match anywhere
+// in the field, dates are RFC3339 and ranges include their bounds
+type MedicationSearchQuery struct {
+	PageQuery
+	Name                   string `form:"name"`
+	MedicationPrescribedBy string `form:"medication_prescribed_by"`
+	PurposeOfMedication    string `form:"purpose_of_medication"`
+	Dosage                 int    `form:"dosage" binding:"omitempty,gte=1"`
+	Duration               int    `form:"duration" binding:"omitempty,gte=1"`
+	StartFrom              string `form:"start_from"`
+	StartTo                string `form:"start_to"`
+	StopFrom               string `form:"stop_from"`
+	StopTo                 string `form:"stop_to"`
+}
+
+// MedicationFilter is a validated medication search the repository runs
+type MedicationFilter struct {
+	UserID                 uint
+	Name                   string
+	MedicationPrescribedBy string
+	PurposeOfMedication    string
+	Dosage                 int
+	Duration               int
+	StartFrom              time.Time
+	StartTo                time.Time
+	StopFrom               time.Time
+	StopTo                 time.Time
+	Page                   *Page
+}
+
+// ToFilter validates the query and turns it into the filter of the
+// medications of userID
+func (q *MedicationSearchQuery) ToFilter(userID uint) (*MedicationFilter, error) {
+	page, err := q.PageQuery.ToPage(MedicationSearchListSpec)
+	if err != nil {
+		return nil, err
+	}
+	filter := &MedicationFilter{
+		UserID:                 userID,
+		Name:                   strings.TrimSpace(q.Name),
+		MedicationPrescribedBy: strings.TrimSpace(q.MedicationPrescribedBy),
+		PurposeOfMedication:    strings.TrimSpace(q.PurposeOfMedication),
+		Dosage:                 q.Dosage,
+		Duration:               q.Duration,
+		Page:                   page,
+	}
+	bounds := []struct {
+		name  string
+		value string
+		into  *time.Time
+	}{
+		{"start_from", q.StartFrom, &filter.StartFrom},
+		{"start_to", q.StartTo, &filter.StartTo},
+		{"stop_from", q.StopFrom, &filter.StopFrom},
+		{"stop_to", q.StopTo, &filter.StopTo},
+	}
+	for _, bound := range bounds {
+		if *bound.into, err = parseOptionalDate(bound.name, bound.value); err != nil {
+			return nil, err
+		}
+	}
+	if !filter.StartFrom.IsZero() && !filter.StartTo.IsZero() && filter.StartTo.Before(filter.StartFrom) {
+		return nil, fmt.Errorf("start_to is before start_from")
+	}
+	if !filter.StopFrom.IsZero() && !filter.StopTo.IsZero() && filter.StopTo.Before(filter.StopFrom) {
+		return nil, fmt.Errorf("stop_to is before stop_from")
+	}
+	return filter, nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+type MedicationStatus string
+
+const (
+	MedicationActive       MedicationStatus = "active"
+	MedicationPaused       MedicationStatus = "paused"
+	MedicationDiscontinued MedicationStatus = "discontinued"
+	MedicationCompleted    MedicationStatus = "completed"
+)
+
+// medicationTransitions lists the statuses a medication can move to from each status
+var medicationTransitions = map[MedicationStatus][]MedicationStatus{
+	MedicationActive: {MedicationPaused, MedicationDiscontinued, MedicationCompleted},
+	MedicationPaused: {MedicationActive, MedicationDiscontinued},
+}
+
+type ResumeMedicationRequest struct {
+	ExtendStopDate bool `json:"extend_stop_date"`
+}
+
+type DiscontinueMedicationRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// EffectiveStatus returns the status of the medication, medications created
+// before statuses existed are active until they are done
+func (m *Medication) EffectiveStatus() MedicationStatus {
+	if m.IsMedicationDone && (m.Status == "" || m.Status == MedicationActive) {
+		return MedicationCompleted
+	}
+	if m.Status == "" {
+		return MedicationActive
+	}
+	return m.Status
+}
+
+// TransitionTo moves the medication to status at t, failing when the current
+// status can't move there
+func (m *Medication) TransitionTo(status MedicationStatus, t time.Time) error {
+	current := m.EffectiveStatus()
+	allowed := false
+	for _, next := range medicationTransitions[current] {
+		allowed = allowed || next == status
+	}
+	if !allowed {
+		return fmt.Errorf("a %s medication can't be %s", current, status)
+	}
+
+	m.Status = status
+	switch status {
+	case MedicationPaused:
+		m.PausedAt = t
+	case MedicationDiscontinued:
+		m.DiscontinuedAt = t
+	case MedicationCompleted:
+		m.IsMedicationDone = true
+	}
+	return nil
+}
@@ -1,8 +1,19 @@
 package models
 
+import "gorm.io/gorm"
+
 type Model struct {
 	ID        uint  `json:"id" gorm:"primaryKey,autoIncrement"`
 	CreatedAt int64 `json:"created_at"`
 	UpdatedAt int64 `json:"updated_at"`
 	DeletedAt int64 `json:"deleted_at"`
 }
+
+// SoftDeleteModel is a Model whose rows are soft deleted, GORM leaves rows
+// with a deleted_at out of every query that isn't Unscoped
+type SoftDeleteModel struct {
+	ID        uint           `json:"id" gorm:"primaryKey,autoIncrement"`
+	CreatedAt int64          `json:"created_at"`
+	UpdatedAt int64          `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+}
@@ -1,13 +1,10 @@
 package models
 
-type FacebookUser struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
-}
-
-type GoogleUser struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+// ExternalIdentity is who an identity provider says signed in with it
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string // the ID of the user at the provider, it never changes
+	Email         string
+	EmailVerified bool
+	Name          string
 }
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// TokenPurpose is what a one-time token was issued for, a token is only
+// accepted for its purpose
+type TokenPurpose string
+
+const (
+	PurposeEmailVerification TokenPurpose = "email_verification"
+	PurposePasswordReset     TokenPurpose = "password_reset"
+	PurposeEmailChange       TokenPurpose = "email_change"
+	PurposeCaregiverInvite   TokenPurpose = "caregiver_invite"
+)
+
+// Validity is how long the tokens of the purpose last
+func (p TokenPurpose) Validity() time.Duration {
+	switch p {
+	case PurposePasswordReset:
+		return time.Hour
+	case PurposeCaregiverInvite:
+		return time.Hour * 24 * 7
+	default:
+		return time.Hour * 24
+	}
+}
+
+// OneTimeToken is the token of an emailed link, only its hash is stored and
+// it can be used once
+type OneTimeToken struct {
+	Model
+	UserID    uint         `json:"user_id" gorm:"index"` // who the token was issued to, the patient for caregiver invites
+	Purpose   TokenPurpose `json:"purpose"`
+	TokenHash string       `json:"-" gorm:"uniqueIndex"`
+	Data      string       `json:"-"` // what the token is about, the new email of an email change or the invitation of a caregiver invite
+	ExpiresAt int64        `json:"expires_at"`
+	UsedAt    int64        `json:"used_at"` // 0 until the token is used
+	User      *User        `json:"-"`
+}
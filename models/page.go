@@ -0,0 +1,192 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 100
+)
+
+// SortKind is the type of the column a list is sorted by, cursors keep the
+// value of that column
+type SortKind int
+
+const (
+	SortString SortKind = iota
+	SortTime
+	SortInt
+)
+
+// ListSpec describes what a list endpoint can be filtered and sorted by
+type ListSpec struct {
+	SortColumns map[string]SortKind
+	DefaultSort string          // column, prefixed with - for descending order
+	DateColumn  string          // column the from and to filters apply to
+	Statuses    map[string]bool // accepted values of the status filter
+}
+
+// PageQuery is the query string of a paginated list endpoint
+type PageQuery struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,gte=1"`
+	Sort   string `form:"sort"`
+	From   string `form:"from"`
+	To     string `form:"to"`
+	Status string `form:"status"`
+	// ProfileID is the dependent selected with the profile_id of the request, 0
+	// for the user themselves
+	ProfileID uint `form:"-"`
+}
+
+// Page is a validated PageQuery the repositories run
+type Page struct {
+	Limit          int
+	SortColumn     string
+	SortKind       SortKind
+	SortDescending bool
+	DateColumn     string
+	From           time.Time
+	To             time.Time
+	Status         string
+	ProfileID      uint
+	After          *Cursor // nil on the first page
+}
+
+// Cursor is the position of the last row of a page: the value of the sort
+// column and the id breaking ties
+type Cursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"id"`
+}
+
+// PageMeta is the pagination metadata of a list response
+type PageMeta struct {
+	Limit      int    `json:"limit"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+// ToPage validates the query against what the list supports
+func (q *PageQuery) ToPage(spec ListSpec) (*Page, error) {
+	sort := q.Sort
+	if sort == "" {
+		sort = spec.DefaultSort
+	}
+	column := strings.TrimPrefix(sort, "-")
+	kind, ok := spec.SortColumns[column]
+	if !ok {
+		return nil, fmt.Errorf("can't sort by %s", column)
+	}
+	page := &Page{
+		Limit:          q.Limit,
+		SortColumn:     column,
+		SortKind:       kind,
+		SortDescending: strings.HasPrefix(sort, "-"),
+		DateColumn:     spec.DateColumn,
+		Status:         q.Status,
+		ProfileID:      q.ProfileID,
+	}
+	if page.Limit == 0 {
+		page.Limit = DefaultPageLimit
+	}
+	if page.Limit > MaxPageLimit {
+		page.Limit = MaxPageLimit
+	}
+	if q.Status != "" && !spec.Statuses[q.Status] {
+		return nil, fmt.Errorf("invalid status: %s", q.Status)
+	}
+	if q.From != "" || q.To != "" {
+		if spec.DateColumn == "" {
+			return nil, fmt.Errorf("this list can't be filtered by date")
+		}
+		var err error
+		if page.From, err = parseOptionalDate("from", q.From); err != nil {
+			return nil, err
+		}
+		if page.To, err = parseOptionalDate("to", q.To); err != nil {
+			return nil, err
+		}
+		if !page.From.IsZero() && !page.To.IsZero() && page.To.Before(page.From) {
+			return nil, fmt.Errorf("to is before from")
+		}
+	}
+	if q.Cursor != "" {
+		cursor, err := decodeCursor(q.Cursor)
+		if err != nil || cursor.Sort != sort {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		page.After = cursor
+	}
+	return page, nil
+}
+
+// CursorValue returns the sort value kept in the cursor in the type of the
+// sort column
+func (p *Page) CursorValue() (interface{}, error) {
+	switch p.SortKind {
+	case SortTime:
+		var t time.Time
+		err := json.Unmarshal(p.After.Value, &t)
+		return t, err
+	case SortInt:
+		var i int64
+		err := json.Unmarshal(p.After.Value, &i)
+		return i, err
+	default:
+		var s string
+		err := json.Unmarshal(p.After.Value, &s)
+		return s, err
+	}
+}
+
+// Meta returns the metadata of a page of rows. rows is the number of rows
+// fetched, one more than the limit when there's a next page, and last the sort
+// value and id of the last row of the page
+func (p *Page) Meta(rows int, lastValue interface{}, lastID uint) *PageMeta {
+	meta := &PageMeta{Limit: p.Limit, HasMore: rows > p.Limit}
+	if meta.HasMore {
+		sort := p.SortColumn
+		if p.SortDescending {
+			sort = "-" + sort
+		}
+		value, _ := json.Marshal(lastValue)
+		meta.NextCursor = encodeCursor(&Cursor{Sort: sort, Value: value, ID: lastID})
+	}
+	return meta
+}
+
+func encodeCursor(cursor *Cursor) string {
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+func parseOptionalDate(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC3339 date", name)
+	}
+	return t, nil
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// Profile is a dependent, a child say, whose medications the user tracks
+// without them having a login. Medications and history with a ProfileID of 0
+// are for the user themselves
+type Profile struct {
+	Model
+	UserID      uint      `json:"user_id" gorm:"index"`
+	Name        string    `json:"name"`
+	DateOfBirth time.Time `json:"date_of_birth"`
+	WeightKg    *float64  `json:"weight_kg"` // nil when not known
+}
+
+type CreateProfileRequest struct {
+	Name        string   `json:"name" binding:"required,min=2"`
+	DateOfBirth string   `json:"date_of_birth" binding:"required"` // 2006-01-02
+	WeightKg    *float64 `json:"weight_kg" binding:"omitempty,gt=0,lte=500"`
+}
+
+type UpdateProfileRequest struct {
+	Name        string   `json:"name" binding:"omitempty,min=2"`
+	DateOfBirth string   `json:"date_of_birth"`
+	WeightKg    *float64 `json:"weight_kg" binding:"omitempty,gt=0,lte=500"`
+}
+
+type ProfileResponse struct {
+	ID          uint     `json:"id"`
+	CreatedAt   string   `json:"created_at"`
+	Name        string   `json:"name"`
+	DateOfBirth string   `json:"date_of_birth"`
+	Age         int      `json:"age"`
+	WeightKg    *float64 `json:"weight_kg,omitempty"`
+}
+
+// NewProfile returns the profile of the request for the user
+func NewProfile(userID uint, request *CreateProfileRequest, now time.Time) (*Profile, error) {
+	dateOfBirth, err := parseDateOfBirth(request.DateOfBirth, now)
+	if err != nil {
+		return nil, err
+	}
+	return &Profile{
+		UserID:      userID,
+		Name:        request.Name,
+		DateOfBirth: dateOfBirth,
+		WeightKg:    request.WeightKg,
+	}, nil
+}
+
+// Apply changes what the request sets
+func (p *Profile) Apply(request *UpdateProfileRequest, now time.Time) error {
+	if request.DateOfBirth != "" {
+		dateOfBirth, err := parseDateOfBirth(request.DateOfBirth, now)
+		if err != nil {
+			return err
+		}
+		p.DateOfBirth = dateOfBirth
+	}
+	if request.Name != "" {
+		p.Name = request.Name
+	}
+	if request.WeightKg != nil {
+		p.WeightKg = request.WeightKg
+	}
+	return nil
+}
+
+// AgeAt returns the age in full years of the dependent at t
+func (p *Profile) AgeAt(t time.Time) int {
+	age := t.Year() - p.DateOfBirth.Year()
+	if t.Month() < p.DateOfBirth.Month() || (t.Month() == p.DateOfBirth.Month() && t.Day() < p.DateOfBirth.Day()) {
+		age--
+	}
+	return age
+}
+
+func (p *Profile) ToResponse() *ProfileResponse {
+	return &ProfileResponse{
+		ID:          p.ID,
+		CreatedAt:   time.Unix(p.CreatedAt, 0).UTC().Format(time.RFC3339),
+		Name:        p.Name,
+		DateOfBirth: p.DateOfBirth.Format(dateLayout),
+		Age:         p.AgeAt(time.Now()),
+		WeightKg:    p.WeightKg,
+	}
+}
+
+// ProfilesToResponse returns the responses of the profiles, empty rather than
+// nil without profiles
+func ProfilesToResponse(profiles []Profile) []ProfileResponse {
+	responses := make([]ProfileResponse, 0, len(profiles))
+	for i := range profiles {
+		responses = append(responses, *profiles[i].ToResponse())
+	}
+	return responses
+}
+
+func parseDateOfBirth(value string, now time.Time) (time.Time, error) {
+	dateOfBirth, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date_of_birth must be a date like 2016-04-30")
+	}
+	if dateOfBirth.After(now) {
+		return time.Time{}, fmt.Errorf("date_of_birth is in the future")
+	}
+	return dateOfBirth, nil
+}
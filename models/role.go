@@ -0,0 +1,37 @@
+package models
+
+// Role is what a user is to the app, it decides what they may do beyond their
+// own account
+type Role string
+
+const (
+	RolePatient   Role = "patient"
+	RoleCaregiver Role = "caregiver"
+	RoleClinician Role = "clinician"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission is something a route needs the role of the user to allow
+type Permission string
+
+const (
+	PermissionReadUsers   Permission = "users:read"
+	PermissionManageUsers Permission = "users:manage"
+)
+
+// rolePermissions are the permissions of each role on top of what every user
+// may do with their own account. Caregivers and clinicians reach the patients
+// who invited them through their caregiver links
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {PermissionReadUsers, PermissionManageUsers},
+}
+
+// Can reports whether the role allows the permission
+func (r Role) Can(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
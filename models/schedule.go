@@ -0,0 +1,192 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ScheduleKind string
+
+const (
+	ScheduleInterval   ScheduleKind = "interval"     // every IntervalHours hours
+	ScheduleDaily      ScheduleKind = "daily"        // TimesOfDay every day
+	ScheduleWeekly     ScheduleKind = "weekly"       // TimesOfDay on the Weekdays
+	ScheduleEveryNDays ScheduleKind = "every_n_days" // TimesOfDay every EveryNDays days
+	ScheduleCyclic     ScheduleKind = "cyclic"       // TimesOfDay for CycleDaysOn days then a CycleDaysOff break
+	ScheduleAsNeeded   ScheduleKind = "as_needed"    // PRN, at most MaxDosesPerDay doses a day
+)
+
+const (
+	MealTimingBefore = "before_meal"
+	MealTimingWith   = "with_meal"
+	MealTimingAfter  = "after_meal"
+)
+
+// DefaultMealTimes are used as the times of day of a meal bound schedule
+// that doesn't list its own times
+var DefaultMealTimes = TimesOfDay{"08:00", "13:00", "19:00"}
+
+// DosageSchedule describes when the doses of a medication are due
+type DosageSchedule struct {
+	Kind           ScheduleKind `json:"kind"`
+	IntervalHours  int          `json:"interval_hours,omitempty"`
+	TimesOfDay     TimesOfDay   `json:"times_of_day,omitempty"`
+	Weekdays       Weekdays     `json:"weekdays,omitempty"`
+	EveryNDays     int          `json:"every_n_days,omitempty"`
+	CycleDaysOn    int          `json:"cycle_days_on,omitempty"`
+	CycleDaysOff   int          `json:"cycle_days_off,omitempty"`
+	MaxDosesPerDay int          `json:"max_doses_per_day,omitempty"`
+	MealTiming     string       `json:"meal_timing,omitempty"`
+}
+
+// IsZero reports whether no schedule was set
+func (s DosageSchedule) IsZero() bool {
+	return s.Kind == ""
+}
+
+// Times returns the sorted times of day of the schedule, falling back to the
+// default meal times for meal bound schedules
+func (s DosageSchedule) Times() TimesOfDay {
+	times := s.TimesOfDay
+	if len(times) == 0 && s.MealTiming != "" {
+		times = DefaultMealTimes
+	}
+	sorted := append(TimesOfDay{}, times...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Validate checks that the fields required by the schedule kind are set
+func (s DosageSchedule) Validate() error {
+	switch s.MealTiming {
+	case "", MealTimingBefore, MealTimingWith, MealTimingAfter:
+	default:
+		return fmt.Errorf("invalid meal timing: %s", s.MealTiming)
+	}
+	for _, t := range s.TimesOfDay {
+		if _, _, err := ParseClock(t); err != nil {
+			return err
+		}
+	}
+
+	needsTimes := func() error {
+		if len(s.Times()) == 0 {
+			return fmt.Errorf("times_of_day is required for a %s schedule", s.Kind)
+		}
+		return nil
+	}
+	switch s.Kind {
+	case ScheduleInterval:
+		if s.IntervalHours <= 0 {
+			return fmt.Errorf("interval_hours must be greater than zero")
+		}
+	case ScheduleDaily:
+		return needsTimes()
+	case ScheduleWeekly:
+		if s.Weekdays == 0 {
+			return fmt.Errorf("weekdays is required for a weekly schedule")
+		}
+		return needsTimes()
+	case ScheduleEveryNDays:
+		if s.EveryNDays <= 0 {
+			return fmt.Errorf("every_n_days must be greater than zero")
+		}
+		return needsTimes()
+	case ScheduleCyclic:
+		if s.CycleDaysOn <= 0 || s.CycleDaysOff < 0 {
+			return fmt.Errorf("cycle_days_on must be greater than zero")
+		}
+		return needsTimes()
+	case ScheduleAsNeeded:
+		if s.MaxDosesPerDay < 0 {
+			return fmt.Errorf("max_doses_per_day can't be negative")
+		}
+	default:
+		return fmt.Errorf("invalid schedule kind: %s", s.Kind)
+	}
+	return nil
+}
+
+// ParseClock parses a "HH:MM" time of day
+func ParseClock(clock string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time of day %q, expected HH:MM", clock)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// TimesOfDay is a list of "HH:MM" clock times stored as a comma separated column
+type TimesOfDay []string
+
+func (t TimesOfDay) Value() (driver.Value, error) {
+	return strings.Join(t, ","), nil
+}
+
+func (t *TimesOfDay) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into TimesOfDay", value)
+	}
+	*t = nil
+	if s != "" {
+		*t = strings.Split(s, ",")
+	}
+	return nil
+}
+
+func (TimesOfDay) GormDataType() string {
+	return "text"
+}
+
+// Weekdays is a bit mask of days of the week, bit 0 being Sunday
+type Weekdays uint8
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Has reports whether day is part of the mask
+func (w Weekdays) Has(day time.Weekday) bool {
+	return w&(1<<uint(day)) != 0
+}
+
+func (w Weekdays) MarshalJSON() ([]byte, error) {
+	days := []string{}
+	for i, name := range weekdayNames {
+		if w.Has(time.Weekday(i)) {
+			days = append(days, name)
+		}
+	}
+	return json.Marshal(days)
+}
+
+func (w *Weekdays) UnmarshalJSON(data []byte) error {
+	var days []string
+	if err := json.Unmarshal(data, &days); err != nil {
+		return fmt.Errorf("weekdays must be a list of days: %v", err)
+	}
+	*w = 0
+	for _, day := range days {
+		found := false
+		for i, name := range weekdayNames {
+			if strings.HasPrefix(strings.ToLower(day), name) {
+				*w |= 1 << uint(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("invalid weekday: %s", day)
+		}
+	}
+	return nil
+}
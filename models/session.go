@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// Session is a login of a user on a device. The client keeps it alive by
+// trading its refresh token for a new pair of tokens before ExpiresAt
+type Session struct {
+	Model
+	UserID     uint   `json:"user_id" gorm:"index"`
+	Device     string `json:"device"`
+	IP         string `json:"ip"`
+	LastSeenAt int64  `json:"last_seen_at"`
+	ExpiresAt  int64  `json:"expires_at"`
+	RevokedAt  int64  `json:"revoked_at"` // 0 while the session is not revoked
+	Email      string `json:"-" gorm:"->;-:migration"`
+}
+
+// RefreshToken is a refresh token of a session, only its hash is stored.
+// Every refresh uses the token up and gives the session a new one, so a used
+// token coming back means it leaked
+type RefreshToken struct {
+	Model
+	SessionID uint     `json:"session_id" gorm:"index"`
+	TokenHash string   `json:"-" gorm:"uniqueIndex"`
+	UsedAt    int64    `json:"used_at"` // 0 while the token is the current one
+	Session   *Session `json:"-"`
+}
+
+// SessionClient is the device and address a session is used from
+type SessionClient struct {
+	Device string
+	IP     string
+}
+
+type RefreshRequest struct {
+	RefreshToken string        `json:"refresh_token" binding:"required"`
+	Client       SessionClient `json:"-"`
+}
+
+// TokenPair is what a client authenticates with, the access token until it
+// expires then the refresh token to get a new pair
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // seconds the access token is valid for
+}
+
+type SessionResponse struct {
+	ID         uint   `json:"id"`
+	Device     string `json:"device"`
+	IP         string `json:"ip"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	Current    bool   `json:"current"` // the session of the request
+}
+
+// Active reports whether the session can still be used at now
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == 0 && s.ExpiresAt > now.Unix()
+}
+
+func (s *Session) ToResponse(currentSessionID uint) SessionResponse {
+	return SessionResponse{
+		ID:         s.ID,
+		Device:     s.Device,
+		IP:         s.IP,
+		CreatedAt:  time.Unix(s.CreatedAt, 0).UTC().Format(time.RFC3339),
+		LastSeenAt: time.Unix(s.LastSeenAt, 0).UTC().Format(time.RFC3339),
+		Current:    s.ID == currentSessionID,
+	}
+}
+
+func SessionsToResponse(sessions []Session, currentSessionID uint) []SessionResponse {
+	responses := make([]SessionResponse, 0, len(sessions))
+	for i := range sessions {
+		responses = append(responses, sessions[i].ToResponse(currentSessionID))
+	}
+	return responses
+}
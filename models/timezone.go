@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// DefaultTimeZone is used for users that haven't set a time zone
+const DefaultTimeZone = "UTC"
+
+// LoadLocation returns the location of an IANA time zone name, falling back
+// to UTC when the name is empty or unknown
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// formatInTimeZone renders t in the given time zone, leaving it untouched
+// when no time zone is known
+func formatInTimeZone(t time.Time, timeZone string) string {
+	if timeZone == "" {
+		return t.String()
+	}
+	return t.In(LoadLocation(timeZone)).String()
+}
+
+// formatOptionalTime renders t like formatInTimeZone, or nothing when t is zero
+func formatOptionalTime(t time.Time, timeZone string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return formatInTimeZone(t, timeZone)
+}
@@ -0,0 +1,50 @@
+package models
+
+// TwoFactor is the authenticator app of a user. Secret is set from the start
+// of the enrolment, Enabled once the user confirmed it with a code
+type TwoFactor struct {
+	Enabled  bool   `json:"-"`
+	Secret   string `json:"-"`
+	LastStep int64  `json:"-"` // period of the last code used, a code works once
+}
+
+// RecoveryCode is a one-time code to sign in with when the authenticator app is
+// lost, only its hash is stored
+type RecoveryCode struct {
+	Model
+	UserID   uint   `json:"user_id" gorm:"index"`
+	CodeHash string `json:"-" gorm:"index"`
+	UsedAt   int64  `json:"used_at"` // 0 while the code is unused
+}
+
+// TwoFactorChallenge is what the login answers instead of tokens for users with
+// two-factor authentication, the challenge token is traded with a code for them
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int64  `json:"expires_in"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string        `json:"challenge_token" binding:"required"`
+	Code           string        `json:"code" binding:"required"` // from the app or a recovery code
+	Client         SessionClient `json:"-"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorEnrolmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorStatusResponse struct {
+	Enabled           bool  `json:"enabled"`
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	goval "github.com/go-passwd/validator"
 	"github.com/go-playground/locales/en"
@@ -15,14 +16,30 @@ import (
 
 type User struct {
 	Model
-	Name           string `json:"name" binding:"required,min=2"`
-	Email          string `json:"email" gorm:"unique;not null" binding:"required,email"`
-	PhoneNumber    string `json:"phone_number" gorm:"unique;default:null" binding:"required,e164"`
-	Password       string `json:"password,omitempty" gorm:"-" binding:"required,min=8,max=15"`
-	HashedPassword string `json:"-" gorm:"password"`
-	IsEmailActive  bool   `json:"-"`
-	Social         string `json:"-"`
-	AccessToken    string `json:"-"`
+	Name                  string                  `json:"name" binding:"required,min=2"`
+	Email                 string                  `json:"email" gorm:"unique;not null" binding:"required,email"`
+	PhoneNumber           string                  `json:"phone_number" gorm:"unique;default:null" binding:"required,e164"`
+	Password              string                  `json:"password,omitempty" gorm:"-" binding:"required,min=8,max=15"`
+	HashedPassword        string                  `json:"-" gorm:"password"`
+	TimeZone              string                  `json:"time_zone" gorm:"default:UTC" binding:"omitempty,timezone"`
+	Locale                string                  `json:"locale" gorm:"default:en" binding:"omitempty,bcp47_language_tag"`
+	IsEmailActive         bool                    `json:"-"`
+	Role                  Role                    `json:"-" gorm:"default:patient;index"`
+	DeactivatedAt         int64                   `json:"-"` // set while an admin keeps the user from signing in
+	PasswordResetRequired bool                    `json:"-"` // keeps the user from signing in with their password until they reset it
+	PendingEmail          string                  `json:"-"` // the address the user is changing their email to, until they verify it
+	Social                string                  `json:"-"`
+	AccessToken           string                  `json:"-"`
+	Digest                DigestSettings          `json:"-" gorm:"embedded;embeddedPrefix:digest_"`
+	TwoFactor             TwoFactor               `json:"-" gorm:"embedded;embeddedPrefix:two_factor_"`
+	Notifications         NotificationPreferences `json:"-" gorm:"embedded;embeddedPrefix:notify_"`
+}
+
+// NotificationPreferences says which reminders the user gets, all of them
+// until the user turns some off
+type NotificationPreferences struct {
+	DoseRemindersOff   bool `json:"-"`
+	RefillRemindersOff bool `json:"-"`
 }
 
 func ValidateStruct(req interface{}) []error {
@@ -65,12 +82,55 @@ type UserResponse struct {
 	Name        string `json:"name"`
 	PhoneNumber string `json:"phone_number"`
 	Email       string `json:"email"`
+	TimeZone    string `json:"time_zone"`
 }
 
-type LoginRequest struct {
+// UserProfileResponse is everything the user can see and change of their account
+type UserProfileResponse struct {
+	UserResponse
+	Locale           string                          `json:"locale"`
+	PendingEmail     string                          `json:"pending_email,omitempty"`
+	EmailVerified    bool                            `json:"email_verified"`
+	TwoFactorEnabled bool                            `json:"two_factor_enabled"`
+	Notifications    NotificationPreferencesResponse `json:"notifications"`
+	CreatedAt        int64                           `json:"created_at"`
+}
+
+type NotificationPreferencesResponse struct {
+	DoseReminders   bool `json:"dose_reminders"`
+	RefillReminders bool `json:"refill_reminders"`
+}
+
+// UpdateUserRequest changes the fields it sets and leaves the others
+type UpdateUserRequest struct {
+	Name          string                                `json:"name" binding:"omitempty,min=2"`
+	PhoneNumber   string                                `json:"phone_number" binding:"omitempty,e164"`
+	TimeZone      string                                `json:"time_zone" binding:"omitempty,timezone"`
+	Locale        string                                `json:"locale" binding:"omitempty,bcp47_language_tag"`
+	Notifications *UpdateNotificationPreferencesRequest `json:"notifications"`
+}
+
+type UpdateNotificationPreferencesRequest struct {
+	DoseReminders   *bool `json:"dose_reminders"`
+	RefillReminders *bool `json:"refill_reminders"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+	ConfirmPassword string `json:"confirm_password" binding:"required"`
+}
+
+type ChangeEmailRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
 }
+
+type LoginRequest struct {
+	Email    string        `json:"email" binding:"required,email"`
+	Password string        `json:"password" binding:"required"`
+	Client   SessionClient `json:"-"`
+}
 type ForgotPassword struct {
 	Email string `json:"email" binding:"required,email"`
 }
@@ -91,7 +151,68 @@ type GoogleAuthResponse struct {
 
 type LoginResponse struct {
 	UserResponse
-	AccessToken string
+	AccessToken  string
+	RefreshToken string              `json:"refresh_token"`
+	ExpiresIn    int64               `json:"expires_in"`
+	Challenge    *TwoFactorChallenge `json:"-"` // set instead of the tokens when a code is needed
+}
+
+func (u *User) Deactivated() bool {
+	return u.DeactivatedAt > 0
+}
+
+// Location returns the time zone of the user
+func (u *User) Location() *time.Location {
+	return LoadLocation(u.TimeZone)
+}
+
+// Apply changes the fields set in the request
+func (u *User) Apply(request *UpdateUserRequest) {
+	if request.Name != "" {
+		u.Name = request.Name
+	}
+	if request.PhoneNumber != "" {
+		u.PhoneNumber = request.PhoneNumber
+	}
+	if request.TimeZone != "" {
+		u.TimeZone = request.TimeZone
+	}
+	if request.Locale != "" {
+		u.Locale = request.Locale
+	}
+	if preferences := request.Notifications; preferences != nil {
+		if preferences.DoseReminders != nil {
+			u.Notifications.DoseRemindersOff = !*preferences.DoseReminders
+		}
+		if preferences.RefillReminders != nil {
+			u.Notifications.RefillRemindersOff = !*preferences.RefillReminders
+		}
+	}
+}
+
+func (u *User) ToResponse() *UserResponse {
+	return &UserResponse{
+		ID:          u.ID,
+		Name:        u.Name,
+		PhoneNumber: u.PhoneNumber,
+		Email:       u.Email,
+		TimeZone:    u.TimeZone,
+	}
+}
+
+func (u *User) ToProfileResponse() *UserProfileResponse {
+	return &UserProfileResponse{
+		UserResponse:     *u.ToResponse(),
+		Locale:           u.Locale,
+		PendingEmail:     u.PendingEmail,
+		EmailVerified:    u.IsEmailActive,
+		TwoFactorEnabled: u.TwoFactor.Enabled,
+		Notifications: NotificationPreferencesResponse{
+			DoseReminders:   !u.Notifications.DoseRemindersOff,
+			RefillReminders: !u.Notifications.RefillRemindersOff,
+		},
+		CreatedAt: u.CreatedAt,
+	}
 }
 
 // VerifyPassword verifies the collected password with the user's hashed password
@@ -100,14 +221,11 @@ func (u *User) VerifyPassword(password string) error {
 }
 
 // LoginUserToDto responsible for creating a response object for the handleLogin handler
-func (u *User) LoginUserToDto(token string) *LoginResponse {
+func (u *User) LoginUserToDto(tokens *TokenPair) *LoginResponse {
 	return &LoginResponse{
-		UserResponse: UserResponse{
-			ID:          u.ID,
-			Name:        u.Name,
-			PhoneNumber: u.PhoneNumber,
-			Email:       u.Email,
-		},
-		AccessToken: token,
+		UserResponse: *u.ToResponse(),
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
 	}
 }
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// UserIdentity is an account of an identity provider the user signs in with,
+// a user has at most one per provider
+type UserIdentity struct {
+	Model
+	UserID   uint   `json:"user_id" gorm:"uniqueIndex:idx_user_identities_user_provider"`
+	Provider string `json:"provider" gorm:"uniqueIndex:idx_user_identities_provider_subject;uniqueIndex:idx_user_identities_user_provider"`
+	Subject  string `json:"-" gorm:"uniqueIndex:idx_user_identities_provider_subject"`
+	Email    string `json:"email"` // the email the provider had when the identity was linked
+	User     *User  `json:"-"`
+}
+
+type UserIdentityResponse struct {
+	Provider string `json:"provider"`
+	Email    string `json:"email,omitempty"`
+	LinkedAt string `json:"linked_at"`
+}
+
+// LinkIdentityResponse is the page of the provider the user goes to, to link
+// their account there
+type LinkIdentityResponse struct {
+	URL string `json:"url"`
+}
+
+func (i *UserIdentity) ToResponse() UserIdentityResponse {
+	return UserIdentityResponse{
+		Provider: i.Provider,
+		Email:    i.Email,
+		LinkedAt: time.Unix(i.CreatedAt, 0).UTC().Format(time.RFC3339),
+	}
+}
+
+func UserIdentitiesToResponse(identities []UserIdentity) []UserIdentityResponse {
+	responses := make([]UserIdentityResponse, 0, len(identities))
+	for i := range identities {
+		responses = append(responses, identities[i].ToResponse())
+	}
+	return responses
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleAdminListUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query models.UserSearchQuery
+		if err := decodeQuery(c, &query); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		users, meta, err := s.AdminService.ListUsers(&query)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.Paginated(c, "users retrieved successfully", http.StatusOK, users, meta)
+	}
+}
+
+func (s *Server) handleAdminGetUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		user, err := s.AdminService.GetUser(uint(userID))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "user retrieved successfully", http.StatusOK, user, nil)
+	}
+}
+
+func (s *Server) handleAdminDeactivateUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, admin, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		userID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		user, err := s.AdminService.DeactivateUser(admin, uint(userID))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "user deactivated successfully", http.StatusOK, user, nil)
+	}
+}
+
+func (s *Server) handleAdminReactivateUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		user, err := s.AdminService.ReactivateUser(uint(userID))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "user reactivated successfully", http.StatusOK, user, nil)
+	}
+}
+
+func (s *Server) handleAdminForcePasswordReset() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.AdminService.ForcePasswordReset(uint(userID)); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "the user was signed out and emailed a password reset link", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleAdminResendVerificationEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.AdminService.ResendVerificationEmail(uint(userID)); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "verification email sent", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleAdminUpdateRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, admin, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		userID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		var request models.UpdateRoleRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		user, err := s.AdminService.UpdateRole(admin, uint(userID), request.Role)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "role updated successfully", http.StatusOK, user, nil)
+	}
+}
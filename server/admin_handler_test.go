@@ -0,0 +1,164 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AdminHandlers(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+	admin := user
+	admin.Role = models.RoleAdmin
+	patient := user
+	patient.Role = models.RolePatient
+	deactivated := admin
+	deactivated.DeactivatedAt = 1
+
+	testCases := []struct {
+		name          string
+		user          *models.User
+		method        string
+		path          string
+		body          string
+		buildStubs    func(service *mocks.MockAdminService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "lists the users",
+			user:   &admin,
+			method: http.MethodGet,
+			path:   "/api/v1/admin/users?q=ken&role=patient&status=deactivated",
+			buildStubs: func(service *mocks.MockAdminService) {
+				service.EXPECT().ListUsers(gomock.Any()).DoAndReturn(func(query *models.UserSearchQuery) ([]models.AdminUserResponse, *models.PageMeta, *errors.Error) {
+					require.Equal(t, "ken", query.Q)
+					require.Equal(t, "patient", query.Role)
+					require.Equal(t, "deactivated", query.Status)
+					return []models.AdminUserResponse{{Role: models.RolePatient, Deactivated: true}}, &models.PageMeta{Limit: 20}, nil
+				})
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"deactivated":true`)
+			},
+		},
+		{
+			name:   "unknown role filter",
+			user:   &admin,
+			method: http.MethodGet,
+			path:   "/api/v1/admin/users?role=owner",
+			buildStubs: func(service *mocks.MockAdminService) {
+				service.EXPECT().ListUsers(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "patients can't list the users",
+			user:   &patient,
+			method: http.MethodGet,
+			path:   "/api/v1/admin/users",
+			buildStubs: func(service *mocks.MockAdminService) {
+				service.EXPECT().ListUsers(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "patients can't deactivate users",
+			user:   &patient,
+			method: http.MethodPost,
+			path:   "/api/v1/admin/users/2/deactivate",
+			buildStubs: func(service *mocks.MockAdminService) {
+				service.EXPECT().DeactivateUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "deactivates a user",
+			user:   &admin,
+			method: http.MethodPost,
+			path:   "/api/v1/admin/users/2/deactivate",
+			buildStubs: func(service *mocks.MockAdminService) {
+				service.EXPECT().DeactivateUser(&admin, uint(2)).Return(&models.AdminUserResponse{Deactivated: true}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "invalid ID",
+			user:   &admin,
+			method: http.MethodPost,
+			path:   "/api/v1/admin/users/abc/password-reset",
+			buildStubs: func(service *mocks.MockAdminService) {
+				service.EXPECT().ForcePasswordReset(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "updates the role",
+			user:   &admin,
+			method: http.MethodPut,
+			path:   "/api/v1/admin/users/2/role",
+			body:   `{"role":"clinician"}`,
+			buildStubs: func(service *mocks.MockAdminService) {
+				service.EXPECT().UpdateRole(&admin, uint(2), models.RoleClinician).Return(&models.AdminUserResponse{Role: models.RoleClinician}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"role":"clinician"`)
+			},
+		},
+		{
+			name:   "deactivated admins are turned away",
+			user:   &deactivated,
+			method: http.MethodGet,
+			path:   "/api/v1/admin/users",
+			buildStubs: func(service *mocks.MockAdminService) {
+				service.EXPECT().ListUsers(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "deactivated")
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAdminService := mocks.NewMockAdminService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.AdminService = mockAdminService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(tc.user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockAdminService)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleCreateAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var request models.CreateAPIKeyRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		key, err := s.APIKeyService.CreateAPIKey(user.ID, &request)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "API key created, copy it now as it won't be shown again", http.StatusCreated, key, nil)
+	}
+}
+
+func (s *Server) handleGetAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		keys, err := s.APIKeyService.GetAPIKeys(user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "API keys retrieved successfully", http.StatusOK, keys, nil)
+	}
+}
+
+func (s *Server) handleRevokeAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		keyID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.APIKeyService.RevokeAPIKey(uint(keyID), user.ID); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "API key revoked successfully", http.StatusOK, nil, nil)
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_APIKeyHandlers(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		body          string
+		buildStubs    func(service *mocks.MockAPIKeyService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "creates a key",
+			method: http.MethodPost,
+			path:   "/api/v1/me/api-keys",
+			body:   `{"name":"sync script","scopes":["medications:read","history:write"],"expires_in_days":30}`,
+			buildStubs: func(service *mocks.MockAPIKeyService) {
+				service.EXPECT().CreateAPIKey(user.ID, &models.CreateAPIKeyRequest{
+					Name:          "sync script",
+					Scopes:        []models.APIScope{models.ScopeMedicationsRead, models.ScopeHistoryWrite},
+					ExpiresInDays: 30,
+				}).Return(&models.CreatedAPIKeyResponse{Key: "mdl_secret"}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"key":"mdl_secret"`)
+			},
+		},
+		{
+			name:   "unknown scope",
+			method: http.MethodPost,
+			path:   "/api/v1/me/api-keys",
+			body:   `{"name":"sync script","scopes":["users:manage"]}`,
+			buildStubs: func(service *mocks.MockAPIKeyService) {
+				service.EXPECT().CreateAPIKey(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "lists the keys",
+			method: http.MethodGet,
+			path:   "/api/v1/me/api-keys",
+			buildStubs: func(service *mocks.MockAPIKeyService) {
+				service.EXPECT().GetAPIKeys(user.ID).Return([]models.APIKeyResponse{{ID: 3, Prefix: "mdl_a1b2c3"}}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"prefix":"mdl_a1b2c3"`)
+			},
+		},
+		{
+			name:   "revokes a key",
+			method: http.MethodDelete,
+			path:   "/api/v1/me/api-keys/3",
+			buildStubs: func(service *mocks.MockAPIKeyService) {
+				service.EXPECT().RevokeAPIKey(uint(3), user.ID).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAPIKeyService := mocks.NewMockAPIKeyService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.APIKeyService = mockAPIKeyService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockAPIKeyService)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func Test_AuthorizeAPIKey(t *testing.T) {
+	_, user := AuthorizeTestUser(t)
+	key := "mdl_secret"
+	apiKey := &models.APIKey{UserID: user.ID, Scopes: []models.APIScope{models.ScopeMedicationsRead}, User: &user}
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		buildStubs    func(keys *mocks.MockAPIKeyService, medications *mocks.MockMedicationService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "key with the scope",
+			method: http.MethodGet,
+			path:   "/api/v1/user/medications",
+			buildStubs: func(keys *mocks.MockAPIKeyService, medications *mocks.MockMedicationService) {
+				keys.EXPECT().AuthenticateAPIKey(key).Return(apiKey, nil)
+				medications.EXPECT().GetAllMedications(user.ID, gomock.Any()).Return([]models.MedicationResponse{}, &models.PageMeta{Limit: 50}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "key without the write scope",
+			method: http.MethodDelete,
+			path:   "/api/v1/user/medications/1",
+			buildStubs: func(keys *mocks.MockAPIKeyService, medications *mocks.MockMedicationService) {
+				keys.EXPECT().AuthenticateAPIKey(key).Return(apiKey, nil)
+				medications.EXPECT().DeleteMedication(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "medications:write")
+			},
+		},
+		{
+			name:   "revoked key",
+			method: http.MethodGet,
+			path:   "/api/v1/user/medications",
+			buildStubs: func(keys *mocks.MockAPIKeyService, medications *mocks.MockMedicationService) {
+				keys.EXPECT().AuthenticateAPIKey(key).Return(nil, errors.New("API key expired or revoked", http.StatusUnauthorized))
+				medications.EXPECT().GetAllMedications(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:   "key of a user who has to reset their password",
+			method: http.MethodGet,
+			path:   "/api/v1/user/medications",
+			buildStubs: func(keys *mocks.MockAPIKeyService, medications *mocks.MockMedicationService) {
+				resetUser := user
+				resetUser.PasswordResetRequired = true
+				resetKey := *apiKey
+				resetKey.User = &resetUser
+				keys.EXPECT().AuthenticateAPIKey(key).Return(&resetKey, nil)
+				medications.EXPECT().GetAllMedications(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:   "route without scopes",
+			method: http.MethodGet,
+			path:   "/api/v1/me/api-keys",
+			buildStubs: func(keys *mocks.MockAPIKeyService, medications *mocks.MockMedicationService) {
+				keys.EXPECT().AuthenticateAPIKey(gomock.Any()).Times(0)
+				keys.EXPECT().GetAPIKeys(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAPIKeyService := mocks.NewMockAPIKeyService(ctrl)
+	mockMedicationService := mocks.NewMockMedicationService(ctrl)
+	testServer.handler.APIKeyService = mockAPIKeyService
+	testServer.handler.MedicationService = mockMedicationService
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.buildStubs(mockAPIKeyService, mockMedicationService)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -1,11 +1,7 @@
 package server
 
 import (
-	"context"
-
-	"github.com/decagonhq/meddle-api/config"
 	"github.com/decagonhq/meddle-api/services/jwt"
-	"golang.org/x/oauth2"
 
 	"log"
 	"net/http"
@@ -40,52 +36,17 @@ func (s *Server) handleLogin() gin.HandlerFunc {
 			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
 			return
 		}
+		loginRequest.Client = sessionClient(c)
 		userResponse, err := s.AuthService.LoginUser(&loginRequest)
 		if err != nil {
 			response.JSON(c, "", err.Status, nil, err)
 			return
 		}
-		response.JSON(c, "login successful", http.StatusOK, userResponse, nil)
-	}
-}
-
-func (s *Server) HandleGoogleOauthLogin() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		conf := config.GetGoogleOAuthConfig(s.Config.GoogleClientID, s.Config.GoogleClientSecret, s.Config.GoogleRedirectURL)
-		state, err := jwt.GenerateToken("", s.Config.JWTSecret)
-		if err != nil {
-			response.JSON(c, "", http.StatusInternalServerError, nil, err)
+		if userResponse.Challenge != nil {
+			response.JSON(c, "enter the code of your authenticator app", http.StatusOK, userResponse.Challenge, nil)
 			return
 		}
-		url := conf.AuthCodeURL(state, oauth2.AccessTypeOffline)
-		c.Redirect(http.StatusTemporaryRedirect, url)
-	}
-}
-
-func (s *Server) HandleGoogleCallback() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var state = c.Query("state")
-		var code = c.Query("code")
-
-		_, err := jwt.ValidateToken(state, s.Config.JWTSecret)
-		if err != nil {
-			respondAndAbort(c, "", http.StatusUnauthorized, nil, errors.New("invalid login", http.StatusUnauthorized))
-			return
-		}
-
-		var oauth2Config = config.GetGoogleOAuthConfig(s.Config.GoogleClientID, s.Config.GoogleClientID, s.Config.GoogleRedirectURL)
-		token, err := oauth2Config.Exchange(context.Background(), code)
-		if err != nil || token == nil {
-			respondAndAbort(c, "", http.StatusUnauthorized, nil, errors.New("invalid token", http.StatusUnauthorized))
-			return
-		}
-		authToken, errr := s.AuthService.GoogleSignInUser(token.AccessToken)
-		if errr != nil {
-			respondAndAbort(c, "", http.StatusUnauthorized, nil, errors.New("invalid authToken", http.StatusUnauthorized))
-			return
-		}
-
-		response.JSON(c, "google sign in successful", http.StatusOK, authToken, nil)
+		response.JSON(c, "login successful", http.StatusOK, userResponse, nil)
 	}
 }
 
@@ -135,94 +96,116 @@ func (s *Server) handleLogout() gin.HandlerFunc {
 				return
 			}
 		}
+		if sessionID, ok := jwt.GetSessionID(claims); ok {
+			if err := s.SessionService.RevokeSession(sessionID, user.ID); err != nil && err != errors.ErrNotFound {
+				response.JSON(c, "logout failed", err.Status, nil, err)
+				return
+			}
+		}
 		response.JSON(c, "logout successful", http.StatusOK, nil, nil)
 
 	}
 }
 
-func (s *Server) handleFBLogin() gin.HandlerFunc {
+func (s *Server) handleDeleteUserByEmail() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		conf := config.GetFacebookOAuthConfig(s.Config.FacebookClientID, s.Config.FacebookClientSecret, s.Config.FacebookRedirectURL)
-		state, err := jwt.GenerateToken("", s.Config.JWTSecret)
+		_, user, err := GetValuesFromContext(c)
 		if err != nil {
-			response.JSON(c, "", http.StatusInternalServerError, nil, err)
+			err.Respond(c)
+			return
+		}
+
+		if err := s.AuthService.DeleteUserByEmail(user.Email); err != nil {
+			err.Respond(c)
 			return
 		}
-		url := conf.AuthCodeURL(state, oauth2.AccessTypeOffline)
-		c.Redirect(http.StatusTemporaryRedirect, url)
+
+		response.JSON(c, "user successfully deleted", http.StatusOK, nil, nil)
 	}
 }
 
-func (s *Server) fbCallbackHandler() gin.HandlerFunc {
+func (s *Server) handleUpdateUserDetails() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var state = c.Query("state")
-		var code = c.Query("code")
-
-		_, err := jwt.ValidateToken(state, s.Config.JWTSecret)
+		_, user, err := GetValuesFromContext(c)
 		if err != nil {
-			respondAndAbort(c, "", http.StatusUnauthorized, nil, errors.New("invalid login", http.StatusUnauthorized))
+			err.Respond(c)
 			return
 		}
-
-		var OAuth2Config = config.GetFacebookOAuthConfig(s.Config.FacebookClientID, s.Config.FacebookClientSecret, s.Config.FacebookRedirectURL)
-
-		token, err := OAuth2Config.Exchange(context.Background(), code)
-		if err != nil || token == nil {
-			respondAndAbort(c, "", http.StatusUnauthorized, nil, errors.New("invalid token", http.StatusUnauthorized))
+		var updateRequest models.UpdateUserRequest
+		if err := decode(c, &updateRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
 			return
 		}
-
-		authToken, errr := s.AuthService.FacebookSignInUser(token.AccessToken)
-		if errr != nil {
-			log.Printf("Facebook Signin failed due to: %v", errr)
-			respondAndAbort(c, "", http.StatusUnauthorized, nil, errors.New("invalid authToken", http.StatusUnauthorized))
+		userResponse, err := s.UserService.UpdateUser(user, &updateRequest)
+		if err != nil {
+			err.Respond(c)
 			return
 		}
-		result := struct {
-			AccessToken *string `json:"access_token"`
-		}{
-			AccessToken: authToken,
-		}
-
-		response.JSON(c, "facebook sign in successful", http.StatusOK, result, nil)
+		response.JSON(c, "successful", http.StatusOK, userResponse, nil)
 	}
 }
 
-func (s *Server) handleDeleteUserByEmail() gin.HandlerFunc {
+func (s *Server) handleShowProfile() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		_, user, err := GetValuesFromContext(c)
 		if err != nil {
 			err.Respond(c)
 			return
 		}
-
-		if err := s.AuthService.DeleteUserByEmail(user.Email); err != nil {
-			err.Respond(c)
-			return
-		}
-
-		response.JSON(c, "user successfully deleted", http.StatusOK, nil, nil)
+		response.JSON(c, "successful", http.StatusOK, user.ToProfileResponse(), nil)
 	}
 }
 
-func (s *Server) handleGetUsers() gin.HandlerFunc {
+func (s *Server) handleChangePassword() gin.HandlerFunc {
 	return func(c *gin.Context) {
-
-		response.JSON(c, "successful", http.StatusOK, nil, nil)
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var request models.ChangePasswordRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		tokens, err := s.UserService.ChangePassword(user, &request, sessionClient(c))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "password changed, other devices were signed out", http.StatusOK, tokens, nil)
 	}
 }
 
-func (s *Server) handleUpdateUserDetails() gin.HandlerFunc {
+func (s *Server) handleChangeEmail() gin.HandlerFunc {
 	return func(c *gin.Context) {
-
-		response.JSON(c, "successful", http.StatusOK, nil, nil)
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var request models.ChangeEmailRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		if err := s.UserService.RequestEmailChange(user, &request); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "follow the link sent to your new email to verify it", http.StatusOK, nil, nil)
 	}
 }
 
-func (s *Server) handleShowProfile() gin.HandlerFunc {
+// handleVerifyEmailChange serves the link sent to the new email of a user, it
+// doesn't need the user to log in
+func (s *Server) handleVerifyEmailChange() gin.HandlerFunc {
 	return func(c *gin.Context) {
-
-		response.JSON(c, "successful", http.StatusOK, nil, nil)
+		if err := s.UserService.ConfirmEmailChange(c.Param("token")); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "your email changed, sign in with the new one", http.StatusOK, nil, nil)
 	}
 }
 
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/services/identity"
 	"github.com/decagonhq/meddle-api/services/jwt"
 	"math/rand"
 	"net/http"
@@ -281,7 +282,7 @@ func TestLoginHandler(t *testing.T) {
 }
 
 func Test_FacebookCallBackHandler(t *testing.T) {
-	testOauthState, err := jwt.GenerateToken("", testServer.handler.Config.JWTSecret)
+	testOauthState, err := jwt.GenerateSSOStateToken("facebook", "state", "nonce", "verifier", 0, testServer.handler.Config.JWTSecret)
 	require.NoError(t, err)
 
 	// test cases
@@ -291,15 +292,15 @@ func Test_FacebookCallBackHandler(t *testing.T) {
 		code                  string
 		inputToken            string
 		facebookLoginResponse *string
-		buildStubs            func(service *mocks.MockAuthService, request string, response *string)
+		buildStubs            func(service *mocks.MockIdentityService, request string, response *string)
 		checkResponse         func(t *testing.T, recorder *httptest.ResponseRecorder)
 	}{
 		{
 			name:  "invalid state case",
 			state: "invalidState",
 			code:  "code",
-			buildStubs: func(service *mocks.MockAuthService, token string, response *string) {
-				service.EXPECT().FacebookSignInUser(token).Times(0)
+			buildStubs: func(service *mocks.MockIdentityService, token string, response *string) {
+				service.EXPECT().SignIn(gomock.Any(), gomock.Any()).Times(0)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
@@ -309,8 +310,8 @@ func Test_FacebookCallBackHandler(t *testing.T) {
 			name:  "invalid token",
 			state: testOauthState,
 			code:  "",
-			buildStubs: func(service *mocks.MockAuthService, token string, response *string) {
-				service.EXPECT().FacebookSignInUser(token).Times(0)
+			buildStubs: func(service *mocks.MockIdentityService, token string, response *string) {
+				service.EXPECT().SignIn(gomock.Any(), gomock.Any()).Times(0)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
@@ -319,8 +320,9 @@ func Test_FacebookCallBackHandler(t *testing.T) {
 	}
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
-	mockService := mocks.NewMockAuthService(ctrl)
-	testServer.handler.AuthService = mockService
+	mockService := mocks.NewMockIdentityService(ctrl)
+	testServer.handler.IdentityService = mockService
+	testServer.handler.IdentityProviders = map[string]identity.Provider{"facebook": &fakeProvider{}}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.buildStubs(mockService, tc.inputToken, tc.facebookLoginResponse)
@@ -336,7 +338,7 @@ func Test_FacebookCallBackHandler(t *testing.T) {
 }
 
 func Test_GoogleCallBackHandler(t *testing.T) {
-	testOauthState, err := jwt.GenerateToken("", testServer.handler.Config.JWTSecret)
+	testOauthState, err := jwt.GenerateSSOStateToken("google", "state", "nonce", "verifier", 0, testServer.handler.Config.JWTSecret)
 	require.NoError(t, err)
 
 	// test cases
@@ -346,15 +348,15 @@ func Test_GoogleCallBackHandler(t *testing.T) {
 		code                string
 		inputToken          string
 		googleLoginResponse *string
-		buildStubs          func(service *mocks.MockAuthService, request string, response *string)
+		buildStubs          func(service *mocks.MockIdentityService, request string, response *string)
 		checkResponse       func(t *testing.T, recorder *httptest.ResponseRecorder)
 	}{
 		{
 			name:  "invalid state case",
 			state: "invalidState",
 			code:  "code",
-			buildStubs: func(service *mocks.MockAuthService, token string, response *string) {
-				service.EXPECT().GoogleSignInUser(token).Times(0)
+			buildStubs: func(service *mocks.MockIdentityService, token string, response *string) {
+				service.EXPECT().SignIn(gomock.Any(), gomock.Any()).Times(0)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
@@ -364,8 +366,8 @@ func Test_GoogleCallBackHandler(t *testing.T) {
 			name:  "invalid token",
 			state: testOauthState,
 			code:  "",
-			buildStubs: func(service *mocks.MockAuthService, token string, response *string) {
-				service.EXPECT().GoogleSignInUser(token).Times(0)
+			buildStubs: func(service *mocks.MockIdentityService, token string, response *string) {
+				service.EXPECT().SignIn(gomock.Any(), gomock.Any()).Times(0)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusUnauthorized, recorder.Code)
@@ -374,8 +376,9 @@ func Test_GoogleCallBackHandler(t *testing.T) {
 	}
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
-	mockService := mocks.NewMockAuthService(ctrl)
-	testServer.handler.AuthService = mockService
+	mockService := mocks.NewMockIdentityService(ctrl)
+	testServer.handler.IdentityService = mockService
+	testServer.handler.IdentityProviders = map[string]identity.Provider{"google": &fakeProvider{}}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.buildStubs(mockService, tc.inputToken, tc.googleLoginResponse)
@@ -427,17 +430,20 @@ func Test_Logout(t *testing.T) {
 		IsEmailActive: true,
 	}
 	conf.JWTSecret = "testSecret"
-	token, err := jwt.GenerateToken(user.Email, conf.JWTSecret)
+	sessionService, sessionRepo, token := startTestSession(t, user, conf)
 
 	s := &Server{
 		Config:         conf,
 		AuthRepository: repo,
 		AuthService:    auth,
+		SessionService: sessionService,
 	}
 
 	repo.EXPECT().AddToBlackList(&models.BlackList{Email: user.Email, Token: token}).Return(nil)
 	repo.EXPECT().TokenInBlacklist(token).Return(false)
 	repo.EXPECT().FindUserByEmail(user.Email).Return(user, nil)
+	// the session of the token ends with the logout
+	sessionRepo.EXPECT().RevokeSession(uint(1), user.ID, gomock.Any()).Return(nil)
 
 	r := s.setupRouter()
 	resp := httptest.NewRecorder()
@@ -543,3 +549,186 @@ func RandomOwnerName() string {
 func RandomEmail() string {
 	return fmt.Sprintf("%s@email.com", RandomString(6))
 }
+
+func Test_LimitRate(t *testing.T) {
+	router := gin.New()
+	router.GET("/limited", limitRate(time.Minute, 2, keyByIP), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/limited", nil)
+		require.NoError(t, err)
+		router.ServeHTTP(recorder, req)
+		require.Equal(t, want, recorder.Code, "request %d", i+1)
+	}
+}
+
+func Test_LimitRateIgnoresForwardedFor(t *testing.T) {
+	limit := testServer.handler.Config.AuthRateLimit
+	if limit <= 0 {
+		limit = defaultAuthRateLimit
+	}
+
+	for i := 0; i <= limit; i++ {
+		recorder := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/api/v1/auth/refresh", strings.NewReader("{}"))
+		require.NoError(t, err)
+		req.RemoteAddr = "192.0.2.50:4321"
+		// a client making up a new address for each request isn't a proxy we trust
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+		testServer.router.ServeHTTP(recorder, req)
+		if i < limit {
+			require.NotEqual(t, http.StatusTooManyRequests, recorder.Code, "request %d", i+1)
+			continue
+		}
+		require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	}
+}
+
+func Test_UserProfileHandlers(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+	user.Locale = "en"
+	user.Notifications.RefillRemindersOff = true
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		reqBody       interface{}
+		buildStubs    func(service *mocks.MockUserService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:       "shows the profile",
+			method:     http.MethodGet,
+			path:       "/api/v1/me",
+			buildStubs: func(service *mocks.MockUserService) {},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), fmt.Sprintf(`"email":"%s"`, user.Email))
+				require.Contains(t, recorder.Body.String(), `"notifications":{"dose_reminders":true,"refill_reminders":false}`)
+				require.NotContains(t, recorder.Body.String(), "password")
+			},
+		},
+		{
+			name:    "updates some fields",
+			method:  http.MethodPut,
+			path:    "/api/v1/me/update",
+			reqBody: gin.H{"locale": "fr-CA", "notifications": gin.H{"dose_reminders": false}},
+			buildStubs: func(service *mocks.MockUserService) {
+				doseReminders := false
+				service.EXPECT().UpdateUser(gomock.Any(), &models.UpdateUserRequest{
+					Locale:        "fr-CA",
+					Notifications: &models.UpdateNotificationPreferencesRequest{DoseReminders: &doseReminders},
+				}).Return(&models.UserProfileResponse{Locale: "fr-CA"}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"locale":"fr-CA"`)
+			},
+		},
+		{
+			name:    "invalid phone number",
+			method:  http.MethodPut,
+			path:    "/api/v1/me/update",
+			reqBody: gin.H{"phone_number": "08012345678"},
+			buildStubs: func(service *mocks.MockUserService) {
+				service.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "changes the password",
+			method:  http.MethodPut,
+			path:    "/api/v1/me/password",
+			reqBody: gin.H{"current_password": "password", "new_password": "newpassword", "confirm_password": "newpassword"},
+			buildStubs: func(service *mocks.MockUserService) {
+				service.EXPECT().ChangePassword(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(&models.TokenPair{AccessToken: "access", RefreshToken: "refresh"}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"refresh_token":"refresh"`)
+			},
+		},
+		{
+			name:    "wrong current password",
+			method:  http.MethodPut,
+			path:    "/api/v1/me/password",
+			reqBody: gin.H{"current_password": "wrong", "new_password": "newpassword", "confirm_password": "newpassword"},
+			buildStubs: func(service *mocks.MockUserService) {
+				service.EXPECT().ChangePassword(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("the current password is wrong", http.StatusBadRequest))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "asks to change the email",
+			method:  http.MethodPut,
+			path:    "/api/v1/me/email",
+			reqBody: gin.H{"email": "new@gmail.com", "password": "password"},
+			buildStubs: func(service *mocks.MockUserService) {
+				service.EXPECT().RequestEmailChange(gomock.Any(), &models.ChangeEmailRequest{Email: "new@gmail.com", Password: "password"}).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockUserService := mocks.NewMockUserService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.UserService = mockUserService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockUserService)
+
+			var body []byte
+			if tc.reqBody != nil {
+				var err error
+				body, err = json.Marshal(tc.reqBody)
+				require.NoError(t, err)
+			}
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(tc.method, tc.path, bytes.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func Test_VerifyEmailChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockUserService := mocks.NewMockUserService(ctrl)
+	testServer.handler.UserService = mockUserService
+
+	mockUserService.EXPECT().ConfirmEmailChange("token").Return(nil)
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/email/verify/token", nil)
+	require.NoError(t, err)
+	testServer.router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	mockUserService.EXPECT().ConfirmEmailChange("used").Return(errors.New("invalid or expired link", http.StatusBadRequest))
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/api/v1/email/verify/used", nil)
+	require.NoError(t, err)
+	testServer.router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleInviteCaregiver() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var request models.InviteCaregiverRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		link, err := s.CaregiverService.InviteCaregiver(user, &request)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "caregiver invited successfully", http.StatusCreated, link, nil)
+	}
+}
+
+func (s *Server) handleGetCaregivers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		links, err := s.CaregiverService.GetCaregivers(user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "caregivers retrieved successfully", http.StatusOK, links, nil)
+	}
+}
+
+func (s *Server) handleUpdateCaregiver() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		linkID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		var request models.UpdateCaregiverRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		link, err := s.CaregiverService.UpdateCaregiver(user.ID, uint(linkID), &request)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "caregiver updated successfully", http.StatusOK, link, nil)
+	}
+}
+
+func (s *Server) handleRemoveCaregiver() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		linkID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.CaregiverService.RemoveCaregiver(user.ID, uint(linkID)); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "caregiver removed successfully", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleGetCaregiverInvitations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		invitations, err := s.CaregiverService.GetInvitations(user)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "invitations retrieved successfully", http.StatusOK, invitations, nil)
+	}
+}
+
+func (s *Server) handleAcceptCaregiverInvitation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		linkID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		link, err := s.CaregiverService.AcceptInvitation(user, uint(linkID))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "invitation accepted successfully", http.StatusOK, link, nil)
+	}
+}
+
+// handleAcceptCaregiverInvitationLink accepts the invitation of the link
+// emailed to the caregiver
+func (s *Server) handleAcceptCaregiverInvitationLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		link, err := s.CaregiverService.AcceptInvitationLink(user, c.Param("token"))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "invitation accepted successfully", http.StatusOK, link, nil)
+	}
+}
+
+func (s *Server) handleDeclineCaregiverInvitation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		linkID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.CaregiverService.DeclineInvitation(user, uint(linkID)); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "invitation declined successfully", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleGetPatients() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		patients, err := s.CaregiverService.GetPatients(user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "patients retrieved successfully", http.StatusOK, patients, nil)
+	}
+}
+
+func (s *Server) handleLeavePatient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		patientID, errr := strconv.ParseUint(c.Param("patientID"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.CaregiverService.LeavePatient(user.ID, uint(patientID)); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "you no longer have access to this user", http.StatusOK, nil, nil)
+	}
+}
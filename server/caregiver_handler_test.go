@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_InviteCaregiverHandler(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+
+	testCases := []struct {
+		name          string
+		reqBody       interface{}
+		buildStubs    func(service *mocks.MockCaregiverService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "success case",
+			reqBody: gin.H{"email": "son@example.com", "permission": "read", "notify_missed_doses": true},
+			buildStubs: func(service *mocks.MockCaregiverService) {
+				service.EXPECT().InviteCaregiver(gomock.Any(), &models.InviteCaregiverRequest{Email: "son@example.com", Permission: "read", NotifyMissedDoses: true}).
+					Times(1).Return(&models.CaregiverLinkResponse{ID: 1, CaregiverEmail: "son@example.com", Status: models.CaregiverPending}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:    "invalid permission",
+			reqBody: gin.H{"email": "son@example.com", "permission": "admin"},
+			buildStubs: func(service *mocks.MockCaregiverService) {
+				service.EXPECT().InviteCaregiver(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "already invited",
+			reqBody: gin.H{"email": "son@example.com", "permission": "manage"},
+			buildStubs: func(service *mocks.MockCaregiverService) {
+				service.EXPECT().InviteCaregiver(gomock.Any(), gomock.Any()).Times(1).Return(nil, errors.New("this caregiver was already invited", http.StatusConflict))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockCaregiverService := mocks.NewMockCaregiverService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.CaregiverService = mockCaregiverService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockCaregiverService)
+
+			body, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/api/v1/user/caregivers", strings.NewReader(string(body)))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func Test_CaregiverActsAsPatient(t *testing.T) {
+	accToken, caregiver := AuthorizeTestUser(t)
+	patient := models.User{Model: models.Model{ID: caregiver.ID + 100}, Name: "Ada", TimeZone: "Africa/Lagos"}
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		buildStubs    func(caregivers *mocks.MockCaregiverService, medications *mocks.MockMedicationService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "reads the medications of the patient",
+			method: http.MethodGet,
+			path:   fmt.Sprintf("/api/v1/caregiving/patients/%d/medications", patient.ID),
+			buildStubs: func(caregivers *mocks.MockCaregiverService, medications *mocks.MockMedicationService) {
+				caregivers.EXPECT().AuthorizeCaregiver(caregiver.ID, patient.ID, models.CaregiverRead).Return(&patient, nil)
+				medications.EXPECT().GetAllMedications(patient.ID, &models.PageQuery{}).Return([]models.MedicationResponse{}, &models.PageMeta{Limit: 50}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "without the manage permission",
+			method: http.MethodPost,
+			path:   fmt.Sprintf("/api/v1/caregiving/patients/%d/medications/3/pause", patient.ID),
+			buildStubs: func(caregivers *mocks.MockCaregiverService, medications *mocks.MockMedicationService) {
+				caregivers.EXPECT().AuthorizeCaregiver(caregiver.ID, patient.ID, models.CaregiverManage).
+					Return(nil, errors.New("you can only view the medications of this user", http.StatusForbidden))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "not a caregiver of the user",
+			method: http.MethodGet,
+			path:   "/api/v1/caregiving/patients/999/medication-history",
+			buildStubs: func(caregivers *mocks.MockCaregiverService, medications *mocks.MockMedicationService) {
+				caregivers.EXPECT().AuthorizeCaregiver(caregiver.ID, uint(999), models.CaregiverRead).Return(nil, errors.ErrNotFound)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockCaregiverService := mocks.NewMockCaregiverService(ctrl)
+	mockMedicationService := mocks.NewMockMedicationService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.CaregiverService = mockCaregiverService
+	testServer.handler.MedicationService = mockMedicationService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(caregiver.Email).Return(&caregiver, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockCaregiverService, mockMedicationService)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -10,20 +10,29 @@ import (
 )
 
 func decode(c *gin.Context, v interface{}) error {
-	if err := c.ShouldBindJSON(v); err != nil {
-		e := &errors.Error{
-			Status: http.StatusBadRequest,
-		}
-		if verr, ok := err.(validator.ValidationErrors); ok {
-			errs := []string{}
-			for _, fieldErr := range verr {
-				errs = append(errs, fmt.Sprintf("%s is invalid: '%s'", fieldErr.Field(), fieldErr.Value()))
-			}
-			e.Message = strings.Join(errs, ";")
-			return e
+	return bindingError(c.ShouldBindJSON(v))
+}
+
+// decodeQuery binds the query string parameters of the request to v
+func decodeQuery(c *gin.Context, v interface{}) error {
+	return bindingError(c.ShouldBindQuery(v))
+}
+
+func bindingError(err error) error {
+	if err == nil {
+		return nil
+	}
+	e := &errors.Error{
+		Status: http.StatusBadRequest,
+	}
+	if verr, ok := err.(validator.ValidationErrors); ok {
+		errs := []string{}
+		for _, fieldErr := range verr {
+			errs = append(errs, fmt.Sprintf("%s is invalid: '%s'", fieldErr.Field(), fieldErr.Value()))
 		}
-		e.Message = err.Error()
+		e.Message = strings.Join(errs, ";")
 		return e
 	}
-	return nil
+	e.Message = err.Error()
+	return e
 }
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleGetDigestSettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "digest settings retrieved successfully", http.StatusOK, s.DigestService.GetDigestSettings(user), nil)
+	}
+}
+
+func (s *Server) handleUpdateDigestSettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var request models.UpdateDigestSettingsRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		settings, err := s.DigestService.UpdateDigestSettings(user, &request)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "digest settings updated successfully", http.StatusOK, settings, nil)
+	}
+}
+
+// handleUnsubscribeDigest serves the unsubscribe link of the digest email, it
+// doesn't need the user to log in
+func (s *Server) handleUnsubscribeDigest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := s.DigestService.Unsubscribe(c.Param("token")); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "you won't get the weekly digest anymore", http.StatusOK, nil, nil)
+	}
+}
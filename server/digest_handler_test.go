@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_UpdateDigestSettingsHandler(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+	hour := 19
+
+	testCases := []struct {
+		name          string
+		reqBody       interface{}
+		buildStubs    func(service *mocks.MockDigestService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "success case",
+			reqBody: gin.H{"day": "friday", "hour": hour},
+			buildStubs: func(service *mocks.MockDigestService) {
+				service.EXPECT().UpdateDigestSettings(gomock.Any(), &models.UpdateDigestSettingsRequest{Day: "friday", Hour: &hour}).
+					Times(1).Return(&models.DigestSettingsResponse{Enabled: true, Day: "friday", Hour: hour}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"day":"friday"`)
+			},
+		},
+		{
+			name:    "invalid day",
+			reqBody: gin.H{"day": "someday"},
+			buildStubs: func(service *mocks.MockDigestService) {
+				service.EXPECT().UpdateDigestSettings(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "invalid hour",
+			reqBody: gin.H{"hour": 24},
+			buildStubs: func(service *mocks.MockDigestService) {
+				service.EXPECT().UpdateDigestSettings(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "internal server error",
+			reqBody: gin.H{"enabled": false},
+			buildStubs: func(service *mocks.MockDigestService) {
+				service.EXPECT().UpdateDigestSettings(gomock.Any(), gomock.Any()).Times(1).Return(nil, errors.ErrInternalServerError)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockDigestService := mocks.NewMockDigestService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.DigestService = mockDigestService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockDigestService)
+
+			body, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPut, "/api/v1/me/digest", strings.NewReader(string(body)))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func Test_UnsubscribeDigestHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockDigestService := mocks.NewMockDigestService(ctrl)
+	testServer.handler.DigestService = mockDigestService
+
+	mockDigestService.EXPECT().Unsubscribe("token").Return(nil)
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/digest/unsubscribe/token", nil)
+	require.NoError(t, err)
+	testServer.router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	mockDigestService.EXPECT().Unsubscribe("unknown").Return(errors.ErrNotFound)
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/api/v1/digest/unsubscribe/unknown", nil)
+	require.NoError(t, err)
+	testServer.router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleAutocompleteDrugs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 0
+		if c.Query("limit") != "" {
+			var errr error
+			limit, errr = strconv.Atoi(c.Query("limit"))
+			if errr != nil {
+				response.JSON(c, "invalid limit", http.StatusBadRequest, nil, errr)
+				return
+			}
+		}
+		drugs, err := s.DrugCatalogService.Autocomplete(c.Query("q"), limit)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "drugs retrieved successfully", http.StatusOK, drugs, nil)
+	}
+}
+
+func (s *Server) handleGetDrug() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, errr := strconv.ParseUint(c.Param("drugID"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		drug, err := s.DrugCatalogService.GetDrug(uint(id))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "drug retrieved successfully", http.StatusOK, drug, nil)
+	}
+}
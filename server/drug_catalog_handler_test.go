@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_AutocompleteDrugsHandler(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(service *mocks.MockDrugCatalogService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "success case",
+			query: "q=para&limit=5",
+			buildStubs: func(service *mocks.MockDrugCatalogService) {
+				service.EXPECT().Autocomplete("para", 5).Times(1).Return([]models.DrugResponse{{ID: 1, Name: "Paracetamol"}}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "Paracetamol")
+			},
+		},
+		{
+			name:  "missing query",
+			query: "",
+			buildStubs: func(service *mocks.MockDrugCatalogService) {
+				service.EXPECT().Autocomplete("", 0).Times(1).Return(nil, errors.New("query is required", http.StatusBadRequest))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "invalid limit",
+			query: "q=para&limit=ten",
+			buildStubs: func(service *mocks.MockDrugCatalogService) {
+				service.EXPECT().Autocomplete(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockDrugCatalogService := mocks.NewMockDrugCatalogService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.DrugCatalogService = mockDrugCatalogService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockDrugCatalogService)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/drugs/autocomplete?%s", tc.query), nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
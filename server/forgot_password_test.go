@@ -3,11 +3,11 @@ package server
 import (
 	"bytes"
 	"encoding/json"
-	"github.com/decagonhq/meddle-api/services/jwt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/mocks"
 	"github.com/decagonhq/meddle-api/models"
 	"github.com/decagonhq/meddle-api/services"
@@ -19,7 +19,7 @@ import (
 func TestResetPassword(t *testing.T) {
 	user := models.User{}
 	email := "toluwasethomas1@gmail.com"
-	token, _ := jwt.GenerateToken(email, testServer.handler.Config.JWTSecret)
+	token := "reset-token"
 	newReq := &models.ResetPassword{
 		Password:        "12345678",
 		ConfirmPassword: "12345678",
@@ -32,7 +32,7 @@ func TestResetPassword(t *testing.T) {
 		ExpectedCode    int
 		ExpectedMessage string
 		ExpectedError   string
-		mockDB          func(ctrl *mocks.MockAuthRepository)
+		mockDB          func(ctrl *mocks.MockAuthRepository, tokens *mocks.MockOneTimeTokenService, sessions *mocks.MockSessionService, apiKeys *mocks.MockAPIKeyRepository)
 		checkResponse   func(recorder *httptest.ResponseRecorder)
 	}{
 		{
@@ -41,10 +41,26 @@ func TestResetPassword(t *testing.T) {
 			ExpectedCode:    http.StatusCreated,
 			ExpectedMessage: "Reset successful, Login with your new password to continue",
 			ExpectedError:   "",
-			mockDB: func(ctrl *mocks.MockAuthRepository) {
-				ctrl.EXPECT().IsTokenInBlacklist(token).Return(nil).AnyTimes()
-				ctrl.EXPECT().UpdatePassword(gomock.Any(), email).Return(nil).AnyTimes()
-				ctrl.EXPECT().AddToBlackList(gomock.Any()).Return(nil).AnyTimes()
+			mockDB: func(ctrl *mocks.MockAuthRepository, tokens *mocks.MockOneTimeTokenService, sessions *mocks.MockSessionService, apiKeys *mocks.MockAPIKeyRepository) {
+				tokens.EXPECT().ConsumeToken(token, models.PurposePasswordReset).
+					Return(&models.OneTimeToken{UserID: 9, Purpose: models.PurposePasswordReset, User: &models.User{Email: email}}, nil)
+				ctrl.EXPECT().UpdatePassword(gomock.Any(), email).Return(nil)
+				// the sessions and API keys made with the old password end
+				apiKeys.EXPECT().RevokeAPIKeys(uint(9), gomock.Any()).Return(nil)
+				sessions.EXPECT().RevokeSessions(uint(9)).Return(nil)
+			},
+		},
+		{
+			Name:          "Test Reset Password with a used link",
+			Request:       newReq,
+			ExpectedCode:  http.StatusUnauthorized,
+			ExpectedError: "invalid or expired link",
+			mockDB: func(ctrl *mocks.MockAuthRepository, tokens *mocks.MockOneTimeTokenService, sessions *mocks.MockSessionService, apiKeys *mocks.MockAPIKeyRepository) {
+				tokens.EXPECT().ConsumeToken(token, models.PurposePasswordReset).
+					Return(nil, errors.New("invalid or expired link", http.StatusUnauthorized))
+				ctrl.EXPECT().UpdatePassword(gomock.Any(), gomock.Any()).Times(0)
+				apiKeys.EXPECT().RevokeAPIKeys(gomock.Any(), gomock.Any()).Times(0)
+				sessions.EXPECT().RevokeSessions(gomock.Any()).Times(0)
 			},
 		},
 		{
@@ -53,7 +69,8 @@ func TestResetPassword(t *testing.T) {
 			ExpectedCode:    http.StatusBadRequest,
 			ExpectedMessage: "",
 			ExpectedError:   "password does not match",
-			mockDB:          func(ctrl *mocks.MockAuthRepository) {},
+			mockDB: func(ctrl *mocks.MockAuthRepository, tokens *mocks.MockOneTimeTokenService, sessions *mocks.MockSessionService, apiKeys *mocks.MockAPIKeyRepository) {
+			},
 		},
 		{
 			Name:            "Test Supply with short password",
@@ -61,7 +78,8 @@ func TestResetPassword(t *testing.T) {
 			ExpectedCode:    http.StatusBadRequest,
 			ExpectedMessage: "",
 			ExpectedError:   "wrong password length",
-			mockDB:          func(ctrl *mocks.MockAuthRepository) {},
+			mockDB: func(ctrl *mocks.MockAuthRepository, tokens *mocks.MockOneTimeTokenService, sessions *mocks.MockSessionService, apiKeys *mocks.MockAPIKeyRepository) {
+			},
 		},
 	}
 
@@ -70,13 +88,17 @@ func TestResetPassword(t *testing.T) {
 	mockAuthRepo := mocks.NewMockAuthRepository(ctrl)
 	mail := mocks.NewMockMailer(ctrl)
 	pushNotifier := mocks.NewMockPushNotifier(ctrl)
-	authService := services.NewAuthService(mockAuthRepo, testServer.handler.Config, mail, pushNotifier)
+	sessionService := mocks.NewMockSessionService(ctrl)
+	loginThrottle := mocks.NewMockLoginThrottleService(ctrl)
+	tokens := mocks.NewMockOneTimeTokenService(ctrl)
+	apiKeyRepo := mocks.NewMockAPIKeyRepository(ctrl)
+	authService := services.NewAuthService(mockAuthRepo, apiKeyRepo, sessionService, loginThrottle, tokens, testServer.handler.Config, mail, pushNotifier)
 	testServer.handler.AuthService = authService
 	testServer.handler.AuthRepository = mockAuthRepo
 
 	for _, c := range cases {
 		t.Run(c.Name, func(t *testing.T) {
-			c.mockDB(mockAuthRepo)
+			c.mockDB(mockAuthRepo, tokens, sessionService, apiKeyRepo)
 			data, err := json.Marshal(c.Request)
 			require.NoError(t, err)
 			req, _ := http.NewRequest(http.MethodPost, "/api/v1/password/reset/"+token, bytes.NewReader(data))
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleGetIdentities() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		identities, err := s.IdentityService.GetIdentities(user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "linked accounts retrieved successfully", http.StatusOK, identities, nil)
+	}
+}
+
+// handleLinkIdentity starts linking the provider to the user, who goes to the
+// returned page to sign in with the provider. The provider sends them back to
+// the SSO callback, which links the account
+func (s *Server) handleLinkIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		name, idp, ok := s.identityProvider(c, "")
+		if !ok {
+			return
+		}
+		url, ok := s.startSSO(c, name, idp, user.ID)
+		if !ok {
+			return
+		}
+		response.JSON(c, "sign in with "+name+" to link your account", http.StatusOK, models.LinkIdentityResponse{URL: url}, nil)
+	}
+}
+
+func (s *Server) handleUnlinkIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		if err := s.IdentityService.UnlinkIdentity(user, c.Param("provider")); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, c.Param("provider")+" account unlinked successfully", http.StatusOK, nil, nil)
+	}
+}
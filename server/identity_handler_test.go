@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/identity"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LinkIdentity(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockService := mocks.NewMockIdentityService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.IdentityService = mockService
+	testServer.handler.AuthRepository = mockAuthRepository
+	testServer.handler.IdentityProviders = map[string]identity.Provider{"company": &fakeProvider{}}
+
+	// linking starts with the logged in user getting the page of the provider
+	mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+	mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/api/v1/me/identities/company", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+	testServer.router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var body struct {
+		Data models.LinkIdentityResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	location, err := url.Parse(body.Data.URL)
+	require.NoError(t, err)
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	// the callback links the account instead of signing in, without the
+	// access token of the user
+	mockService.EXPECT().SignIn(gomock.Any(), gomock.Any()).Times(0)
+	mockService.EXPECT().LinkIdentity(user.ID, &models.ExternalIdentity{Provider: "company", Subject: "42", Email: "ken@gmail.com", EmailVerified: true}).
+		Return(&models.UserIdentityResponse{Provider: "company"}, nil)
+	recorder = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/api/v1/auth/sso/company/callback?code=good&state="+location.Query().Get("state"), nil)
+	require.NoError(t, err)
+	req.RemoteAddr = "192.0.2.24:4321"
+	req.AddCookie(cookies[0])
+	testServer.router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "company account linked")
+}
+
+func Test_UnlinkIdentity(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockService := mocks.NewMockIdentityService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.IdentityService = mockService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+	mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+	mockService.EXPECT().UnlinkIdentity(&user, "google").Return(nil)
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodDelete, "/api/v1/me/identities/google", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+	testServer.router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
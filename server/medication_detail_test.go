@@ -5,7 +5,6 @@ import (
 	"github.com/decagonhq/meddle-api/config"
 	"github.com/decagonhq/meddle-api/mocks"
 	"github.com/decagonhq/meddle-api/models"
-	"github.com/decagonhq/meddle-api/services/jwt"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"net/http"
@@ -39,18 +38,19 @@ func Test_MedicationDetail(t *testing.T) {
 		UserID:                 1,
 	}
 	conf.JWTSecret = "testSecret"
-	token, err := jwt.GenerateToken(user.Email, conf.JWTSecret)
+	sessionService, _, token := startTestSession(t, user, conf)
 
 	s := &Server{
 		Config:            conf,
 		AuthRepository:    repo,
 		AuthService:       auth,
 		MedicationService: med,
+		SessionService:    sessionService,
 	}
 
 	//repo.EXPECT().AddToBlackList(&models.BlackList{Email: user.Email, Token: token}).Return(nil)
 	repo.EXPECT().TokenInBlacklist(token).Return(false)
-	med.EXPECT().GetMedicationDetail(uint(1), user.ID).Return(medication, nil)
+	med.EXPECT().GetMedicationDetail(uint(1), user.ID, uint(0)).Return(medication, nil)
 	repo.EXPECT().FindUserByEmail(user.Email).Return(user, nil)
 
 	r := s.setupRouter()
@@ -1,11 +1,9 @@
 package server
 
 import (
-	"github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/models"
 	"github.com/decagonhq/meddle-api/server/response"
 	"github.com/gin-gonic/gin"
-	"log"
 	"net/http"
 	"strconv"
 )
@@ -24,6 +22,8 @@ func (s *Server) handleCreateMedication() gin.HandlerFunc {
 			return
 		}
 		medicationRequest.UserID = userId
+		medicationRequest.TimeZone = user.TimeZone
+		medicationRequest.ProfileID = selectedProfileID(c)
 		createdMedication, err := s.MedicationService.CreateMedication(&medicationRequest)
 		if err != nil {
 			err.Respond(c)
@@ -46,9 +46,9 @@ func (s *Server) handleGetMedDetail() gin.HandlerFunc {
 			response.JSON(c, "error parsing id", http.StatusBadRequest, nil, errr)
 			return
 		}
-		medication, err := s.MedicationService.GetMedicationDetail(uint(userId), user.ID)
+		medication, err := s.MedicationService.GetMedicationDetail(uint(userId), user.ID, selectedProfileID(c))
 		if err != nil {
-			response.JSON(c, "", http.StatusInternalServerError, nil, errors.New("internal server error", http.StatusInternalServerError))
+			err.Respond(c)
 			return
 		}
 		response.JSON(c, "retrieved medications successfully", http.StatusOK, gin.H{"medication": medication}, nil)
@@ -62,12 +62,18 @@ func (s *Server) handleGetAllMedications() gin.HandlerFunc {
 			err.Respond(c)
 			return
 		}
-		medications, err := s.MedicationService.GetAllMedications(user.ID)
+		var query models.PageQuery
+		if err := decodeQuery(c, &query); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		query.ProfileID = selectedProfileID(c)
+		medications, meta, err := s.MedicationService.GetAllMedications(user.ID, &query)
 		if err != nil {
 			err.Respond(c)
 			return
 		}
-		response.JSON(c, "medications retrieved successfully", http.StatusOK, medications, nil)
+		response.Paginated(c, "medications retrieved successfully", http.StatusOK, medications, meta)
 	}
 }
 
@@ -79,12 +85,18 @@ func (s *Server) handleGetNextMedication() gin.HandlerFunc {
 			return
 		}
 
-		medication, err := s.MedicationService.GetNextMedications(user.ID)
+		var query models.PageQuery
+		if err := decodeQuery(c, &query); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		query.ProfileID = selectedProfileID(c)
+		medication, meta, err := s.MedicationService.GetNextMedications(user.ID, &query)
 		if err != nil {
 			err.Respond(c)
 			return
 		}
-		response.JSON(c, "medication retrieved successfully", http.StatusOK, medication, nil)
+		response.Paginated(c, "medication retrieved successfully", http.StatusOK, medication, meta)
 	}
 }
 
@@ -105,34 +117,242 @@ func (s *Server) handleUpdateMedication() gin.HandlerFunc {
 			response.JSON(c, "", http.StatusBadRequest, nil, err)
 			return
 		}
-		err = s.MedicationService.UpdateMedication(&updateMedicationRequest, uint(medicationID), user.ID)
+		updateMedicationRequest.TimeZone = user.TimeZone
+		medication, err := s.MedicationService.UpdateMedication(&updateMedicationRequest, uint(medicationID), user.ID, selectedProfileID(c))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "medication updated successfully", http.StatusOK, medication, nil)
+	}
+}
+
+func (s *Server) handleSearchMedications() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var query models.MedicationSearchQuery
+		if err := decodeQuery(c, &query); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		query.ProfileID = selectedProfileID(c)
+		medications, meta, err := s.MedicationService.SearchMedications(user.ID, &query)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.Paginated(c, "medications retrieved successfully", http.StatusOK, medications, meta)
+	}
+}
+
+func (s *Server) handleTakeAsNeededDose() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		medicationID, errr := strconv.ParseUint(c.Param("medicationID"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		medicationHistory, err := s.MedicationService.TakeAsNeededDose(uint(medicationID), user.ID, selectedProfileID(c))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "dose recorded successfully", http.StatusCreated, medicationHistory, nil)
+	}
+}
+
+func (s *Server) handleRecordRefill() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		medicationID, errr := strconv.ParseUint(c.Param("medicationID"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		var refillRequest models.RefillRequest
+		if err := decode(c, &refillRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		medication, err := s.MedicationService.RecordRefill(uint(medicationID), user.ID, selectedProfileID(c), &refillRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "refill recorded successfully", http.StatusCreated, medication, nil)
+	}
+}
+
+func (s *Server) handlePauseMedication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		medicationID, errr := strconv.ParseUint(c.Param("medicationID"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		medication, err := s.MedicationService.PauseMedication(uint(medicationID), user.ID, selectedProfileID(c))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "medication paused successfully", http.StatusOK, medication, nil)
+	}
+}
+
+func (s *Server) handleResumeMedication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		medicationID, errr := strconv.ParseUint(c.Param("medicationID"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		// the body is optional, an empty one resumes without extending
+		var resumeRequest models.ResumeMedicationRequest
+		if c.Request.ContentLength > 0 {
+			if err := decode(c, &resumeRequest); err != nil {
+				response.JSON(c, "", http.StatusBadRequest, nil, err)
+				return
+			}
+		}
+		medication, err := s.MedicationService.ResumeMedication(uint(medicationID), user.ID, selectedProfileID(c), &resumeRequest)
 		if err != nil {
 			err.Respond(c)
 			return
 		}
-		response.JSON(c, "medication updated successfully", http.StatusOK, nil, nil)
+		response.JSON(c, "medication resumed successfully", http.StatusOK, medication, nil)
 	}
 }
 
-func (s *Server) handleFindMedication() gin.HandlerFunc {
+func (s *Server) handleDiscontinueMedication() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		medicationID, errr := strconv.ParseUint(c.Param("medicationID"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		var discontinueRequest models.DiscontinueMedicationRequest
+		if err := decode(c, &discontinueRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		medication, err := s.MedicationService.DiscontinueMedication(uint(medicationID), user.ID, selectedProfileID(c), &discontinueRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "medication discontinued successfully", http.StatusOK, medication, nil)
+	}
+}
 
-		medicationName := c.Query("name")
-		medicationDosage := c.Query("dosage")
-		medicationDuration := c.Query("duration")
-		medicationPrescribedBy := c.Query("medication_prescribed_by")
-		medicationPurpose := c.Query("purpose_of_medication")
+func (s *Server) handleDeleteMedication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		medicationID, errr := strconv.ParseUint(c.Param("medicationID"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.MedicationService.DeleteMedication(uint(medicationID), user.ID, selectedProfileID(c)); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "medication deleted successfully", http.StatusOK, nil, nil)
+	}
+}
 
-		dosage,_ := strconv.Atoi(medicationDosage)
-		medDuration,_ := strconv.Atoi(medicationDuration)
+func (s *Server) handleRestoreMedication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		medicationID, errr := strconv.ParseUint(c.Param("medicationID"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		medication, err := s.MedicationService.RestoreMedication(uint(medicationID), user.ID, selectedProfileID(c))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "medication restored successfully", http.StatusOK, medication, nil)
+	}
+}
 
-		medications, err := s.MedicationService.FindMedication(medicationName, medicationPrescribedBy, medicationPurpose, medDuration, dosage)
+func (s *Server) handleGetArchivedMedications() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var query models.PageQuery
+		if err := decodeQuery(c, &query); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		query.ProfileID = selectedProfileID(c)
+		medications, meta, err := s.MedicationService.GetArchivedMedications(user.ID, &query)
 		if err != nil {
-			log.Printf("Error1: %v", err.Error())
-			response.JSON(c, "", http.StatusInternalServerError, nil, errors.New("internal server error", http.StatusInternalServerError))
+			err.Respond(c)
 			return
 		}
-		response.JSON(c, "medications retrieved successfully", http.StatusOK, medications, nil)
+		response.Paginated(c, "archived medications retrieved successfully", http.StatusOK, medications, meta)
 	}
 }
 
+func (s *Server) handleCheckInteractions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var checkRequest models.InteractionCheckRequest
+		if err := decode(c, &checkRequest); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		checkRequest.ProfileID = selectedProfileID(c)
+		warnings, err := s.MedicationService.CheckInteractions(user.ID, &checkRequest)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "interactions checked successfully", http.StatusOK, warnings, nil)
+	}
+}
@@ -24,11 +24,10 @@ func TestCreateMedicationHandler(t *testing.T) {
 	startTime, _ := time.Parse(time.RFC3339, "2013-10-21T13:28:06.419Z")
 
 	medication := &models.Medication{
-		Model: models.Model{
+		SoftDeleteModel: models.SoftDeleteModel{
 			ID:        1,
 			CreatedAt: time.Now().Unix(),
 			UpdatedAt: time.Now().Unix(),
-			DeletedAt: 0,
 		},
 		Name:                   "paracetamol",
 		Dosage:                 2,
@@ -283,17 +282,18 @@ func TestGetAllMedicationHandler(t *testing.T) {
 				},
 			},
 			buildStubs: func(service *mocks.MockMedicationService, request uint, response []models.MedicationResponse) {
-				service.EXPECT().GetAllMedications(request).Times(1).Return(response, nil)
+				service.EXPECT().GetAllMedications(request, &models.PageQuery{}).Times(1).Return(response, &models.PageMeta{Limit: 50}, nil)
 			},
 			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"meta":{"limit":50,"has_more":false}`)
 			},
 		},
 		{
 			name:               "internal server error",
 			medicationResponse: nil,
 			buildStubs: func(service *mocks.MockMedicationService, request uint, response []models.MedicationResponse) {
-				service.EXPECT().GetAllMedications(request).Times(1).Return(nil, errors.ErrInternalServerError)
+				service.EXPECT().GetAllMedications(request, &models.PageQuery{}).Times(1).Return(nil, nil, errors.ErrInternalServerError)
 			},
 			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
@@ -377,7 +377,7 @@ func TestGetNextMedicationHandler(t *testing.T) {
 				},
 			},
 			buildStubs: func(service *mocks.MockMedicationService, request uint, response []models.MedicationResponse) {
-				service.EXPECT().GetNextMedications(request).Times(1).Return(response, nil)
+				service.EXPECT().GetNextMedications(request, &models.PageQuery{}).Times(1).Return(response, &models.PageMeta{Limit: 50}, nil)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -387,7 +387,7 @@ func TestGetNextMedicationHandler(t *testing.T) {
 			name:               "internal server error",
 			medicationResponse: nil,
 			buildStubs: func(service *mocks.MockMedicationService, request uint, response []models.MedicationResponse) {
-				service.EXPECT().GetNextMedications(request).Times(1).Return(nil, errors.ErrInternalServerError)
+				service.EXPECT().GetNextMedications(request, &models.PageQuery{}).Times(1).Return(nil, nil, errors.ErrInternalServerError)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
@@ -477,7 +477,7 @@ func Test_UpdateMedicationHandler(t *testing.T) {
 			medicationID: 1,
 			routeParam:   "1",
 			buildStubs: func(service *mocks.MockMedicationService, request models.UpdateMedicationRequest, medicationID uint, userID uint, errorResponse *errors.Error) {
-				service.EXPECT().UpdateMedication(&request, medicationID, userID).Times(1).Return(errorResponse)
+				service.EXPECT().UpdateMedication(&request, medicationID, userID, uint(0)).Times(1).Return(&models.MedicationResponse{ID: medicationID}, errorResponse)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -511,7 +511,7 @@ func Test_UpdateMedicationHandler(t *testing.T) {
 			routeParam:    "1",
 			errorResponse: errors.ErrInternalServerError,
 			buildStubs: func(service *mocks.MockMedicationService, request models.UpdateMedicationRequest, medicationID uint, userID uint, errorResponse *errors.Error) {
-				service.EXPECT().UpdateMedication(&request, medicationID, userID).Times(1).Return(errorResponse)
+				service.EXPECT().UpdateMedication(&request, medicationID, userID, uint(0)).Times(1).Return(nil, errorResponse)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
@@ -521,7 +521,7 @@ func Test_UpdateMedicationHandler(t *testing.T) {
 			name:       "bad request from route param",
 			routeParam: "a",
 			buildStubs: func(service *mocks.MockMedicationService, request models.UpdateMedicationRequest, medicationID uint, userID uint, errorResponse *errors.Error) {
-				service.EXPECT().UpdateMedication(&request, medicationID, userID).Times(0).Return(errorResponse)
+				service.EXPECT().UpdateMedication(&request, medicationID, userID, uint(0)).Times(0).Return(nil, errorResponse)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusBadRequest, recorder.Code)
@@ -557,3 +557,136 @@ func Test_UpdateMedicationHandler(t *testing.T) {
 		})
 	}
 }
+
+func Test_DeleteMedicationHandler(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+
+	testCases := []struct {
+		name          string
+		routeParam    string
+		buildStubs    func(service *mocks.MockMedicationService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:       "success case",
+			routeParam: "1",
+			buildStubs: func(service *mocks.MockMedicationService) {
+				service.EXPECT().DeleteMedication(uint(1), user.ID, uint(0)).Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:       "medication not found",
+			routeParam: "2",
+			buildStubs: func(service *mocks.MockMedicationService) {
+				service.EXPECT().DeleteMedication(uint(2), user.ID, uint(0)).Times(1).Return(errors.ErrNotFound)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:       "bad request from route param",
+			routeParam: "a",
+			buildStubs: func(service *mocks.MockMedicationService) {
+				service.EXPECT().DeleteMedication(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockMedicationService := mocks.NewMockMedicationService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.MedicationService = mockMedicationService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockMedicationService)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("/api/v1/user/medications/%v", tc.routeParam), nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func Test_SearchMedicationsHandler(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(service *mocks.MockMedicationService, userID uint)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "success case",
+			query: "name=para&status=active&sort=-name&limit=2",
+			buildStubs: func(service *mocks.MockMedicationService, userID uint) {
+				query := &models.MedicationSearchQuery{PageQuery: models.PageQuery{Status: "active", Sort: "-name", Limit: 2}, Name: "para"}
+				service.EXPECT().SearchMedications(userID, query).Times(1).
+					Return([]models.MedicationResponse{}, &models.PageMeta{Limit: 2}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:  "invalid limit",
+			query: "limit=-1",
+			buildStubs: func(service *mocks.MockMedicationService, userID uint) {
+				service.EXPECT().SearchMedications(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "invalid filter",
+			query: "start_from=yesterday",
+			buildStubs: func(service *mocks.MockMedicationService, userID uint) {
+				service.EXPECT().SearchMedications(userID, gomock.Any()).Times(1).
+					Return(nil, nil, errors.New("start_from must be an RFC3339 date", http.StatusBadRequest))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockMedicationService := mocks.NewMockMedicationService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.MedicationService = mockMedicationService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockMedicationService, user.ID)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/user/medications/search?%s", tc.query), nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
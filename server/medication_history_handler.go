@@ -1,6 +1,7 @@
 package server
 
 import (
+	"github.com/decagonhq/meddle-api/models"
 	"github.com/decagonhq/meddle-api/server/response"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -19,19 +20,17 @@ func (s *Server) handleUpdateMedicationHistory() gin.HandlerFunc {
 			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
 			return
 		}
-		medicationHistoryRequest := struct {
-			HasMedicationBeenTaken bool `json:"has_medication_been_taken"`
-		}{}
+		var medicationHistoryRequest models.UpdateMedicationHistoryRequest
 		if err := decode(c, &medicationHistoryRequest); err != nil {
 			response.JSON(c, "", http.StatusBadRequest, nil, err)
 			return
 		}
-		err = s.MedicationHistoryService.UpdateMedicationHistory(medicationHistoryRequest.HasMedicationBeenTaken, uint(medicationHistoryID), user.ID)
+		medicationHistory, err := s.MedicationHistoryService.UpdateMedicationHistory(&medicationHistoryRequest, uint(medicationHistoryID), user.ID, selectedProfileID(c))
 		if err != nil {
 			err.Respond(c)
 			return
 		}
-		response.JSON(c, "medication history updated successfully", http.StatusOK, nil, nil)
+		response.JSON(c, "medication history updated successfully", http.StatusOK, medicationHistory, nil)
 	}
 }
 
@@ -42,11 +41,79 @@ func (s *Server) handleGetAllMedicationHistoryByUser() gin.HandlerFunc {
 			err.Respond(c)
 			return
 		}
-		medicationHistories, err := s.MedicationHistoryService.GetAllMedicationHistoryByUser(user.ID)
+		var query models.PageQuery
+		if err := decodeQuery(c, &query); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		query.ProfileID = selectedProfileID(c)
+		medicationHistories, meta, err := s.MedicationHistoryService.GetAllMedicationHistoryByUser(user.ID, &query)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.Paginated(c, "medication history retrieved successfully", http.StatusOK, medicationHistories, meta)
+	}
+}
+
+func (s *Server) handleDeleteMedicationHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		medicationHistoryID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.MedicationHistoryService.DeleteMedicationHistory(uint(medicationHistoryID), user.ID, selectedProfileID(c)); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "medication history deleted successfully", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleRestoreMedicationHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		medicationHistoryID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.MedicationHistoryService.RestoreMedicationHistory(uint(medicationHistoryID), user.ID, selectedProfileID(c)); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "medication history restored successfully", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleGetAdherence() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var query models.AdherenceQuery
+		if err := decodeQuery(c, &query); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		query.ProfileID = selectedProfileID(c)
+		report, err := s.MedicationHistoryService.GetAdherence(user.ID, &query)
 		if err != nil {
 			err.Respond(c)
 			return
 		}
-		response.JSON(c, "medication history retrieved successfully", http.StatusOK, medicationHistories, nil)
+		response.JSON(c, "adherence retrieved successfully", http.StatusOK, report, nil)
 	}
 }
@@ -27,21 +27,21 @@ func Test_UpdateMedicationHistoryHandler(t *testing.T) {
 		reqBody             interface{}
 		routeParam          string
 		medicationHistoryID uint
-		reqBodyValue        bool
+		reqBodyValue        *models.UpdateMedicationHistoryRequest
 		errorResponse       *errors.Error
-		buildStubs          func(service *mocks.MockMedicationHistoryService, reqBodyValue bool, medicationHistoryID uint, userID uint, errorResponse *errors.Error)
+		buildStubs          func(service *mocks.MockMedicationHistoryService, reqBodyValue *models.UpdateMedicationHistoryRequest, medicationHistoryID uint, userID uint, errorResponse *errors.Error)
 		checkResponse       func(t *testing.T, recorder *httptest.ResponseRecorder)
 	}{
 		{
 			name: "success case",
 			reqBody: gin.H{
-				"has_medication_been_taken": true,
+				"status": "taken",
 			},
-			reqBodyValue:        true,
+			reqBodyValue:        &models.UpdateMedicationHistoryRequest{Status: "taken"},
 			medicationHistoryID: 1,
 			routeParam:          "1",
-			buildStubs: func(service *mocks.MockMedicationHistoryService, reqBodyValue bool, medicationID uint, userID uint, errorResponse *errors.Error) {
-				service.EXPECT().UpdateMedicationHistory(reqBodyValue, medicationID, userID).Times(1).Return(errorResponse)
+			buildStubs: func(service *mocks.MockMedicationHistoryService, reqBodyValue *models.UpdateMedicationHistoryRequest, medicationID uint, userID uint, errorResponse *errors.Error) {
+				service.EXPECT().UpdateMedicationHistory(reqBodyValue, medicationID, userID, uint(0)).Times(1).Return(&models.MedicationHistoryResponse{ID: medicationID, Status: models.DoseOnTime}, nil)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -50,24 +50,38 @@ func Test_UpdateMedicationHistoryHandler(t *testing.T) {
 		{
 			name: "internal server error",
 			reqBody: gin.H{
-				"has_medication_been_taken": true,
+				"status": "taken",
 			},
-			reqBodyValue:        true,
+			reqBodyValue:        &models.UpdateMedicationHistoryRequest{Status: "taken"},
 			medicationHistoryID: 1,
 			routeParam:          "1",
 			errorResponse:       errors.ErrInternalServerError,
-			buildStubs: func(service *mocks.MockMedicationHistoryService, reqBodyValue bool, medicationID uint, userID uint, errorResponse *errors.Error) {
-				service.EXPECT().UpdateMedicationHistory(reqBodyValue, medicationID, userID).Times(1).Return(errorResponse)
+			buildStubs: func(service *mocks.MockMedicationHistoryService, reqBodyValue *models.UpdateMedicationHistoryRequest, medicationID uint, userID uint, errorResponse *errors.Error) {
+				service.EXPECT().UpdateMedicationHistory(reqBodyValue, medicationID, userID, uint(0)).Times(1).Return(nil, errorResponse)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
 			},
 		},
+		{
+			name: "invalid status",
+			reqBody: gin.H{
+				"status": "forgotten",
+			},
+			medicationHistoryID: 1,
+			routeParam:          "1",
+			buildStubs: func(service *mocks.MockMedicationHistoryService, reqBodyValue *models.UpdateMedicationHistoryRequest, medicationID uint, userID uint, errorResponse *errors.Error) {
+				service.EXPECT().UpdateMedicationHistory(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
 		{
 			name:       "bad request from route param",
 			routeParam: "a",
-			buildStubs: func(service *mocks.MockMedicationHistoryService, reqBodyValue bool, medicationID uint, userID uint, errorResponse *errors.Error) {
-				service.EXPECT().UpdateMedicationHistory(reqBodyValue, medicationID, userID).Times(0).Return(errorResponse)
+			buildStubs: func(service *mocks.MockMedicationHistoryService, reqBodyValue *models.UpdateMedicationHistoryRequest, medicationID uint, userID uint, errorResponse *errors.Error) {
+				service.EXPECT().UpdateMedicationHistory(reqBodyValue, medicationID, userID, uint(0)).Times(0)
 			},
 			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusBadRequest, recorder.Code)
@@ -117,7 +131,6 @@ func TestGetAllMedicationHistoryByUserHandler(t *testing.T) {
 		MedicationDosage:       2,
 		UserID:                 user.ID,
 		HasMedicationBeenTaken: false,
-		WasMedicationMissed:    "",
 	}
 
 	// test cases
@@ -140,7 +153,6 @@ func TestGetAllMedicationHistoryByUserHandler(t *testing.T) {
 					MedicationTime:         medicationHistory.MedicationTime.String(),
 					UserID:                 user.ID,
 					HasMedicationBeenTaken: false,
-					WasMedicationMissed:    "",
 				},
 				{
 					ID:                     medicationHistory.ID + 1,
@@ -152,11 +164,11 @@ func TestGetAllMedicationHistoryByUserHandler(t *testing.T) {
 					MedicationTime:         medicationHistory.MedicationTime.String(),
 					UserID:                 user.ID,
 					HasMedicationBeenTaken: true,
-					WasMedicationMissed:    "YES",
+					Status:                 models.DoseOnTime,
 				},
 			},
 			buildStubs: func(service *mocks.MockMedicationHistoryService, request uint, response []models.MedicationHistoryResponse) {
-				service.EXPECT().GetAllMedicationHistoryByUser(request).Times(1).Return(response, nil)
+				service.EXPECT().GetAllMedicationHistoryByUser(request, &models.PageQuery{}).Times(1).Return(response, &models.PageMeta{Limit: 50}, nil)
 			},
 			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
@@ -166,7 +178,7 @@ func TestGetAllMedicationHistoryByUserHandler(t *testing.T) {
 			name:               "internal server error",
 			medicationResponse: nil,
 			buildStubs: func(service *mocks.MockMedicationHistoryService, request uint, response []models.MedicationHistoryResponse) {
-				service.EXPECT().GetAllMedicationHistoryByUser(request).Times(1).Return(nil, errors.ErrInternalServerError)
+				service.EXPECT().GetAllMedicationHistoryByUser(request, &models.PageQuery{}).Times(1).Return(nil, nil, errors.ErrInternalServerError)
 			},
 			checkCodeResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
@@ -200,3 +212,74 @@ func TestGetAllMedicationHistoryByUserHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestGetAdherenceHandler(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(service *mocks.MockMedicationHistoryService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "success case",
+			query: "?from=2022-08-01T00:00:00Z&period=week&medication_id=3",
+			buildStubs: func(service *mocks.MockMedicationHistoryService) {
+				service.EXPECT().GetAdherence(user.ID, &models.AdherenceQuery{From: "2022-08-01T00:00:00Z", Period: "week", MedicationID: 3}).
+					Times(1).Return(&models.AdherenceReport{Period: "week", Overall: models.AdherenceStats{Taken: 3, Adherence: 100}}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var body struct {
+					Data models.AdherenceReport `json:"data"`
+				}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+				require.Equal(t, float64(100), body.Data.Overall.Adherence)
+			},
+		},
+		{
+			name:  "invalid period",
+			query: "?period=year",
+			buildStubs: func(service *mocks.MockMedicationHistoryService) {
+				service.EXPECT().GetAdherence(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "internal server error",
+			query: "",
+			buildStubs: func(service *mocks.MockMedicationHistoryService) {
+				service.EXPECT().GetAdherence(user.ID, &models.AdherenceQuery{}).Times(1).Return(nil, errors.ErrInternalServerError)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockMedicationHistoryService := mocks.NewMockMedicationHistoryService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.MedicationHistoryService = mockMedicationHistoryService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockMedicationHistoryService)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, "/api/v1/user/medication-history/adherence"+tc.query, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -3,11 +3,13 @@ package server
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	ratelimit "github.com/JGLTechnologies/gin-rate-limit"
 	"github.com/decagonhq/meddle-api/services/jwt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"gorm.io/gorm"
@@ -21,6 +23,11 @@ import (
 // Authorize authorizes a request
 func (s *Server) Authorize() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// acceptAPIKey already authorized the requests with an API key
+		if _, ok := c.Get("api_key"); ok {
+			c.Next()
+			return
+		}
 		secret := s.Config.JWTSecret
 		accessToken := getTokenFromHeader(c)
 		accessClaims, err := jwt.ValidateAndGetClaims(accessToken, secret)
@@ -29,6 +36,17 @@ func (s *Server) Authorize() gin.HandlerFunc {
 			return
 		}
 
+		if jwt.GetPurpose(accessClaims) != "" {
+			respondAndAbort(c, "", http.StatusUnauthorized, nil, errs.New("invalid token", http.StatusUnauthorized))
+			return
+		}
+		// a token without a session could never be revoked
+		sessionID, ok := jwt.GetSessionID(accessClaims)
+		if !ok {
+			respondAndAbort(c, "", http.StatusUnauthorized, nil, errs.New("invalid token", http.StatusUnauthorized))
+			return
+		}
+
 		if s.AuthRepository.TokenInBlacklist(accessToken) {
 			respondAndAbort(c, "expired token", http.StatusUnauthorized, nil, errs.New("expired token", http.StatusUnauthorized))
 			return
@@ -60,6 +78,18 @@ func (s *Server) Authorize() gin.HandlerFunc {
 			return
 		}
 
+		if user.Deactivated() {
+			respondAndAbort(c, "", http.StatusForbidden, nil, errs.ErrAccountDeactivated)
+			return
+		}
+
+		// the access tokens of a session stop working as soon as it is revoked
+		if err := s.SessionService.CheckSession(sessionID, user.ID); err != nil {
+			respondAndAbort(c, "", err.Status, nil, err)
+			return
+		}
+		c.Set("session_id", sessionID)
+
 		c.Set("access_token", accessToken)
 		c.Set("user", user)
 
@@ -67,20 +97,161 @@ func (s *Server) Authorize() gin.HandlerFunc {
 	}
 }
 
-func limitRateForPasswordReset(store ratelimit.Store) gin.HandlerFunc {
-	store = ratelimit.InMemoryStore(&ratelimit.InMemoryOptions{
-		Rate:  time.Hour * 24,
-		Limit: 3,
+// acceptAPIKey lets the routes after it take personal API keys instead of
+// access tokens, when the key has the read scope for GET or the write scope
+// otherwise. It goes before Authorize, which the requests without a key go on
+// to
+func (s *Server) acceptAPIKey(read, write models.APIScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := getTokenFromHeader(c)
+		if !models.IsAPIKey(key) {
+			c.Next()
+			return
+		}
+		apiKey, err := s.APIKeyService.AuthenticateAPIKey(key)
+		if err != nil {
+			respondAndAbort(c, "", err.Status, nil, err)
+			return
+		}
+		scope := write
+		if c.Request.Method == http.MethodGet {
+			scope = read
+		}
+		if !apiKey.Allows(scope) {
+			respondAndAbort(c, "", http.StatusForbidden, nil, errs.New(fmt.Sprintf("the API key needs the %s scope", scope), http.StatusForbidden))
+			return
+		}
+		user := apiKey.User
+		if !user.IsEmailActive {
+			respondAndAbort(c, "user needs to be verified", http.StatusUnauthorized, nil, errs.New("email not verified", http.StatusUnauthorized))
+			return
+		}
+		if user.Deactivated() {
+			respondAndAbort(c, "", http.StatusForbidden, nil, errs.ErrAccountDeactivated)
+			return
+		}
+		// keys made before a forced reset are revoked with it, this covers the
+		// ones in use until then
+		if user.PasswordResetRequired {
+			respondAndAbort(c, "", http.StatusUnauthorized, nil, errs.New("API key expired or revoked", http.StatusUnauthorized))
+			return
+		}
+
+		c.Set("api_key", apiKey)
+		c.Set("access_token", key)
+		c.Set("user", user)
+		c.Next()
+	}
+}
+
+// requirePermission lets only the users whose role allows the permission use
+// the routes after it
+func (s *Server) requirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			respondAndAbort(c, "", err.Status, nil, err)
+			return
+		}
+		if !user.Role.Can(permission) {
+			respondAndAbort(c, "", http.StatusForbidden, nil, errs.New("you are not allowed to do this", http.StatusForbidden))
+			return
+		}
+		c.Next()
+	}
+}
+
+// actAsPatient lets a caregiver use the routes after it on the medications of
+// the user in the patientID param, when they have the permission. The handlers
+// find the patient as the user and the caregiver under "caregiver"
+func (s *Server) actAsPatient(permission models.CaregiverPermission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, caregiver, err := GetValuesFromContext(c)
+		if err != nil {
+			respondAndAbort(c, "", err.Status, nil, err)
+			return
+		}
+		patientID, errr := strconv.ParseUint(c.Param("patientID"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			c.Abort()
+			return
+		}
+		patient, err := s.CaregiverService.AuthorizeCaregiver(caregiver.ID, uint(patientID), permission)
+		if err != nil {
+			respondAndAbort(c, "", err.Status, nil, err)
+			return
+		}
+		c.Set("caregiver", caregiver)
+		c.Set("user", patient)
+		c.Next()
+	}
+}
+
+// selectProfile selects, for the routes after it, the dependent of the user in
+// the profile_id query. Without one the routes act for the user themselves
+func (s *Server) selectProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value := c.Query("profile_id")
+		if value == "" {
+			c.Next()
+			return
+		}
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			respondAndAbort(c, "", err.Status, nil, err)
+			return
+		}
+		profileID, errr := strconv.ParseUint(value, 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid profile_id", http.StatusBadRequest, nil, errr)
+			c.Abort()
+			return
+		}
+		profile, err := s.ProfileService.GetProfile(uint(profileID), user.ID)
+		if err != nil {
+			respondAndAbort(c, "", err.Status, nil, err)
+			return
+		}
+		c.Set("profile", profile)
+		c.Next()
+	}
+}
+
+// Requests per minute from an address when the config doesn't set them
+const (
+	defaultAuthRateLimit = 20
+	defaultAPIRateLimit  = 600
+)
+
+// limitRate lets through limit requests with the same key every rate, each
+// call counts its requests on its own so route groups get their own limits
+func limitRate(rate time.Duration, limit uint, key func(c *gin.Context) string) gin.HandlerFunc {
+	store := ratelimit.InMemoryStore(&ratelimit.InMemoryOptions{
+		Rate:  rate,
+		Limit: limit,
 	})
-	mw := ratelimit.RateLimiter(store, &ratelimit.Options{
-		ErrorHandler:   errs.ErrorHandler,
-		KeyFunc:        keyFunc,
-		BeforeResponse: nil,
+	return ratelimit.RateLimiter(store, &ratelimit.Options{
+		ErrorHandler: errs.ErrorHandler,
+		KeyFunc:      key,
 	})
-	return mw
 }
 
-func keyFunc(c *gin.Context) string {
+// limitRatePerMinute limits the requests from an address to the configured
+// rate, or to the default one
+func limitRatePerMinute(configured, defaultLimit int) gin.HandlerFunc {
+	if configured <= 0 {
+		configured = defaultLimit
+	}
+	return limitRate(time.Minute, uint(configured), keyByIP)
+}
+
+func keyByIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// keyByEmail keys the request by the email in its body
+func keyByEmail(c *gin.Context) string {
 	//TODO Handle when email isn't sent successfully in any of the three tries
 	//b1, err := c.Request.GetBody()
 	buf, err := ioutil.ReadAll(c.Request.Body)
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleCreateProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var request models.CreateProfileRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		profile, err := s.ProfileService.CreateProfile(user.ID, &request)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "profile created successfully", http.StatusCreated, profile, nil)
+	}
+}
+
+func (s *Server) handleGetProfiles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		profiles, err := s.ProfileService.GetProfiles(user.ID)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "profiles retrieved successfully", http.StatusOK, profiles, nil)
+	}
+}
+
+func (s *Server) handleUpdateProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		profileID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		var request models.UpdateProfileRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		profile, err := s.ProfileService.UpdateProfile(uint(profileID), user.ID, &request)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "profile updated successfully", http.StatusOK, profile, nil)
+	}
+}
+
+func (s *Server) handleDeleteProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		profileID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.ProfileService.DeleteProfile(uint(profileID), user.ID); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "profile deleted successfully", http.StatusOK, nil, nil)
+	}
+}
+
+// selectedProfileID returns the id of the dependent selectProfile selected, 0
+// when the request is for the user themselves
+func selectedProfileID(c *gin.Context) uint {
+	if profile, ok := c.Get("profile"); ok {
+		if profile, ok := profile.(*models.Profile); ok {
+			return profile.ID
+		}
+	}
+	return 0
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_CreateProfileHandler(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+
+	testCases := []struct {
+		name          string
+		reqBody       interface{}
+		buildStubs    func(service *mocks.MockProfileService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "success case",
+			reqBody: gin.H{"name": "Tobi", "date_of_birth": "2018-03-01", "weight_kg": 18.5},
+			buildStubs: func(service *mocks.MockProfileService) {
+				weight := 18.5
+				service.EXPECT().CreateProfile(user.ID, &models.CreateProfileRequest{Name: "Tobi", DateOfBirth: "2018-03-01", WeightKg: &weight}).
+					Times(1).Return(&models.ProfileResponse{ID: 4, Name: "Tobi", DateOfBirth: "2018-03-01"}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:    "missing date of birth",
+			reqBody: gin.H{"name": "Tobi"},
+			buildStubs: func(service *mocks.MockProfileService) {
+				service.EXPECT().CreateProfile(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "negative weight",
+			reqBody: gin.H{"name": "Tobi", "date_of_birth": "2018-03-01", "weight_kg": -2},
+			buildStubs: func(service *mocks.MockProfileService) {
+				service.EXPECT().CreateProfile(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockProfileService := mocks.NewMockProfileService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.ProfileService = mockProfileService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockProfileService)
+
+			body, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/api/v1/user/profiles", strings.NewReader(string(body)))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func Test_SelectProfile(t *testing.T) {
+	accToken, user := AuthorizeTestUser(t)
+	profile := &models.Profile{Model: models.Model{ID: 4}, UserID: user.ID, Name: "Tobi"}
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		buildStubs    func(profiles *mocks.MockProfileService, medications *mocks.MockMedicationService, histories *mocks.MockMedicationHistoryService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "lists the medications of the dependent",
+			path: "/api/v1/user/medications?profile_id=4",
+			buildStubs: func(profiles *mocks.MockProfileService, medications *mocks.MockMedicationService, histories *mocks.MockMedicationHistoryService) {
+				profiles.EXPECT().GetProfile(uint(4), user.ID).Return(profile, nil)
+				medications.EXPECT().GetAllMedications(user.ID, &models.PageQuery{ProfileID: 4}).Return([]models.MedicationResponse{}, &models.PageMeta{Limit: 50}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "lists the history of the dependent",
+			path: "/api/v1/user/medication-history?profile_id=4&status=missed",
+			buildStubs: func(profiles *mocks.MockProfileService, medications *mocks.MockMedicationService, histories *mocks.MockMedicationHistoryService) {
+				profiles.EXPECT().GetProfile(uint(4), user.ID).Return(profile, nil)
+				histories.EXPECT().GetAllMedicationHistoryByUser(user.ID, &models.PageQuery{Status: "missed", ProfileID: 4}).Return([]models.MedicationHistoryResponse{}, &models.PageMeta{Limit: 50}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "gets a medication of the dependent",
+			path: "/api/v1/user/medications/12?profile_id=4",
+			buildStubs: func(profiles *mocks.MockProfileService, medications *mocks.MockMedicationService, histories *mocks.MockMedicationHistoryService) {
+				profiles.EXPECT().GetProfile(uint(4), user.ID).Return(profile, nil)
+				medications.EXPECT().GetMedicationDetail(uint(12), user.ID, uint(4)).Return(&models.MedicationResponse{ID: 12, ProfileID: 4}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "medication of another profile",
+			path: "/api/v1/user/medications/12",
+			buildStubs: func(profiles *mocks.MockProfileService, medications *mocks.MockMedicationService, histories *mocks.MockMedicationHistoryService) {
+				medications.EXPECT().GetMedicationDetail(uint(12), user.ID, uint(0)).Return(nil, errors.ErrNotFound)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "pauses a medication of the dependent",
+			method: http.MethodPost,
+			path:   "/api/v1/user/medications/12/pause?profile_id=4",
+			buildStubs: func(profiles *mocks.MockProfileService, medications *mocks.MockMedicationService, histories *mocks.MockMedicationHistoryService) {
+				profiles.EXPECT().GetProfile(uint(4), user.ID).Return(profile, nil)
+				medications.EXPECT().PauseMedication(uint(12), user.ID, uint(4)).Return(&models.MedicationResponse{ID: 12, ProfileID: 4}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "deletes a dose of the dependent",
+			method: http.MethodDelete,
+			path:   "/api/v1/user/medication-history/3?profile_id=4",
+			buildStubs: func(profiles *mocks.MockProfileService, medications *mocks.MockMedicationService, histories *mocks.MockMedicationHistoryService) {
+				profiles.EXPECT().GetProfile(uint(4), user.ID).Return(profile, nil)
+				histories.EXPECT().DeleteMedicationHistory(uint(3), user.ID, uint(4)).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "profile of another user",
+			path: "/api/v1/user/medications/next?profile_id=9",
+			buildStubs: func(profiles *mocks.MockProfileService, medications *mocks.MockMedicationService, histories *mocks.MockMedicationHistoryService) {
+				profiles.EXPECT().GetProfile(uint(9), user.ID).Return(nil, errors.ErrNotFound)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "invalid profile id",
+			path: "/api/v1/user/medications?profile_id=tobi",
+			buildStubs: func(profiles *mocks.MockProfileService, medications *mocks.MockMedicationService, histories *mocks.MockMedicationHistoryService) {
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockProfileService := mocks.NewMockProfileService(ctrl)
+	mockMedicationService := mocks.NewMockMedicationService(ctrl)
+	mockMedicationHistoryService := mocks.NewMockMedicationHistoryService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.ProfileService = mockProfileService
+	testServer.handler.MedicationService = mockMedicationService
+	testServer.handler.MedicationHistoryService = mockMedicationHistoryService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockProfileService, mockMedicationService, mockMedicationHistoryService)
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(method, tc.path, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
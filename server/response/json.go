@@ -9,18 +9,27 @@ import (
 )
 
 func JSON(c *gin.Context, message string, status int, data interface{}, err error) {
+	c.JSON(status, envelope(message, status, data, err))
+}
+
+// Paginated responds with a page of a list and its pagination metadata
+func Paginated(c *gin.Context, message string, status int, data interface{}, meta interface{}) {
+	responsedata := envelope(message, status, data, nil)
+	responsedata["meta"] = meta
+	c.JSON(status, responsedata)
+}
+
+func envelope(message string, status int, data interface{}, err error) gin.H {
 	errMessage := ""
 	if err != nil {
 		errMessage = err.Error()
 	}
-	responsedata := gin.H{
+	return gin.H{
 		"message": message,
 		"data":    data,
 		"errors":  errMessage,
 		"status":  http.StatusText(status),
 	}
-
-	c.JSON(status, responsedata)
 }
 
 func HandleErrors(c *gin.Context, err error) {
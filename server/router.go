@@ -2,65 +2,170 @@ package server
 
 import (
 	"fmt"
-	rateLimit "github.com/JGLTechnologies/gin-rate-limit"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
+	"github.com/decagonhq/meddle-api/models"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func (s *Server) defineRoutes(router *gin.Engine) {
-	store := rateLimit.InMemoryStore(&rateLimit.InMemoryOptions{})
-	limitRate := limitRateForPasswordReset(store)
-
 	apirouter := router.Group("/api/v1")
-	apirouter.POST("/auth/signup", s.HandleSignup())
-	apirouter.POST("/auth/login", s.handleLogin())
+	auth := apirouter.Group("/auth", limitRatePerMinute(s.Config.AuthRateLimit, defaultAuthRateLimit))
+	auth.POST("/signup", s.HandleSignup())
+	auth.POST("/login", s.handleLogin())
+	auth.POST("/login/2fa", s.handleTwoFactorLogin())
+	auth.POST("/refresh", s.handleRefreshToken())
+	auth.GET("/sso/:provider/login", s.handleSSOLogin(""))
+	auth.GET("/sso/:provider/callback", s.handleSSOCallback(""))
 
-	apirouter.GET("/fb/auth", s.handleFBLogin())
-	apirouter.GET("fb/callback", s.fbCallbackHandler())
+	apirouter.GET("/fb/auth", s.handleSSOLogin("facebook"))
+	apirouter.GET("fb/callback", s.handleSSOCallback("facebook"))
 
-	apirouter.GET("/google/login", s.HandleGoogleOauthLogin())
-	apirouter.GET("/google/callback", s.HandleGoogleCallback())
+	apirouter.GET("/google/login", s.handleSSOLogin("google"))
+	apirouter.GET("/google/callback", s.handleSSOCallback("google"))
 
 	apirouter.GET("/verifyEmail/:token", s.HandleVerifyEmail())
-	apirouter.POST("/password/forgot", limitRate, s.SendEmailForPasswordReset())
+	apirouter.POST("/password/forgot", limitRate(24*time.Hour, 3, keyByEmail), s.SendEmailForPasswordReset())
 	apirouter.POST("/password/reset/:token", s.ResetPassword())
+	apirouter.GET("/digest/unsubscribe/:token", s.handleUnsubscribeDigest())
+	apirouter.GET("/email/verify/:token", s.handleVerifyEmailChange())
 
+	apiRateLimit := limitRatePerMinute(s.Config.APIRateLimit, defaultAPIRateLimit)
 	authorized := apirouter.Group("/")
-	authorized.Use(s.Authorize())
+	authorized.Use(apiRateLimit, s.Authorize())
 	authorized.GET("/logout", s.handleLogout())
-	authorized.GET("/users", s.handleGetUsers())
 	authorized.DELETE("/users", s.handleDeleteUserByEmail())
 	authorized.PUT("/me/update", s.handleUpdateUserDetails())
 	authorized.GET("/me", s.handleShowProfile())
+	authorized.PUT("/me/password", s.handleChangePassword())
+	authorized.PUT("/me/email", s.handleChangeEmail())
+	authorized.GET("/me/digest", s.handleGetDigestSettings())
+	authorized.PUT("/me/digest", s.handleUpdateDigestSettings())
+	authorized.GET("/me/sessions", s.handleGetSessions())
+	authorized.DELETE("/me/sessions", s.handleRevokeSessions())
+	authorized.DELETE("/me/sessions/:id", s.handleRevokeSession())
+	authorized.GET("/me/2fa", s.handleGetTwoFactorStatus())
+	authorized.POST("/me/2fa", s.handleEnrolTwoFactor())
+	authorized.POST("/me/2fa/confirm", s.handleConfirmTwoFactor())
+	authorized.POST("/me/2fa/recovery-codes", s.handleRegenerateRecoveryCodes())
+	authorized.DELETE("/me/2fa", s.handleDisableTwoFactor())
+	authorized.GET("/me/api-keys", s.handleGetAPIKeys())
+	authorized.POST("/me/api-keys", s.handleCreateAPIKey())
+	authorized.DELETE("/me/api-keys/:id", s.handleRevokeAPIKey())
+	authorized.GET("/me/identities", s.handleGetIdentities())
+	authorized.POST("/me/identities/:provider", s.handleLinkIdentity())
+	authorized.DELETE("/me/identities/:provider", s.handleUnlinkIdentity())
 
-	authorized.POST("/user/medications", s.handleCreateMedication())
-	authorized.GET("/user/medications/:id", s.handleGetMedDetail())
-	authorized.GET("/user/medications", s.handleGetAllMedications())
-	authorized.PUT("/user/medications/:medicationID", s.handleUpdateMedication())
-	authorized.GET("/user/medications/next", s.handleGetNextMedication())
-	authorized.GET("/user/medications/search", s.handleFindMedication())
-
-	authorized.PUT("/user/medication-history/:id", s.handleUpdateMedicationHistory())
-	authorized.GET("/user/medication-history", s.handleGetAllMedicationHistoryByUser())
 	authorized.POST("/notifications/add-token", s.authorizeNotificationsForDevice())
+	authorized.GET("/drugs/autocomplete", s.handleAutocompleteDrugs())
+	authorized.GET("/drugs/:drugID", s.handleGetDrug())
+
+	authorized.POST("/user/profiles", s.handleCreateProfile())
+	authorized.GET("/user/profiles", s.handleGetProfiles())
+	authorized.PUT("/user/profiles/:id", s.handleUpdateProfile())
+	authorized.DELETE("/user/profiles/:id", s.handleDeleteProfile())
+
+	// the medication routes act for the dependent in the profile_id query, or
+	// for the user without one. They also take the API keys of the user
+	medications := apirouter.Group("/user/medications", apiRateLimit,
+		s.acceptAPIKey(models.ScopeMedicationsRead, models.ScopeMedicationsWrite), s.Authorize(), s.selectProfile())
+	history := apirouter.Group("/user/medication-history", apiRateLimit,
+		s.acceptAPIKey(models.ScopeHistoryRead, models.ScopeHistoryWrite), s.Authorize(), s.selectProfile())
+	medications.POST("", s.handleCreateMedication())
+	medications.GET("/:id", s.handleGetMedDetail())
+	medications.GET("", s.handleGetAllMedications())
+	medications.PUT("/:medicationID", s.handleUpdateMedication())
+	medications.POST("/:medicationID/doses", s.handleTakeAsNeededDose())
+	medications.POST("/:medicationID/refills", s.handleRecordRefill())
+	medications.POST("/:medicationID/pause", s.handlePauseMedication())
+	medications.POST("/:medicationID/resume", s.handleResumeMedication())
+	medications.POST("/:medicationID/discontinue", s.handleDiscontinueMedication())
+	medications.DELETE("/:medicationID", s.handleDeleteMedication())
+	medications.POST("/:medicationID/restore", s.handleRestoreMedication())
+	medications.GET("/archive", s.handleGetArchivedMedications())
+	medications.POST("/interactions/check", s.handleCheckInteractions())
+	medications.GET("/next", s.handleGetNextMedication())
+	medications.GET("/search", s.handleSearchMedications())
+
+	history.PUT("/:id", s.handleUpdateMedicationHistory())
+	history.GET("", s.handleGetAllMedicationHistoryByUser())
+	history.GET("/adherence", s.handleGetAdherence())
+	history.DELETE("/:id", s.handleDeleteMedicationHistory())
+	history.POST("/:id/restore", s.handleRestoreMedicationHistory())
+
+	authorized.POST("/user/caregivers", s.handleInviteCaregiver())
+	authorized.GET("/user/caregivers", s.handleGetCaregivers())
+	authorized.PUT("/user/caregivers/:id", s.handleUpdateCaregiver())
+	authorized.DELETE("/user/caregivers/:id", s.handleRemoveCaregiver())
+	authorized.GET("/caregiving/invitations", s.handleGetCaregiverInvitations())
+	authorized.POST("/caregiving/invitations/accept/:token", s.handleAcceptCaregiverInvitationLink())
+	authorized.POST("/caregiving/invitations/:id/accept", s.handleAcceptCaregiverInvitation())
+	authorized.POST("/caregiving/invitations/:id/decline", s.handleDeclineCaregiverInvitation())
+	authorized.GET("/caregiving/patients", s.handleGetPatients())
+	authorized.DELETE("/caregiving/patients/:patientID", s.handleLeavePatient())
+
+	// caregivers use the routes of their patients, as them
+	viewing := authorized.Group("/caregiving/patients/:patientID", s.actAsPatient(models.CaregiverRead), s.selectProfile())
+	viewing.GET("/profiles", s.handleGetProfiles())
+	viewing.GET("/medications", s.handleGetAllMedications())
+	viewing.GET("/medications/:id", s.handleGetMedDetail())
+	viewing.GET("/medications/next", s.handleGetNextMedication())
+	viewing.GET("/medications/search", s.handleSearchMedications())
+	viewing.GET("/medication-history", s.handleGetAllMedicationHistoryByUser())
+	viewing.GET("/medication-history/adherence", s.handleGetAdherence())
+	managing := authorized.Group("/caregiving/patients/:patientID", s.actAsPatient(models.CaregiverManage), s.selectProfile())
+	managing.POST("/medications", s.handleCreateMedication())
+	managing.PUT("/medications/:medicationID", s.handleUpdateMedication())
+	managing.POST("/medications/:medicationID/doses", s.handleTakeAsNeededDose())
+	managing.POST("/medications/:medicationID/refills", s.handleRecordRefill())
+	managing.POST("/medications/:medicationID/pause", s.handlePauseMedication())
+	managing.POST("/medications/:medicationID/resume", s.handleResumeMedication())
+	managing.POST("/medications/:medicationID/discontinue", s.handleDiscontinueMedication())
+	managing.PUT("/medication-history/:id", s.handleUpdateMedicationHistory())
+
+	admin := authorized.Group("/admin/users")
+	admin.GET("", s.requirePermission(models.PermissionReadUsers), s.handleAdminListUsers())
+	admin.GET("/:id", s.requirePermission(models.PermissionReadUsers), s.handleAdminGetUser())
+	administering := admin.Group("/:id", s.requirePermission(models.PermissionManageUsers))
+	administering.POST("/deactivate", s.handleAdminDeactivateUser())
+	administering.POST("/reactivate", s.handleAdminReactivateUser())
+	administering.POST("/password-reset", s.handleAdminForcePasswordReset())
+	administering.POST("/verification-email", s.handleAdminResendVerificationEmail())
+	administering.PUT("/role", s.handleAdminUpdateRole())
+}
 
+// newEngine returns an engine trusting X-Forwarded-For only from the configured
+// proxies, the client IP keys the rate limits and the login lockouts
+func (s *Server) newEngine() *gin.Engine {
+	var proxies []string
+	for _, proxy := range strings.Split(s.Config.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	r := gin.New()
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Fatalf("invalid trusted proxies: %v", err)
+	}
+	return r
 }
 
 func (s *Server) setupRouter() *gin.Engine {
 	ginMode := os.Getenv("GIN_MODE")
 	if ginMode == "test" {
-		r := gin.New()
+		r := s.newEngine()
 		s.defineRoutes(r)
 		return r
 	}
 
-	r := gin.New()
+	r := s.newEngine()
 	staticFiles := "server/templates/static"
 	htmlFiles := "server/templates/*.html"
 	if s.Config.Env == "test" {
@@ -6,6 +6,7 @@ import (
 	"github.com/decagonhq/meddle-api/config"
 	"github.com/decagonhq/meddle-api/db"
 	"github.com/decagonhq/meddle-api/services"
+	"github.com/decagonhq/meddle-api/services/identity"
 	"log"
 	"net/http"
 	"os"
@@ -19,9 +20,20 @@ type Server struct {
 	Config                   *config.Config
 	AuthRepository           db.AuthRepository
 	AuthService              services.AuthService
+	SessionService           services.SessionService
+	TwoFactorService         services.TwoFactorService
+	UserService              services.UserService
+	AdminService             services.AdminService
+	APIKeyService            services.APIKeyService
+	IdentityService          services.IdentityService
 	MedicationService        services.MedicationService
 	MedicationHistoryService services.MedicationHistoryService
+	DrugCatalogService       services.DrugCatalogService
+	DigestService            services.DigestService
+	CaregiverService         services.CaregiverService
+	ProfileService           services.ProfileService
 	PushNotification         services.PushNotifier
+	IdentityProviders        map[string]identity.Provider
 }
 
 func (s *Server) Start() {
@@ -2,12 +2,15 @@ package server
 
 import (
 	"fmt"
+	"github.com/decagonhq/meddle-api/mocks"
 	"github.com/decagonhq/meddle-api/models"
-	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/decagonhq/meddle-api/services"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/decagonhq/meddle-api/config"
 	"github.com/gin-gonic/gin"
@@ -44,8 +47,24 @@ func TestMain(m *testing.M) {
 func AuthorizeTestUser(t *testing.T) (string, models.User) {
 	user, _ := randomUser(t)
 	user.IsEmailActive = true
-	accToken, err := jwt.GenerateToken(user.Email, testServer.handler.Config.JWTSecret)
-
-	require.NoError(t, err)
+	sessionService, _, accToken := startTestSession(t, &user, testServer.handler.Config)
+	testServer.handler.SessionService = sessionService
 	return accToken, user
 }
+
+// startTestSession signs the user in with a session service of its own and
+// returns it with its repository and the access token, the session stays
+// active during the test
+func startTestSession(t *testing.T, user *models.User, conf *config.Config) (services.SessionService, *mocks.MockSessionRepository, string) {
+	ctrl := gomock.NewController(t)
+	sessionRepo := mocks.NewMockSessionRepository(ctrl)
+	sessionRepo.EXPECT().CreateSession(gomock.Any(), gomock.Any()).DoAndReturn(func(session *models.Session, tokenHash string) (*models.Session, error) {
+		session.ID = 1
+		return session, nil
+	})
+	sessionRepo.EXPECT().GetSession(uint(1), user.ID).Return(&models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour).Unix()}, nil).AnyTimes()
+	sessionService := services.NewSessionService(sessionRepo, conf)
+	tokens, err := sessionService.StartSession(user, models.SessionClient{})
+	require.Nil(t, err)
+	return sessionService, sessionRepo, tokens.AccessToken
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleRefreshToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.RefreshRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		request.Client = sessionClient(c)
+		tokens, err := s.SessionService.RefreshSession(&request)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "token refreshed successfully", http.StatusOK, tokens, nil)
+	}
+}
+
+func (s *Server) handleGetSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		sessions, err := s.SessionService.GetSessions(user.ID, currentSessionID(c))
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "sessions retrieved successfully", http.StatusOK, sessions, nil)
+	}
+}
+
+func (s *Server) handleRevokeSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		sessionID, errr := strconv.ParseUint(c.Param("id"), 10, 32)
+		if errr != nil {
+			response.JSON(c, "invalid ID", http.StatusBadRequest, nil, errr)
+			return
+		}
+		if err := s.SessionService.RevokeSession(uint(sessionID), user.ID); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "session revoked successfully", http.StatusOK, nil, nil)
+	}
+}
+
+func (s *Server) handleRevokeSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		if err := s.SessionService.RevokeSessions(user.ID); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "sessions revoked successfully", http.StatusOK, nil, nil)
+	}
+}
+
+// sessionClient returns the device and address of the request for its session
+func sessionClient(c *gin.Context) models.SessionClient {
+	return models.SessionClient{
+		Device: c.Request.UserAgent(),
+		IP:     c.ClientIP(),
+	}
+}
+
+// currentSessionID returns the session of the access token of the request, 0
+// for tokens without one
+func currentSessionID(c *gin.Context) uint {
+	if sessionID, ok := c.Get("session_id"); ok {
+		if sessionID, ok := sessionID.(uint); ok {
+			return sessionID
+		}
+	}
+	return 0
+}
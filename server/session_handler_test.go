@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_RefreshTokenHandler(t *testing.T) {
+	testCases := []struct {
+		name          string
+		reqBody       interface{}
+		buildStubs    func(service *mocks.MockSessionService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "success case",
+			reqBody: gin.H{"refresh_token": "refresh"},
+			buildStubs: func(service *mocks.MockSessionService) {
+				service.EXPECT().RefreshSession(&models.RefreshRequest{RefreshToken: "refresh", Client: models.SessionClient{Device: "meddle-android/2.1"}}).
+					Return(&models.TokenPair{AccessToken: "access", RefreshToken: "rotated", ExpiresIn: 900}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"refresh_token":"rotated"`)
+			},
+		},
+		{
+			name:    "reused token",
+			reqBody: gin.H{"refresh_token": "used"},
+			buildStubs: func(service *mocks.MockSessionService) {
+				service.EXPECT().RefreshSession(gomock.Any()).Return(nil, errors.New("invalid refresh token, sign in again", http.StatusUnauthorized))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:    "missing token",
+			reqBody: gin.H{},
+			buildStubs: func(service *mocks.MockSessionService) {
+				service.EXPECT().RefreshSession(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSessionService := mocks.NewMockSessionService(ctrl)
+	testServer.handler.SessionService = mockSessionService
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.buildStubs(mockSessionService)
+
+			body, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/api/v1/auth/refresh", strings.NewReader(string(body)))
+			require.NoError(t, err)
+			req.Header.Set("User-Agent", "meddle-android/2.1")
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func Test_SessionsHandlers(t *testing.T) {
+	_, user := AuthorizeTestUser(t)
+	accToken, err := jwt.GenerateAccessToken(user.Email, 7, testServer.handler.Config.JWTSecret)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		buildStubs    func(service *mocks.MockSessionService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "lists the sessions",
+			method: http.MethodGet,
+			path:   "/api/v1/me/sessions",
+			buildStubs: func(service *mocks.MockSessionService) {
+				service.EXPECT().CheckSession(uint(7), user.ID).Return(nil)
+				service.EXPECT().GetSessions(user.ID, uint(7)).Return([]models.SessionResponse{{ID: 7, Current: true}, {ID: 5}}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"current":true`)
+			},
+		},
+		{
+			name:   "revokes a session",
+			method: http.MethodDelete,
+			path:   "/api/v1/me/sessions/5",
+			buildStubs: func(service *mocks.MockSessionService) {
+				service.EXPECT().CheckSession(uint(7), user.ID).Return(nil)
+				service.EXPECT().RevokeSession(uint(5), user.ID).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "revokes all sessions",
+			method: http.MethodDelete,
+			path:   "/api/v1/me/sessions",
+			buildStubs: func(service *mocks.MockSessionService) {
+				service.EXPECT().CheckSession(uint(7), user.ID).Return(nil)
+				service.EXPECT().RevokeSessions(user.ID).Return(nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "revoked session",
+			method: http.MethodGet,
+			path:   "/api/v1/me/sessions",
+			buildStubs: func(service *mocks.MockSessionService) {
+				service.EXPECT().CheckSession(uint(7), user.ID).Return(errors.New("session expired", http.StatusUnauthorized))
+				service.EXPECT().GetSessions(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSessionService := mocks.NewMockSessionService(ctrl)
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.SessionService = mockSessionService
+	testServer.handler.AuthRepository = mockAuthRepository
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAuthRepository.EXPECT().FindUserByEmail(user.Email).Return(&user, nil)
+			mockAuthRepository.EXPECT().TokenInBlacklist(accToken).Return(false)
+			tc.buildStubs(mockSessionService)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func Test_TokenWithoutSession(t *testing.T) {
+	_, user := AuthorizeTestUser(t)
+	// signed with the secret, but no logout or revocation could end it
+	claims := gojwt.MapClaims{"email": user.Email, "exp": time.Now().Add(time.Hour).Unix()}
+	accToken, err := gojwt.NewWithClaims(gojwt.SigningMethodHS256, claims).SignedString([]byte(testServer.handler.Config.JWTSecret))
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAuthRepository := mocks.NewMockAuthRepository(ctrl)
+	testServer.handler.AuthRepository = mockAuthRepository
+	mockAuthRepository.EXPECT().FindUserByEmail(gomock.Any()).Times(0)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/me/sessions", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accToken))
+	testServer.router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/decagonhq/meddle-api/services/identity"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// ssoCookie keeps the state of a sign in with an identity provider in the
+// browser until the callback
+const ssoCookie = "meddle_sso"
+
+var errInvalidSSOLogin = errors.New("invalid login, try signing in again", http.StatusUnauthorized)
+
+// handleSSOLogin sends the user to the identity provider to sign in, the
+// provider of the route or of its provider param
+func (s *Server) handleSSOLogin(provider string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name, idp, ok := s.identityProvider(c, provider)
+		if !ok {
+			return
+		}
+		url, ok := s.startSSO(c, name, idp, 0)
+		if !ok {
+			return
+		}
+		c.Redirect(http.StatusTemporaryRedirect, url)
+	}
+}
+
+// startSSO keeps the state of a sign in with the provider in the cookie and
+// returns the page of the provider, the sign in links the provider to the user
+// userID when it isn't 0
+func (s *Server) startSSO(c *gin.Context, name string, idp identity.Provider, userID uint) (string, bool) {
+	var values [3]string
+	for i := range values {
+		value, err := identity.RandomString()
+		if err != nil {
+			log.Println(err)
+			errors.ErrInternalServerError.Respond(c)
+			return "", false
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+	stateToken, err := jwt.GenerateSSOStateToken(name, state, nonce, verifier, userID, s.Config.JWTSecret)
+	if err != nil {
+		log.Printf("error generating token %s", err)
+		errors.ErrInternalServerError.Respond(c)
+		return "", false
+	}
+	url, err := idp.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("error starting sign in with %s: %v", name, err)
+		response.JSON(c, "", http.StatusBadGateway, nil, errors.New("could not reach the identity provider", http.StatusBadGateway))
+		return "", false
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoCookie, stateToken, int(jwt.SSOStateValidity.Seconds()), "/api/v1", "", !s.Config.Debug, true)
+	return url, true
+}
+
+// handleSSOCallback signs in the user the identity provider sends back, or
+// links the provider to the user who started linking it, when the state
+// matches the one of the browser
+func (s *Server) handleSSOCallback(provider string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name, idp, ok := s.identityProvider(c, provider)
+		if !ok {
+			return
+		}
+		stateToken, _ := c.Cookie(ssoCookie)
+		c.SetCookie(ssoCookie, "", -1, "/api/v1", "", !s.Config.Debug, true)
+		if reason := c.Query("error"); reason != "" {
+			response.JSON(c, "", http.StatusUnauthorized, nil, errors.New("sign in cancelled: "+reason, http.StatusUnauthorized))
+			return
+		}
+		claims, err := jwt.ValidateAndGetClaims(stateToken, s.Config.JWTSecret)
+		if err != nil || jwt.GetPurpose(claims) != jwt.PurposeSSO || claims["provider"] != name {
+			errInvalidSSOLogin.Respond(c)
+			return
+		}
+		state, _ := claims["state"].(string)
+		nonce, _ := claims["nonce"].(string)
+		verifier, _ := claims["verifier"].(string)
+		if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(c.Query("state"))) != 1 {
+			errInvalidSSOLogin.Respond(c)
+			return
+		}
+		code := c.Query("code")
+		if code == "" {
+			errInvalidSSOLogin.Respond(c)
+			return
+		}
+		externalIdentity, err := idp.Exchange(c.Request.Context(), code, nonce, verifier)
+		if err != nil {
+			log.Printf("error signing in with %s: %v", name, err)
+			errInvalidSSOLogin.Respond(c)
+			return
+		}
+		if userID := jwt.GetLinkUserID(claims); userID != 0 {
+			linked, errr := s.IdentityService.LinkIdentity(userID, externalIdentity)
+			if errr != nil {
+				errr.Respond(c)
+				return
+			}
+			response.JSON(c, name+" account linked successfully", http.StatusOK, linked, nil)
+			return
+		}
+		loginResponse, errr := s.IdentityService.SignIn(externalIdentity, sessionClient(c))
+		if errr != nil {
+			errr.Respond(c)
+			return
+		}
+		if loginResponse.Challenge != nil {
+			response.JSON(c, "enter the code of your authenticator app", http.StatusOK, loginResponse.Challenge, nil)
+			return
+		}
+		response.JSON(c, name+" sign in successful", http.StatusOK, loginResponse, nil)
+	}
+}
+
+// identityProvider returns the provider, or the one of the provider param
+// when it is empty, responding 404 when it isn't set up
+func (s *Server) identityProvider(c *gin.Context, provider string) (string, identity.Provider, bool) {
+	if provider == "" {
+		provider = c.Param("provider")
+	}
+	idp, ok := s.IdentityProviders[provider]
+	if !ok {
+		response.JSON(c, "", http.StatusNotFound, nil, errors.New("unknown identity provider", http.StatusNotFound))
+		return "", nil, false
+	}
+	return provider, idp, true
+}
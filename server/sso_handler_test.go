@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/identity"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider is an identity provider whose page is the login params and
+// which signs in whoever has the code "good"
+type fakeProvider struct {
+	nonce    string
+	verifier string
+}
+
+func (p *fakeProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	p.nonce, p.verifier = nonce, verifier
+	return "https://idp.example.com/authorize?" + url.Values{"state": {state}}.Encode(), nil
+}
+
+func (p *fakeProvider) Exchange(ctx context.Context, code, nonce, verifier string) (*models.ExternalIdentity, error) {
+	if code != "good" || nonce != p.nonce || verifier != p.verifier {
+		return nil, fmt.Errorf("invalid code")
+	}
+	return &models.ExternalIdentity{Provider: "company", Subject: "42", Email: "ken@gmail.com", EmailVerified: true}, nil
+}
+
+func Test_SSOHandlers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockService := mocks.NewMockIdentityService(ctrl)
+	testServer.handler.IdentityService = mockService
+	testServer.handler.IdentityProviders = map[string]identity.Provider{"company": &fakeProvider{}}
+
+	// the requests come from their own address so they don't use up the rate
+	// limit of the other auth tests
+	const remoteAddr = "192.0.2.23:4321"
+
+	// login sends the user to the provider with the state of the cookie
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/auth/sso/company/login", nil)
+	require.NoError(t, err)
+	req.RemoteAddr = remoteAddr
+	testServer.router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusTemporaryRedirect, recorder.Code)
+	location, err := url.Parse(recorder.Header().Get("Location"))
+	require.NoError(t, err)
+	state := location.Query().Get("state")
+	require.NotEmpty(t, state)
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	cookie := cookies[0]
+	require.Equal(t, ssoCookie, cookie.Name)
+	require.True(t, cookie.HttpOnly)
+
+	testCases := []struct {
+		name          string
+		path          string
+		cookie        *http.Cookie
+		buildStubs    func(service *mocks.MockIdentityService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "unknown provider",
+			path:   "/api/v1/auth/sso/other/callback?code=good&state=" + state,
+			cookie: cookie,
+			buildStubs: func(service *mocks.MockIdentityService) {
+				service.EXPECT().SignIn(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "no cookie",
+			path: "/api/v1/auth/sso/company/callback?code=good&state=" + state,
+			buildStubs: func(service *mocks.MockIdentityService) {
+				service.EXPECT().SignIn(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:   "other state",
+			path:   "/api/v1/auth/sso/company/callback?code=good&state=forged",
+			cookie: cookie,
+			buildStubs: func(service *mocks.MockIdentityService) {
+				service.EXPECT().SignIn(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:   "code refused",
+			path:   "/api/v1/auth/sso/company/callback?code=bad&state=" + state,
+			cookie: cookie,
+			buildStubs: func(service *mocks.MockIdentityService) {
+				service.EXPECT().SignIn(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:   "signs the user in",
+			path:   "/api/v1/auth/sso/company/callback?code=good&state=" + state,
+			cookie: cookie,
+			buildStubs: func(service *mocks.MockIdentityService) {
+				service.EXPECT().SignIn(&models.ExternalIdentity{Provider: "company", Subject: "42", Email: "ken@gmail.com", EmailVerified: true}, gomock.Any()).
+					Return(&models.LoginResponse{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 900}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"refresh_token":"refresh"`)
+			},
+		},
+		{
+			name:   "asks for the second factor",
+			path:   "/api/v1/auth/sso/company/callback?code=good&state=" + state,
+			cookie: cookie,
+			buildStubs: func(service *mocks.MockIdentityService) {
+				service.EXPECT().SignIn(gomock.Any(), gomock.Any()).
+					Return(&models.LoginResponse{Challenge: &models.TwoFactorChallenge{TwoFactorRequired: true, ChallengeToken: "challenge"}}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"challenge_token":"challenge"`)
+				require.NotContains(t, recorder.Body.String(), "refresh_token")
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.buildStubs(mockService)
+
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, tc.path, nil)
+			require.NoError(t, err)
+			req.RemoteAddr = remoteAddr
+			if tc.cookie != nil {
+				req.AddCookie(tc.cookie)
+			}
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/server/response"
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) handleTwoFactorLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.TwoFactorLoginRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		request.Client = sessionClient(c)
+		userResponse, err := s.TwoFactorService.LoginWithTwoFactor(&request)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "login successful", http.StatusOK, userResponse, nil)
+	}
+}
+
+func (s *Server) handleGetTwoFactorStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		status, err := s.TwoFactorService.GetTwoFactorStatus(user)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "successful", http.StatusOK, status, nil)
+	}
+}
+
+func (s *Server) handleEnrolTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		enrolment, err := s.TwoFactorService.EnrolTwoFactor(user)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "add the secret to your authenticator app then confirm with a code", http.StatusOK, enrolment, nil)
+	}
+}
+
+func (s *Server) handleConfirmTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var request models.TwoFactorCodeRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		codes, err := s.TwoFactorService.ConfirmTwoFactor(user, request.Code)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "two-factor authentication enabled, keep the recovery codes safe", http.StatusOK, codes, nil)
+	}
+}
+
+func (s *Server) handleRegenerateRecoveryCodes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var request models.TwoFactorCodeRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		codes, err := s.TwoFactorService.RegenerateRecoveryCodes(user, request.Code)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "recovery codes replaced, keep them safe", http.StatusOK, codes, nil)
+	}
+}
+
+func (s *Server) handleDisableTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, user, err := GetValuesFromContext(c)
+		if err != nil {
+			err.Respond(c)
+			return
+		}
+		var request models.TwoFactorCodeRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+		if err := s.TwoFactorService.DisableTwoFactor(user, request.Code); err != nil {
+			err.Respond(c)
+			return
+		}
+		response.JSON(c, "two-factor authentication disabled", http.StatusOK, nil, nil)
+	}
+}
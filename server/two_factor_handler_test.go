@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_TwoFactorLogin(t *testing.T) {
+	user, password := randomUser(t)
+
+	testCases := []struct {
+		name          string
+		path          string
+		reqBody       interface{}
+		buildStubs    func(auth *mocks.MockAuthService, twoFactor *mocks.MockTwoFactorService)
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "password asks for a code",
+			path:    "/api/v1/auth/login",
+			reqBody: gin.H{"email": user.Email, "password": password},
+			buildStubs: func(auth *mocks.MockAuthService, twoFactor *mocks.MockTwoFactorService) {
+				auth.EXPECT().LoginUser(&models.LoginRequest{Email: user.Email, Password: password}).
+					Return(&models.LoginResponse{Challenge: &models.TwoFactorChallenge{TwoFactorRequired: true, ChallengeToken: "challenge", ExpiresIn: 300}}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"challenge_token":"challenge"`)
+				require.NotContains(t, recorder.Body.String(), "AccessToken")
+			},
+		},
+		{
+			name:    "code signs in",
+			path:    "/api/v1/auth/login/2fa",
+			reqBody: gin.H{"challenge_token": "challenge", "code": "123456"},
+			buildStubs: func(auth *mocks.MockAuthService, twoFactor *mocks.MockTwoFactorService) {
+				twoFactor.EXPECT().LoginWithTwoFactor(&models.TwoFactorLoginRequest{ChallengeToken: "challenge", Code: "123456"}).
+					Return(&models.LoginResponse{AccessToken: "access", RefreshToken: "refresh"}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), `"refresh_token":"refresh"`)
+			},
+		},
+		{
+			name:    "wrong code",
+			path:    "/api/v1/auth/login/2fa",
+			reqBody: gin.H{"challenge_token": "challenge", "code": "654321"},
+			buildStubs: func(auth *mocks.MockAuthService, twoFactor *mocks.MockTwoFactorService) {
+				twoFactor.EXPECT().LoginWithTwoFactor(gomock.Any()).Return(nil, errors.New("invalid code", http.StatusUnauthorized))
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:    "missing code",
+			path:    "/api/v1/auth/login/2fa",
+			reqBody: gin.H{"challenge_token": "challenge"},
+			buildStubs: func(auth *mocks.MockAuthService, twoFactor *mocks.MockTwoFactorService) {
+				twoFactor.EXPECT().LoginWithTwoFactor(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+	mockTwoFactorService := mocks.NewMockTwoFactorService(ctrl)
+	testServer.handler.AuthService = mockAuthService
+	testServer.handler.TwoFactorService = mockTwoFactorService
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.buildStubs(mockAuthService, mockTwoFactorService)
+
+			body, err := json.Marshal(tc.reqBody)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, tc.path, strings.NewReader(string(body)))
+			require.NoError(t, err)
+
+			testServer.router.ServeHTTP(recorder, req)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func Test_ChallengeTokenIsNoAccessToken(t *testing.T) {
+	_, user := AuthorizeTestUser(t)
+	challengeToken, err := jwt.GenerateChallengeToken(user.Email, testServer.handler.Config.JWTSecret)
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockTwoFactorService := mocks.NewMockTwoFactorService(ctrl)
+	testServer.handler.TwoFactorService = mockTwoFactorService
+	mockTwoFactorService.EXPECT().GetTwoFactorStatus(gomock.Any()).Times(0)
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/me/2fa", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", challengeToken))
+
+	testServer.router.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	stderrors "errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/admin_mock.go -package=mocks github.com/decagonhq/meddle-api/services AdminService
+
+// AdminService lets admins look after the accounts of the users
+type AdminService interface {
+	ListUsers(query *models.UserSearchQuery) ([]models.AdminUserResponse, *models.PageMeta, *errors.Error)
+	GetUser(userID uint) (*models.AdminUserResponse, *errors.Error)
+	DeactivateUser(admin *models.User, userID uint) (*models.AdminUserResponse, *errors.Error)
+	ReactivateUser(userID uint) (*models.AdminUserResponse, *errors.Error)
+	ForcePasswordReset(userID uint) *errors.Error
+	ResendVerificationEmail(userID uint) *errors.Error
+	UpdateRole(admin *models.User, userID uint, role models.Role) (*models.AdminUserResponse, *errors.Error)
+	PromoteAdmins(emails string) error
+}
+
+var errOwnAccount = errors.New("you can't do this to your own account", http.StatusBadRequest)
+
+type adminService struct {
+	Config     *config.Config
+	adminRepo  db.AdminRepository
+	apiKeyRepo db.APIKeyRepository
+	sessions   SessionService
+	auth       AuthService
+}
+
+func NewAdminService(adminRepo db.AdminRepository, apiKeyRepo db.APIKeyRepository, sessions SessionService, auth AuthService, conf *config.Config) AdminService {
+	return &adminService{
+		Config:     conf,
+		adminRepo:  adminRepo,
+		apiKeyRepo: apiKeyRepo,
+		sessions:   sessions,
+		auth:       auth,
+	}
+}
+
+func (a *adminService) ListUsers(query *models.UserSearchQuery) ([]models.AdminUserResponse, *models.PageMeta, *errors.Error) {
+	filter, errr := query.ToFilter()
+	if errr != nil {
+		return nil, nil, errors.New(errr.Error(), http.StatusBadRequest)
+	}
+	users, err := a.adminRepo.ListUsers(filter)
+	if err != nil {
+		log.Printf("error listing users: %v", err)
+		return nil, nil, errors.ErrInternalServerError
+	}
+	rows := len(users)
+	if rows > filter.Page.Limit {
+		users = users[:filter.Page.Limit]
+	}
+	userIDs := make([]uint, len(users))
+	for i := range users {
+		userIDs[i] = users[i].ID
+	}
+	counts, err := a.adminRepo.CountMedications(userIDs)
+	if err != nil {
+		log.Printf("error counting medications: %v", err)
+		return nil, nil, errors.ErrInternalServerError
+	}
+	responses := make([]models.AdminUserResponse, len(users))
+	for i := range users {
+		responses[i] = *users[i].ToAdminResponse(counts[users[i].ID])
+	}
+	if len(users) == 0 {
+		return responses, filter.Page.Meta(rows, nil, 0), nil
+	}
+	last := &users[len(users)-1]
+	return responses, filter.Page.Meta(rows, last.SortValue(filter.Page.SortColumn), last.ID), nil
+}
+
+func (a *adminService) GetUser(userID uint) (*models.AdminUserResponse, *errors.Error) {
+	user, err := a.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return a.toResponse(user)
+}
+
+// DeactivateUser keeps the user from signing in and signs them out everywhere
+func (a *adminService) DeactivateUser(admin *models.User, userID uint) (*models.AdminUserResponse, *errors.Error) {
+	if admin.ID == userID {
+		return nil, errOwnAccount
+	}
+	user, err := a.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Deactivated() {
+		user.DeactivatedAt = time.Now().Unix()
+		if err := a.setDeactivatedAt(user); err != nil {
+			return nil, err
+		}
+	}
+	if err := a.sessions.RevokeSessions(user.ID); err != nil {
+		return nil, err
+	}
+	return a.toResponse(user)
+}
+
+func (a *adminService) ReactivateUser(userID uint) (*models.AdminUserResponse, *errors.Error) {
+	user, err := a.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Deactivated() {
+		user.DeactivatedAt = 0
+		if err := a.setDeactivatedAt(user); err != nil {
+			return nil, err
+		}
+	}
+	return a.toResponse(user)
+}
+
+// ForcePasswordReset signs the user out everywhere and keeps them from signing
+// in with their password until they reset it with the link emailed to them
+func (a *adminService) ForcePasswordReset(userID uint) *errors.Error {
+	user, err := a.getUser(userID)
+	if err != nil {
+		return err
+	}
+	errr := a.adminRepo.RequirePasswordReset(user.ID)
+	if errr != nil {
+		log.Printf("error requiring password reset of user %v: %v", user.ID, errr)
+		return errors.ErrInternalServerError
+	}
+	errr = a.apiKeyRepo.RevokeAPIKeys(user.ID, time.Now().Unix())
+	if errr != nil {
+		log.Printf("error revoking api keys of user %v: %v", user.ID, errr)
+		return errors.ErrInternalServerError
+	}
+	if err := a.sessions.RevokeSessions(user.ID); err != nil {
+		return err
+	}
+	return a.auth.SendEmailForPasswordReset(&models.ForgotPassword{Email: user.Email})
+}
+
+func (a *adminService) ResendVerificationEmail(userID uint) *errors.Error {
+	user, err := a.getUser(userID)
+	if err != nil {
+		return err
+	}
+	return a.auth.ResendVerificationEmail(user)
+}
+
+// UpdateRole changes the role of the user, admins can't change their own so
+// that there is always one left
+func (a *adminService) UpdateRole(admin *models.User, userID uint, role models.Role) (*models.AdminUserResponse, *errors.Error) {
+	if admin.ID == userID {
+		return nil, errOwnAccount
+	}
+	user, err := a.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	errr := a.adminRepo.SetRole(user.ID, role)
+	if errr != nil {
+		log.Printf("error setting role of user %v: %v", user.ID, errr)
+		return nil, errors.ErrInternalServerError
+	}
+	user.Role = role
+	return a.toResponse(user)
+}
+
+// PromoteAdmins makes the users of the comma separated emails admins, it
+// gives a new deployment its first admins
+func (a *adminService) PromoteAdmins(emails string) error {
+	var list []string
+	for _, email := range strings.Split(emails, ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			list = append(list, email)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	promoted, err := a.adminRepo.PromoteAdmins(list)
+	if err != nil {
+		return err
+	}
+	if promoted > 0 {
+		log.Printf("made %d users admins", promoted)
+	}
+	return nil
+}
+
+func (a *adminService) getUser(userID uint) (*models.User, *errors.Error) {
+	user, err := a.adminRepo.GetUser(userID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error getting user %v: %v", userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return user, nil
+}
+
+func (a *adminService) setDeactivatedAt(user *models.User) *errors.Error {
+	err := a.adminRepo.SetDeactivatedAt(user.ID, user.DeactivatedAt)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error updating deactivation of user %v: %v", user.ID, err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+// toResponse returns the user with the counts of their medications
+func (a *adminService) toResponse(user *models.User) (*models.AdminUserResponse, *errors.Error) {
+	counts, err := a.adminRepo.CountMedications([]uint{user.ID})
+	if err != nil {
+		log.Printf("error counting medications of user %v: %v", user.ID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return user.ToAdminResponse(counts[user.ID]), nil
+}
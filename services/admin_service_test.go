@@ -0,0 +1,118 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var mockAdminRepository *mocks.MockAdminRepository
+var mockAuthService *mocks.MockAuthService
+var testAdminService AdminService
+
+func Test_AdminListUsersService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	users := []models.User{
+		{Model: models.Model{ID: 3, CreatedAt: 30}, Email: "c@gmail.com", Role: models.RolePatient},
+		{Model: models.Model{ID: 2, CreatedAt: 20}, Email: "b@gmail.com", Role: models.RolePatient, DeactivatedAt: 5},
+		{Model: models.Model{ID: 1, CreatedAt: 10}, Email: "a@gmail.com", Role: models.RolePatient},
+	}
+	mockAdminRepository.EXPECT().ListUsers(gomock.Any()).DoAndReturn(func(filter *models.UserFilter) ([]models.User, error) {
+		require.Equal(t, "ken", filter.Query)
+		require.Equal(t, models.RolePatient, filter.Role)
+		require.Equal(t, 2, filter.Page.Limit)
+		return users, nil
+	})
+	mockAdminRepository.EXPECT().CountMedications([]uint{3, 2}).Return(map[uint]models.MedicationCounts{3: {Active: 2, Archived: 1}}, nil)
+
+	query := &models.UserSearchQuery{PageQuery: models.PageQuery{Limit: 2}, Q: " ken ", Role: "patient"}
+	list, meta, err := testAdminService.ListUsers(query)
+	require.Nil(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, int64(2), list[0].Medications.Active)
+	require.Equal(t, int64(1), list[0].Medications.Archived)
+	require.True(t, list[1].Deactivated)
+	require.True(t, meta.HasMore)
+
+	_, _, err = testAdminService.ListUsers(&models.UserSearchQuery{PageQuery: models.PageQuery{Sort: "password"}})
+	require.Equal(t, http.StatusBadRequest, err.Status)
+}
+
+func Test_AdminDeactivateUserService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	admin := &models.User{Model: models.Model{ID: 1}, Role: models.RoleAdmin}
+	_, err := testAdminService.DeactivateUser(admin, 1)
+	require.Equal(t, errOwnAccount, err)
+
+	mockAdminRepository.EXPECT().GetUser(uint(9)).Return(nil, gorm.ErrRecordNotFound)
+	_, err = testAdminService.DeactivateUser(admin, 9)
+	require.Equal(t, errors.ErrNotFound, err)
+
+	mockAdminRepository.EXPECT().GetUser(uint(2)).Return(&models.User{Model: models.Model{ID: 2}}, nil)
+	mockAdminRepository.EXPECT().SetDeactivatedAt(uint(2), gomock.Any()).DoAndReturn(func(userID uint, deactivatedAt int64) error {
+		require.NotZero(t, deactivatedAt)
+		return nil
+	})
+	mockSessionService.EXPECT().RevokeSessions(uint(2)).Return(nil)
+	mockAdminRepository.EXPECT().CountMedications([]uint{2}).Return(map[uint]models.MedicationCounts{}, nil)
+	user, err := testAdminService.DeactivateUser(admin, 2)
+	require.Nil(t, err)
+	require.True(t, user.Deactivated)
+
+	mockAdminRepository.EXPECT().GetUser(uint(2)).Return(&models.User{Model: models.Model{ID: 2}, DeactivatedAt: 5}, nil)
+	mockAdminRepository.EXPECT().SetDeactivatedAt(uint(2), int64(0)).Return(nil)
+	mockAdminRepository.EXPECT().CountMedications([]uint{2}).Return(map[uint]models.MedicationCounts{}, nil)
+	user, err = testAdminService.ReactivateUser(2)
+	require.Nil(t, err)
+	require.False(t, user.Deactivated)
+}
+
+func Test_AdminForcePasswordResetService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	mockAdminRepository.EXPECT().GetUser(uint(2)).Return(&models.User{Model: models.Model{ID: 2}, Email: "ken@gmail.com"}, nil)
+	gomock.InOrder(
+		mockAdminRepository.EXPECT().RequirePasswordReset(uint(2)).Return(nil),
+		mockAPIKeyRepository.EXPECT().RevokeAPIKeys(uint(2), gomock.Any()).Return(nil),
+		mockSessionService.EXPECT().RevokeSessions(uint(2)).Return(nil),
+		mockAuthService.EXPECT().SendEmailForPasswordReset(&models.ForgotPassword{Email: "ken@gmail.com"}).Return(nil),
+	)
+	require.Nil(t, testAdminService.ForcePasswordReset(2))
+}
+
+func Test_AdminUpdateRoleService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	admin := &models.User{Model: models.Model{ID: 1}, Role: models.RoleAdmin}
+	_, err := testAdminService.UpdateRole(admin, 1, models.RolePatient)
+	require.Equal(t, errOwnAccount, err)
+
+	mockAdminRepository.EXPECT().GetUser(uint(2)).Return(&models.User{Model: models.Model{ID: 2}, Role: models.RolePatient}, nil)
+	mockAdminRepository.EXPECT().SetRole(uint(2), models.RoleClinician).Return(nil)
+	mockAdminRepository.EXPECT().CountMedications([]uint{2}).Return(map[uint]models.MedicationCounts{}, nil)
+	user, err := testAdminService.UpdateRole(admin, 2, models.RoleClinician)
+	require.Nil(t, err)
+	require.Equal(t, models.RoleClinician, user.Role)
+}
+
+func Test_PromoteAdminsService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	require.NoError(t, testAdminService.PromoteAdmins(" , "))
+
+	mockAdminRepository.EXPECT().PromoteAdmins([]string{"ken@gmail.com", "ada@gmail.com"}).Return(int64(1), nil)
+	require.NoError(t, testAdminService.PromoteAdmins("ken@gmail.com, ada@gmail.com,"))
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/api_key_mock.go -package=mocks github.com/decagonhq/meddle-api/services APIKeyService
+
+// APIKeyService manages the personal API keys users script against the API
+// with
+type APIKeyService interface {
+	CreateAPIKey(userID uint, request *models.CreateAPIKeyRequest) (*models.CreatedAPIKeyResponse, *errors.Error)
+	GetAPIKeys(userID uint) ([]models.APIKeyResponse, *errors.Error)
+	RevokeAPIKey(keyID uint, userID uint) *errors.Error
+	AuthenticateAPIKey(key string) (*models.APIKey, *errors.Error)
+}
+
+var errInvalidAPIKey = errors.New("invalid API key", http.StatusUnauthorized)
+
+// apiKeyTouchInterval is how stale the last use of a key may get, so that a
+// busy script doesn't write it on every request
+const apiKeyTouchInterval = time.Minute
+
+type apiKeyService struct {
+	Config     *config.Config
+	apiKeyRepo db.APIKeyRepository
+}
+
+func NewAPIKeyService(apiKeyRepo db.APIKeyRepository, conf *config.Config) APIKeyService {
+	return &apiKeyService{
+		Config:     conf,
+		apiKeyRepo: apiKeyRepo,
+	}
+}
+
+// CreateAPIKey creates a key for the user, the key itself is only returned
+// here
+func (a *apiKeyService) CreateAPIKey(userID uint, request *models.CreateAPIKeyRequest) (*models.CreatedAPIKeyResponse, *errors.Error) {
+	now := time.Now()
+	keys, err := a.apiKeyRepo.GetActiveAPIKeys(userID, now.Unix())
+	if err != nil {
+		log.Printf("error getting api keys of user %v: %v", userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	if len(keys) >= models.MaxActiveAPIKeys {
+		return nil, errors.New(fmt.Sprintf("you can have at most %d API keys, revoke one first", models.MaxActiveAPIKeys), http.StatusBadRequest)
+	}
+	key, keyHash, err := newAPIKey()
+	if err != nil {
+		log.Printf("error generating api key: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	days := request.ExpiresInDays
+	if days <= 0 {
+		days = models.DefaultAPIKeyValidityDays
+	}
+	apiKey, err := a.apiKeyRepo.CreateAPIKey(&models.APIKey{
+		UserID:    userID,
+		Name:      request.Name,
+		Prefix:    key[:len(models.APIKeyPrefix)+6],
+		KeyHash:   keyHash,
+		Scopes:    uniqueScopes(request.Scopes),
+		ExpiresAt: now.AddDate(0, 0, days).Unix(),
+	})
+	if err != nil {
+		log.Printf("error creating api key of user %v: %v", userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return &models.CreatedAPIKeyResponse{APIKeyResponse: apiKey.ToResponse(), Key: key}, nil
+}
+
+func (a *apiKeyService) GetAPIKeys(userID uint) ([]models.APIKeyResponse, *errors.Error) {
+	keys, err := a.apiKeyRepo.GetActiveAPIKeys(userID, time.Now().Unix())
+	if err != nil {
+		log.Printf("error getting api keys of user %v: %v", userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return models.APIKeysToResponse(keys), nil
+}
+
+func (a *apiKeyService) RevokeAPIKey(keyID uint, userID uint) *errors.Error {
+	err := a.apiKeyRepo.RevokeAPIKey(keyID, userID, time.Now().Unix())
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error revoking api key %v: %v", keyID, err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+// AuthenticateAPIKey finds the active key, with its user, and records its use
+func (a *apiKeyService) AuthenticateAPIKey(key string) (*models.APIKey, *errors.Error) {
+	apiKey, err := a.apiKeyRepo.FindAPIKey(hashAPIKey(key))
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvalidAPIKey
+	}
+	if err != nil {
+		log.Printf("error finding api key: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	now := time.Now()
+	if !apiKey.Active(now) {
+		return nil, errors.New("API key expired or revoked", http.StatusUnauthorized)
+	}
+	if now.Unix()-apiKey.LastUsedAt >= int64(apiKeyTouchInterval.Seconds()) {
+		// the request goes on whether its use was recorded or not
+		if err := a.apiKeyRepo.TouchAPIKey(apiKey.ID, now.Unix()); err != nil {
+			log.Printf("error recording use of api key %v: %v", apiKey.ID, err)
+		} else {
+			apiKey.LastUsedAt = now.Unix()
+		}
+	}
+	return apiKey, nil
+}
+
+func uniqueScopes(scopes []models.APIScope) []models.APIScope {
+	seen := map[models.APIScope]bool{}
+	unique := make([]models.APIScope, 0, len(scopes))
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+	return unique
+}
+
+// newAPIKey returns a random API key and the hash it is stored as
+func newAPIKey() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key := models.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, hashAPIKey(key), nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
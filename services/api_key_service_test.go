@@ -0,0 +1,89 @@
+package services
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var mockAPIKeyRepository *mocks.MockAPIKeyRepository
+var testAPIKeyService APIKeyService
+
+func Test_CreateAPIKeyService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	var stored *models.APIKey
+	mockAPIKeyRepository.EXPECT().GetActiveAPIKeys(uint(1), gomock.Any()).Return(nil, nil)
+	mockAPIKeyRepository.EXPECT().CreateAPIKey(gomock.Any()).DoAndReturn(func(key *models.APIKey) (*models.APIKey, error) {
+		stored = key
+		key.ID = 3
+		return key, nil
+	})
+	created, err := testAPIKeyService.CreateAPIKey(1, &models.CreateAPIKeyRequest{
+		Name:   "sync script",
+		Scopes: []models.APIScope{models.ScopeMedicationsRead, models.ScopeMedicationsRead, models.ScopeHistoryWrite},
+	})
+	require.Nil(t, err)
+	require.True(t, models.IsAPIKey(created.Key))
+	require.True(t, strings.HasPrefix(created.Key, created.Prefix))
+	require.Equal(t, hashAPIKey(created.Key), stored.KeyHash)
+	require.Equal(t, []models.APIScope{models.ScopeMedicationsRead, models.ScopeHistoryWrite}, stored.Scopes)
+	require.InDelta(t, time.Now().AddDate(0, 0, models.DefaultAPIKeyValidityDays).Unix(), stored.ExpiresAt, 5)
+
+	mockAPIKeyRepository.EXPECT().GetActiveAPIKeys(uint(1), gomock.Any()).Return(make([]models.APIKey, models.MaxActiveAPIKeys), nil)
+	_, err = testAPIKeyService.CreateAPIKey(1, &models.CreateAPIKeyRequest{Name: "one more", Scopes: []models.APIScope{models.ScopeHistoryRead}})
+	require.Equal(t, http.StatusBadRequest, err.Status)
+}
+
+func Test_AuthenticateAPIKeyService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	key := "mdl_secret"
+	now := time.Now().Unix()
+	active := &models.APIKey{Model: models.Model{ID: 3}, ExpiresAt: now + 3600, User: &models.User{}}
+	mockAPIKeyRepository.EXPECT().FindAPIKey(hashAPIKey(key)).Return(active, nil)
+	mockAPIKeyRepository.EXPECT().TouchAPIKey(uint(3), gomock.Any()).Return(nil)
+	apiKey, err := testAPIKeyService.AuthenticateAPIKey(key)
+	require.Nil(t, err)
+	require.NotZero(t, apiKey.LastUsedAt)
+
+	// used a moment ago, the last use isn't written again
+	mockAPIKeyRepository.EXPECT().FindAPIKey(hashAPIKey(key)).Return(active, nil)
+	_, err = testAPIKeyService.AuthenticateAPIKey(key)
+	require.Nil(t, err)
+
+	revoked := &models.APIKey{Model: models.Model{ID: 4}, ExpiresAt: now + 3600, RevokedAt: now}
+	mockAPIKeyRepository.EXPECT().FindAPIKey(gomock.Any()).Return(revoked, nil)
+	_, err = testAPIKeyService.AuthenticateAPIKey(key)
+	require.Equal(t, http.StatusUnauthorized, err.Status)
+
+	expired := &models.APIKey{Model: models.Model{ID: 5}, ExpiresAt: now - 1}
+	mockAPIKeyRepository.EXPECT().FindAPIKey(gomock.Any()).Return(expired, nil)
+	_, err = testAPIKeyService.AuthenticateAPIKey(key)
+	require.Equal(t, http.StatusUnauthorized, err.Status)
+
+	mockAPIKeyRepository.EXPECT().FindAPIKey(gomock.Any()).Return(nil, gorm.ErrRecordNotFound)
+	_, err = testAPIKeyService.AuthenticateAPIKey("mdl_unknown")
+	require.Equal(t, errInvalidAPIKey, err)
+}
+
+func Test_RevokeAPIKeyService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	mockAPIKeyRepository.EXPECT().RevokeAPIKey(uint(3), uint(1), gomock.Any()).Return(nil)
+	require.Nil(t, testAPIKeyService.RevokeAPIKey(3, 1))
+
+	mockAPIKeyRepository.EXPECT().RevokeAPIKey(uint(3), uint(2), gomock.Any()).Return(gorm.ErrRecordNotFound)
+	require.Equal(t, errors.ErrNotFound, testAPIKeyService.RevokeAPIKey(3, 2))
+}
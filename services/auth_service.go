@@ -2,10 +2,8 @@ package services
 
 import (
 	"crypto/rand"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 
@@ -26,27 +24,36 @@ import (
 type AuthService interface {
 	LoginUser(request *models.LoginRequest) (*models.LoginResponse, *apiError.Error)
 	SignupUser(request *models.User) (*models.User, *apiError.Error)
-	FacebookSignInUser(token string) (*string, *apiError.Error)
 	VerifyEmail(token string) error
+	ResendVerificationEmail(user *models.User) *apiError.Error
 	SendEmailForPasswordReset(user *models.ForgotPassword) *apiError.Error
 	ResetPassword(user *models.ResetPassword, token string) *apiError.Error
-	GoogleSignInUser(token string) (*string, *apiError.Error)
 	DeleteUserByEmail(userEmail string) *apiError.Error
 }
 
+var errPasswordResetRequired = apiError.New("reset your password to sign in, follow the link we emailed you", http.StatusForbidden)
+
 // authService struct
 type authService struct {
 	Config           *config.Config
 	authRepo         db.AuthRepository
+	apiKeyRepo       db.APIKeyRepository
+	sessions         SessionService
+	throttle         LoginThrottleService
+	tokens           OneTimeTokenService
 	mail             Mailer
 	pushNotification PushNotifier
 }
 
 // NewAuthService instantiate an authService
-func NewAuthService(authRepo db.AuthRepository, conf *config.Config, mailer Mailer, pushNotifier PushNotifier) AuthService {
+func NewAuthService(authRepo db.AuthRepository, apiKeyRepo db.APIKeyRepository, sessions SessionService, throttle LoginThrottleService, tokens OneTimeTokenService, conf *config.Config, mailer Mailer, pushNotifier PushNotifier) AuthService {
 	return &authService{
 		Config:           conf,
 		authRepo:         authRepo,
+		apiKeyRepo:       apiKeyRepo,
+		sessions:         sessions,
+		throttle:         throttle,
+		tokens:           tokens,
 		mail:             mailer,
 		pushNotification: pushNotifier,
 	}
@@ -71,14 +78,6 @@ func (a *authService) SignupUser(user *models.User) (*models.User, *apiError.Err
 		return nil, apiError.New("internal server error", http.StatusInternalServerError)
 	}
 
-	token, err := jwt.GenerateToken(user.Email, a.Config.JWTSecret)
-	if err != nil {
-		return nil, apiError.New("internal server error", http.StatusInternalServerError)
-	}
-	if err := a.sendVerifyEmail(token, user.Email); err != nil {
-		return nil, err
-	}
-
 	user.Password = ""
 	user.IsEmailActive = false
 	user, err = a.authRepo.CreateUser(user)
@@ -88,33 +87,59 @@ func (a *authService) SignupUser(user *models.User) (*models.User, *apiError.Err
 		return nil, apiError.New("internal server error", http.StatusInternalServerError)
 	}
 
+	// the user can sign up again when the link couldn't be sent
+	if err := a.sendVerifyEmail(user); err != nil {
+		if errr := a.authRepo.DeleteUserByEmail(user.Email); errr != nil {
+			log.Printf("error deleting user whose verification email failed: %v", errr)
+		}
+		return nil, err
+	}
+
 	return user, nil
 }
 
-func (a *authService) sendVerifyEmail(token, email string) *apiError.Error {
+// sendVerifyEmail sends the user a link to verify their email, the links sent
+// before stop working
+func (a *authService) sendVerifyEmail(user *models.User) *apiError.Error {
+	token, err := a.tokens.IssueToken(user.ID, models.PurposeEmailVerification, user.Email)
+	if err != nil {
+		return err
+	}
+	email := user.Email
 	link := fmt.Sprintf("%s/verifyEmail/%s", a.Config.BaseUrl, token)
 	value := map[string]interface{}{}
 	value["link"] = link
 	subject := "Verify your email"
 	body := "Please Click the link below to verify your email"
 	templateName := "emailverification"
-	err := a.mail.SendMail(email, subject, body, templateName, value)
-	if err != nil {
+	if err := a.mail.SendMail(email, subject, body, templateName, value); err != nil {
 		log.Printf("Error: %v", err.Error())
 		return apiError.New("Internal server error", http.StatusInternalServerError)
 	}
 	return nil
 }
 
+// ResendVerificationEmail sends the user a new link to verify their email
+func (a *authService) ResendVerificationEmail(user *models.User) *apiError.Error {
+	if user.IsEmailActive {
+		return apiError.New("email already verified", http.StatusBadRequest)
+	}
+	return a.sendVerifyEmail(user)
+}
+
 func GenerateHashPassword(password string) (string, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(hashedPassword), err
 }
 
 func (a *authService) LoginUser(loginRequest *models.LoginRequest) (*models.LoginResponse, *apiError.Error) {
+	if err := a.throttle.CheckLogin(loginRequest.Email, loginRequest.Client.IP); err != nil {
+		return nil, err
+	}
 	foundUser, err := a.authRepo.FindUserByEmail(loginRequest.Email)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			a.throttle.LoginFailed(loginRequest.Email, loginRequest.Client.IP, nil)
 			return nil, apiError.New("invalid email", http.StatusUnprocessableEntity)
 		} else {
 			log.Printf("error from database: %v", err)
@@ -127,189 +152,69 @@ func (a *authService) LoginUser(loginRequest *models.LoginRequest) (*models.Logi
 	}
 
 	if err := foundUser.VerifyPassword(loginRequest.Password); err != nil {
+		a.throttle.LoginFailed(loginRequest.Email, loginRequest.Client.IP, foundUser)
 		return nil, apiError.ErrInvalidPassword
 	}
 
-	accessToken, err := jwt.GenerateToken(foundUser.Email, a.Config.JWTSecret)
-	if err != nil {
-		log.Printf("error generating token %s", err)
-		return nil, apiError.ErrInternalServerError
-	}
-
-	return foundUser.LoginUserToDto(accessToken), nil
-}
-
-func (a *authService) VerifyEmail(token string) error {
-	claims, err := jwt.ValidateAndGetClaims(token, a.Config.JWTSecret)
-	if err != nil {
-		return apiError.New("invalid link", http.StatusUnauthorized)
-	}
-	email := claims["email"].(string)
-	err = a.authRepo.VerifyEmail(email, token)
-	return err
-}
-
-func (a *authService) GoogleSignInUser(token string) (*string, *apiError.Error) {
-
-	googleUserDetails, googleUserDetailsError := GetUserInfoFromGoogle(token)
-
-	if googleUserDetailsError != nil {
-		return nil, apiError.New(fmt.Sprintf("unable to get user details from google: %v", googleUserDetailsError), http.StatusUnauthorized)
-	}
-
-	authToken, authTokenError := a.GetGoogleSignInToken(googleUserDetails)
-
-	if authTokenError != nil {
-		return nil, apiError.New(fmt.Sprintf("unable sign in user: %v", authTokenError), http.StatusUnauthorized)
-	}
-	return &authToken, nil
-}
-
-// GetUserInfoFromGoogle will return information of user which is fetched from Google
-func GetUserInfoFromGoogle(token string) (*models.GoogleUser, error) {
-	var googleUserDetails *models.GoogleUser
-
-	url := "https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + token
-	googleUserDetailsRequest, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error occurred while getting information from Google: %+v", err)
-	}
-
-	googleUserDetailsResponse, googleDetailsResponseError := http.DefaultClient.Do(googleUserDetailsRequest)
-	if googleDetailsResponseError != nil {
-		return nil, fmt.Errorf("error occurred while getting information from Google: %+v", googleDetailsResponseError)
-	}
-
-	body, err := ioutil.ReadAll(googleUserDetailsResponse.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error occurred while getting information from Google: %+v", err)
-	}
-	defer googleUserDetailsResponse.Body.Close()
-
-	err = json.Unmarshal(body, &googleUserDetails)
-	if err != nil {
-		return nil, fmt.Errorf("error occurred while getting information from Google: %+v", err)
-	}
-
-	return googleUserDetails, nil
-}
-
-func (a *authService) FacebookSignInUser(token string) (*string, *apiError.Error) {
-	// rename function
-	fbUserDetails, fbUserDetailsError := GetUserInfoFromFacebook(token)
-
-	if fbUserDetailsError != nil {
-		return nil, apiError.New(fmt.Sprintf("unable to get user details from facebook: %v", fbUserDetailsError), http.StatusUnauthorized)
+	loginResponse, errr := completeLogin(foundUser, loginRequest.Client, a.sessions, a.Config)
+	if errr != nil {
+		return nil, errr
 	}
-
-	authToken, authTokenError := a.GetFacebookSignInToken(fbUserDetails)
-	if authTokenError != nil {
-		return nil, apiError.New(fmt.Sprintf("unable sign in user: %v", authTokenError), http.StatusUnauthorized)
+	// the failures of the account are forgotten once the code is right too
+	if loginResponse.Challenge == nil {
+		a.throttle.LoginSucceeded(foundUser.Email)
 	}
-	return &authToken, nil
+	return loginResponse, nil
 }
 
-// GetUserInfoFromFacebook will return information of user which is fetched from facebook
-func GetUserInfoFromFacebook(token string) (*models.FacebookUser, error) {
-	var fbUserDetails *models.FacebookUser
-	facebookUserDetailsRequest, _ := http.NewRequest("GET", "https://graph.facebook.com/me?fields=name,email&access_token="+token, nil)
-	facebookUserDetailsResponse, facebookUserDetailsResponseError := http.DefaultClient.Do(facebookUserDetailsRequest)
-
-	if facebookUserDetailsResponseError != nil {
-		return nil, fmt.Errorf("error occurred while getting information from Facebook: %+v", facebookUserDetailsResponseError)
+// completeLogin signs in the user who proved who they are, with their
+// password or an identity provider. Users who must reset their password or
+// are deactivated can't sign in, users with two-factor authentication get
+// the challenge of their second factor instead of a session
+func completeLogin(user *models.User, client models.SessionClient, sessions SessionService, conf *config.Config) (*models.LoginResponse, *apiError.Error) {
+	if user.Deactivated() {
+		return nil, apiError.ErrAccountDeactivated
 	}
-	body, err := ioutil.ReadAll(facebookUserDetailsResponse.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error occurred while getting information from Facebook: %+v", err)
+	if user.PasswordResetRequired {
+		return nil, errPasswordResetRequired
 	}
-	defer facebookUserDetailsResponse.Body.Close()
-	err = json.Unmarshal(body, &fbUserDetails)
 
-	if err != nil {
-		return nil, fmt.Errorf("error occurred while getting information from Facebook: %+v", err)
-	}
-
-	return fbUserDetails, nil
-}
-
-// GetGoogleSignInToken Used for Signing In the Users
-func (a *authService) GetGoogleSignInToken(googleUserDetails *models.GoogleUser) (string, error) {
-	var result *models.User
-
-	if googleUserDetails == nil {
-		return "", fmt.Errorf("error: google user details can't be empty")
-	}
-
-	if googleUserDetails.Email == "" {
-		return "", fmt.Errorf("error: email can't be empty")
-	}
-
-	if googleUserDetails.Name == "" {
-		return "", fmt.Errorf("error: name can't be empty")
-	}
-
-	result, err := a.authRepo.FindUserByEmail(googleUserDetails.Email)
-	if err != nil {
-		return "", fmt.Errorf("error finding user: %+v", err)
-	}
-
-	if result == nil {
-		result.Email = googleUserDetails.Email
-		result.Name = googleUserDetails.Name
-		_, err = a.authRepo.CreateUser(result)
+	if user.TwoFactor.Enabled {
+		challengeToken, err := jwt.GenerateChallengeToken(user.Email, conf.JWTSecret)
 		if err != nil {
-			return "", fmt.Errorf("error occurred creating user: %+v", err)
+			log.Printf("error generating token %s", err)
+			return nil, apiError.ErrInternalServerError
 		}
+		return &models.LoginResponse{Challenge: &models.TwoFactorChallenge{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+			ExpiresIn:         int64(jwt.ChallengeTokenValidity.Seconds()),
+		}}, nil
 	}
 
-	tokenString, err := jwt.GenerateToken(googleUserDetails.Email, a.Config.JWTSecret)
-
-	if tokenString == "" {
-		return "", fmt.Errorf("unable to generate Auth token: %+v", err)
+	tokens, errr := sessions.StartSession(user, client)
+	if errr != nil {
+		return nil, errr
 	}
-
-	return tokenString, nil
+	return user.LoginUserToDto(tokens), nil
 }
 
-// GetFacebookSignInToken Used for Signing In the Users
-func (a *authService) GetFacebookSignInToken(facebookUserDetails *models.FacebookUser) (string, error) {
-	var result *models.User
-
-	if facebookUserDetails == nil {
-		return "", fmt.Errorf("error: facebook user details can't be empty")
-	}
-
-	if facebookUserDetails.Email == "" {
-		return "", fmt.Errorf("error: email can't be empty")
-	}
-
-	if facebookUserDetails.Name == "" {
-		return "", fmt.Errorf("error: name can't be empty")
-	}
-
-	result, err := a.authRepo.FindUserByEmail(facebookUserDetails.Email)
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return "", fmt.Errorf("error finding user: %+v", err)
+// VerifyEmail verifies the email the link was sent to, when it is still the
+// one of the user
+func (a *authService) VerifyEmail(token string) error {
+	verification, errr := a.tokens.ConsumeToken(token, models.PurposeEmailVerification)
+	if errr != nil {
+		return errr
 	}
-
-	if result == nil {
-		result = &models.User{}
-		result.Email = facebookUserDetails.Email
-		result.Name = facebookUserDetails.Name
-		result.IsEmailActive = true
-		_, err = a.authRepo.CreateUser(result)
-		if err != nil {
-			return "", fmt.Errorf("error occurred creating user: %+v", err)
-		}
+	err := a.authRepo.VerifyEmail(verification.UserID, verification.Data)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errInvalidLink
 	}
-
-	tokenString, err := jwt.GenerateToken(result.Email, a.Config.JWTSecret)
-
-	if tokenString == "" {
-		return "", fmt.Errorf("unable to generate Auth token: %+v", err)
+	if err != nil {
+		log.Printf("error verifying email of user %v: %v", verification.UserID, err)
+		return apiError.ErrInternalServerError
 	}
-
-	return tokenString, nil
+	return nil
 }
 
 func (a *authService) DeleteUserByEmail(userEmail string) *apiError.Error {
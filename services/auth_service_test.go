@@ -7,6 +7,7 @@ import (
 	"github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/mocks"
 	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
@@ -14,21 +15,52 @@ import (
 )
 
 var mockRepository *mocks.MockAuthRepository
+var mockSessionService *mocks.MockSessionService
+var mockLoginThrottle *mocks.MockLoginThrottleService
+var mockOneTimeTokens *mocks.MockOneTimeTokenService
+var mockMailer *mocks.MockMailer
 var testAuthService AuthService
 
 func setup(t *testing.T) func() {
 	ctrl := gomock.NewController(t)
-	ctrl.Finish()
 	mockRepository = mocks.NewMockAuthRepository(ctrl)
-	mailService := mocks.NewMockMailer(ctrl)
+	mockMailer = mocks.NewMockMailer(ctrl)
 	pushNotification := mocks.NewMockPushNotifier(ctrl)
-	testAuthService = NewAuthService(mockRepository, testConfig, mailService, pushNotification)
+	mockSessionService = mocks.NewMockSessionService(ctrl)
+	mockLoginThrottle = mocks.NewMockLoginThrottleService(ctrl)
+	mockOneTimeTokens = mocks.NewMockOneTimeTokenService(ctrl)
+	mockAPIKeyRepository = mocks.NewMockAPIKeyRepository(ctrl)
+	testAuthService = NewAuthService(mockRepository, mockAPIKeyRepository, mockSessionService, mockLoginThrottle, mockOneTimeTokens, testConfig, mockMailer, pushNotification)
 
 	mockMedicationRepository = mocks.NewMockMedicationRepository(ctrl)
 	mockMedicationHistoryRepository = mocks.NewMockMedicationHistoryRepository(ctrl)
-	testMedicationService = NewMedicationService(mockMedicationRepository, mockMedicationHistoryRepository, testConfig)
+	mockDrugRepository = mocks.NewMockDrugRepository(ctrl)
+	testMedicationService = NewMedicationService(mockMedicationRepository, mockMedicationHistoryRepository, mockDrugRepository, testConfig)
+	testDrugCatalogService = NewDrugCatalogService(mockDrugRepository, testConfig)
 
 	testMedicationHistoryService = NewMedicationHistoryService(mockMedicationHistoryRepository, testConfig)
+
+	mockDigestRepository = mocks.NewMockDigestRepository(ctrl)
+	testDigestService = NewDigestService(mockDigestRepository, mockMedicationRepository, mockMedicationHistoryRepository, mockMailer, testConfig)
+	mockCaregiverRepository = mocks.NewMockCaregiverRepository(ctrl)
+	testCaregiverService = NewCaregiverService(mockCaregiverRepository, mockOneTimeTokens, mockMailer, testConfig)
+	mockProfileRepository = mocks.NewMockProfileRepository(ctrl)
+	testProfileService = NewProfileService(mockProfileRepository, testConfig)
+	mockSessionRepository = mocks.NewMockSessionRepository(ctrl)
+	testSessionService = NewSessionService(mockSessionRepository, testConfig)
+	mockTwoFactorRepository = mocks.NewMockTwoFactorRepository(ctrl)
+	testTwoFactorService = NewTwoFactorService(mockTwoFactorRepository, mockRepository, mockSessionService, mockLoginThrottle, testConfig)
+	mockLoginThrottleRepository = mocks.NewMockLoginThrottleRepository(ctrl)
+	testLoginThrottleService = NewLoginThrottleService(mockLoginThrottleRepository, testConfig, mockMailer)
+	testUserService = NewUserService(mockRepository, mockMedicationRepository, mockSessionService, mockOneTimeTokens, testConfig, mockMailer)
+	mockAdminRepository = mocks.NewMockAdminRepository(ctrl)
+	mockAuthService = mocks.NewMockAuthService(ctrl)
+	testAdminService = NewAdminService(mockAdminRepository, mockAPIKeyRepository, mockSessionService, mockAuthService, testConfig)
+	testAPIKeyService = NewAPIKeyService(mockAPIKeyRepository, testConfig)
+	mockIdentityRepository = mocks.NewMockIdentityRepository(ctrl)
+	testIdentityService = NewIdentityService(mockIdentityRepository, mockRepository, mockSessionService, testConfig)
+	mockOneTimeTokenRepository = mocks.NewMockOneTimeTokenRepository(ctrl)
+	testOneTimeTokenService = NewOneTimeTokenService(mockOneTimeTokenRepository, testConfig)
 	return func() {
 		testAuthService = nil
 		testMedicationService = nil
@@ -59,12 +91,16 @@ func Test_AuthLoginService(t *testing.T) {
 
 	inactiveUser := user
 	inactiveUser.IsEmailActive = false
+	deactivatedUser := user
+	deactivatedUser.DeactivatedAt = 1
 
 	testCases := []struct {
 		name          string
 		input         models.LoginRequest
 		dbOutput      *models.User
 		dbError       error
+		tokens        *models.TokenPair
+		loginFailed   bool
 		loginResponse *models.LoginResponse
 		loginError    *errors.Error
 	}{
@@ -76,6 +112,7 @@ func Test_AuthLoginService(t *testing.T) {
 			},
 			dbOutput: &user,
 			dbError:  nil,
+			tokens:   &models.TokenPair{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 900},
 			loginResponse: &models.LoginResponse{
 				UserResponse: models.UserResponse{
 					ID:          user.ID,
@@ -83,6 +120,9 @@ func Test_AuthLoginService(t *testing.T) {
 					PhoneNumber: user.PhoneNumber,
 					Email:       user.Email,
 				},
+				AccessToken:  "access",
+				RefreshToken: "refresh",
+				ExpiresIn:    900,
 			},
 			loginError: nil,
 		},
@@ -94,6 +134,7 @@ func Test_AuthLoginService(t *testing.T) {
 			},
 			dbOutput:      nil,
 			dbError:       gorm.ErrRecordNotFound,
+			loginFailed:   true,
 			loginResponse: nil,
 			loginError:    errors.New("invalid email", http.StatusUnprocessableEntity),
 		},
@@ -105,6 +146,7 @@ func Test_AuthLoginService(t *testing.T) {
 			},
 			dbOutput:      &user,
 			dbError:       nil,
+			loginFailed:   true,
 			loginResponse: nil,
 			loginError:    errors.ErrInvalidPassword,
 		},
@@ -119,6 +161,17 @@ func Test_AuthLoginService(t *testing.T) {
 			loginResponse: nil,
 			loginError:    errors.New("email not verified", http.StatusUnauthorized),
 		},
+		{
+			name: "deactivated user",
+			input: models.LoginRequest{
+				Email:    deactivatedUser.Email,
+				Password: "password",
+			},
+			dbOutput:      &deactivatedUser,
+			dbError:       nil,
+			loginResponse: nil,
+			loginError:    errors.ErrAccountDeactivated,
+		},
 		{
 			name: "internal server error case",
 			input: models.LoginRequest{
@@ -136,17 +189,64 @@ func Test_AuthLoginService(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 
+			mockLoginThrottle.EXPECT().CheckLogin(tc.input.Email, "").Return(nil)
 			mockRepository.EXPECT().FindUserByEmail(tc.input.Email).Times(1).Return(tc.dbOutput, tc.dbError)
+			if tc.tokens != nil {
+				mockSessionService.EXPECT().StartSession(tc.dbOutput, tc.input.Client).Return(tc.tokens, nil)
+				mockLoginThrottle.EXPECT().LoginSucceeded(tc.input.Email)
+			}
+			if tc.loginFailed {
+				mockLoginThrottle.EXPECT().LoginFailed(tc.input.Email, "", tc.dbOutput)
+			}
 
 			loginResponse, err := testAuthService.LoginUser(&tc.input)
-			if tc.name != "login successful case" {
-				require.Equal(t, tc.loginResponse, loginResponse)
-				require.Equal(t, tc.loginError, err)
-			}
+			require.Equal(t, tc.loginResponse, loginResponse)
+			require.Equal(t, tc.loginError, err)
 		})
 	}
 }
 
+func Test_AuthLoginThrottled(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	throttled := errors.New("too many failed logins, try again in 15m0s", http.StatusTooManyRequests)
+	request := &models.LoginRequest{Email: "email@gmail.com", Password: "password", Client: models.SessionClient{IP: "10.0.0.1"}}
+	mockLoginThrottle.EXPECT().CheckLogin(request.Email, "10.0.0.1").Return(throttled)
+	mockRepository.EXPECT().FindUserByEmail(gomock.Any()).Times(0)
+
+	loginResponse, err := testAuthService.LoginUser(request)
+	require.Nil(t, loginResponse)
+	require.Equal(t, throttled, err)
+}
+
+func Test_AuthLoginTwoFactorChallenge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	authRepo := mocks.NewMockAuthRepository(ctrl)
+	conf := *testConfig
+	conf.JWTSecret = "testSecret"
+	throttle := mocks.NewMockLoginThrottleService(ctrl)
+	service := NewAuthService(authRepo, mocks.NewMockAPIKeyRepository(ctrl), mocks.NewMockSessionService(ctrl), throttle, mocks.NewMockOneTimeTokenService(ctrl), &conf, mocks.NewMockMailer(ctrl), mocks.NewMockPushNotifier(ctrl))
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+	user := &models.User{Email: "email@gmail.com", HashedPassword: string(hashedPassword), IsEmailActive: true}
+	user.TwoFactor.Enabled = true
+	throttle.EXPECT().CheckLogin(user.Email, "").Return(nil)
+	authRepo.EXPECT().FindUserByEmail(user.Email).Return(user, nil)
+	throttle.EXPECT().LoginSucceeded(gomock.Any()).Times(0)
+
+	loginResponse, errr := service.LoginUser(&models.LoginRequest{Email: user.Email, Password: "password"})
+	require.Nil(t, errr)
+	require.Empty(t, loginResponse.AccessToken)
+	require.True(t, loginResponse.Challenge.TwoFactorRequired)
+
+	claims, err := jwt.ValidateAndGetClaims(loginResponse.Challenge.ChallengeToken, "testSecret")
+	require.NoError(t, err)
+	require.Equal(t, jwt.PurposeTwoFactor, jwt.GetPurpose(claims))
+}
+
 func Test_DeleteUserByEmail(t *testing.T) {
 	// arrange
 	testCases := []struct {
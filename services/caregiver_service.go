@@ -0,0 +1,294 @@
+package services
+
+import (
+	stderrors "errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/caregiver_mock.go -package=mocks github.com/decagonhq/meddle-api/services CaregiverService
+
+type CaregiverService interface {
+	InviteCaregiver(patient *models.User, request *models.InviteCaregiverRequest) (*models.CaregiverLinkResponse, *errors.Error)
+	GetCaregivers(patientID uint) ([]models.CaregiverLinkResponse, *errors.Error)
+	UpdateCaregiver(patientID uint, linkID uint, request *models.UpdateCaregiverRequest) (*models.CaregiverLinkResponse, *errors.Error)
+	RemoveCaregiver(patientID uint, linkID uint) *errors.Error
+	GetInvitations(caregiver *models.User) ([]models.CaregiverLinkResponse, *errors.Error)
+	AcceptInvitation(caregiver *models.User, linkID uint) (*models.CaregiverLinkResponse, *errors.Error)
+	AcceptInvitationLink(caregiver *models.User, token string) (*models.CaregiverLinkResponse, *errors.Error)
+	DeclineInvitation(caregiver *models.User, linkID uint) *errors.Error
+	GetPatients(caregiverID uint) ([]models.CaregiverLinkResponse, *errors.Error)
+	LeavePatient(caregiverID uint, patientID uint) *errors.Error
+	AuthorizeCaregiver(caregiverID uint, patientID uint, permission models.CaregiverPermission) (*models.User, *errors.Error)
+	NotifyMissedDoses(doses []models.MedicationHistory)
+}
+
+var errAlreadyInvited = errors.New("this caregiver was already invited", http.StatusConflict)
+
+type caregiverService struct {
+	Config        *config.Config
+	caregiverRepo db.CaregiverRepository
+	tokens        OneTimeTokenService
+	mail          Mailer
+}
+
+// NewCaregiverService instantiates a service sharing the medications of
+// patients with their caregivers
+func NewCaregiverService(caregiverRepo db.CaregiverRepository, tokens OneTimeTokenService, mail Mailer, conf *config.Config) CaregiverService {
+	return &caregiverService{
+		Config:        conf,
+		caregiverRepo: caregiverRepo,
+		tokens:        tokens,
+		mail:          mail,
+	}
+}
+
+// InviteCaregiver invites the caregiver at the email of the request to the
+// medications of the patient and lets them know by email
+func (c *caregiverService) InviteCaregiver(patient *models.User, request *models.InviteCaregiverRequest) (*models.CaregiverLinkResponse, *errors.Error) {
+	link := models.NewCaregiverLink(patient.ID, request)
+	if link.CaregiverEmail == models.NormalizeEmail(patient.Email) {
+		return nil, errors.New("you can't be your own caregiver", http.StatusBadRequest)
+	}
+	links, err := c.caregiverRepo.GetCaregiverLinksByPatient(patient.ID)
+	if err != nil {
+		log.Printf("error getting caregivers of user %v: %v", patient.ID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	for _, existing := range links {
+		if existing.CaregiverEmail == link.CaregiverEmail {
+			return nil, errAlreadyInvited
+		}
+	}
+	link, err = c.caregiverRepo.CreateCaregiverLink(link)
+	// the same caregiver may be invited twice at once past the check above
+	if stderrors.Is(err, db.ErrAlreadyExists) {
+		return nil, errAlreadyInvited
+	}
+	if err != nil {
+		log.Printf("error inviting caregiver: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+
+	// the invitation also shows in the app, so it stands without the email
+	invitationLink := fmt.Sprintf("%s/caregiving/invitations", c.Config.BaseUrl)
+	if token, err := c.tokens.IssueToken(patient.ID, models.PurposeCaregiverInvite, strconv.FormatUint(uint64(link.ID), 10)); err == nil {
+		invitationLink = fmt.Sprintf("%s/caregiving/invitations/accept/%s", c.Config.BaseUrl, token)
+	}
+	value := map[string]interface{}{
+		"patient_name": patient.Name,
+		"permission":   string(link.Permission),
+		"link":         invitationLink,
+	}
+	body := fmt.Sprintf("%s invited you to help with their medications", patient.Name)
+	if err := c.mail.SendMail(link.CaregiverEmail, body, body, "caregiverinvitation", value); err != nil {
+		log.Printf("error sending caregiver invitation: %v", err)
+	}
+	return link.ToResponse(), nil
+}
+
+func (c *caregiverService) GetCaregivers(patientID uint) ([]models.CaregiverLinkResponse, *errors.Error) {
+	links, err := c.caregiverRepo.GetCaregiverLinksByPatient(patientID)
+	if err != nil {
+		log.Printf("error getting caregivers of user %v: %v", patientID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return models.CaregiverLinksToResponse(links), nil
+}
+
+func (c *caregiverService) UpdateCaregiver(patientID uint, linkID uint, request *models.UpdateCaregiverRequest) (*models.CaregiverLinkResponse, *errors.Error) {
+	link, err := c.caregiverRepo.GetCaregiverLink(linkID, patientID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error getting caregiver: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	link.Apply(request)
+	if err := c.caregiverRepo.UpdateCaregiverLink(link); err != nil {
+		log.Printf("error updating caregiver: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	return link.ToResponse(), nil
+}
+
+// RemoveCaregiver revokes the access of a caregiver, or cancels their
+// invitation
+func (c *caregiverService) RemoveCaregiver(patientID uint, linkID uint) *errors.Error {
+	err := c.caregiverRepo.DeleteCaregiverLink(linkID, patientID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error removing caregiver: %v", err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+// GetInvitations returns the pending invitations sent to the email of the
+// caregiver
+func (c *caregiverService) GetInvitations(caregiver *models.User) ([]models.CaregiverLinkResponse, *errors.Error) {
+	links, err := c.caregiverRepo.GetInvitations(models.NormalizeEmail(caregiver.Email))
+	if err != nil {
+		log.Printf("error getting invitations of user %v: %v", caregiver.ID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return models.CaregiverLinksToResponse(links), nil
+}
+
+func (c *caregiverService) AcceptInvitation(caregiver *models.User, linkID uint) (*models.CaregiverLinkResponse, *errors.Error) {
+	link, err := c.caregiverRepo.AcceptInvitation(linkID, caregiver)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error accepting invitation: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	return link.ToResponse(), nil
+}
+
+// AcceptInvitationLink accepts the invitation of the emailed link, which is
+// still only for the caregiver it was sent to. The link is only used up once
+// the invitation is accepted, anyone else opening it leaves it working
+func (c *caregiverService) AcceptInvitationLink(caregiver *models.User, token string) (*models.CaregiverLinkResponse, *errors.Error) {
+	invite, err := c.tokens.CheckToken(token, models.PurposeCaregiverInvite)
+	if err != nil {
+		return nil, err
+	}
+	linkID, errr := strconv.ParseUint(invite.Data, 10, 32)
+	if errr != nil {
+		log.Printf("invalid invitation of caregiver invite token %v: %v", invite.ID, errr)
+		return nil, errInvalidLink
+	}
+	link, err := c.AcceptInvitation(caregiver, uint(linkID))
+	if err != nil {
+		return nil, err
+	}
+	// the invitation is accepted even when the caregiver used the link twice
+	// at once and the other request consumed it
+	if _, err := c.tokens.ConsumeToken(token, models.PurposeCaregiverInvite); err != nil && err != errInvalidLink {
+		log.Printf("error consuming caregiver invite token %v: %v", invite.ID, err.Message)
+	}
+	return link, nil
+}
+
+func (c *caregiverService) DeclineInvitation(caregiver *models.User, linkID uint) *errors.Error {
+	err := c.caregiverRepo.DeclineInvitation(linkID, models.NormalizeEmail(caregiver.Email))
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error declining invitation: %v", err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+// GetPatients returns the patients the caregiver accepted the invitation of
+func (c *caregiverService) GetPatients(caregiverID uint) ([]models.CaregiverLinkResponse, *errors.Error) {
+	links, err := c.caregiverRepo.GetPatients(caregiverID)
+	if err != nil {
+		log.Printf("error getting patients of user %v: %v", caregiverID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return models.CaregiverLinksToResponse(links), nil
+}
+
+func (c *caregiverService) LeavePatient(caregiverID uint, patientID uint) *errors.Error {
+	err := c.caregiverRepo.LeavePatient(patientID, caregiverID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error leaving patient: %v", err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+// AuthorizeCaregiver returns the patient when the caregiver has the permission
+// on their medications. Users without access to the patient get not found, so
+// they can't tell which users exist
+func (c *caregiverService) AuthorizeCaregiver(caregiverID uint, patientID uint, permission models.CaregiverPermission) (*models.User, *errors.Error) {
+	link, err := c.caregiverRepo.GetAcceptedLink(patientID, caregiverID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error authorizing caregiver: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	if !link.Permission.Allows(permission) {
+		return nil, errors.New("you can only view the medications of this user", http.StatusForbidden)
+	}
+	if link.Patient == nil {
+		return nil, errors.ErrNotFound
+	}
+	return link.Patient, nil
+}
+
+// NotifyMissedDoses emails the caregivers who asked for it the doses their
+// patients missed, one email per patient
+func (c *caregiverService) NotifyMissedDoses(doses []models.MedicationHistory) {
+	if len(doses) == 0 {
+		return
+	}
+	byPatient := map[uint][]models.MedicationHistory{}
+	var patientIDs []uint
+	for _, dose := range doses {
+		if _, ok := byPatient[dose.UserID]; !ok {
+			patientIDs = append(patientIDs, dose.UserID)
+		}
+		byPatient[dose.UserID] = append(byPatient[dose.UserID], dose)
+	}
+	links, err := c.caregiverRepo.GetCaregiversToNotify(patientIDs)
+	if err != nil {
+		log.Printf("error getting caregivers to notify: %v", err)
+		return
+	}
+	for _, link := range links {
+		if link.Patient == nil || link.Caregiver == nil {
+			continue
+		}
+		loc := link.Caregiver.Location()
+		var missed []string
+		var lines []string
+		var names []string
+		named := map[string]bool{}
+		for _, dose := range byPatient[link.PatientID] {
+			// doses of a dependent name them, the caregiver may not know them
+			name, medication := link.Patient.Name, dose.MedicationName
+			if dose.ProfileName != "" {
+				name = fmt.Sprintf("%s (dependent of %s)", dose.ProfileName, link.Patient.Name)
+				medication = fmt.Sprintf("%s for %s", dose.MedicationName, dose.ProfileName)
+			}
+			if !named[name] {
+				named[name] = true
+				names = append(names, name)
+			}
+			at := dose.MedicationTime.In(loc).Format("Mon 2 Jan 15:04")
+			missed = append(missed, fmt.Sprintf("%s at %s", medication, at))
+			lines = append(lines, fmt.Sprintf("%s missed %s due at %s", name, dose.MedicationName, at))
+		}
+		value := map[string]interface{}{
+			"patient_name": link.Patient.Name,
+			"doses":        missed,
+		}
+		subject := fmt.Sprintf("%s missed a dose", strings.Join(names, " and "))
+		if err := c.mail.SendMail(link.Caregiver.Email, subject, strings.Join(lines, "\n"), "caregivermisseddoses", value); err != nil {
+			log.Printf("error notifying caregiver %v: %v", link.Caregiver.ID, err)
+		}
+	}
+}
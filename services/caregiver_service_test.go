@@ -0,0 +1,223 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var mockCaregiverRepository *mocks.MockCaregiverRepository
+var testCaregiverService CaregiverService
+
+func Test_InviteCaregiverService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	patient := &models.User{Model: models.Model{ID: 1}, Name: "Ada", Email: "ada@example.com"}
+	invited := models.CaregiverLink{PatientID: 1, CaregiverEmail: "son@example.com", Permission: models.CaregiverRead, Status: models.CaregiverPending}
+
+	testCases := []struct {
+		name       string
+		request    *models.InviteCaregiverRequest
+		buildStubs func()
+		err        *errors.Error
+	}{
+		{
+			name:    "invites and emails the caregiver",
+			request: &models.InviteCaregiverRequest{Email: " Daughter@Example.com", Permission: "manage", NotifyMissedDoses: true},
+			buildStubs: func() {
+				mockCaregiverRepository.EXPECT().GetCaregiverLinksByPatient(patient.ID).Return([]models.CaregiverLink{invited}, nil)
+				mockCaregiverRepository.EXPECT().CreateCaregiverLink(&models.CaregiverLink{
+					PatientID: 1, CaregiverEmail: "daughter@example.com", Permission: models.CaregiverManage,
+					Status: models.CaregiverPending, NotifyMissedDoses: true,
+				}).DoAndReturn(func(link *models.CaregiverLink) (*models.CaregiverLink, error) {
+					link.ID = 2
+					return link, nil
+				})
+				mockOneTimeTokens.EXPECT().IssueToken(patient.ID, models.PurposeCaregiverInvite, "2").Return("token", nil)
+				mockMailer.EXPECT().SendMail("daughter@example.com", gomock.Any(), gomock.Any(), "caregiverinvitation", map[string]interface{}{
+					"patient_name": "Ada",
+					"permission":   "manage",
+					"link":         testConfig.BaseUrl + "/caregiving/invitations/accept/token",
+				}).Return(nil)
+			},
+		},
+		{
+			name:       "inviting yourself",
+			request:    &models.InviteCaregiverRequest{Email: "ADA@example.com", Permission: "read"},
+			buildStubs: func() {},
+			err:        errors.New("you can't be your own caregiver", http.StatusBadRequest),
+		},
+		{
+			name:    "already invited",
+			request: &models.InviteCaregiverRequest{Email: "son@example.com", Permission: "manage"},
+			buildStubs: func() {
+				mockCaregiverRepository.EXPECT().GetCaregiverLinksByPatient(patient.ID).Return([]models.CaregiverLink{invited}, nil)
+			},
+			err: errors.New("this caregiver was already invited", http.StatusConflict),
+		},
+		{
+			name:    "invited at the same time",
+			request: &models.InviteCaregiverRequest{Email: "daughter@example.com", Permission: "read"},
+			buildStubs: func() {
+				mockCaregiverRepository.EXPECT().GetCaregiverLinksByPatient(patient.ID).Return([]models.CaregiverLink{invited}, nil)
+				mockCaregiverRepository.EXPECT().CreateCaregiverLink(gomock.Any()).
+					Return(nil, fmt.Errorf("could not create caregiver link: %w", db.ErrAlreadyExists))
+				mockMailer.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			err: errors.New("this caregiver was already invited", http.StatusConflict),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.buildStubs()
+			link, err := testCaregiverService.InviteCaregiver(patient, tc.request)
+			require.Equal(t, tc.err, err)
+			if tc.err == nil {
+				require.Equal(t, uint(2), link.ID)
+				require.Equal(t, models.CaregiverPending, link.Status)
+			}
+		})
+	}
+}
+
+func Test_AuthorizeCaregiverService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	patient := &models.User{Model: models.Model{ID: 1}, Name: "Ada"}
+	reader := &models.CaregiverLink{PatientID: 1, Patient: patient, Permission: models.CaregiverRead, Status: models.CaregiverAccepted}
+	manager := &models.CaregiverLink{PatientID: 1, Patient: patient, Permission: models.CaregiverManage, Status: models.CaregiverAccepted}
+
+	mockCaregiverRepository.EXPECT().GetAcceptedLink(uint(1), uint(2)).Return(reader, nil)
+	got, err := testCaregiverService.AuthorizeCaregiver(2, 1, models.CaregiverRead)
+	require.Nil(t, err)
+	require.Equal(t, patient, got)
+
+	mockCaregiverRepository.EXPECT().GetAcceptedLink(uint(1), uint(2)).Return(reader, nil)
+	_, err = testCaregiverService.AuthorizeCaregiver(2, 1, models.CaregiverManage)
+	require.Equal(t, http.StatusForbidden, err.Status)
+
+	mockCaregiverRepository.EXPECT().GetAcceptedLink(uint(1), uint(3)).Return(manager, nil)
+	got, err = testCaregiverService.AuthorizeCaregiver(3, 1, models.CaregiverManage)
+	require.Nil(t, err)
+	require.Equal(t, patient, got)
+
+	mockCaregiverRepository.EXPECT().GetAcceptedLink(uint(1), uint(4)).Return(nil, gorm.ErrRecordNotFound)
+	_, err = testCaregiverService.AuthorizeCaregiver(4, 1, models.CaregiverRead)
+	require.Equal(t, errors.ErrNotFound, err)
+}
+
+func Test_CaregiverInvitationsService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	caregiver := &models.User{Model: models.Model{ID: 2}, Email: "Son@Example.com"}
+	caregiverID := caregiver.ID
+	mockCaregiverRepository.EXPECT().AcceptInvitation(uint(5), caregiver).Return(&models.CaregiverLink{
+		Model: models.Model{ID: 5}, PatientID: 1, Patient: &models.User{Name: "Ada"}, CaregiverID: &caregiverID,
+		Permission: models.CaregiverRead, Status: models.CaregiverAccepted,
+	}, nil)
+	link, err := testCaregiverService.AcceptInvitation(caregiver, 5)
+	require.Nil(t, err)
+	require.Equal(t, "Ada", link.PatientName)
+	require.Equal(t, models.CaregiverAccepted, link.Status)
+
+	mockCaregiverRepository.EXPECT().AcceptInvitation(uint(6), caregiver).Return(nil, gorm.ErrRecordNotFound)
+	_, err = testCaregiverService.AcceptInvitation(caregiver, 6)
+	require.Equal(t, errors.ErrNotFound, err)
+
+	mockCaregiverRepository.EXPECT().DeclineInvitation(uint(7), "son@example.com").Return(nil)
+	require.Nil(t, testCaregiverService.DeclineInvitation(caregiver, 7))
+
+	mockCaregiverRepository.EXPECT().GetInvitations("son@example.com").Return(nil, nil)
+	invitations, err := testCaregiverService.GetInvitations(caregiver)
+	require.Nil(t, err)
+	require.Equal(t, []models.CaregiverLinkResponse{}, invitations)
+}
+
+func Test_NotifyMissedDosesService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	at := time.Date(2022, 8, 15, 7, 0, 0, 0, time.UTC)
+	doses := []models.MedicationHistory{
+		{UserID: 1, MedicationName: "metformin", MedicationTime: at},
+		{UserID: 3, MedicationName: "insulin", MedicationTime: at},
+		{UserID: 1, MedicationName: "aspirin", MedicationTime: at.Add(time.Hour)},
+	}
+	mockCaregiverRepository.EXPECT().GetCaregiversToNotify([]uint{1, 3}).Return([]models.CaregiverLink{{
+		PatientID: 1,
+		Patient:   &models.User{Name: "Ada"},
+		Caregiver: &models.User{Email: "son@example.com", TimeZone: "Africa/Lagos"},
+	}}, nil)
+	mockMailer.EXPECT().SendMail("son@example.com", "Ada missed a dose", gomock.Any(), "caregivermisseddoses", map[string]interface{}{
+		"patient_name": "Ada",
+		"doses":        []string{"metformin at Mon 15 Aug 08:00", "aspirin at Mon 15 Aug 09:00"},
+	}).Return(nil)
+
+	testCaregiverService.NotifyMissedDoses(doses)
+	testCaregiverService.NotifyMissedDoses(nil)
+}
+
+func Test_NotifyMissedDosesOfDependentService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	at := time.Date(2022, 8, 15, 7, 0, 0, 0, time.UTC)
+	doses := []models.MedicationHistory{
+		{UserID: 1, ProfileID: 4, ProfileName: "Tobi", MedicationName: "amoxicillin", MedicationTime: at},
+		{UserID: 1, MedicationName: "metformin", MedicationTime: at},
+	}
+	mockCaregiverRepository.EXPECT().GetCaregiversToNotify([]uint{1}).Return([]models.CaregiverLink{{
+		PatientID: 1,
+		Patient:   &models.User{Name: "Ada"},
+		Caregiver: &models.User{Email: "son@example.com", TimeZone: "Africa/Lagos"},
+	}}, nil)
+	lines := "Tobi (dependent of Ada) missed amoxicillin due at Mon 15 Aug 08:00\nAda missed metformin due at Mon 15 Aug 08:00"
+	mockMailer.EXPECT().SendMail("son@example.com", "Tobi (dependent of Ada) and Ada missed a dose", lines, "caregivermisseddoses", map[string]interface{}{
+		"patient_name": "Ada",
+		"doses":        []string{"amoxicillin for Tobi at Mon 15 Aug 08:00", "metformin at Mon 15 Aug 08:00"},
+	}).Return(nil)
+
+	testCaregiverService.NotifyMissedDoses(doses)
+	testCaregiverService.NotifyMissedDoses(nil)
+}
+
+func Test_AcceptInvitationLinkService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	caregiver := &models.User{Model: models.Model{ID: 2}, Email: "son@example.com"}
+	invite := &models.OneTimeToken{UserID: 1, Purpose: models.PurposeCaregiverInvite, Data: "5", User: &models.User{}}
+	gomock.InOrder(
+		mockOneTimeTokens.EXPECT().CheckToken("token", models.PurposeCaregiverInvite).Return(invite, nil),
+		mockCaregiverRepository.EXPECT().AcceptInvitation(uint(5), caregiver).Return(&models.CaregiverLink{Model: models.Model{ID: 5}, Status: models.CaregiverAccepted}, nil),
+		mockOneTimeTokens.EXPECT().ConsumeToken("token", models.PurposeCaregiverInvite).Return(invite, nil),
+	)
+	link, err := testCaregiverService.AcceptInvitationLink(caregiver, "token")
+	require.Nil(t, err)
+	require.Equal(t, uint(5), link.ID)
+
+	// a used or expired link
+	mockOneTimeTokens.EXPECT().CheckToken("token", models.PurposeCaregiverInvite).Return(nil, errInvalidLink)
+	_, err = testCaregiverService.AcceptInvitationLink(caregiver, "token")
+	require.Equal(t, errInvalidLink, err)
+
+	// the invitation was sent to another caregiver, or was cancelled, and
+	// the link keeps working for the caregiver it was sent to
+	mockOneTimeTokens.EXPECT().CheckToken("other", models.PurposeCaregiverInvite).Return(invite, nil)
+	mockCaregiverRepository.EXPECT().AcceptInvitation(uint(5), caregiver).Return(nil, gorm.ErrRecordNotFound)
+	mockOneTimeTokens.EXPECT().ConsumeToken("other", gomock.Any()).Times(0)
+	_, err = testCaregiverService.AcceptInvitationLink(caregiver, "other")
+	require.Equal(t, errors.ErrNotFound, err)
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/go-co-op/gocron"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/digest_mock.go -package=mocks github.com/decagonhq/meddle-api/services DigestService
+
+type DigestService interface {
+	GetDigestSettings(user *models.User) *models.DigestSettingsResponse
+	UpdateDigestSettings(user *models.User, request *models.UpdateDigestSettingsRequest) (*models.DigestSettingsResponse, *errors.Error)
+	Unsubscribe(token string) *errors.Error
+	SendDueDigests(now time.Time) error
+	SendDigest(user *models.User, now time.Time) error
+}
+
+type digestService struct {
+	Config                *config.Config
+	digestRepo            db.DigestRepository
+	medicationRepo        db.MedicationRepository
+	medicationHistoryRepo db.MedicationHistoryRepository
+	mail                  Mailer
+}
+
+// NewDigestService instantiates a service sending the weekly adherence digest
+func NewDigestService(digestRepo db.DigestRepository, medicationRepo db.MedicationRepository, medicationHistoryRepo db.MedicationHistoryRepository, mail Mailer, conf *config.Config) DigestService {
+	return &digestService{
+		Config:                conf,
+		digestRepo:            digestRepo,
+		medicationRepo:        medicationRepo,
+		medicationHistoryRepo: medicationHistoryRepo,
+		mail:                  mail,
+	}
+}
+
+func (d *digestService) GetDigestSettings(user *models.User) *models.DigestSettingsResponse {
+	return user.Digest.ToResponse()
+}
+
+func (d *digestService) UpdateDigestSettings(user *models.User, request *models.UpdateDigestSettingsRequest) (*models.DigestSettingsResponse, *errors.Error) {
+	settings := user.Digest
+	settings.Apply(request)
+	if err := d.digestRepo.UpdateDigestSettings(user.ID, &settings); err != nil {
+		log.Printf("error updating digest settings of user %v: %v", user.ID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	user.Digest = settings
+	return settings.ToResponse(), nil
+}
+
+// Unsubscribe opts the user the unsubscribe link of the digest was sent to out
+// of the digest
+func (d *digestService) Unsubscribe(token string) *errors.Error {
+	user, err := d.digestRepo.FindUserByUnsubscribeToken(token)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error finding user to unsubscribe: %v", err)
+		return errors.ErrInternalServerError
+	}
+	settings := user.Digest
+	settings.OptOut = true
+	if err := d.digestRepo.UpdateDigestSettings(user.ID, &settings); err != nil {
+		log.Printf("error unsubscribing user %v: %v", user.ID, err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+// SendDueDigests sends the digest to the users who get it at the hour of now
+func (d *digestService) SendDueDigests(now time.Time) error {
+	users, err := d.digestRepo.GetUsersDueDigest(now)
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		if err := d.SendDigest(&users[i], now); err != nil {
+			log.Printf("error sending digest to user %v: %v", users[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// SendDigest emails the user their adherence over the week before now, the
+// medications they took less than the low adherence threshold and the
+// medications ending in the week after now. Users without either get nothing
+func (d *digestService) SendDigest(user *models.User, now time.Time) error {
+	digest, err := d.weeklyDigest(user, now)
+	if err != nil {
+		return err
+	}
+	if digest.IsEmpty() {
+		return nil
+	}
+	if user.Digest.UnsubscribeToken == "" {
+		token, err := generateUnsubscribeToken()
+		if err != nil {
+			return err
+		}
+		settings := user.Digest
+		settings.UnsubscribeToken = token
+		if err := d.digestRepo.UpdateDigestSettings(user.ID, &settings); err != nil {
+			return err
+		}
+		user.Digest = settings
+	}
+	digest.UnsubscribeLink = fmt.Sprintf("%s/api/v1/digest/unsubscribe/%s", d.Config.BaseUrl, user.Digest.UnsubscribeToken)
+
+	err = d.mail.SendMail(user.Email, "Your week in medications", digest.Body(), "weeklydigest", digest.TemplateValues())
+	if err != nil {
+		return err
+	}
+	return d.digestRepo.MarkDigestSent(user.ID, now)
+}
+
+func (d *digestService) weeklyDigest(user *models.User, now time.Time) (*models.WeeklyDigest, error) {
+	week := &models.AdherenceRange{From: now.AddDate(0, 0, -7), To: now, Period: "day"}
+	adherence, err := d.medicationHistoryRepo.GetAdherence(user.ID, week)
+	if err != nil {
+		return nil, err
+	}
+	medications, err := d.medicationHistoryRepo.GetAdherenceByMedication(user.ID, week)
+	if err != nil {
+		return nil, err
+	}
+	threshold := float64(d.Config.DigestLowAdherencePercent)
+	if threshold <= 0 {
+		threshold = models.DefaultLowAdherencePercent
+	}
+	var lowAdherence []models.MedicationAdherence
+	for _, medication := range medications {
+		if medication.Taken+medication.Missed > 0 && medication.Adherence < threshold {
+			lowAdherence = append(lowAdherence, medication)
+		}
+	}
+
+	all, err := d.medicationRepo.GetAllMedications(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	var stoppingSoon []models.Medication
+	for _, medication := range all {
+		// like the adherence, the digest covers the user's own medications
+		if medication.ProfileID != 0 {
+			continue
+		}
+		stop := medication.MedicationStopDate
+		if medication.EffectiveStatus() == models.MedicationActive && !stop.Before(now) && stop.Before(now.AddDate(0, 0, 7)) {
+			stoppingSoon = append(stoppingSoon, medication)
+		}
+	}
+
+	return &models.WeeklyDigest{
+		Name:         user.Name,
+		From:         week.From,
+		To:           week.To,
+		Location:     user.Location(),
+		Adherence:    *adherence,
+		LowAdherence: lowAdherence,
+		StoppingSoon: stoppingSoon,
+	}, nil
+}
+
+func generateUnsubscribeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// DigestCronJob sends the digests due at the start of every hour
+func DigestCronJob(digestService DigestService) {
+	s := gocron.NewScheduler(time.UTC)
+	s.Cron("0 * * * *").Do(func() {
+		if err := digestService.SendDueDigests(time.Now()); err != nil {
+			log.Printf("digest cron job error: %v", err)
+		}
+	})
+	s.StartBlocking()
+}
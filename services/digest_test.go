@@ -0,0 +1,120 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var mockDigestRepository *mocks.MockDigestRepository
+var testDigestService DigestService
+
+func Test_SendDigestService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	now := time.Date(2022, 8, 15, 8, 0, 0, 0, time.UTC)
+	user := &models.User{Model: models.Model{ID: 1}, Name: "Tolu", Email: "tolu@example.com", TimeZone: "Africa/Lagos"}
+	week := &models.AdherenceRange{From: now.AddDate(0, 0, -7), To: now, Period: "day"}
+	stopping := models.Medication{Name: "amoxicillin", Status: models.MedicationActive, MedicationStopDate: now.AddDate(0, 0, 3)}
+	ended := models.Medication{Name: "ibuprofen", Status: models.MedicationActive, MedicationStopDate: now.AddDate(0, 0, -1)}
+	lowAdherence := models.MedicationAdherence{MedicationName: "metformin", AdherenceStats: models.AdherenceStats{Taken: 5, Missed: 9, Adherence: 35.7}}
+
+	t.Run("sends the week and creates the unsubscribe token", func(t *testing.T) {
+		mockMedicationHistoryRepository.EXPECT().GetAdherence(user.ID, week).Return(&models.AdherenceStats{Taken: 12, Missed: 9, Adherence: 57.1}, nil)
+		mockMedicationHistoryRepository.EXPECT().GetAdherenceByMedication(user.ID, week).Return([]models.MedicationAdherence{
+			lowAdherence,
+			{MedicationName: "paracetamol", AdherenceStats: models.AdherenceStats{Taken: 7, Adherence: 100}},
+		}, nil)
+		mockMedicationRepository.EXPECT().GetAllMedications(user.ID).Return([]models.Medication{stopping, ended}, nil)
+
+		var token string
+		mockDigestRepository.EXPECT().UpdateDigestSettings(user.ID, gomock.Any()).DoAndReturn(func(userID uint, settings *models.DigestSettings) error {
+			token = settings.UnsubscribeToken
+			return nil
+		})
+		mockMailer.EXPECT().SendMail(user.Email, "Your week in medications", gomock.Any(), "weeklydigest", gomock.Any()).
+			DoAndReturn(func(toEmail, subject, body, template string, values map[string]interface{}) error {
+				require.Equal(t, "Tolu", values["name"])
+				require.Equal(t, int64(9), values["missed"])
+				require.Equal(t, []map[string]interface{}{{"name": "metformin", "adherence": 35.7, "missed": int64(9)}}, values["low_adherence"])
+				require.Equal(t, []map[string]interface{}{{"name": "amoxicillin", "stop_date": "Thursday, 18 August"}}, values["stopping_soon"])
+				require.True(t, strings.HasSuffix(values["unsubscribe_link"].(string), "/api/v1/digest/unsubscribe/"+token))
+				require.Contains(t, body, "metformin: 35.7% adherence")
+				return nil
+			})
+		mockDigestRepository.EXPECT().MarkDigestSent(user.ID, now).Return(nil)
+
+		require.NoError(t, testDigestService.SendDigest(user, now))
+		require.Len(t, token, 64)
+		require.Equal(t, token, user.Digest.UnsubscribeToken)
+	})
+
+	t.Run("nothing to tell", func(t *testing.T) {
+		mockMedicationHistoryRepository.EXPECT().GetAdherence(user.ID, week).Return(&models.AdherenceStats{}, nil)
+		mockMedicationHistoryRepository.EXPECT().GetAdherenceByMedication(user.ID, week).Return(nil, nil)
+		mockMedicationRepository.EXPECT().GetAllMedications(user.ID).Return([]models.Medication{ended}, nil)
+
+		require.NoError(t, testDigestService.SendDigest(user, now))
+	})
+}
+
+func Test_SendDueDigestsService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	now := time.Now()
+	mockDigestRepository.EXPECT().GetUsersDueDigest(now).Return(nil, gorm.ErrInvalidDB)
+	require.Error(t, testDigestService.SendDueDigests(now))
+
+	// a failing user doesn't stop the others
+	users := []models.User{{Model: models.Model{ID: 1}}, {Model: models.Model{ID: 2}}}
+	mockDigestRepository.EXPECT().GetUsersDueDigest(now).Return(users, nil)
+	mockMedicationHistoryRepository.EXPECT().GetAdherence(uint(1), gomock.Any()).Return(nil, gorm.ErrInvalidDB)
+	mockMedicationHistoryRepository.EXPECT().GetAdherence(uint(2), gomock.Any()).Return(&models.AdherenceStats{}, nil)
+	mockMedicationHistoryRepository.EXPECT().GetAdherenceByMedication(uint(2), gomock.Any()).Return(nil, nil)
+	mockMedicationRepository.EXPECT().GetAllMedications(uint(2)).Return(nil, nil)
+	require.NoError(t, testDigestService.SendDueDigests(now))
+}
+
+func Test_DigestSettingsService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user := &models.User{Model: models.Model{ID: 1}, Digest: models.DigestSettings{Day: int(time.Monday), Hour: 8, UnsubscribeToken: "token"}}
+	require.Equal(t, &models.DigestSettingsResponse{Enabled: true, Day: "monday", Hour: 8}, testDigestService.GetDigestSettings(user))
+
+	enabled, hour := false, 0
+	mockDigestRepository.EXPECT().UpdateDigestSettings(user.ID, &models.DigestSettings{OptOut: true, Day: int(time.Sunday), Hour: 0, UnsubscribeToken: "token"}).Return(nil)
+	settings, err := testDigestService.UpdateDigestSettings(user, &models.UpdateDigestSettingsRequest{Enabled: &enabled, Day: "sunday", Hour: &hour})
+	require.Nil(t, err)
+	require.Equal(t, &models.DigestSettingsResponse{Enabled: false, Day: "sunday", Hour: 0}, settings)
+
+	mockDigestRepository.EXPECT().UpdateDigestSettings(user.ID, gomock.Any()).Return(gorm.ErrInvalidDB)
+	_, err = testDigestService.UpdateDigestSettings(user, &models.UpdateDigestSettingsRequest{Day: "friday"})
+	require.Equal(t, errors.ErrInternalServerError, err)
+	require.Equal(t, int(time.Sunday), user.Digest.Day)
+}
+
+func Test_UnsubscribeDigestService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user := &models.User{Model: models.Model{ID: 1}, Digest: models.DigestSettings{Day: 1, Hour: 8, UnsubscribeToken: "token"}}
+	mockDigestRepository.EXPECT().FindUserByUnsubscribeToken("token").Return(user, nil)
+	mockDigestRepository.EXPECT().UpdateDigestSettings(user.ID, &models.DigestSettings{OptOut: true, Day: 1, Hour: 8, UnsubscribeToken: "token"}).Return(nil)
+	require.Nil(t, testDigestService.Unsubscribe("token"))
+
+	mockDigestRepository.EXPECT().FindUserByUnsubscribeToken("unknown").Return(nil, gorm.ErrRecordNotFound)
+	require.Equal(t, errors.ErrNotFound, testDigestService.Unsubscribe("unknown"))
+
+	mockDigestRepository.EXPECT().FindUserByUnsubscribeToken("token").Return(nil, gorm.ErrInvalidDB)
+	require.Equal(t, errors.ErrInternalServerError, testDigestService.Unsubscribe("token"))
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAutocompleteLimit = 10
+	maxAutocompleteLimit     = 50
+)
+
+//go:generate mockgen -destination=../mocks/drug_catalog_mock.go -package=mocks github.com/decagonhq/meddle-api/services DrugCatalogService
+
+type DrugCatalogService interface {
+	ImportFile(path string) (int, error)
+	Import(r io.Reader) (int, error)
+	Autocomplete(query string, limit int) ([]models.DrugResponse, *errors.Error)
+	GetDrug(id uint) (*models.DrugResponse, *errors.Error)
+}
+
+type drugCatalogService struct {
+	Config   *config.Config
+	drugRepo db.DrugRepository
+}
+
+func NewDrugCatalogService(drugRepo db.DrugRepository, conf *config.Config) DrugCatalogService {
+	return &drugCatalogService{
+		Config:   conf,
+		drugRepo: drugRepo,
+	}
+}
+
+// ImportFile imports the catalog file at path, see Import
+func (d *drugCatalogService) ImportFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("could not open drug catalog: %v", err)
+	}
+	defer f.Close()
+	return d.Import(f)
+}
+
+// Import adds the drugs of a JSON catalog file to the catalog and returns how
+// many it imported. The whole file is rejected when a drug in it is invalid
+func (d *drugCatalogService) Import(r io.Reader) (int, error) {
+	var file models.DrugCatalogFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return 0, fmt.Errorf("could not decode drug catalog: %v", err)
+	}
+	seen := map[string]bool{}
+	for i := range file.Drugs {
+		if err := file.Drugs[i].Normalize(); err != nil {
+			return 0, fmt.Errorf("invalid drug at position %d: %v", i+1, err)
+		}
+		if seen[file.Drugs[i].Name] {
+			return 0, fmt.Errorf("drug %s is in the catalog twice", file.Drugs[i].Name)
+		}
+		seen[file.Drugs[i].Name] = true
+	}
+	if len(file.Drugs) == 0 {
+		return 0, nil
+	}
+	if err := d.drugRepo.UpsertDrugs(file.Drugs); err != nil {
+		return 0, err
+	}
+	return len(file.Drugs), nil
+}
+
+// Autocomplete returns the drugs whose name or a synonym starts with query
+func (d *drugCatalogService) Autocomplete(query string, limit int) ([]models.DrugResponse, *errors.Error) {
+	query = strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	if query == "" {
+		return nil, errors.New("query is required", http.StatusBadRequest)
+	}
+	if limit <= 0 {
+		limit = defaultAutocompleteLimit
+	}
+	if limit > maxAutocompleteLimit {
+		limit = maxAutocompleteLimit
+	}
+	drugs, err := d.drugRepo.SearchDrugs(query, limit)
+	if err != nil {
+		log.Printf("error searching drug catalog: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	responses := []models.DrugResponse{}
+	for i := range drugs {
+		responses = append(responses, *drugs[i].DrugToResponse())
+	}
+	return responses, nil
+}
+
+func (d *drugCatalogService) GetDrug(id uint) (*models.DrugResponse, *errors.Error) {
+	drug, err := d.drugRepo.GetDrug(id)
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.ErrNotFound
+		}
+		return nil, errors.ErrInternalServerError
+	}
+	return drug.DrugToResponse(), nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var mockDrugRepository *mocks.MockDrugRepository
+var testDrugCatalogService DrugCatalogService
+
+func Test_ImportDrugCatalog(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	catalog := `{"drugs": [
+		{"name": "Paracetamol", "synonyms": ["Panadol", "acetaminophen", "paracetamol"], "strengths": [{"amount": 500, "unit": "mg"}], "forms": ["tablet", "liquid"], "class_code": "n02be01"},
+		{"name": "ibuprofen", "synonyms": ["Advil"], "class_code": "M01AE01", "icon": "pill"}
+	]}`
+	mockDrugRepository.EXPECT().UpsertDrugs([]models.Drug{
+		{
+			Name:      "paracetamol",
+			Synonyms:  []string{"panadol", "acetaminophen"},
+			Strengths: []models.DoseQuantity{{Amount: 500, Unit: models.DoseUnitMilligram}},
+			Forms:     []models.DosageForm{models.DosageFormTablet, models.DosageFormLiquid},
+			ClassCode: "N02BE01",
+		},
+		{Name: "ibuprofen", Synonyms: []string{"advil"}, ClassCode: "M01AE01", Icon: "pill"},
+	}).Times(1).Return(nil)
+	count, err := testDrugCatalogService.Import(strings.NewReader(catalog))
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	invalid := []string{
+		`{"drugs": [{"name": ""}]}`,
+		`{"drugs": [{"name": "paracetamol", "forms": ["pill"]}]}`,
+		`{"drugs": [{"name": "paracetamol", "strengths": [{"amount": 500, "unit": "tablet"}]}]}`,
+		`{"drugs": [{"name": "paracetamol"}, {"name": "Paracetamol"}]}`,
+		`not json`,
+	}
+	for _, file := range invalid {
+		_, err := testDrugCatalogService.Import(strings.NewReader(file))
+		require.Error(t, err, file)
+	}
+}
+
+func Test_AutocompleteDrugs(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	testCases := []struct {
+		name       string
+		query      string
+		limit      int
+		buildStubs func(repository *mocks.MockDrugRepository)
+		expected   []models.DrugResponse
+		err        *errors.Error
+	}{
+		{
+			name:  "matching drugs",
+			query: "  PARA ",
+			buildStubs: func(repository *mocks.MockDrugRepository) {
+				repository.EXPECT().SearchDrugs("para", defaultAutocompleteLimit).Times(1).
+					Return([]models.Drug{{Model: models.Model{ID: 1}, Name: "paracetamol"}}, nil)
+			},
+			expected: []models.DrugResponse{{ID: 1, Name: "Paracetamol"}},
+		},
+		{
+			name:  "limit is capped",
+			query: "a",
+			limit: 1000,
+			buildStubs: func(repository *mocks.MockDrugRepository) {
+				repository.EXPECT().SearchDrugs("a", maxAutocompleteLimit).Times(1).Return(nil, nil)
+			},
+			expected: []models.DrugResponse{},
+		},
+		{
+			name:       "empty query",
+			query:      " ",
+			buildStubs: func(repository *mocks.MockDrugRepository) {},
+			err:        errors.New("query is required", http.StatusBadRequest),
+		},
+		{
+			name:  "db error",
+			query: "para",
+			buildStubs: func(repository *mocks.MockDrugRepository) {
+				repository.EXPECT().SearchDrugs("para", defaultAutocompleteLimit).Times(1).Return(nil, gorm.ErrInvalidDB)
+			},
+			err: errors.ErrInternalServerError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.buildStubs(mockDrugRepository)
+			drugs, err := testDrugCatalogService.Autocomplete(tc.query, tc.limit)
+			require.Equal(t, tc.err, err)
+			require.Equal(t, tc.expected, drugs)
+		})
+	}
+}
+
+func Test_MedicationFromCatalogDrug(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	service := testMedicationService.(*medicationService)
+
+	drugID := uint(3)
+	mockDrugRepository.EXPECT().GetDrug(drugID).Times(1).Return(&models.Drug{Model: models.Model{ID: drugID}, Name: "paracetamol", Icon: "pill"}, nil)
+	medication := &models.Medication{Name: "panadol 500mg", DrugID: &drugID, MedicationIcon: "heart"}
+	require.Nil(t, service.applyCatalogDrug(medication))
+	require.Equal(t, "Paracetamol", medication.Name)
+	require.Equal(t, "pill", medication.MedicationIcon)
+
+	mockDrugRepository.EXPECT().GetDrug(drugID).Times(1).Return(nil, gorm.ErrRecordNotFound)
+	err := service.applyCatalogDrug(&models.Medication{DrugID: &drugID})
+	require.Equal(t, http.StatusBadRequest, err.Status)
+
+	medication = &models.Medication{Name: "vitamin c"}
+	require.Nil(t, service.applyCatalogDrug(medication))
+	require.Equal(t, "vitamin c", medication.Name)
+}
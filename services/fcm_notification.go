@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"fmt"
 	firebase "firebase.google.com/go"
 	"firebase.google.com/go/messaging"
 	"github.com/decagonhq/meddle-api/config"
@@ -23,16 +24,18 @@ type PushNotifier interface {
 	SendPushNotification(registrationTokens []string, payload *models.PushPayload) (*messaging.MulticastMessage, *errors.Error)
 	NotificationsCronJob()
 	GetSingleUserDeviceTokens(userId int) ([]string, *errors.Error)
+	CheckLowStockMedications()
 }
 
 type notificationService struct {
 	Conf             *config.Config
 	notificationRepo db.NotificationRepository
 	Client           *messaging.Client
+	mail             Mailer
 }
 
 // NewFirebaseCloudMessaging instantiates an FCM service
-func NewFirebaseCloudMessaging(notificationRepo db.NotificationRepository, conf *config.Config) (PushNotifier, error) {
+func NewFirebaseCloudMessaging(notificationRepo db.NotificationRepository, mail Mailer, conf *config.Config) (PushNotifier, error) {
 	firebaseApp, err := firebase.NewApp(context.Background(), nil, option.WithCredentialsFile(conf.GoogleApplicationCredentials))
 	if err != nil {
 		log.Println(err)
@@ -51,6 +54,7 @@ func NewFirebaseCloudMessaging(notificationRepo db.NotificationRepository, conf
 		notificationRepo: notificationRepo,
 		Conf:             conf,
 		Client:           fcm.Client,
+		mail:             mail,
 	}, nil
 }
 
@@ -95,8 +99,8 @@ func (fcm *notificationService) CheckIfThereIsNextMedication() {
 			}
 
 			notification, err := fcm.SendPushNotification(deviceTokens, &models.PushPayload{
-				Body:  "'" + (medicationNotifications)[i].Name + "' is due in___",
-				Title: (medicationNotifications)[i].Name,
+				Body:  medicationNotificationBody(&medicationNotifications[i]),
+				Title: medicationNotificationTitle(&medicationNotifications[i]),
 				Data: map[string]string{
 					"link": "/user/medication/id?=" + strconv.Itoa(int((medicationNotifications)[i].ID)),
 				},
@@ -113,6 +117,96 @@ func (fcm *notificationService) CheckIfThereIsNextMedication() {
 	}
 }
 
+// medicationNotificationBody tells the user the dose due next, in their time
+// zone, and which dependent it is for
+func medicationNotificationBody(medication *models.Medication) string {
+	dueAt := medication.NextDosageTime.In(medication.Location())
+	name := medication.Name
+	if !medication.Strength.IsZero() {
+		name += " " + medication.Strength.String()
+	}
+	if medication.ProfileName != "" {
+		return fmt.Sprintf("'%s' is due for %s at %s, give %s", name, medication.ProfileName, dueAt.Format("15:04"), medication.DoseAt(medication.NextDosageTime))
+	}
+	return fmt.Sprintf("'%s' is due at %s, take %s", name, dueAt.Format("15:04"), medication.DoseAt(medication.NextDosageTime))
+}
+
+// medicationNotificationTitle is the name of the medication, with the
+// dependent it is for
+func medicationNotificationTitle(medication *models.Medication) string {
+	if medication.ProfileName != "" {
+		return fmt.Sprintf("%s for %s", medication.Name, medication.ProfileName)
+	}
+	return medication.Name
+}
+
+// CheckLowStockMedications reminds users by push notification and email to
+// refill the medications projected to run out within the configured number
+// of days. A medication is reminded once until its next refill
+func (fcm *notificationService) CheckLowStockMedications() {
+	medications, err := fcm.notificationRepo.GetStockTrackedMedicationsToNotify()
+	if err != nil {
+		log.Println("could not get stock tracked medications from db", err)
+		return
+	}
+
+	days := fcm.Conf.RefillReminderDays
+	if days <= 0 {
+		days = defaultRefillReminderDays
+	}
+	remindBefore := time.Now().AddDate(0, 0, days)
+	for i := range medications {
+		medication := &medications[i]
+		runOut, ok := ProjectedRunOutTime(medication)
+		if !ok || runOut.After(remindBefore) {
+			continue
+		}
+		body := lowStockNotificationBody(medication, runOut)
+
+		deviceTokens, err := fcm.notificationRepo.GetSingleUserDeviceTokens(int(medication.UserID))
+		if err != nil {
+			log.Printf("error retrieving device notification tokens: %v\n", err)
+		}
+		if len(deviceTokens) > 0 {
+			_, errr := fcm.SendPushNotification(deviceTokens, &models.PushPayload{
+				Body:  body,
+				Title: "Time to refill " + medicationNotificationTitle(medication),
+				Data: map[string]string{
+					"link": "/user/medication/id?=" + strconv.Itoa(int(medication.ID)),
+				},
+				ClickAction: "/user/medication/id?=" + strconv.Itoa(int(medication.ID)),
+			})
+			if errr != nil {
+				log.Println("error sending low stock notification", errr)
+			}
+		}
+
+		email, err := fcm.notificationRepo.GetUserEmail(medication.UserID)
+		if err != nil {
+			log.Printf("error retrieving email of user %v: %v", medication.UserID, err)
+		} else if fcm.mail != nil {
+			value := map[string]interface{}{
+				"medication_name": medicationNotificationTitle(medication),
+				"run_out_date":    runOut.In(medication.Location()).Format("Monday, 2 January"),
+			}
+			if err := fcm.mail.SendMail(email, "Time to refill "+medicationNotificationTitle(medication), body, "refillreminder", value); err != nil {
+				log.Printf("error sending low stock email: %v", err)
+			}
+		}
+
+		if err := fcm.notificationRepo.MarkLowStockNotified(medication.ID); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// lowStockNotificationBody tells the user when the medication runs out, in
+// their time zone
+func lowStockNotificationBody(medication *models.Medication, runOut time.Time) string {
+	return fmt.Sprintf("'%s' runs out on %s, %v left", medication.Name,
+		runOut.In(medication.Location()).Format("Mon 2 Jan"), models.DoseQuantity{Amount: *medication.StockQuantity, Unit: medication.EffectiveDose().Unit})
+}
+
 func (fcm *notificationService) SendPushNotification(registrationTokens []string, payload *models.PushPayload) (*messaging.MulticastMessage, *errors.Error) {
 
 	notification := &messaging.MulticastMessage{
@@ -177,5 +271,8 @@ func (fcm *notificationService) NotificationsCronJob() {
 	scheduler.Every(1).Hour().Do(func() {
 		fcm.CheckIfThereIsNextMedication()
 	})
+	scheduler.Every(1).Day().At("09:00").Do(func() {
+		fcm.CheckLowStockMedications()
+	})
 	scheduler.StartBlocking()
 }
@@ -3,9 +3,9 @@ package services
 import (
 	apiError "github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/models"
-	"github.com/decagonhq/meddle-api/services/jwt"
 	"log"
 	"net/http"
+	"time"
 )
 
 func (a *authService) SendEmailForPasswordReset(user *models.ForgotPassword) *apiError.Error {
@@ -14,9 +14,9 @@ func (a *authService) SendEmailForPasswordReset(user *models.ForgotPassword) *ap
 	if err != nil {
 		return apiError.New("email does not exist", http.StatusBadRequest)
 	}
-	token, err := jwt.GenerateToken(foundUser.Email, a.Config.JWTSecret)
-	if err != nil {
-		return apiError.New("", http.StatusInternalServerError)
+	token, errr := a.tokens.IssueToken(foundUser.ID, models.PurposePasswordReset, "")
+	if errr != nil {
+		return errr
 	}
 	//link := fmt.Sprintf("%s/resetpassword/%s", a.Config.BaseUrl, token)
 	link := "https://www.meddle-go.net/resetpassword/" + token
@@ -46,25 +46,19 @@ func (a *authService) ResetPassword(reset *models.ResetPassword, token string) *
 	if err != nil {
 		return apiError.New("", http.StatusInternalServerError)
 	}
-	err = a.authRepo.IsTokenInBlacklist(token)
-	if err != nil {
-		return apiError.New("expired link", http.StatusUnauthorized)
+	resetToken, errr := a.tokens.ConsumeToken(token, models.PurposePasswordReset)
+	if errr != nil {
+		return errr
 	}
-	claims, err := jwt.ValidateAndGetClaims(token, a.Config.JWTSecret)
+	err = a.authRepo.UpdatePassword(user.HashedPassword, resetToken.User.Email)
 	if err != nil {
-		return apiError.New("invalid link", http.StatusUnauthorized)
-	}
-	email := claims["email"].(string)
-	errr := a.authRepo.UpdatePassword(user.HashedPassword, email)
-	if errr != nil {
 		return apiError.New("", http.StatusInternalServerError)
 	}
-	accBlacklist := &models.BlackList{
-		Email: email,
-		Token: token,
+	// whoever knew the old password is signed out with it, and loses the
+	// API keys they made with it
+	if err := a.apiKeyRepo.RevokeAPIKeys(resetToken.UserID, time.Now().Unix()); err != nil {
+		log.Printf("error revoking api keys of user %v: %v", resetToken.UserID, err)
+		return apiError.ErrInternalServerError
 	}
-	if err := a.authRepo.AddToBlackList(accBlacklist); err != nil {
-		return apiError.New("", http.StatusInternalServerError)
-	}
-	return nil
+	return a.sessions.RevokeSessions(resetToken.UserID)
 }
@@ -0,0 +1,80 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/decagonhq/meddle-api/models"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/facebook"
+)
+
+// facebookProvider signs users in with Facebook Login, which gives an access
+// token to the Graph API instead of an ID token
+type facebookProvider struct {
+	conf     *oauth2.Config
+	graphURL string
+	client   *http.Client
+}
+
+func NewFacebook(clientID, clientSecret, redirectURL string) Provider {
+	return &facebookProvider{
+		conf: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     facebook.Endpoint,
+			Scopes:       []string{"email"},
+		},
+		graphURL: "https://graph.facebook.com",
+		client:   http.DefaultClient,
+	}
+}
+
+func (p *facebookProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	return p.conf.AuthCodeURL(state, pkceParams(verifier)...), nil
+}
+
+func (p *facebookProvider) Exchange(ctx context.Context, code, nonce, verifier string) (*models.ExternalIdentity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.conf.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return nil, fmt.Errorf("could not exchange code with facebook: %v", err)
+	}
+	query := url.Values{"fields": {"id,name,email"}, "access_token": {token.AccessToken}}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.graphURL+"/me?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := p.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("could not get user from facebook: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not get user from facebook: %s", response.Status)
+	}
+	var user struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("could not decode user from facebook: %v", err)
+	}
+	if user.ID == "" {
+		return nil, fmt.Errorf("facebook returned no user ID")
+	}
+	return &models.ExternalIdentity{
+		Provider: "facebook",
+		Subject:  user.ID,
+		Email:    user.Email,
+		// the Graph API doesn't say whether the user confirmed the address,
+		// so a facebook account is only ever linked by a signed in user
+		EmailVerified: false,
+		Name:          user.Name,
+	}, nil
+}
@@ -0,0 +1,38 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func Test_FacebookExchange(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/me", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "access", r.URL.Query().Get("access_token"))
+		json.NewEncoder(w).Encode(map[string]string{"id": "42", "name": "Ken", "email": "ken@gmail.com"})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	provider := &facebookProvider{
+		conf:     &oauth2.Config{ClientID: "meddle", Endpoint: oauth2.Endpoint{TokenURL: server.URL + "/token"}},
+		graphURL: server.URL,
+		client:   server.Client(),
+	}
+
+	identity, err := provider.Exchange(context.Background(), "code", "", "verifier")
+	require.NoError(t, err)
+	require.Equal(t, "42", identity.Subject)
+	require.Equal(t, "ken@gmail.com", identity.Email)
+	// facebook doesn't vouch for the address, so it can't link an account
+	require.False(t, identity.EmailVerified)
+}
@@ -0,0 +1,82 @@
+// Package identity signs users in with external identity providers, OpenID
+// Connect ones or Facebook
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/models"
+	"golang.org/x/oauth2"
+)
+
+// Provider is an identity provider users sign in with through the
+// authorization code flow
+type Provider interface {
+	// AuthCodeURL returns the page of the provider to send the user to. The
+	// state comes back with the code, the nonce is bound into the ID token and
+	// the verifier proves the code is traded by who asked for it
+	AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error)
+	// Exchange trades the code of the callback for the identity of the user
+	Exchange(ctx context.Context, code, nonce, verifier string) (*models.ExternalIdentity, error)
+}
+
+// googleIssuer issues the ID tokens of Google accounts
+const googleIssuer = "https://accounts.google.com"
+
+// NewProviders returns the providers the config sets up by name, Google and
+// Facebook when they have a client ID and every OpenID Connect provider
+func NewProviders(conf *config.Config) map[string]Provider {
+	providers := map[string]Provider{}
+	if conf.GoogleClientID != "" {
+		providers["google"] = NewOIDC("google", config.OIDCProviderConfig{
+			Issuer:       googleIssuer,
+			ClientID:     conf.GoogleClientID,
+			ClientSecret: conf.GoogleClientSecret,
+			RedirectURL:  conf.GoogleRedirectURL,
+		})
+	}
+	if conf.FacebookClientID != "" {
+		providers["facebook"] = NewFacebook(conf.FacebookClientID, conf.FacebookClientSecret, conf.FacebookRedirectURL)
+	}
+	for _, provider := range conf.OIDC {
+		providers[provider.Name] = NewOIDC(provider.Name, provider)
+	}
+	return providers
+}
+
+// RandomString returns a random url safe string for states, nonces and
+// verifiers
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate random string: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// pkceParams returns the parameters sending the S256 challenge of the verifier
+func pkceParams(verifier string) []oauth2.AuthCodeOption {
+	sum := sha256.Sum256([]byte(verifier))
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+}
+
+func scopes(configured string, defaults ...string) []string {
+	seen := map[string]bool{}
+	var list []string
+	for _, scope := range append(defaults, strings.Fields(configured)...) {
+		if !seen[scope] {
+			seen[scope] = true
+			list = append(list, scope)
+		}
+	}
+	return list
+}
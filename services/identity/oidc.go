@@ -0,0 +1,361 @@
+package identity
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/oauth2"
+)
+
+// clockSkew is how far the clock of a provider may be from ours
+const clockSkew = time.Minute
+
+// keysRefreshInterval is how often at most the keys of a provider are fetched
+// again for an ID token signed with a key we don't know
+const keysRefreshInterval = time.Minute
+
+// oidcProvider is an OpenID Connect provider, it finds its endpoints and keys
+// from its discovery document the first time they are needed
+type oidcProvider struct {
+	name   string
+	conf   config.OIDCProviderConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *discoveryDocument
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDC returns the OpenID Connect provider of the config
+func NewOIDC(name string, conf config.OIDCProviderConfig) Provider {
+	conf.Issuer = strings.TrimSuffix(conf.Issuer, "/")
+	return &oidcProvider{name: name, conf: conf, client: http.DefaultClient}
+}
+
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	options := append(pkceParams(verifier), oauth2.SetAuthURLParam("nonce", nonce))
+	return p.oauth2Config(discovery).AuthCodeURL(state, options...), nil
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code, nonce, verifier string) (*models.ExternalIdentity, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.oauth2Config(discovery).Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return nil, fmt.Errorf("could not exchange code with %s: %v", p.name, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("%s returned no ID token", p.name)
+	}
+	claims, err := p.verifyIDToken(ctx, rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ExternalIdentity{
+		Provider:      p.name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+func (p *oidcProvider) oauth2Config(discovery *discoveryDocument) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.conf.ClientID,
+		ClientSecret: p.conf.ClientSecret,
+		RedirectURL:  p.conf.RedirectURL,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+		Scopes: scopes(p.conf.Scopes, "openid", "email", "profile"),
+	}
+}
+
+// discover returns the discovery document of the provider, fetching it the
+// first time
+func (p *oidcProvider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	var discovery discoveryDocument
+	if err := p.getJSON(ctx, p.conf.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("could not get discovery document of %s: %v", p.name, err)
+	}
+	// the document must be the one of the issuer, whose ID tokens we accept
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.conf.Issuer {
+		return nil, fmt.Errorf("discovery document of %s is for issuer %q", p.name, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of %s is missing endpoints", p.name)
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// idTokenClaims are the claims of an ID token we use
+type idTokenClaims struct {
+	Issuer          string    `json:"iss"`
+	Subject         string    `json:"sub"`
+	Audience        audience  `json:"aud"`
+	AuthorizedParty string    `json:"azp"`
+	ExpiresAt       int64     `json:"exp"`
+	IssuedAt        int64     `json:"iat"`
+	Nonce           string    `json:"nonce"`
+	Email           string    `json:"email"`
+	EmailVerified   claimBool `json:"email_verified"`
+	Name            string    `json:"name"`
+}
+
+// Valid checks the times of the token, verifyIDToken checks the rest
+func (c *idTokenClaims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(clockSkew)) {
+		return fmt.Errorf("token is expired")
+	}
+	if now.Add(clockSkew).Before(time.Unix(c.IssuedAt, 0)) {
+		return fmt.Errorf("token used before issued")
+	}
+	return nil
+}
+
+// verifyIDToken verifies the signature of the ID token against the keys of
+// the provider, and that it was issued by the provider for us in answer to
+// the login with the nonce
+func (p *oidcProvider) verifyIDToken(ctx context.Context, rawIDToken, nonce string) (*idTokenClaims, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token from %s: %v", p.name, err)
+	}
+	if strings.TrimSuffix(claims.Issuer, "/") != p.conf.Issuer {
+		return nil, fmt.Errorf("ID token from %s has issuer %q", p.name, claims.Issuer)
+	}
+	if !claims.Audience.contains(p.conf.ClientID) {
+		return nil, fmt.Errorf("ID token from %s is not for us", p.name)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.conf.ClientID {
+		return nil, fmt.Errorf("ID token from %s was issued to %q", p.name, claims.AuthorizedParty)
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("ID token from %s has the wrong nonce", p.name)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("ID token from %s has no subject", p.name)
+	}
+	return &claims, nil
+}
+
+// key returns the signing key kid of the provider, fetching the keys again
+// when it rotated them
+func (p *oidcProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.findKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	var set jsonWebKeySet
+	if err := p.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("could not get signing keys of %s: %v", p.name, err)
+	}
+	p.keys = set.publicKeys()
+	p.keysFetchedAt = time.Now()
+	if key, ok := p.findKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// findKey finds the key kid, or the only key for tokens without a kid
+func (p *oidcProvider) findKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, response.Status)
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKeys returns the signing keys of the set by kid, skipping the ones we
+// can't use
+func (s *jsonWebKeySet) publicKeys() map[string]crypto.PublicKey {
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range s.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// audience is the aud claim, a string or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// claimBool is a boolean claim, some providers send it as a string
+type claimBool bool
+
+func (c *claimBool) UnmarshalJSON(b []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case bool:
+		*c = claimBool(v)
+	case string:
+		*c = claimBool(v == "true")
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+// testIssuer is an OpenID Connect provider answering every code with the ID
+// token its idToken func makes
+type testIssuer struct {
+	*httptest.Server
+	key     *rsa.PrivateKey
+	idToken func(issuer string) string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	issuer := &testIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(discoveryDocument{
+			Issuer:                issuer.URL,
+			AuthorizationEndpoint: issuer.URL + "/authorize",
+			TokenEndpoint:         issuer.URL + "/token",
+			JWKSURI:               issuer.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jsonWebKeySet{Keys: []jsonWebKey{{
+			Kty: "RSA",
+			Kid: "key-1",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     issuer.idToken(issuer.URL),
+		})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func (i *testIssuer) sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = "key-1"
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestOIDCExchange(t *testing.T) {
+	issuer := newTestIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	claims := func(change func(claims jwt.MapClaims)) func(string) jwt.MapClaims {
+		return func(iss string) jwt.MapClaims {
+			now := time.Now()
+			claims := jwt.MapClaims{
+				"iss":            iss,
+				"sub":            "1234",
+				"aud":            "meddle",
+				"exp":            now.Add(time.Hour).Unix(),
+				"iat":            now.Unix(),
+				"nonce":          "nonce",
+				"email":          "ken@gmail.com",
+				"email_verified": true,
+				"name":           "Ken",
+			}
+			if change != nil {
+				change(claims)
+			}
+			return claims
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		idToken func(issuer string) string
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			idToken: func(iss string) string {
+				return issuer.sign(t, jwt.SigningMethodRS256, issuer.key, claims(nil)(iss))
+			},
+		},
+		{
+			name: "wrong nonce",
+			idToken: func(iss string) string {
+				return issuer.sign(t, jwt.SigningMethodRS256, issuer.key, claims(func(c jwt.MapClaims) { c["nonce"] = "other" })(iss))
+			},
+			wantErr: true,
+		},
+		{
+			name: "other audience",
+			idToken: func(iss string) string {
+				return issuer.sign(t, jwt.SigningMethodRS256, issuer.key, claims(func(c jwt.MapClaims) { c["aud"] = "other" })(iss))
+			},
+			wantErr: true,
+		},
+		{
+			name: "other issuer",
+			idToken: func(iss string) string {
+				return issuer.sign(t, jwt.SigningMethodRS256, issuer.key, claims(nil)("https://evil.example.com"))
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			idToken: func(iss string) string {
+				return issuer.sign(t, jwt.SigningMethodRS256, issuer.key, claims(func(c jwt.MapClaims) {
+					c["exp"] = time.Now().Add(-time.Hour).Unix()
+				})(iss))
+			},
+			wantErr: true,
+		},
+		{
+			name: "signed with another key",
+			idToken: func(iss string) string {
+				return issuer.sign(t, jwt.SigningMethodRS256, otherKey, claims(nil)(iss))
+			},
+			wantErr: true,
+		},
+		{
+			name: "signed with the client secret",
+			idToken: func(iss string) string {
+				return issuer.sign(t, jwt.SigningMethodHS256, []byte("secret"), claims(nil)(iss))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			issuer.idToken = tc.idToken
+			provider := NewOIDC("company", config.OIDCProviderConfig{
+				Issuer:       issuer.URL,
+				ClientID:     "meddle",
+				ClientSecret: "secret",
+				RedirectURL:  "https://meddle.example.com/callback",
+			})
+
+			identity, err := provider.Exchange(context.Background(), "code", "nonce", "verifier")
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "company", identity.Provider)
+			require.Equal(t, "1234", identity.Subject)
+			require.Equal(t, "ken@gmail.com", identity.Email)
+			require.True(t, identity.EmailVerified)
+		})
+	}
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := NewOIDC("company", config.OIDCProviderConfig{Issuer: issuer.URL, ClientID: "meddle"})
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	require.NoError(t, err)
+	require.Contains(t, authURL, issuer.URL+"/authorize?")
+	require.Contains(t, authURL, "nonce=nonce")
+	require.Contains(t, authURL, "code_challenge_method=S256")
+	require.NotContains(t, authURL, "verifier")
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	stderrors "errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/identity_mock.go -package=mocks github.com/decagonhq/meddle-api/services IdentityService
+
+// IdentityService signs users in with the accounts of identity providers
+// they linked, and links and unlinks them
+type IdentityService interface {
+	SignIn(identity *models.ExternalIdentity, client models.SessionClient) (*models.LoginResponse, *errors.Error)
+	LinkIdentity(userID uint, identity *models.ExternalIdentity) (*models.UserIdentityResponse, *errors.Error)
+	GetIdentities(userID uint) ([]models.UserIdentityResponse, *errors.Error)
+	UnlinkIdentity(user *models.User, provider string) *errors.Error
+}
+
+type identityService struct {
+	Config       *config.Config
+	identityRepo db.IdentityRepository
+	authRepo     db.AuthRepository
+	sessions     SessionService
+}
+
+func NewIdentityService(identityRepo db.IdentityRepository, authRepo db.AuthRepository, sessions SessionService, conf *config.Config) IdentityService {
+	return &identityService{
+		Config:       conf,
+		identityRepo: identityRepo,
+		authRepo:     authRepo,
+		sessions:     sessions,
+	}
+}
+
+// SignIn signs in the user who linked the identity. An identity that isn't
+// linked yet is linked to the user of its email, or signs up a new user, when
+// the provider vouches for the email. Signing in goes through the same checks
+// as with a password, including the second factor
+func (i *identityService) SignIn(identity *models.ExternalIdentity, client models.SessionClient) (*models.LoginResponse, *errors.Error) {
+	linked, err := i.identityRepo.FindIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		return completeLogin(linked.User, client, i.sessions, i.Config)
+	}
+	if !stderrors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("error finding identity: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+
+	if identity.Email == "" {
+		return nil, errors.New(fmt.Sprintf("your %s account has no email address", identity.Provider), http.StatusUnauthorized)
+	}
+	// anyone can put an address they don't own on some accounts, signing in
+	// with one would take over the user of the address
+	if !identity.EmailVerified {
+		return nil, errors.New(fmt.Sprintf("%s doesn't vouch for your email address, sign in another way and link your %s account from your profile", identity.Provider, identity.Provider), http.StatusUnauthorized)
+	}
+
+	user, err := i.authRepo.FindUserByEmail(identity.Email)
+	if err != nil && !stderrors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("error finding user: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	if user == nil {
+		user = &models.User{
+			Name:          identity.Name,
+			Email:         identity.Email,
+			IsEmailActive: true,
+		}
+		if user.Name == "" {
+			user.Name = identity.Email
+		}
+		if err := i.identityRepo.CreateUserWithIdentity(user, newUserIdentity(identity)); err != nil {
+			log.Printf("error signing up user with %s: %v", identity.Provider, err)
+			return nil, errors.ErrInternalServerError
+		}
+		return completeLogin(user, client, i.sessions, i.Config)
+	}
+
+	// whoever signed up with an address they don't own would keep the
+	// password they set on the account of its owner
+	if !user.IsEmailActive {
+		return nil, errors.New(fmt.Sprintf("an account with this email is waiting for verification, verify it and sign in with your password to link your %s account", identity.Provider), http.StatusConflict)
+	}
+	if _, err := i.linkIdentity(user.ID, identity); err != nil {
+		return nil, err
+	}
+	return completeLogin(user, client, i.sessions, i.Config)
+}
+
+// LinkIdentity links the identity to the user, who proved they own it by
+// signing in with the provider
+func (i *identityService) LinkIdentity(userID uint, identity *models.ExternalIdentity) (*models.UserIdentityResponse, *errors.Error) {
+	linked, err := i.identityRepo.FindIdentity(identity.Provider, identity.Subject)
+	if err == nil {
+		if linked.UserID != userID {
+			return nil, errors.New(fmt.Sprintf("this %s account is linked to another user", identity.Provider), http.StatusConflict)
+		}
+		response := linked.ToResponse()
+		return &response, nil
+	}
+	if !stderrors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("error finding identity: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	userIdentity, errr := i.linkIdentity(userID, identity)
+	if errr != nil {
+		return nil, errr
+	}
+	response := userIdentity.ToResponse()
+	return &response, nil
+}
+
+// linkIdentity links an identity no user has to the user
+func (i *identityService) linkIdentity(userID uint, identity *models.ExternalIdentity) (*models.UserIdentity, *errors.Error) {
+	identities, err := i.identityRepo.GetIdentities(userID)
+	if err != nil {
+		log.Printf("error getting identities of user %v: %v", userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	for _, linked := range identities {
+		if linked.Provider == identity.Provider {
+			return nil, errors.New(fmt.Sprintf("your account is linked to another %s account, unlink it first", identity.Provider), http.StatusConflict)
+		}
+	}
+	userIdentity := newUserIdentity(identity)
+	userIdentity.UserID = userID
+	if err := i.identityRepo.CreateIdentity(userIdentity); err != nil {
+		log.Printf("error linking %s identity to user %v: %v", identity.Provider, userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return userIdentity, nil
+}
+
+func (i *identityService) GetIdentities(userID uint) ([]models.UserIdentityResponse, *errors.Error) {
+	identities, err := i.identityRepo.GetIdentities(userID)
+	if err != nil {
+		log.Printf("error getting identities of user %v: %v", userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return models.UserIdentitiesToResponse(identities), nil
+}
+
+// UnlinkIdentity unlinks the identity of the provider from the user, unless
+// the user couldn't sign in anymore
+func (i *identityService) UnlinkIdentity(user *models.User, provider string) *errors.Error {
+	identities, err := i.identityRepo.GetIdentities(user.ID)
+	if err != nil {
+		log.Printf("error getting identities of user %v: %v", user.ID, err)
+		return errors.ErrInternalServerError
+	}
+	linked := false
+	for _, identity := range identities {
+		linked = linked || identity.Provider == provider
+	}
+	if !linked {
+		return errors.ErrNotFound
+	}
+	if user.HashedPassword == "" && len(identities) == 1 {
+		return errors.New("set a password before unlinking the only account you sign in with", http.StatusBadRequest)
+	}
+	err = i.identityRepo.DeleteIdentity(provider, user.ID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error unlinking %s identity of user %v: %v", provider, user.ID, err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+func newUserIdentity(identity *models.ExternalIdentity) *models.UserIdentity {
+	return &models.UserIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var mockIdentityRepository *mocks.MockIdentityRepository
+var testIdentityService IdentityService
+
+func Test_IdentitySignIn(t *testing.T) {
+	tokens := &models.TokenPair{AccessToken: "access", RefreshToken: "refresh"}
+	verified := &models.ExternalIdentity{Provider: "google", Subject: "1", Email: "ken@gmail.com", EmailVerified: true, Name: "Ken"}
+	testCases := []struct {
+		name          string
+		identity      *models.ExternalIdentity
+		buildStubs    func()
+		wantStatus    int
+		wantChallenge bool
+	}{
+		{
+			name:     "linked identity",
+			identity: &models.ExternalIdentity{Provider: "google", Subject: "1", Email: "old@gmail.com"},
+			buildStubs: func() {
+				user := &models.User{Model: models.Model{ID: 7}, Email: "ken@gmail.com"}
+				mockIdentityRepository.EXPECT().FindIdentity("google", "1").Return(&models.UserIdentity{UserID: 7, User: user}, nil)
+				mockRepository.EXPECT().FindUserByEmail(gomock.Any()).Times(0)
+				mockSessionService.EXPECT().StartSession(user, gomock.Any()).Return(tokens, nil)
+			},
+		},
+		{
+			name:     "linked user with two-factor authentication",
+			identity: &models.ExternalIdentity{Provider: "google", Subject: "1"},
+			buildStubs: func() {
+				user := &models.User{Model: models.Model{ID: 7}, Email: "ken@gmail.com", TwoFactor: models.TwoFactor{Enabled: true}}
+				mockIdentityRepository.EXPECT().FindIdentity("google", "1").Return(&models.UserIdentity{UserID: 7, User: user}, nil)
+				mockSessionService.EXPECT().StartSession(gomock.Any(), gomock.Any()).Times(0)
+			},
+			wantChallenge: true,
+		},
+		{
+			name:     "linked user who must reset their password",
+			identity: &models.ExternalIdentity{Provider: "google", Subject: "1"},
+			buildStubs: func() {
+				user := &models.User{Model: models.Model{ID: 7}, Email: "ken@gmail.com", PasswordResetRequired: true}
+				mockIdentityRepository.EXPECT().FindIdentity("google", "1").Return(&models.UserIdentity{UserID: 7, User: user}, nil)
+				mockSessionService.EXPECT().StartSession(gomock.Any(), gomock.Any()).Times(0)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:     "linked user deactivated",
+			identity: &models.ExternalIdentity{Provider: "google", Subject: "1"},
+			buildStubs: func() {
+				user := &models.User{Model: models.Model{ID: 7}, Email: "ken@gmail.com", DeactivatedAt: 1}
+				mockIdentityRepository.EXPECT().FindIdentity("google", "1").Return(&models.UserIdentity{UserID: 7, User: user}, nil)
+				mockSessionService.EXPECT().StartSession(gomock.Any(), gomock.Any()).Times(0)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:     "links the verified user of the email",
+			identity: verified,
+			buildStubs: func() {
+				user := &models.User{Model: models.Model{ID: 7}, Email: "ken@gmail.com", IsEmailActive: true}
+				mockIdentityRepository.EXPECT().FindIdentity("google", "1").Return(nil, gorm.ErrRecordNotFound)
+				mockRepository.EXPECT().FindUserByEmail("ken@gmail.com").Return(user, nil)
+				mockIdentityRepository.EXPECT().GetIdentities(uint(7)).Return(nil, nil)
+				mockIdentityRepository.EXPECT().CreateIdentity(&models.UserIdentity{UserID: 7, Provider: "google", Subject: "1", Email: "ken@gmail.com"}).Return(nil)
+				mockSessionService.EXPECT().StartSession(user, gomock.Any()).Return(tokens, nil)
+			},
+		},
+		{
+			name:     "signs up a new user",
+			identity: verified,
+			buildStubs: func() {
+				mockIdentityRepository.EXPECT().FindIdentity("google", "1").Return(nil, gorm.ErrRecordNotFound)
+				mockRepository.EXPECT().FindUserByEmail("ken@gmail.com").Return(nil, gorm.ErrRecordNotFound)
+				mockIdentityRepository.EXPECT().CreateUserWithIdentity(gomock.Any(), gomock.Any()).DoAndReturn(func(user *models.User, identity *models.UserIdentity) error {
+					require.Equal(t, "Ken", user.Name)
+					require.True(t, user.IsEmailActive)
+					require.Empty(t, user.HashedPassword)
+					require.Equal(t, "1", identity.Subject)
+					return nil
+				})
+				mockSessionService.EXPECT().StartSession(gomock.Any(), gomock.Any()).Return(tokens, nil)
+			},
+		},
+		{
+			name:     "user of the email not verified",
+			identity: verified,
+			buildStubs: func() {
+				mockIdentityRepository.EXPECT().FindIdentity("google", "1").Return(nil, gorm.ErrRecordNotFound)
+				mockRepository.EXPECT().FindUserByEmail("ken@gmail.com").Return(&models.User{Email: "ken@gmail.com"}, nil)
+				mockIdentityRepository.EXPECT().CreateIdentity(gomock.Any()).Times(0)
+				mockSessionService.EXPECT().StartSession(gomock.Any(), gomock.Any()).Times(0)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:     "user of the email linked another account",
+			identity: verified,
+			buildStubs: func() {
+				mockIdentityRepository.EXPECT().FindIdentity("google", "1").Return(nil, gorm.ErrRecordNotFound)
+				mockRepository.EXPECT().FindUserByEmail("ken@gmail.com").Return(&models.User{Model: models.Model{ID: 7}, IsEmailActive: true}, nil)
+				mockIdentityRepository.EXPECT().GetIdentities(uint(7)).Return([]models.UserIdentity{{Provider: "google", Subject: "2"}}, nil)
+				mockIdentityRepository.EXPECT().CreateIdentity(gomock.Any()).Times(0)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:     "unverified email",
+			identity: &models.ExternalIdentity{Provider: "company", Subject: "1", Email: "ken@gmail.com"},
+			buildStubs: func() {
+				mockIdentityRepository.EXPECT().FindIdentity("company", "1").Return(nil, gorm.ErrRecordNotFound)
+				mockRepository.EXPECT().FindUserByEmail(gomock.Any()).Times(0)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:     "no email",
+			identity: &models.ExternalIdentity{Provider: "facebook", Subject: "1"},
+			buildStubs: func() {
+				mockIdentityRepository.EXPECT().FindIdentity("facebook", "1").Return(nil, gorm.ErrRecordNotFound)
+				mockRepository.EXPECT().FindUserByEmail(gomock.Any()).Times(0)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			teardown := setup(t)
+			defer teardown()
+			tc.buildStubs()
+
+			loginResponse, err := testIdentityService.SignIn(tc.identity, models.SessionClient{})
+			if tc.wantStatus != 0 {
+				require.NotNil(t, err)
+				require.Equal(t, tc.wantStatus, err.Status)
+				require.Nil(t, loginResponse)
+				return
+			}
+			require.Nil(t, err)
+			if tc.wantChallenge {
+				require.True(t, loginResponse.Challenge.TwoFactorRequired)
+				require.NotEmpty(t, loginResponse.Challenge.ChallengeToken)
+				require.Empty(t, loginResponse.AccessToken)
+				return
+			}
+			require.Nil(t, loginResponse.Challenge)
+			require.Equal(t, tokens.AccessToken, loginResponse.AccessToken)
+			require.Equal(t, tokens.RefreshToken, loginResponse.RefreshToken)
+		})
+	}
+}
+
+func Test_LinkIdentityService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	identity := &models.ExternalIdentity{Provider: "company", Subject: "1", Email: "ken@company.com"}
+
+	mockIdentityRepository.EXPECT().FindIdentity("company", "1").Return(nil, gorm.ErrRecordNotFound)
+	mockIdentityRepository.EXPECT().GetIdentities(uint(7)).Return([]models.UserIdentity{{Provider: "google"}}, nil)
+	mockIdentityRepository.EXPECT().CreateIdentity(&models.UserIdentity{UserID: 7, Provider: "company", Subject: "1", Email: "ken@company.com"}).Return(nil)
+	linked, err := testIdentityService.LinkIdentity(7, identity)
+	require.Nil(t, err)
+	require.Equal(t, "company", linked.Provider)
+
+	// linking it again changes nothing
+	mockIdentityRepository.EXPECT().FindIdentity("company", "1").Return(&models.UserIdentity{UserID: 7, Provider: "company"}, nil)
+	_, err = testIdentityService.LinkIdentity(7, identity)
+	require.Nil(t, err)
+
+	mockIdentityRepository.EXPECT().FindIdentity("company", "1").Return(&models.UserIdentity{UserID: 8, Provider: "company"}, nil)
+	_, err = testIdentityService.LinkIdentity(7, identity)
+	require.Equal(t, http.StatusConflict, err.Status)
+}
+
+func Test_UnlinkIdentityService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	withPassword := &models.User{Model: models.Model{ID: 7}, HashedPassword: "hash"}
+	withoutPassword := &models.User{Model: models.Model{ID: 8}}
+
+	mockIdentityRepository.EXPECT().GetIdentities(uint(7)).Return([]models.UserIdentity{{Provider: "google"}}, nil)
+	mockIdentityRepository.EXPECT().DeleteIdentity("google", uint(7)).Return(nil)
+	require.Nil(t, testIdentityService.UnlinkIdentity(withPassword, "google"))
+
+	mockIdentityRepository.EXPECT().GetIdentities(uint(7)).Return(nil, nil)
+	err := testIdentityService.UnlinkIdentity(withPassword, "google")
+	require.Equal(t, http.StatusNotFound, err.Status)
+
+	// the only way a user without a password signs in stays
+	mockIdentityRepository.EXPECT().GetIdentities(uint(8)).Return([]models.UserIdentity{{Provider: "google"}}, nil)
+	mockIdentityRepository.EXPECT().DeleteIdentity(gomock.Any(), gomock.Any()).Times(0)
+	err = testIdentityService.UnlinkIdentity(withoutPassword, "google")
+	require.Equal(t, http.StatusBadRequest, err.Status)
+
+	mockIdentityRepository.EXPECT().GetIdentities(uint(8)).Return([]models.UserIdentity{{Provider: "google"}, {Provider: "facebook"}}, nil)
+	mockIdentityRepository.EXPECT().DeleteIdentity("google", uint(8)).Return(nil)
+	require.Nil(t, testIdentityService.UnlinkIdentity(withoutPassword, "google"))
+}
@@ -0,0 +1,181 @@
+// Package interactions checks drugs against a dataset of known drug-drug
+// interactions and of drug classes, so that taking two drugs of the same class
+// is flagged as duplicate therapy
+package interactions
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/decagonhq/meddle-api/models"
+)
+
+//go:embed interactions.json
+var bundledDataset []byte
+
+type interaction struct {
+	Drugs       [2]string                  `json:"drugs"`
+	Severity    models.InteractionSeverity `json:"severity"`
+	Description string                     `json:"description"`
+}
+
+type datasetFile struct {
+	Synonyms     map[string]string   `json:"synonyms"`
+	Classes      map[string][]string `json:"classes"`
+	Interactions []interaction       `json:"interactions"`
+}
+
+// Dataset holds the interactions between drugs, indexed by normalized name
+type Dataset struct {
+	synonyms     map[string]string
+	classes      map[string]string
+	interactions map[[2]string]interaction
+	known        map[string]bool
+}
+
+var severityRank = map[models.InteractionSeverity]int{
+	models.SeverityMinor:           1,
+	models.SeverityModerate:        2,
+	models.SeverityMajor:           3,
+	models.SeverityContraindicated: 4,
+}
+
+// Bundled returns the dataset shipped with the api
+func Bundled() *Dataset {
+	dataset, err := Load(bytes.NewReader(bundledDataset))
+	if err != nil {
+		panic(fmt.Sprintf("bundled interaction dataset is invalid: %v", err))
+	}
+	return dataset
+}
+
+// LoadFile loads a dataset in the format of the bundled interactions.json
+func LoadFile(path string) (*Dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+func Load(r io.Reader) (*Dataset, error) {
+	var file datasetFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("could not decode interaction dataset: %v", err)
+	}
+	dataset := &Dataset{
+		synonyms:     map[string]string{},
+		classes:      map[string]string{},
+		interactions: map[[2]string]interaction{},
+		known:        map[string]bool{},
+	}
+	for synonym, name := range file.Synonyms {
+		dataset.synonyms[normalize(synonym)] = normalize(name)
+		dataset.known[normalize(name)] = true
+	}
+	for class, drugs := range file.Classes {
+		for _, drug := range drugs {
+			dataset.known[normalize(drug)] = true
+			dataset.classes[dataset.Normalize(drug)] = class
+		}
+	}
+	for i, entry := range file.Interactions {
+		if _, ok := severityRank[entry.Severity]; !ok {
+			return nil, fmt.Errorf("interaction %d: unknown severity %q", i+1, entry.Severity)
+		}
+		dataset.known[normalize(entry.Drugs[0])] = true
+		dataset.known[normalize(entry.Drugs[1])] = true
+		dataset.interactions[dataset.pairKey(entry.Drugs[0], entry.Drugs[1])] = entry
+	}
+	return dataset, nil
+}
+
+// Normalize returns the name the dataset knows a drug by. Strengths, salts and
+// forms written after the name ("Panadol 500mg tablets") are dropped
+func (d *Dataset) Normalize(name string) string {
+	name = normalize(name)
+	for words := strings.Fields(name); len(words) > 0; words = words[:len(words)-1] {
+		candidate := strings.Join(words, " ")
+		if generic, ok := d.synonyms[candidate]; ok {
+			return generic
+		}
+		if d.known[candidate] {
+			return candidate
+		}
+	}
+	return name
+}
+
+func (d *Dataset) pairKey(a, b string) [2]string {
+	a, b = d.Normalize(a), d.Normalize(b)
+	if b < a {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// Check returns the warnings between every pair of drugs and between each of
+// them and the drugs already taken, most severe first
+func (d *Dataset) Check(drugs []string, taken []string) []models.InteractionWarning {
+	var warnings []models.InteractionWarning
+	for i, drug := range drugs {
+		for _, other := range append(drugs[i+1:len(drugs):len(drugs)], taken...) {
+			if warning, ok := d.checkPair(drug, other); ok {
+				warnings = append(warnings, warning)
+			}
+		}
+	}
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return severityRank[warnings[i].Severity] > severityRank[warnings[j].Severity]
+	})
+	return warnings
+}
+
+func (d *Dataset) checkPair(a, b string) (models.InteractionWarning, bool) {
+	key := d.pairKey(a, b)
+	if entry, ok := d.interactions[key]; ok {
+		return models.InteractionWarning{
+			Kind:        models.InteractionKindInteraction,
+			Drugs:       []string{a, b},
+			Severity:    entry.Severity,
+			Description: entry.Description,
+		}, true
+	}
+	if key[0] == key[1] {
+		return models.InteractionWarning{
+			Kind:        models.InteractionKindDuplicateTherapy,
+			Drugs:       []string{a, b},
+			Severity:    models.SeverityModerate,
+			Description: fmt.Sprintf("%s and %s are the same drug.", a, b),
+		}, true
+	}
+	if class, ok := d.classes[key[0]]; ok && d.classes[key[1]] == class {
+		return models.InteractionWarning{
+			Kind:        models.InteractionKindDuplicateTherapy,
+			Drugs:       []string{a, b},
+			Severity:    models.SeverityModerate,
+			Description: fmt.Sprintf("%s and %s are both %ss, taking two of them adds up their side effects.", a, b, class),
+		}, true
+	}
+	return models.InteractionWarning{}, false
+}
+
+// normalize lowercases name, drops the words with digits in them (strengths)
+// and collapses the spaces
+func normalize(name string) string {
+	var words []string
+	for _, word := range strings.Fields(strings.ToLower(name)) {
+		if strings.IndexFunc(word, unicode.IsDigit) < 0 {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,89 @@
+package interactions
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Normalize(t *testing.T) {
+	dataset := Bundled()
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{name: "Panadol 500mg tablets", expected: "paracetamol"},
+		{name: "Ibuprofen", expected: "ibuprofen"},
+		{name: "  COUMADIN 5 mg", expected: "warfarin"},
+		{name: "Vitamin C", expected: "vitamin c"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, dataset.Normalize(tc.name))
+		})
+	}
+}
+
+func Test_Check(t *testing.T) {
+	dataset := Bundled()
+	testCases := []struct {
+		name     string
+		drugs    []string
+		taken    []string
+		expected []models.InteractionWarning
+	}{
+		{
+			name:  "known interaction",
+			drugs: []string{"Advil 200mg"},
+			taken: []string{"warfarin"},
+			expected: []models.InteractionWarning{{
+				Kind:     models.InteractionKindInteraction,
+				Drugs:    []string{"Advil 200mg", "warfarin"},
+				Severity: models.SeverityMajor,
+			}},
+		},
+		{
+			name:  "duplicate therapy in the same class",
+			drugs: []string{"ibuprofen", "naproxen"},
+			expected: []models.InteractionWarning{{
+				Kind:     models.InteractionKindDuplicateTherapy,
+				Drugs:    []string{"ibuprofen", "naproxen"},
+				Severity: models.SeverityModerate,
+			}},
+		},
+		{
+			name:  "same drug under a brand name",
+			drugs: []string{"Nurofen"},
+			taken: []string{"ibuprofen 400mg"},
+			expected: []models.InteractionWarning{{
+				Kind:     models.InteractionKindDuplicateTherapy,
+				Drugs:    []string{"Nurofen", "ibuprofen 400mg"},
+				Severity: models.SeverityModerate,
+			}},
+		},
+		{
+			name:  "no interaction",
+			drugs: []string{"paracetamol", "vitamin c"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			warnings := dataset.Check(tc.drugs, tc.taken)
+			require.Len(t, warnings, len(tc.expected))
+			for i := range warnings {
+				require.NotEmpty(t, warnings[i].Description)
+				warnings[i].Description = ""
+			}
+			if len(tc.expected) > 0 {
+				require.Equal(t, tc.expected, warnings)
+			}
+		})
+	}
+}
+
+func Test_LoadRejectsUnknownSeverity(t *testing.T) {
+	_, err := Load(strings.NewReader(`{"interactions": [{"drugs": ["a", "b"], "severity": "bad", "description": "x"}]}`))
+	require.Error(t, err)
+}
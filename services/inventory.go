@@ -0,0 +1,46 @@
+package services
+
+import (
+	"time"
+
+	"github.com/decagonhq/meddle-api/models"
+)
+
+// maxProjectedDoses bounds the number of doses walked when projecting stock
+const maxProjectedDoses = 2000
+
+// defaultRefillReminderDays is used when the reminder lead time isn't configured
+const defaultRefillReminderDays = 3
+
+// ProjectedRunOutTime returns the time of the first dose the stock of the
+// medication doesn't cover. The boolean is false when the stock isn't
+// tracked, the medication has no fixed dose times or the stock lasts the course
+func ProjectedRunOutTime(medication *models.Medication) (time.Time, bool) {
+	if medication.StockQuantity == nil || medication.IsMedicationDone || medication.NextDosageTime.IsZero() {
+		return time.Time{}, false
+	}
+	stock := *medication.StockQuantity
+	next := medication.NextDosageTime
+	for i := 0; i < maxProjectedDoses; i++ {
+		if !next.Before(medication.MedicationStopDate) {
+			return time.Time{}, false
+		}
+		dose := medication.DoseAt(next).Amount
+		if stock < dose {
+			return next, true
+		}
+		stock -= dose
+		var ok bool
+		next, ok = MedicationNextDosageTimeAfter(medication, next)
+		if !ok {
+			return time.Time{}, false
+		}
+	}
+	return time.Time{}, false
+}
+
+// medicationToResponse converts the medication with its projected run out date
+func medicationToResponse(medication *models.Medication) *models.MedicationResponse {
+	medication.RunOutTime, _ = ProjectedRunOutTime(medication)
+	return medication.MedicationToResponse()
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func Test_ProjectedRunOutTime(t *testing.T) {
+	start := time.Date(2022, 8, 1, 8, 0, 0, 0, time.UTC)
+	stock := func(quantity float64) *float64 { return &quantity }
+	twiceDaily := models.DosageSchedule{Kind: models.ScheduleDaily, TimesOfDay: models.TimesOfDay{"08:00", "20:00"}}
+
+	testCases := []struct {
+		name       string
+		medication models.Medication
+		expected   time.Time
+		ok         bool
+	}{
+		{
+			name: "stock runs out before the end of the course",
+			medication: models.Medication{
+				Dose:     models.DoseQuantity{Amount: 2, Unit: models.DoseUnitTablet},
+				Schedule: twiceDaily,
+				// covers four doses, the fifth can't be taken
+				StockQuantity: stock(9),
+			},
+			expected: time.Date(2022, 8, 3, 8, 0, 0, 0, time.UTC),
+			ok:       true,
+		},
+		{
+			name: "stock lasts the course",
+			medication: models.Medication{
+				Dose:          models.DoseQuantity{Amount: 1, Unit: models.DoseUnitTablet},
+				Schedule:      twiceDaily,
+				StockQuantity: stock(20),
+			},
+			ok: false,
+		},
+		{
+			name: "stock isn't tracked",
+			medication: models.Medication{
+				Dosage:   1,
+				Schedule: twiceDaily,
+			},
+			ok: false,
+		},
+		{
+			name: "empty stock runs out at the next dose",
+			medication: models.Medication{
+				Dosage:        1,
+				Schedule:      twiceDaily,
+				StockQuantity: stock(0),
+			},
+			expected: start,
+			ok:       true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			medication := tc.medication
+			medication.MedicationStartTime = start
+			medication.NextDosageTime = start
+			medication.MedicationStopDate = start.AddDate(0, 0, 7)
+			runOut, ok := ProjectedRunOutTime(&medication)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.expected, runOut)
+		})
+	}
+}
+
+func Test_RecordRefillService(t *testing.T) {
+	setup(t)
+	quantity := 30.0
+	medication := &models.Medication{
+		SoftDeleteModel:     models.SoftDeleteModel{ID: 1},
+		Name:                "paracetamol",
+		Dosage:              1,
+		TimeInterval:        8,
+		Duration:            7,
+		MedicationStartDate: time.Now(),
+		MedicationStartTime: time.Now(),
+		MedicationStopDate:  time.Now().AddDate(0, 0, 7),
+		UserID:              1,
+		StockQuantity:       &quantity,
+	}
+
+	testCases := []struct {
+		name     string
+		dbError  error
+		response *models.MedicationResponse
+		err      *errors.Error
+	}{
+		{
+			name:     "refill recorded",
+			response: medication.MedicationToResponse(),
+		},
+		{
+			name:    "medication not found",
+			dbError: fmt.Errorf("could not record refill: %w", gorm.ErrRecordNotFound),
+			err:     errors.ErrNotFound,
+		},
+		{
+			name:    "database error",
+			dbError: fmt.Errorf("could not record refill"),
+			err:     errors.New("internal server error", http.StatusInternalServerError),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var recorded *models.Medication
+			if tc.dbError == nil {
+				recorded = medication
+			}
+			mockMedicationRepository.EXPECT().RecordRefill(gomock.Any(), gomock.Any()).Return(recorded, tc.dbError)
+			response, err := testMedicationService.RecordRefill(1, 1, 0, &models.RefillRequest{Quantity: 30})
+			require.Equal(t, tc.err, err)
+			require.Equal(t, tc.response, response)
+		})
+	}
+}
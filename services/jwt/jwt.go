@@ -10,8 +10,26 @@ import (
 	"github.com/golang-jwt/jwt"
 )
 
-const AccessTokenValidity = time.Hour * 24
-const RefreshTokenValidity = time.Hour * 24
+// AccessTokenValidity is how long the access token of a session lasts, the
+// client then trades its refresh token for a new one
+const AccessTokenValidity = time.Minute * 15
+
+// RefreshTokenValidity is how long a session lasts without being refreshed
+const RefreshTokenValidity = time.Hour * 24 * 30
+
+// SSOStateValidity is how long a user has to sign in with an identity provider
+const SSOStateValidity = time.Minute * 10
+
+// ChallengeTokenValidity is how long a user has to enter their two-factor code
+// after their password
+const ChallengeTokenValidity = time.Minute * 5
+
+// PurposeTwoFactor is the purpose of the challenge tokens of a two-factor login
+const PurposeTwoFactor = "two_factor"
+
+// PurposeSSO is the purpose of the tokens keeping the state of a sign in with
+// an identity provider
+const PurposeSSO = "sso"
 
 // verifyAccessToken verifies a token
 func verifyToken(tokenString string, secret string) (*jwt.Token, error) {
@@ -66,30 +84,76 @@ func ValidateAndGetClaims(tokenString string, secret string) (jwt.MapClaims, err
 	return claims, nil
 }
 
-// GenerateToken generates only an access token
-func GenerateToken(email string, secret string) (string, error) {
+// GenerateAccessToken generates the access token of the session sessionID
+func GenerateAccessToken(email string, sessionID uint, secret string) (string, error) {
 	if secret == "" {
 		return "", errors.New("", http.StatusInternalServerError)
 	}
-	// Generate claims
-	claims := GenerateClaims(email)
+	claims := jwt.MapClaims{
+		"email": email,
+		"sid":   sessionID,
+		"exp":   time.Now().Add(AccessTokenValidity).Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
 
-	// Create a new token object, specifying signing method and the claims
-	// you would like it to contain.
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// GetSessionID returns the session of the claims of an access token, false
+// for tokens that aren't access tokens
+func GetSessionID(claims jwt.MapClaims) (uint, bool) {
+	sessionID, ok := claims["sid"].(float64)
+	if !ok || sessionID <= 0 {
+		return 0, false
+	}
+	return uint(sessionID), true
+}
 
-	// Sign and get the complete encoded token as a string using the secret
-	tokenString, err := token.SignedString([]byte(secret))
-	if err != nil {
-		return "", err
+// GenerateChallengeToken generates the token of a login waiting for the
+// two-factor code of the user, it is no access token
+func GenerateChallengeToken(email string, secret string) (string, error) {
+	if secret == "" {
+		return "", errors.New("", http.StatusInternalServerError)
+	}
+	claims := jwt.MapClaims{
+		"email":   email,
+		"purpose": PurposeTwoFactor,
+		"exp":     time.Now().Add(ChallengeTokenValidity).Unix(),
 	}
-	return tokenString, nil
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
 }
 
-func GenerateClaims(email string) jwt.MapClaims {
-	accessClaims := jwt.MapClaims{
-		"email": email,
-		"exp":   time.Now().Add(AccessTokenValidity).Unix(),
+// GenerateSSOStateToken generates the token keeping, until the callback, the
+// state, nonce and PKCE verifier of a sign in with provider. The sign in links
+// the provider to the user userID, when it isn't 0
+func GenerateSSOStateToken(provider, state, nonce, verifier string, userID uint, secret string) (string, error) {
+	if secret == "" {
+		return "", errors.New("", http.StatusInternalServerError)
+	}
+	claims := jwt.MapClaims{
+		"provider": provider,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"purpose":  PurposeSSO,
+		"exp":      time.Now().Add(SSOStateValidity).Unix(),
 	}
-	return accessClaims
+	if userID != 0 {
+		claims["link_user_id"] = userID
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// GetLinkUserID returns the user an SSO state token links the provider to, 0
+// for a sign in
+func GetLinkUserID(claims jwt.MapClaims) uint {
+	userID, _ := claims["link_user_id"].(float64)
+	if userID <= 0 {
+		return 0
+	}
+	return uint(userID)
+}
+
+// GetPurpose returns the purpose of a token, empty for access tokens
+func GetPurpose(claims jwt.MapClaims) string {
+	purpose, _ := claims["purpose"].(string)
+	return purpose
 }
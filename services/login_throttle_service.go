@@ -0,0 +1,144 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+)
+
+//go:generate mockgen -destination=../mocks/login_throttle_mock.go -package=mocks github.com/decagonhq/meddle-api/services LoginThrottleService
+
+// LoginThrottleService slows down and locks the logins of an account, and
+// from an address, that keep failing
+type LoginThrottleService interface {
+	CheckLogin(email, ip string) *errors.Error
+	LoginFailed(email, ip string, user *models.User)
+	LoginSucceeded(email string)
+}
+
+type loginThrottleService struct {
+	Config       *config.Config
+	throttleRepo db.LoginThrottleRepository
+	mail         Mailer
+}
+
+func NewLoginThrottleService(throttleRepo db.LoginThrottleRepository, conf *config.Config, mailer Mailer) LoginThrottleService {
+	return &loginThrottleService{
+		Config:       conf,
+		throttleRepo: throttleRepo,
+		mail:         mailer,
+	}
+}
+
+// CheckLogin tells to wait when the account or the address failed too many
+// logins lately
+func (l *loginThrottleService) CheckLogin(email, ip string) *errors.Error {
+	accountKey, ipKey := models.AccountThrottleKey(email), models.IPThrottleKey(ip)
+	throttles, err := l.throttleRepo.GetLoginThrottles([]string{accountKey, ipKey})
+	if err != nil {
+		log.Printf("error getting login throttles: %v", err)
+		return errors.ErrInternalServerError
+	}
+	var retryAt time.Time
+	for _, throttle := range throttles {
+		policy := l.accountPolicy()
+		if throttle.Key == ipKey {
+			policy = l.ipPolicy()
+		}
+		if at := throttle.RetryAt(policy); at.After(retryAt) {
+			retryAt = at
+		}
+	}
+	wait := retryAt.Unix() - time.Now().Unix()
+	if wait > 0 {
+		return errors.New(fmt.Sprintf("too many failed logins, try again in %v", time.Duration(wait)*time.Second), http.StatusTooManyRequests)
+	}
+	return nil
+}
+
+// LoginFailed counts a failed login of the account and from the address,
+// locking their logins when they reach the lockout and telling the user
+// when their account got locked. user is nil when no account has the email
+func (l *loginThrottleService) LoginFailed(email, ip string, user *models.User) {
+	if l.recordFailure(models.AccountThrottleKey(email), l.accountPolicy()) && user != nil {
+		l.sendLockoutEmail(user)
+	}
+	l.recordFailure(models.IPThrottleKey(ip), l.ipPolicy())
+}
+
+// LoginSucceeded forgets the failed logins of the account, those from the
+// address still count as it may be trying other accounts
+func (l *loginThrottleService) LoginSucceeded(email string) {
+	if err := l.throttleRepo.ResetLoginThrottle(models.AccountThrottleKey(email)); err != nil {
+		log.Printf("error resetting login throttle: %v", err)
+	}
+}
+
+// recordFailure counts a failed login for the key and reports whether it
+// locked the logins. Failures a lockout apart don't add up, so occasional
+// typos never lock anyone out
+func (l *loginThrottleService) recordFailure(key string, policy models.LoginThrottlePolicy) bool {
+	now := time.Now()
+	throttle, err := l.throttleRepo.RecordLoginFailure(key, now.Unix(), now.Add(-policy.Lockout).Unix())
+	if err != nil {
+		log.Printf("error recording login failure: %v", err)
+		return false
+	}
+	if !policy.ShouldLock(throttle.Failures) {
+		return false
+	}
+	if err := l.throttleRepo.LockLogins(key, now.Add(policy.Lockout).Unix()); err != nil {
+		log.Printf("error locking logins: %v", err)
+		return false
+	}
+	return true
+}
+
+func (l *loginThrottleService) sendLockoutEmail(user *models.User) {
+	minutes := int(l.accountPolicy().Lockout.Minutes())
+	value := map[string]interface{}{
+		"name":    user.Name,
+		"minutes": minutes,
+		"link":    fmt.Sprintf("%s/forgotpassword", l.Config.BaseUrl),
+	}
+	body := fmt.Sprintf("There were too many failed attempts to sign in to your account, so signing in is locked for %d minutes. If this wasn't you, reset your password.", minutes)
+	if err := l.mail.SendMail(user.Email, "Your account is temporarily locked", body, "accountlocked", value); err != nil {
+		log.Printf("error sending lockout email: %v", err)
+	}
+}
+
+func (l *loginThrottleService) accountPolicy() models.LoginThrottlePolicy {
+	policy := models.LoginThrottlePolicy{
+		FreeAttempts:    l.Config.LoginFreeAttempts,
+		LockoutAttempts: l.Config.LoginLockoutAttempts,
+		Lockout:         time.Duration(l.Config.LoginLockoutMinutes) * time.Minute,
+	}
+	if policy.FreeAttempts <= 0 {
+		policy.FreeAttempts = models.DefaultLoginFreeAttempts
+	}
+	if policy.LockoutAttempts <= 0 {
+		policy.LockoutAttempts = models.DefaultLoginLockoutAttempts
+	}
+	if policy.Lockout <= 0 {
+		policy.Lockout = models.DefaultLoginLockout
+	}
+	return policy
+}
+
+// ipPolicy lets an address fail more logins than an account before slowing
+// it down, as many users may share it
+func (l *loginThrottleService) ipPolicy() models.LoginThrottlePolicy {
+	policy := l.accountPolicy()
+	policy.LockoutAttempts = l.Config.IPLoginLockoutAttempts
+	if policy.LockoutAttempts <= 0 {
+		policy.LockoutAttempts = models.DefaultIPLoginLockoutAttempts
+	}
+	policy.FreeAttempts = policy.LockoutAttempts / 2
+	return policy
+}
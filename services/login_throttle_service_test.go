@@ -0,0 +1,138 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+var mockLoginThrottleRepository *mocks.MockLoginThrottleRepository
+var testLoginThrottleService LoginThrottleService
+
+func Test_CheckLoginService(t *testing.T) {
+	now := time.Now().Unix()
+	keys := []string{"account:ken@gmail.com", "ip:10.0.0.1"}
+
+	testCases := []struct {
+		name       string
+		throttles  []models.LoginThrottle
+		wantStatus int
+	}{
+		{
+			name: "no failed logins",
+		},
+		{
+			name:      "free attempts",
+			throttles: []models.LoginThrottle{{Key: keys[0], Failures: 3, LastFailedAt: now}},
+		},
+		{
+			name:       "waiting after too many failures",
+			throttles:  []models.LoginThrottle{{Key: keys[0], Failures: 4, LastFailedAt: now}},
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:      "waited long enough",
+			throttles: []models.LoginThrottle{{Key: keys[0], Failures: 4, LastFailedAt: now - 2}},
+		},
+		{
+			name:       "account locked",
+			throttles:  []models.LoginThrottle{{Key: keys[0], LockedUntil: now + 600}},
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:      "address failing within its free attempts",
+			throttles: []models.LoginThrottle{{Key: keys[1], Failures: 10, LastFailedAt: now}},
+		},
+		{
+			name:       "address locked",
+			throttles:  []models.LoginThrottle{{Key: keys[1], LockedUntil: now + 600}},
+			wantStatus: http.StatusTooManyRequests,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			teardown := setup(t)
+			defer teardown()
+			mockLoginThrottleRepository.EXPECT().GetLoginThrottles(keys).Return(tc.throttles, nil)
+
+			err := testLoginThrottleService.CheckLogin("Ken@gmail.com", "10.0.0.1")
+			if tc.wantStatus == 0 {
+				require.Nil(t, err)
+				return
+			}
+			require.Equal(t, tc.wantStatus, err.Status)
+		})
+	}
+}
+
+func Test_LoginFailedService(t *testing.T) {
+	user := &models.User{Model: models.Model{ID: 1}, Email: "ken@gmail.com", Name: "Ken"}
+
+	t.Run("counts the failure", func(t *testing.T) {
+		teardown := setup(t)
+		defer teardown()
+		mockLoginThrottleRepository.EXPECT().RecordLoginFailure("account:ken@gmail.com", gomock.Any(), gomock.Any()).Return(&models.LoginThrottle{Failures: 2}, nil)
+		mockLoginThrottleRepository.EXPECT().RecordLoginFailure("ip:10.0.0.1", gomock.Any(), gomock.Any()).Return(&models.LoginThrottle{Failures: 2}, nil)
+		mockLoginThrottleRepository.EXPECT().LockLogins(gomock.Any(), gomock.Any()).Times(0)
+		mockMailer.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		testLoginThrottleService.LoginFailed(user.Email, "10.0.0.1", user)
+	})
+
+	t.Run("locks the account and tells the user", func(t *testing.T) {
+		teardown := setup(t)
+		defer teardown()
+		mockLoginThrottleRepository.EXPECT().RecordLoginFailure("account:ken@gmail.com", gomock.Any(), gomock.Any()).Return(&models.LoginThrottle{Failures: 10}, nil)
+		mockLoginThrottleRepository.EXPECT().LockLogins("account:ken@gmail.com", gomock.Any()).DoAndReturn(func(key string, until int64) error {
+			require.InDelta(t, time.Now().Add(15*time.Minute).Unix(), until, 2)
+			return nil
+		})
+		mockLoginThrottleRepository.EXPECT().RecordLoginFailure("ip:10.0.0.1", gomock.Any(), gomock.Any()).Return(&models.LoginThrottle{Failures: 5}, nil)
+		mockMailer.EXPECT().SendMail(user.Email, gomock.Any(), gomock.Any(), "accountlocked", gomock.Any()).Return(nil)
+
+		testLoginThrottleService.LoginFailed(user.Email, "10.0.0.1", user)
+	})
+
+	t.Run("forgets failures older than the lockout", func(t *testing.T) {
+		teardown := setup(t)
+		defer teardown()
+		forgetBefore := time.Now().Add(-15 * time.Minute).Unix()
+		for _, key := range []string{"account:ken@gmail.com", "ip:10.0.0.1"} {
+			mockLoginThrottleRepository.EXPECT().RecordLoginFailure(key, gomock.Any(), gomock.Any()).DoAndReturn(func(key string, now, before int64) (*models.LoginThrottle, error) {
+				require.InDelta(t, forgetBefore, before, 2)
+				return &models.LoginThrottle{Failures: 1}, nil
+			})
+		}
+		mockLoginThrottleRepository.EXPECT().LockLogins(gomock.Any(), gomock.Any()).Times(0)
+
+		testLoginThrottleService.LoginFailed(user.Email, "10.0.0.1", user)
+	})
+
+	t.Run("locks an unknown email without an email", func(t *testing.T) {
+		teardown := setup(t)
+		defer teardown()
+		mockLoginThrottleRepository.EXPECT().RecordLoginFailure("account:nobody@gmail.com", gomock.Any(), gomock.Any()).Return(&models.LoginThrottle{Failures: 10}, nil)
+		mockLoginThrottleRepository.EXPECT().LockLogins("account:nobody@gmail.com", gomock.Any()).Return(nil)
+		mockLoginThrottleRepository.EXPECT().RecordLoginFailure("ip:10.0.0.1", gomock.Any(), gomock.Any()).Return(&models.LoginThrottle{Failures: 50}, nil)
+		mockLoginThrottleRepository.EXPECT().LockLogins("ip:10.0.0.1", gomock.Any()).Return(nil)
+		mockMailer.EXPECT().SendMail(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		testLoginThrottleService.LoginFailed("nobody@gmail.com", "10.0.0.1", nil)
+	})
+}
+
+func Test_LoginThrottleDelay(t *testing.T) {
+	policy := models.LoginThrottlePolicy{FreeAttempts: 3, LockoutAttempts: 10}
+	require.Equal(t, time.Duration(0), policy.Delay(3))
+	require.Equal(t, time.Second, policy.Delay(4))
+	require.Equal(t, 4*time.Second, policy.Delay(6))
+	require.Equal(t, time.Minute, policy.Delay(40))
+	require.False(t, policy.ShouldLock(9))
+	require.True(t, policy.ShouldLock(10))
+}
@@ -1,18 +1,26 @@
 package services
 
 import (
+	stderrors "errors"
+	"log"
+	"net/http"
+	"time"
+
 	"github.com/decagonhq/meddle-api/config"
 	"github.com/decagonhq/meddle-api/db"
 	"github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/models"
-	"log"
+	"gorm.io/gorm"
 )
 
 //go:generate mockgen -destination=../mocks/medication_history_mock.go -package=mocks github.com/decagonhq/meddle-api/services MedicationHistoryService
 
 type MedicationHistoryService interface {
-	UpdateMedicationHistory(hasMedicationBeenTaken bool, medicationHistoryID uint, userID uint) *errors.Error
-	GetAllMedicationHistoryByUser(userID uint) ([]models.MedicationHistoryResponse, *errors.Error)
+	UpdateMedicationHistory(request *models.UpdateMedicationHistoryRequest, medicationHistoryID uint, userID uint, profileID uint) (*models.MedicationHistoryResponse, *errors.Error)
+	GetAllMedicationHistoryByUser(userID uint, query *models.PageQuery) ([]models.MedicationHistoryResponse, *models.PageMeta, *errors.Error)
+	DeleteMedicationHistory(medicationHistoryID uint, userID uint, profileID uint) *errors.Error
+	RestoreMedicationHistory(medicationHistoryID uint, userID uint, profileID uint) *errors.Error
+	GetAdherence(userID uint, query *models.AdherenceQuery) (*models.AdherenceReport, *errors.Error)
 }
 
 // medicationHistoryService struct
@@ -29,32 +37,127 @@ func NewMedicationHistoryService(medicationHistoryRepo db.MedicationHistoryRepos
 	}
 }
 
-func (m *medicationHistoryService) UpdateMedicationHistory(hasMedicationBeenTaken bool, medicationHistoryID uint, userID uint) *errors.Error {
-	var wasMedicationMissed string
-	if hasMedicationBeenTaken == true {
-		wasMedicationMissed = "NO"
-	} else {
-		wasMedicationMissed = "YES"
+// UpdateMedicationHistory records that a dose was taken, on time or late,
+// skipped or missed
+func (m *medicationHistoryService) UpdateMedicationHistory(request *models.UpdateMedicationHistoryRequest, medicationHistoryID uint, userID uint, profileID uint) (*models.MedicationHistoryResponse, *errors.Error) {
+	medicationHistory, err := m.medicationHistoryRepo.GetMedicationHistory(medicationHistoryID, userID, profileID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error getting medication history: %v", err)
+		return nil, errors.ErrInternalServerError
 	}
-	err := m.medicationHistoryRepo.UpdateMedicationHistory(hasMedicationBeenTaken, wasMedicationMissed, medicationHistoryID, userID)
+	if err := medicationHistory.Record(request, time.Now()); err != nil {
+		return nil, errors.New(err.Error(), http.StatusBadRequest)
+	}
+	err = m.medicationHistoryRepo.UpdateMedicationHistory(medicationHistory)
 	if err != nil {
 		log.Printf("error updating medication history: %v", err)
-		return errors.ErrInternalServerError
+		return nil, errors.ErrInternalServerError
 	}
-	return nil
+	return medicationHistory.MedicationHistoryToResponse(), nil
 }
 
-func (m *medicationHistoryService) GetAllMedicationHistoryByUser(userID uint) ([]models.MedicationHistoryResponse, *errors.Error) {
+func (m *medicationHistoryService) GetAllMedicationHistoryByUser(userID uint, query *models.PageQuery) ([]models.MedicationHistoryResponse, *models.PageMeta, *errors.Error) {
 	var medicationHistoryResponses []models.MedicationHistoryResponse
 
-	medicationHistories, err := m.medicationHistoryRepo.GetAllMedicationHistoryByUserID(userID)
+	page, errr := query.ToPage(models.MedicationHistoryListSpec)
+	if errr != nil {
+		return nil, nil, errors.New(errr.Error(), http.StatusBadRequest)
+	}
+	medicationHistories, err := m.medicationHistoryRepo.GetAllMedicationHistoryByUserID(userID, page)
 	if err != nil {
 		log.Printf("error getting all medication history of user %v : %v", userID, err)
-		return nil, errors.ErrInternalServerError
+		return nil, nil, errors.ErrInternalServerError
 	}
 
+	rows := len(medicationHistories)
+	if rows > page.Limit {
+		medicationHistories = medicationHistories[:page.Limit]
+	}
 	for _, medicationHistory := range medicationHistories {
 		medicationHistoryResponses = append(medicationHistoryResponses, *medicationHistory.MedicationHistoryToResponse())
 	}
-	return medicationHistoryResponses, nil
+	if len(medicationHistories) == 0 {
+		return medicationHistoryResponses, page.Meta(rows, nil, 0), nil
+	}
+	last := &medicationHistories[len(medicationHistories)-1]
+	return medicationHistoryResponses, page.Meta(rows, last.SortValue(page.SortColumn), last.ID), nil
+}
+
+// DeleteMedicationHistory moves a medication history to the archive
+func (m *medicationHistoryService) DeleteMedicationHistory(medicationHistoryID uint, userID uint, profileID uint) *errors.Error {
+	err := m.medicationHistoryRepo.DeleteMedicationHistory(medicationHistoryID, userID, profileID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error deleting medication history: %v", err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+// RestoreMedicationHistory brings a medication history back from the archive
+func (m *medicationHistoryService) RestoreMedicationHistory(medicationHistoryID uint, userID uint, profileID uint) *errors.Error {
+	err := m.medicationHistoryRepo.RestoreMedicationHistory(medicationHistoryID, userID, profileID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error restoring medication history: %v", err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+// GetAdherence summarizes what happened to the doses of the user in the range
+// of the query
+func (m *medicationHistoryService) GetAdherence(userID uint, query *models.AdherenceQuery) (*models.AdherenceReport, *errors.Error) {
+	adherenceRange, errr := query.ToRange(time.Now())
+	if errr != nil {
+		return nil, errors.New(errr.Error(), http.StatusBadRequest)
+	}
+	overall, err := m.medicationHistoryRepo.GetAdherence(userID, adherenceRange)
+	if err != nil {
+		log.Printf("error getting adherence of user %v: %v", userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	medications, err := m.medicationHistoryRepo.GetAdherenceByMedication(userID, adherenceRange)
+	if err != nil {
+		log.Printf("error getting adherence of user %v: %v", userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	periods, err := m.medicationHistoryRepo.GetAdherenceByPeriod(userID, adherenceRange)
+	if err != nil {
+		log.Printf("error getting adherence of user %v: %v", userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	streaks, err := m.medicationHistoryRepo.GetAdherenceStreaks(userID, adherenceRange)
+	if err != nil {
+		log.Printf("error getting adherence of user %v: %v", userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	slots, err := m.medicationHistoryRepo.GetMostMissedTimeSlots(userID, adherenceRange, models.MostMissedTimeSlots)
+	if err != nil {
+		log.Printf("error getting adherence of user %v: %v", userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	if medications == nil {
+		medications = []models.MedicationAdherence{}
+	}
+	if slots == nil {
+		slots = []models.TimeSlotMisses{}
+	}
+	return &models.AdherenceReport{
+		From:                adherenceRange.From.UTC().Format(time.RFC3339),
+		To:                  adherenceRange.To.UTC().Format(time.RFC3339),
+		Period:              adherenceRange.Period,
+		Overall:             *overall,
+		Medications:         medications,
+		Periods:             models.PeriodsToResponse(periods),
+		Streaks:             *streaks,
+		MostMissedTimeSlots: slots,
+	}, nil
 }
@@ -4,8 +4,10 @@ import (
 	"github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/mocks"
 	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
+	"net/http"
 	"testing"
 	"time"
 )
@@ -14,46 +16,106 @@ var testMedicationHistoryService MedicationHistoryService
 
 func Test_UpdateMedicationHistoryService(t *testing.T) {
 	// arrange
+	taken := true
+	dueAt := time.Now().Add(-3 * time.Hour)
+	dose := func(graceEndsAt time.Time) *models.MedicationHistory {
+		return &models.MedicationHistory{
+			SoftDeleteModel: models.SoftDeleteModel{ID: 1},
+			MedicationName:  "paracetamol",
+			MedicationID:    1,
+			MedicationTime:  dueAt,
+			UserID:          1,
+			Status:          models.DosePending,
+			GraceEndsAt:     graceEndsAt,
+		}
+	}
 
 	testCases := []struct {
-		name                   string
-		reqInput               bool
-		dbInput                string
-		medicationID           uint
-		userID                 uint
-		dbError                error
-		updateMedResponseError *errors.Error
-		buildStubs             func(repository *mocks.MockMedicationHistoryRepository, dbInput string, medicationID uint, userID uint, dbError error)
+		name          string
+		request       *models.UpdateMedicationHistoryRequest
+		dbOutput      *models.MedicationHistory
+		getError      error
+		updateError   error
+		updateTimes   int
+		wantStatus    models.DoseStatus
+		wantTaken     bool
+		responseError *errors.Error
 	}{
 		{
-			name:                   "medication updates successfully case",
-			reqInput:               true,
-			dbInput:                "NO",
-			dbError:                nil,
-			updateMedResponseError: nil,
-			buildStubs: func(repository *mocks.MockMedicationHistoryRepository, dbInput string, medicationID uint, userID uint, dbError error) {
-				repository.EXPECT().UpdateMedicationHistory(true, dbInput, medicationID, userID).Times(1).Return(dbError)
-			},
+			name:        "taken within the grace window is on time",
+			request:     &models.UpdateMedicationHistoryRequest{Status: "taken", TakenAt: dueAt.Add(30 * time.Minute).Format(time.RFC3339)},
+			dbOutput:    dose(dueAt.Add(time.Hour)),
+			updateTimes: 1,
+			wantStatus:  models.DoseOnTime,
+			wantTaken:   true,
 		},
 		{
-			name:                   "error updating medication due server error",
-			reqInput:               true,
-			dbInput:                "NO",
-			dbError:                gorm.ErrInvalidDB,
-			updateMedResponseError: errors.ErrInternalServerError,
-			buildStubs: func(repository *mocks.MockMedicationHistoryRepository, dbInput string, medicationID uint, userID uint, dbError error) {
-				repository.EXPECT().UpdateMedicationHistory(true, dbInput, medicationID, userID).Times(1).Return(dbError)
-			},
+			name:        "taken after the grace window is late",
+			request:     &models.UpdateMedicationHistoryRequest{Status: "taken"},
+			dbOutput:    dose(dueAt.Add(time.Hour)),
+			updateTimes: 1,
+			wantStatus:  models.DoseLate,
+			wantTaken:   true,
+		},
+		{
+			name:        "legacy taken flag",
+			request:     &models.UpdateMedicationHistoryRequest{HasMedicationBeenTaken: &taken},
+			dbOutput:    dose(time.Now().Add(time.Hour)),
+			updateTimes: 1,
+			wantStatus:  models.DoseOnTime,
+			wantTaken:   true,
+		},
+		{
+			name:        "skipped dose",
+			request:     &models.UpdateMedicationHistoryRequest{Status: "skipped"},
+			dbOutput:    dose(dueAt.Add(time.Hour)),
+			updateTimes: 1,
+			wantStatus:  models.DoseSkipped,
+		},
+		{
+			name:          "taken_at on a skipped dose",
+			request:       &models.UpdateMedicationHistoryRequest{Status: "skipped", TakenAt: dueAt.Format(time.RFC3339)},
+			dbOutput:      dose(dueAt.Add(time.Hour)),
+			responseError: errors.New("taken_at is only for taken doses", http.StatusBadRequest),
+		},
+		{
+			name:          "taken_at in the future",
+			request:       &models.UpdateMedicationHistoryRequest{Status: "taken", TakenAt: time.Now().Add(time.Hour).Format(time.RFC3339)},
+			dbOutput:      dose(dueAt.Add(time.Hour)),
+			responseError: errors.New("taken_at is in the future", http.StatusBadRequest),
+		},
+		{
+			name:          "dose not found",
+			request:       &models.UpdateMedicationHistoryRequest{Status: "taken"},
+			getError:      gorm.ErrRecordNotFound,
+			responseError: errors.ErrNotFound,
+		},
+		{
+			name:          "error updating medication due server error",
+			request:       &models.UpdateMedicationHistoryRequest{Status: "taken"},
+			dbOutput:      dose(dueAt.Add(time.Hour)),
+			updateError:   gorm.ErrInvalidDB,
+			updateTimes:   1,
+			responseError: errors.ErrInternalServerError,
 		},
 	}
 	teardown := setup(t)
 	defer teardown()
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			tc.buildStubs(mockMedicationHistoryRepository, tc.dbInput, tc.medicationID, tc.userID, tc.dbError)
-			err := testMedicationHistoryService.UpdateMedicationHistory(tc.reqInput, tc.medicationID, tc.userID)
+			mockMedicationHistoryRepository.EXPECT().GetMedicationHistory(uint(1), uint(1), uint(0)).Times(1).Return(tc.dbOutput, tc.getError)
+			mockMedicationHistoryRepository.EXPECT().UpdateMedicationHistory(tc.dbOutput).Times(tc.updateTimes).Return(tc.updateError)
 
-			require.Equal(t, tc.updateMedResponseError, err)
+			response, err := testMedicationHistoryService.UpdateMedicationHistory(tc.request, 1, 1, 0)
+
+			require.Equal(t, tc.responseError, err)
+			if tc.responseError != nil {
+				require.Nil(t, response)
+				return
+			}
+			require.Equal(t, tc.wantStatus, response.Status)
+			require.Equal(t, tc.wantTaken, response.HasMedicationBeenTaken)
+			require.Equal(t, tc.wantTaken, response.TakenAt != "")
 		})
 	}
 }
@@ -70,7 +132,6 @@ func Test_GetAllMedicationHistoryByUserService(t *testing.T) {
 		MedicationDosage:       2,
 		UserID:                 1,
 		HasMedicationBeenTaken: false,
-		WasMedicationMissed:    "",
 	}
 	testCases := []struct {
 		name              string
@@ -91,11 +152,11 @@ func Test_GetAllMedicationHistoryByUserService(t *testing.T) {
 					MedicationDosage:       medicationHistory.MedicationDosage,
 					MedicationTime:         medicationHistory.MedicationTime,
 					HasMedicationBeenTaken: false,
-					WasMedicationMissed:    "",
+					Status:                 models.DosePending,
 					UserID:                 1,
 				},
 				{
-					Model: models.Model{
+					SoftDeleteModel: models.SoftDeleteModel{
 						ID: medicationHistory.ID + 1,
 					},
 					MedicationID:           medicationHistory.MedicationID,
@@ -103,7 +164,7 @@ func Test_GetAllMedicationHistoryByUserService(t *testing.T) {
 					MedicationDosage:       medicationHistory.MedicationDosage,
 					MedicationTime:         medicationHistory.MedicationTime,
 					HasMedicationBeenTaken: false,
-					WasMedicationMissed:    "",
+					Status:                 models.DosePending,
 					UserID:                 1,
 				},
 			},
@@ -117,7 +178,9 @@ func Test_GetAllMedicationHistoryByUserService(t *testing.T) {
 					MedicationName:         medicationHistory.MedicationName,
 					MedicationDosage:       medicationHistory.MedicationDosage,
 					MedicationTime:         medicationHistory.MedicationTime.UTC().String(),
+					Dose:                   models.DoseQuantity{Amount: float64(medicationHistory.MedicationDosage)},
 					HasMedicationBeenTaken: false,
+					Status:                 models.DosePending,
 					UserID:                 1,
 				},
 				{
@@ -128,13 +191,15 @@ func Test_GetAllMedicationHistoryByUserService(t *testing.T) {
 					MedicationName:         medicationHistory.MedicationName,
 					MedicationDosage:       medicationHistory.MedicationDosage,
 					MedicationTime:         medicationHistory.MedicationTime.UTC().String(),
+					Dose:                   models.DoseQuantity{Amount: float64(medicationHistory.MedicationDosage)},
 					HasMedicationBeenTaken: false,
+					Status:                 models.DosePending,
 					UserID:                 1,
 				},
 			},
 			getAllMedError: nil,
 			buildStubs: func(repository *mocks.MockMedicationHistoryRepository, dbInput uint, dbOutput []models.MedicationHistory, dbError error) {
-				repository.EXPECT().GetAllMedicationHistoryByUserID(dbInput).Times(1).Return(dbOutput, dbError)
+				repository.EXPECT().GetAllMedicationHistoryByUserID(dbInput, defaultPage(models.MedicationHistoryListSpec)).Times(1).Return(dbOutput, dbError)
 			},
 		},
 		{
@@ -145,7 +210,7 @@ func Test_GetAllMedicationHistoryByUserService(t *testing.T) {
 			getAllMedResponse: nil,
 			getAllMedError:    errors.ErrInternalServerError,
 			buildStubs: func(repository *mocks.MockMedicationHistoryRepository, dbInput uint, dbOutput []models.MedicationHistory, dbError error) {
-				repository.EXPECT().GetAllMedicationHistoryByUserID(dbInput).Times(1).Return(dbOutput, dbError)
+				repository.EXPECT().GetAllMedicationHistoryByUserID(dbInput, defaultPage(models.MedicationHistoryListSpec)).Times(1).Return(dbOutput, dbError)
 			},
 		},
 	}
@@ -154,7 +219,7 @@ func Test_GetAllMedicationHistoryByUserService(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.buildStubs(mockMedicationHistoryRepository, tc.dbInput, tc.dbOutput, tc.dbError)
-			medicationResponse, err := testMedicationHistoryService.GetAllMedicationHistoryByUser(1)
+			medicationResponse, _, err := testMedicationHistoryService.GetAllMedicationHistoryByUser(1, &models.PageQuery{})
 
 			require.Equal(t, tc.getAllMedResponse, medicationResponse)
 			require.Equal(t, tc.getAllMedError, err)
@@ -162,3 +227,77 @@ func Test_GetAllMedicationHistoryByUserService(t *testing.T) {
 	}
 
 }
+
+func Test_GetAdherenceService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	userID := uint(1)
+	overall := &models.AdherenceStats{Taken: 9, OnTime: 7, Late: 2, Missed: 1, Adherence: 90, AverageLatenessMinutes: 12.5}
+	medications := []models.MedicationAdherence{{MedicationID: 1, MedicationName: "paracetamol", AdherenceStats: *overall}}
+	periods := []models.PeriodAdherence{{Start: time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC), AdherenceStats: *overall}}
+	streaks := &models.AdherenceStreaks{Current: 2, Longest: 5}
+
+	t.Run("report of the range", func(t *testing.T) {
+		var got *models.AdherenceRange
+		mockMedicationHistoryRepository.EXPECT().GetAdherence(userID, gomock.Any()).DoAndReturn(func(userID uint, adherenceRange *models.AdherenceRange) (*models.AdherenceStats, error) {
+			got = adherenceRange
+			return overall, nil
+		})
+		mockMedicationHistoryRepository.EXPECT().GetAdherenceByMedication(userID, gomock.Any()).Return(medications, nil)
+		mockMedicationHistoryRepository.EXPECT().GetAdherenceByPeriod(userID, gomock.Any()).Return(periods, nil)
+		mockMedicationHistoryRepository.EXPECT().GetAdherenceStreaks(userID, gomock.Any()).Return(streaks, nil)
+		mockMedicationHistoryRepository.EXPECT().GetMostMissedTimeSlots(userID, gomock.Any(), models.MostMissedTimeSlots).Return(nil, nil)
+
+		report, err := testMedicationHistoryService.GetAdherence(userID, &models.AdherenceQuery{
+			From:   "2022-08-01T00:00:00Z",
+			To:     "2022-09-01T00:00:00Z",
+			Period: "week",
+		})
+		require.Nil(t, err)
+		require.Equal(t, &models.AdherenceRange{
+			From:   time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC),
+			To:     time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+			Period: "week",
+		}, got)
+		require.Equal(t, &models.AdherenceReport{
+			From:                "2022-08-01T00:00:00Z",
+			To:                  "2022-09-01T00:00:00Z",
+			Period:              "week",
+			Overall:             *overall,
+			Medications:         medications,
+			Periods:             []models.PeriodAdherenceResponse{{Start: "2022-08-01", AdherenceStats: *overall}},
+			Streaks:             *streaks,
+			MostMissedTimeSlots: []models.TimeSlotMisses{},
+		}, report)
+	})
+
+	t.Run("defaults to the last 30 days by day", func(t *testing.T) {
+		var got *models.AdherenceRange
+		mockMedicationHistoryRepository.EXPECT().GetAdherence(userID, gomock.Any()).DoAndReturn(func(userID uint, adherenceRange *models.AdherenceRange) (*models.AdherenceStats, error) {
+			got = adherenceRange
+			return nil, gorm.ErrInvalidDB
+		})
+
+		_, err := testMedicationHistoryService.GetAdherence(userID, &models.AdherenceQuery{})
+		require.Equal(t, errors.ErrInternalServerError, err)
+		require.Equal(t, "day", got.Period)
+		require.WithinDuration(t, time.Now(), got.To, time.Minute)
+		require.Equal(t, got.To.AddDate(0, 0, -models.DefaultAdherenceDays), got.From)
+	})
+
+	for _, tc := range []struct {
+		name  string
+		query models.AdherenceQuery
+		err   string
+	}{
+		{"invalid from", models.AdherenceQuery{From: "yesterday"}, "from must be an RFC3339 date"},
+		{"from after to", models.AdherenceQuery{From: "2022-09-01T00:00:00Z", To: "2022-08-01T00:00:00Z"}, "from must be before to"},
+		{"range too long", models.AdherenceQuery{From: "2020-01-01T00:00:00Z", To: "2022-01-01T00:00:00Z"}, "the range can't be longer than 366 days"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := testMedicationHistoryService.GetAdherence(userID, &tc.query)
+			require.Equal(t, errors.New(tc.err, http.StatusBadRequest), err)
+		})
+	}
+}
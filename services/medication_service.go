@@ -1,6 +1,7 @@
 package services
 
 import (
+	stderrors "errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,35 +11,69 @@ import (
 	"github.com/decagonhq/meddle-api/db"
 	"github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/interactions"
 	"github.com/go-co-op/gocron"
+	"gorm.io/gorm"
 )
 
 //go:generate mockgen -destination=../mocks/medication_mock.go -package=mocks github.com/decagonhq/meddle-api/services MedicationService
 
 type MedicationService interface {
 	CreateMedication(request *models.MedicationRequest) (*models.MedicationResponse, *errors.Error)
-	GetNextMedications(userID uint) ([]models.MedicationResponse, *errors.Error)
-	GetMedicationDetail(id uint, userId uint) (*models.MedicationResponse, *errors.Error)
-	GetAllMedications(userID uint) ([]models.MedicationResponse, *errors.Error)
+	GetNextMedications(userID uint, query *models.PageQuery) ([]models.MedicationResponse, *models.PageMeta, *errors.Error)
+	GetMedicationDetail(id uint, userId uint, profileID uint) (*models.MedicationResponse, *errors.Error)
+	GetAllMedications(userID uint, query *models.PageQuery) ([]models.MedicationResponse, *models.PageMeta, *errors.Error)
 	CronUpdateMedicationForNextTime() error
-	UpdateMedication(request *models.UpdateMedicationRequest, medicationID uint, userID uint) *errors.Error
-	FindMedication(medicationName string, by string, purpose string, duration int, dosage int) (*[]models.Medication, error)
+	UpdateMedication(request *models.UpdateMedicationRequest, medicationID uint, userID uint, profileID uint) (*models.MedicationResponse, *errors.Error)
+	SearchMedications(userID uint, query *models.MedicationSearchQuery) ([]models.MedicationResponse, *models.PageMeta, *errors.Error)
+	TakeAsNeededDose(medicationID uint, userID uint, profileID uint) (*models.MedicationHistoryResponse, *errors.Error)
+	RecordRefill(medicationID uint, userID uint, profileID uint, request *models.RefillRequest) (*models.MedicationResponse, *errors.Error)
+	PauseMedication(medicationID uint, userID uint, profileID uint) (*models.MedicationResponse, *errors.Error)
+	ResumeMedication(medicationID uint, userID uint, profileID uint, request *models.ResumeMedicationRequest) (*models.MedicationResponse, *errors.Error)
+	DiscontinueMedication(medicationID uint, userID uint, profileID uint, request *models.DiscontinueMedicationRequest) (*models.MedicationResponse, *errors.Error)
+	DeleteMedication(medicationID uint, userID uint, profileID uint) *errors.Error
+	RestoreMedication(medicationID uint, userID uint, profileID uint) (*models.MedicationResponse, *errors.Error)
+	GetArchivedMedications(userID uint, query *models.PageQuery) ([]models.MedicationResponse, *models.PageMeta, *errors.Error)
+	PurgeArchive() error
+	MarkMissedDoses() ([]models.MedicationHistory, error)
+	CheckInteractions(userID uint, request *models.InteractionCheckRequest) ([]models.InteractionWarning, *errors.Error)
 }
 
+// defaultArchiveRetentionDays is how long deleted medications are kept when
+// the retention window isn't configured
+const defaultArchiveRetentionDays = 30
+
 // medicationService struct
 type medicationService struct {
 	Config                *config.Config
 	medicationRepo        db.MedicationRepository
 	medicationHistoryRepo db.MedicationHistoryRepository
+	drugRepo              db.DrugRepository
+	interactions          *interactions.Dataset
 }
 
 // NewMedicationService instantiate an authService
-func NewMedicationService(medicationRepo db.MedicationRepository, medicationHistoryRepo db.MedicationHistoryRepository, conf *config.Config) MedicationService {
+func NewMedicationService(medicationRepo db.MedicationRepository, medicationHistoryRepo db.MedicationHistoryRepository, drugRepo db.DrugRepository, conf *config.Config) MedicationService {
 	return &medicationService{
 		Config:                conf,
 		medicationRepo:        medicationRepo,
 		medicationHistoryRepo: medicationHistoryRepo,
+		drugRepo:              drugRepo,
+		interactions:          loadInteractions(conf),
+	}
+}
+
+// loadInteractions loads the interaction dataset configured, falling back to
+// the bundled one
+func loadInteractions(conf *config.Config) *interactions.Dataset {
+	if conf.InteractionsFile != "" {
+		dataset, err := interactions.LoadFile(conf.InteractionsFile)
+		if err == nil {
+			return dataset
+		}
+		log.Printf("could not load interaction dataset %s, using the bundled one: %v", conf.InteractionsFile, err)
 	}
+	return interactions.Bundled()
 }
 
 func (m *medicationService) CreateMedication(request *models.MedicationRequest) (*models.MedicationResponse, *errors.Error) {
@@ -51,61 +86,92 @@ func (m *medicationService) CreateMedication(request *models.MedicationRequest)
 		return nil, errors.New("wrong time format", http.StatusBadRequest)
 	}
 
+	if err := validateSchedule(request.Schedule, request.TimeInterval); err != nil {
+		return nil, err
+	}
+	if len(request.Phases) == 0 {
+		if err := models.ValidateDose(request.Dosage, request.Dose, request.Strength, request.DosageForm); err != nil {
+			return nil, errors.New(err.Error(), http.StatusBadRequest)
+		}
+	}
+
 	medication := request.ReqToMedicationModel()
+	if err := m.applyCatalogDrug(medication); err != nil {
+		return nil, err
+	}
+	medication.Status = models.MedicationActive
 	medication.CreatedAt = time.Now().Unix()
 	medication.UpdatedAt = time.Now().Unix()
 	medication.MedicationStartDate = startDate
 	medication.MedicationStartTime = startTime
-	var nextTime time.Time
-	if medication.MedicationStartTime.Unix() > time.Now().Unix() {
-		nextTime = medication.MedicationStartTime
-	} else {
-		nextTime = medication.MedicationStartTime.Add(time.Hour * time.Duration(medication.TimeInterval))
+	phases, errr := models.ReqToMedicationPhases(request.Phases)
+	if errr != nil {
+		return nil, errors.New(errr.Error(), http.StatusBadRequest)
 	}
-
-	medication.MedicationStopDate = medication.MedicationStartTime.AddDate(0, 0, medication.Duration)
-	medication.NextDosageTime = GetNextDosageTime(nextTime, medication.MedicationStartTime)
+	if phases != nil {
+		medication.Phases = phases
+		medication.Duration = models.TotalPhaseDays(phases)
+		medication.Dosage = phases[0].Dosage
+		if !phases[0].Dose.IsZero() {
+			medication.Dose = phases[0].Dose
+		}
+	}
+	medication.MedicationStopDate = startTime.In(medication.Location()).AddDate(0, 0, medication.Duration)
+	medication.NextDosageTime, _ = MedicationFirstDosageTime(medication, time.Now())
 
 	response, err := m.medicationRepo.CreateMedication(medication)
 	if err != nil {
 		return nil, errors.ErrInternalServerError
 	}
-	return response.MedicationToResponse(), nil
+	medicationResponse := medicationToResponse(response)
+	medicationResponse.Warnings = m.interactionWarnings(response)
+	return medicationResponse, nil
 }
 
-func (m *medicationService) GetMedicationDetail(id uint, userId uint) (*models.MedicationResponse, *errors.Error) {
-	medic, err := m.medicationRepo.GetMedicationDetail(id, userId)
+func (m *medicationService) GetMedicationDetail(id uint, userId uint, profileID uint) (*models.MedicationResponse, *errors.Error) {
+	medic, err := m.medicationRepo.GetMedicationDetail(id, userId, profileID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.ErrNotFound
+	}
 	if err != nil {
 		return nil, errors.ErrInternalServerError
 	}
-	return medic.MedicationToResponse(), nil
+	return medicationToResponse(medic), nil
 }
 
-func (m *medicationService) GetAllMedications(userID uint) ([]models.MedicationResponse, *errors.Error) {
-	var medicationResponses []models.MedicationResponse
-
-	medications, err := m.medicationRepo.GetAllMedications(userID)
-	if err != nil {
-		return nil, errors.ErrInternalServerError
+func (m *medicationService) GetAllMedications(userID uint, query *models.PageQuery) ([]models.MedicationResponse, *models.PageMeta, *errors.Error) {
+	page, errr := query.ToPage(models.MedicationListSpec)
+	if errr != nil {
+		return nil, nil, errors.New(errr.Error(), http.StatusBadRequest)
 	}
-
-	for _, medication := range medications {
-		medicationResponses = append(medicationResponses, *medication.MedicationToResponse())
+	medications, err := m.medicationRepo.ListMedications(userID, page)
+	if err != nil {
+		return nil, nil, errors.ErrInternalServerError
 	}
-	return medicationResponses, nil
+	medicationResponses, meta := medicationsPage(medications, page, medicationToResponse)
+	return medicationResponses, meta, nil
 }
 
-func (m *medicationService) UpdateMedication(request *models.UpdateMedicationRequest, medicationID uint, userID uint) *errors.Error {
+func (m *medicationService) UpdateMedication(request *models.UpdateMedicationRequest, medicationID uint, userID uint, profileID uint) (*models.MedicationResponse, *errors.Error) {
 	startDate, err := time.Parse(time.RFC3339, request.MedicationStartDate)
 	if err != nil {
-		return errors.New("wrong date format", http.StatusBadRequest)
+		return nil, errors.New("wrong date format", http.StatusBadRequest)
 	}
 	startTime, err := time.Parse(time.RFC3339, request.MedicationStartTime)
 	if err != nil {
-		return errors.New("wrong time format", http.StatusBadRequest)
+		return nil, errors.New("wrong time format", http.StatusBadRequest)
+	}
+	if err := validateSchedule(request.Schedule, request.TimeInterval); err != nil {
+		return nil, err
+	}
+	if request.Dose != nil || request.Strength != nil || request.DosageForm != "" {
+		if err := models.ValidateDose(request.Dosage, request.Dose, request.Strength, request.DosageForm); err != nil {
+			return nil, errors.New(err.Error(), http.StatusBadRequest)
+		}
 	}
 	medication := models.Medication{
 		Name:                   request.Name,
+		DrugID:                 request.DrugID,
 		Dosage:                 request.Dosage,
 		TimeInterval:           request.TimeInterval,
 		Duration:               request.Duration,
@@ -115,33 +181,73 @@ func (m *medicationService) UpdateMedication(request *models.UpdateMedicationReq
 		MedicationStartDate:    startDate,
 		MedicationStartTime:    startTime,
 	}
+	if err := m.applyCatalogDrug(&medication); err != nil {
+		return nil, err
+	}
+	if request.Schedule != nil {
+		medication.Schedule = *request.Schedule
+	}
+	medication.SetDose(request.Dose, request.Strength, request.DosageForm)
+	phases, errr := models.ReqToMedicationPhases(request.Phases)
+	if errr != nil {
+		return nil, errors.New(errr.Error(), http.StatusBadRequest)
+	}
+	if phases != nil {
+		medication.Phases = phases
+		medication.Duration = models.TotalPhaseDays(phases)
+		medication.Dosage = phases[0].Dosage
+		if !phases[0].Dose.IsZero() {
+			medication.Dose = phases[0].Dose
+		}
+	}
 
-	nextTime := medication.MedicationStartTime.Add(time.Hour * time.Duration(medication.TimeInterval))
-	medication.MedicationStopDate = medication.MedicationStartTime.AddDate(0, 0, medication.Duration)
-
-	medication.NextDosageTime = GetNextDosageTime(nextTime, medication.MedicationStartTime)
+	medication.TimeZone = request.TimeZone
+	medication.MedicationStopDate = startTime.In(medication.Location()).AddDate(0, 0, medication.Duration)
+	medication.NextDosageTime, _ = MedicationFirstDosageTime(&medication, time.Now())
 
 	//get medication where user and medication id is defined above then send it for updating
-	err = m.medicationRepo.UpdateMedication(&medication, medicationID, userID)
+	err = m.medicationRepo.UpdateMedication(&medication, medicationID, userID, profileID)
 	if err != nil {
-		return errors.ErrInternalServerError
+		return nil, errors.ErrInternalServerError
 	}
-	return nil
+	updated, err := m.medicationRepo.GetMedicationDetail(medicationID, userID, profileID)
+	if err != nil {
+		return nil, errors.ErrNotFound
+	}
+	response := medicationToResponse(updated)
+	response.Warnings = m.interactionWarnings(updated)
+	return response, nil
 }
 
-func (m *medicationService) GetNextMedications(userID uint) ([]models.MedicationResponse, *errors.Error) {
-	var nextMedicationResponses []models.MedicationResponse
-
-	medications, err := m.medicationRepo.GetNextMedications(userID)
+func (m *medicationService) GetNextMedications(userID uint, query *models.PageQuery) ([]models.MedicationResponse, *models.PageMeta, *errors.Error) {
+	page, errr := query.ToPage(models.NextMedicationListSpec)
+	if errr != nil {
+		return nil, nil, errors.New(errr.Error(), http.StatusBadRequest)
+	}
+	medications, err := m.medicationRepo.GetNextMedications(userID, page)
 	if err != nil {
-		return nil, errors.ErrInternalServerError
+		return nil, nil, errors.ErrInternalServerError
 	}
+	nextMedicationResponses, meta := medicationsPage(medications, page, medicationToResponse)
+	return nextMedicationResponses, meta, nil
+}
 
-	for _, medication := range medications {
-		nextMedicationResponses = append(nextMedicationResponses, *medication.MedicationToResponse())
+// medicationsPage turns the rows fetched for a page into their responses and
+// the pagination metadata
+func medicationsPage(medications []models.Medication, page *models.Page, toResponse func(*models.Medication) *models.MedicationResponse) ([]models.MedicationResponse, *models.PageMeta) {
+	var medicationResponses []models.MedicationResponse
+	rows := len(medications)
+	if rows > page.Limit {
+		medications = medications[:page.Limit]
 	}
-	return nextMedicationResponses, nil
-
+	for i := range medications {
+		medicationResponses = append(medicationResponses, *toResponse(&medications[i]))
+	}
+	if len(medications) == 0 {
+		return medicationResponses, page.Meta(rows, nil, 0)
+	}
+	last := &medications[len(medications)-1]
+	return medicationResponses, page.Meta(rows, last.SortValue(page.SortColumn), last.ID)
 }
 
 func (m *medicationService) CronUpdateMedicationForNextTime() error {
@@ -150,16 +256,24 @@ func (m *medicationService) CronUpdateMedicationForNextTime() error {
 		return fmt.Errorf("could not get next medications while running update next dosage cron job")
 	}
 
+	// paused and discontinued medications have no doses due
+	active := medications[:0]
+	for _, medication := range medications {
+		if medication.EffectiveStatus() == models.MedicationActive {
+			active = append(active, medication)
+		}
+	}
+	medications = active
+
 	//create medication history for each medication
-	if medications != nil {
+	if len(medications) > 0 {
 		go m.CreateMedicationHistory(medications)
 	}
 
 	for _, medication := range medications {
-		timeSumation := medication.NextDosageTime.Add(time.Hour * time.Duration(medication.TimeInterval))
-		nextDosageTime := GetNextDosageTime(timeSumation, medication.NextDosageTime)
+		nextDosageTime, ok := MedicationNextDosageTimeAfter(&medication, medication.NextDosageTime)
 
-		if nextDosageTime.Unix() < medication.MedicationStopDate.Unix() {
+		if ok && nextDosageTime.Unix() < medication.MedicationStopDate.Unix() {
 			err = m.medicationRepo.UpdateNextMedicationTime(&medication, nextDosageTime)
 			if err != nil {
 				return fmt.Errorf("could not update next medication time while running update next dosage cron job")
@@ -174,7 +288,279 @@ func (m *medicationService) CronUpdateMedicationForNextTime() error {
 	return nil
 }
 
-func UpdateMedicationCronJob(medicationService MedicationService) {
+// validateSchedule checks the schedule of a medication request, a request
+// without a schedule must at least have a time interval
+func validateSchedule(schedule *models.DosageSchedule, timeInterval int) *errors.Error {
+	if schedule == nil {
+		if timeInterval <= 0 {
+			return errors.New("time_interval or schedule is required", http.StatusBadRequest)
+		}
+		return nil
+	}
+	if err := schedule.Validate(); err != nil {
+		return errors.New(err.Error(), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// TakeAsNeededDose records a dose of an as needed (PRN) medication, refusing
+// it once the maximum number of doses for the day has been taken
+func (m *medicationService) TakeAsNeededDose(medicationID uint, userID uint, profileID uint) (*models.MedicationHistoryResponse, *errors.Error) {
+	medication, err := m.medicationRepo.GetMedicationDetail(medicationID, userID, profileID)
+	if err != nil {
+		return nil, errors.ErrNotFound
+	}
+	if medication.EffectiveSchedule().Kind != models.ScheduleAsNeeded {
+		return nil, errors.New("medication is not taken as needed", http.StatusBadRequest)
+	}
+	if status := medication.EffectiveStatus(); status != models.MedicationActive {
+		return nil, errors.New(fmt.Sprintf("medication is %s", status), http.StatusConflict)
+	}
+
+	now := time.Now().In(medication.Location())
+	if maxDoses := medication.Schedule.MaxDosesPerDay; maxDoses > 0 {
+		dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		count, err := m.medicationHistoryRepo.CountMedicationHistoryBetween(medicationID, dayStart, dayStart.AddDate(0, 0, 1))
+		if err != nil {
+			log.Printf("error counting doses of medication %v: %v", medicationID, err)
+			return nil, errors.ErrInternalServerError
+		}
+		if count >= int64(maxDoses) {
+			return nil, errors.New(fmt.Sprintf("maximum of %d doses a day already taken", maxDoses), http.StatusUnprocessableEntity)
+		}
+	}
+
+	medication.NextDosageTime = now
+	medicationHistory := models.NewMedicationHistory(*medication, missedDoseGrace(m.Config))
+	medicationHistory.HasMedicationBeenTaken = true
+	medicationHistory.Status = models.DoseOnTime
+	medicationHistory.TakenAt = now
+	medicationHistory, err = m.medicationHistoryRepo.CreateMedicationHistory(medicationHistory)
+	if err != nil {
+		log.Printf("error recording dose of medication %v: %v", medicationID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return medicationHistory.MedicationHistoryToResponse(), nil
+}
+
+// RecordRefill adds a refill to the stock of a medication, starting to track
+// the stock of medications that didn't
+func (m *medicationService) RecordRefill(medicationID uint, userID uint, profileID uint, request *models.RefillRequest) (*models.MedicationResponse, *errors.Error) {
+	medication, err := m.medicationRepo.RecordRefill(&models.MedicationRefill{
+		Model:        models.Model{CreatedAt: time.Now().Unix(), UpdatedAt: time.Now().Unix()},
+		MedicationID: medicationID,
+		UserID:       userID,
+		Quantity:     request.Quantity,
+	}, profileID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error recording refill of medication %v: %v", medicationID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return medicationToResponse(medication), nil
+}
+
+// PauseMedication pauses an active medication, no doses are due until it is resumed
+func (m *medicationService) PauseMedication(medicationID uint, userID uint, profileID uint) (*models.MedicationResponse, *errors.Error) {
+	return m.transitionMedication(medicationID, userID, profileID, models.MedicationPaused, nil)
+}
+
+// ResumeMedication resumes a paused medication from its next dose after now,
+// extending the stop date by the time spent paused when asked to
+func (m *medicationService) ResumeMedication(medicationID uint, userID uint, profileID uint, request *models.ResumeMedicationRequest) (*models.MedicationResponse, *errors.Error) {
+	return m.transitionMedication(medicationID, userID, profileID, models.MedicationActive, func(medication *models.Medication) {
+		now := time.Now()
+		if request.ExtendStopDate && !medication.PausedAt.IsZero() {
+			medication.MedicationStopDate = medication.MedicationStopDate.Add(now.Sub(medication.PausedAt))
+		}
+		medication.PausedAt = time.Time{}
+		next, ok := MedicationFirstDosageTime(medication, now)
+		if ok && next.Before(medication.MedicationStopDate) {
+			medication.NextDosageTime = next
+			return
+		}
+		if medication.EffectiveSchedule().Kind != models.ScheduleAsNeeded {
+			medication.Status = models.MedicationCompleted
+			medication.IsMedicationDone = true
+		}
+	})
+}
+
+// DiscontinueMedication stops a medication for good, recording why
+func (m *medicationService) DiscontinueMedication(medicationID uint, userID uint, profileID uint, request *models.DiscontinueMedicationRequest) (*models.MedicationResponse, *errors.Error) {
+	return m.transitionMedication(medicationID, userID, profileID, models.MedicationDiscontinued, func(medication *models.Medication) {
+		medication.DiscontinuedReason = request.Reason
+	})
+}
+
+// transitionMedication moves the medication to status, letting apply, when
+// given, adjust it before it is saved
+func (m *medicationService) transitionMedication(medicationID, userID, profileID uint, status models.MedicationStatus, apply func(medication *models.Medication)) (*models.MedicationResponse, *errors.Error) {
+	medication, err := m.medicationRepo.GetMedicationDetail(medicationID, userID, profileID)
+	if err != nil {
+		return nil, errors.ErrNotFound
+	}
+	if err := medication.TransitionTo(status, time.Now()); err != nil {
+		return nil, errors.New(err.Error(), http.StatusConflict)
+	}
+	if apply != nil {
+		apply(medication)
+	}
+	if err := m.medicationRepo.UpdateMedicationStatus(medication); err != nil {
+		log.Printf("error updating status of medication %v: %v", medicationID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return medicationToResponse(medication), nil
+}
+
+// DeleteMedication moves a medication and its history to the archive
+func (m *medicationService) DeleteMedication(medicationID uint, userID uint, profileID uint) *errors.Error {
+	err := m.medicationRepo.DeleteMedication(medicationID, userID, profileID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error deleting medication %v: %v", medicationID, err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+// RestoreMedication brings a medication back from the archive
+func (m *medicationService) RestoreMedication(medicationID uint, userID uint, profileID uint) (*models.MedicationResponse, *errors.Error) {
+	medication, err := m.medicationRepo.RestoreMedication(medicationID, userID, profileID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error restoring medication %v: %v", medicationID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return medicationToResponse(medication), nil
+}
+
+func (m *medicationService) GetArchivedMedications(userID uint, query *models.PageQuery) ([]models.MedicationResponse, *models.PageMeta, *errors.Error) {
+	page, errr := query.ToPage(models.ArchivedMedicationListSpec)
+	if errr != nil {
+		return nil, nil, errors.New(errr.Error(), http.StatusBadRequest)
+	}
+	medications, err := m.medicationRepo.GetArchivedMedications(userID, page)
+	if err != nil {
+		log.Printf("error getting archived medications of user %v: %v", userID, err)
+		return nil, nil, errors.ErrInternalServerError
+	}
+	medicationResponses, meta := medicationsPage(medications, page, medicationToResponse)
+	return medicationResponses, meta, nil
+}
+
+// PurgeArchive permanently deletes the medications and history that have been
+// in the archive for longer than the retention window
+func (m *medicationService) PurgeArchive() error {
+	days := m.Config.ArchiveRetentionDays
+	if days <= 0 {
+		days = defaultArchiveRetentionDays
+	}
+	before := time.Now().AddDate(0, 0, -days)
+	medications, err := m.medicationRepo.PurgeDeletedMedications(before)
+	if err != nil {
+		return err
+	}
+	histories, err := m.medicationHistoryRepo.PurgeDeletedMedicationHistory(before)
+	if err != nil {
+		return err
+	}
+	log.Printf("purged %d medications and %d medication histories deleted before %v", medications, histories, before)
+	return nil
+}
+
+// MarkMissedDoses marks the doses that weren't taken by the end of their grace
+// window as missed and returns them
+func (m *medicationService) MarkMissedDoses() ([]models.MedicationHistory, error) {
+	missed, err := m.medicationHistoryRepo.MarkMissedDoses(time.Now(), missedDoseGrace(m.Config))
+	if err != nil {
+		return nil, err
+	}
+	if len(missed) > 0 {
+		log.Printf("marked %d doses as missed", len(missed))
+	}
+	return missed, nil
+}
+
+// missedDoseGrace returns the grace window of the medications that don't set
+// their own
+func missedDoseGrace(conf *config.Config) time.Duration {
+	if conf.MissedDoseGraceMinutes > 0 {
+		return time.Duration(conf.MissedDoseGraceMinutes) * time.Minute
+	}
+	return models.DefaultMissedDoseGrace
+}
+
+// applyCatalogDrug gives a medication referencing the drug catalog the name
+// and icon of its catalog entry
+func (m *medicationService) applyCatalogDrug(medication *models.Medication) *errors.Error {
+	if medication.DrugID == nil {
+		return nil
+	}
+	drug, err := m.drugRepo.GetDrug(*medication.DrugID)
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("drug not found in the catalog", http.StatusBadRequest)
+		}
+		log.Printf("error getting drug %v: %v", *medication.DrugID, err)
+		return errors.ErrInternalServerError
+	}
+	medication.Name = drug.DisplayName()
+	if drug.Icon != "" {
+		medication.MedicationIcon = drug.Icon
+	}
+	return nil
+}
+
+// CheckInteractions checks the drugs against each other and, when asked to,
+// against the active medications of the user or of the dependent selected
+func (m *medicationService) CheckInteractions(userID uint, request *models.InteractionCheckRequest) ([]models.InteractionWarning, *errors.Error) {
+	var taken []string
+	if request.IncludeCurrentMedications {
+		medications, err := m.medicationRepo.GetAllMedications(userID)
+		if err != nil {
+			log.Printf("error getting medications of user %v: %v", userID, err)
+			return nil, errors.ErrInternalServerError
+		}
+		taken = activeMedicationNames(medications, request.ProfileID, 0)
+	}
+	warnings := m.interactions.Check(request.Drugs, taken)
+	if warnings == nil {
+		warnings = []models.InteractionWarning{}
+	}
+	return warnings, nil
+}
+
+// interactionWarnings checks the medication against the other active
+// medications of the person it is for. Failing to check doesn't fail saving it
+func (m *medicationService) interactionWarnings(medication *models.Medication) []models.InteractionWarning {
+	medications, err := m.medicationRepo.GetAllMedications(medication.UserID)
+	if err != nil {
+		log.Printf("error checking interactions of medication %v: %v", medication.ID, err)
+		return nil
+	}
+	return m.interactions.Check([]string{medication.Name}, activeMedicationNames(medications, medication.ProfileID, medication.ID))
+}
+
+// activeMedicationNames returns the names of the active medications of the
+// dependent, or of the user with a profileID of 0
+func activeMedicationNames(medications []models.Medication, profileID uint, exceptID uint) []string {
+	var names []string
+	for i := range medications {
+		if medications[i].ID != exceptID && medications[i].ProfileID == profileID && medications[i].EffectiveStatus() == models.MedicationActive {
+			names = append(names, medications[i].Name)
+		}
+	}
+	return names
+}
+
+func UpdateMedicationCronJob(medicationService MedicationService, caregiverService CaregiverService) {
 	// _, presentMinute, _ := time.Now().UTC().Clock()
 	// if presentMinute%15 != 0 {
 	// 	time.Sleep(time.Duration(presentMinute+(presentMinute%15)) * time.Minute)
@@ -187,19 +573,37 @@ func UpdateMedicationCronJob(medicationService MedicationService) {
 			log.Printf("cron job error: %v", err)
 		}
 	})
+	s.Every(1).Day().At("03:00").Do(func() {
+		if err := medicationService.PurgeArchive(); err != nil {
+			log.Printf("purge archive cron job error: %v", err)
+		}
+	})
+	s.Every(5).Minutes().Do(func() {
+		missed, err := medicationService.MarkMissedDoses()
+		if err != nil {
+			log.Printf("missed doses cron job error: %v", err)
+			return
+		}
+		caregiverService.NotifyMissedDoses(missed)
+	})
 	s.StartBlocking()
 }
 
+// GetNextDosageTime returns t1 truncated to the minute when it falls on the
+// same day as the previous dose t2, or nine o'clock the day after t2. Days are
+// counted in the time zone of t2
 func GetNextDosageTime(t1, t2 time.Time) time.Time {
-	if t1.Day()-t2.Day() <= 0 {
-		return time.Date(t1.Year(), t1.Month(), t1.Day(), t1.Hour(), t1.Minute(), 0, 0, time.UTC)
+	loc := t2.Location()
+	t1 = t1.In(loc)
+	if daysBetween(t2, t1) <= 0 {
+		return time.Date(t1.Year(), t1.Month(), t1.Day(), t1.Hour(), t1.Minute(), 0, 0, loc)
 	}
-	return time.Date(t2.Year(), t2.Month(), t2.Day()+1, 9, 0, 0, 0, time.UTC)
+	return time.Date(t2.Year(), t2.Month(), t2.Day()+1, 9, 0, 0, 0, loc)
 }
 
 func (m *medicationService) CreateMedicationHistory(medications []models.Medication) {
 	for _, medication := range medications {
-		medicationHistory := models.NewMedicationHistory(medication)
+		medicationHistory := models.NewMedicationHistory(medication, missedDoseGrace(m.Config))
 		_, err := m.medicationHistoryRepo.CreateMedicationHistory(medicationHistory)
 		if err != nil {
 			log.Printf("error creating medication history for %v for %v : %v", medication.ID, medication.NextDosageTime, err)
@@ -207,14 +611,19 @@ func (m *medicationService) CreateMedicationHistory(medications []models.Medicat
 	}
 }
 
-func (m *medicationService) FindMedication(medicationName, by, purpose string, duration int, dosage int) (*[]models.Medication, error) {
-	var medicationResponses []models.MedicationResponse
-	medications, err := m.medicationRepo.FindMedication(medicationName, by, purpose, duration, dosage)
-	if err != nil {
-		return nil, errors.ErrInternalServerError
+// SearchMedications returns the page of the medications of the user matching
+// the query
+func (m *medicationService) SearchMedications(userID uint, query *models.MedicationSearchQuery) ([]models.MedicationResponse, *models.PageMeta, *errors.Error) {
+	filter, errr := query.ToFilter(userID)
+	if errr != nil {
+		return nil, nil, errors.New(errr.Error(), http.StatusBadRequest)
 	}
-	for _, medication := range *medications {
-		medicationResponses = append(medicationResponses, *medication.MedicationToResponse())
+	medications, total, err := m.medicationRepo.SearchMedications(filter)
+	if err != nil {
+		log.Printf("error searching medications of user %v: %v", userID, err)
+		return nil, nil, errors.ErrInternalServerError
 	}
-	return medications, nil
+	medicationResponses, meta := medicationsPage(medications, filter.Page, medicationToResponse)
+	meta.Total = &total
+	return medicationResponses, meta, nil
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/decagonhq/meddle-api/errors"
 	"github.com/decagonhq/meddle-api/mocks"
 	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
 	"log"
@@ -23,11 +24,10 @@ func Test_CreateMedicationService(t *testing.T) {
 	startTime, _ := time.Parse(time.RFC3339, "2013-10-21T13:28:06.419Z")
 
 	medication := &models.Medication{
-		Model: models.Model{
+		SoftDeleteModel: models.SoftDeleteModel{
 			ID:        0,
 			CreatedAt: time.Now().Unix(),
 			UpdatedAt: time.Now().Unix(),
-			DeletedAt: 0,
 		},
 		Name:                   "paracetamol",
 		Dosage:                 2,
@@ -39,6 +39,7 @@ func Test_CreateMedicationService(t *testing.T) {
 		MedicationStartTime:    startTime,
 		NextDosageTime:         time.Date(startTime.Add(time.Hour*time.Duration(8)).Year(), startTime.Add(time.Hour*time.Duration(8)).Month(), startTime.Add(time.Hour*time.Duration(8)).Day(), startTime.Add(time.Hour*time.Duration(8)).Hour(), startTime.Add(time.Hour*time.Duration(8)).Minute(), 0, 0, time.UTC),
 		PurposeOfMedication:    "malaria treatment",
+		Status:                 models.MedicationActive,
 	}
 	testCases := []struct {
 		name              string
@@ -90,10 +91,14 @@ func Test_CreateMedicationService(t *testing.T) {
 				MedicationStartTime:    medication.MedicationStartTime.String(),
 				NextDosageTime:         medication.NextDosageTime.String(),
 				PurposeOfMedication:    "malaria treatment",
+				Schedule:               models.DosageSchedule{Kind: models.ScheduleInterval, IntervalHours: 8},
+				Dose:                   models.DoseQuantity{Amount: 2},
+				Status:                 models.MedicationActive,
 			},
 			createMedError: nil,
 			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput *models.Medication, dbOutput *models.Medication, dbError error) {
 				repository.EXPECT().CreateMedication(dbInput).Times(1).Return(dbOutput, dbError)
+				repository.EXPECT().GetAllMedications(dbOutput.UserID).Times(1).Return([]models.Medication{}, nil)
 			},
 		},
 		{
@@ -209,7 +214,7 @@ func Test_GetAllMedicationsService(t *testing.T) {
 					UserID:                 1,
 				},
 				{
-					Model: models.Model{
+					SoftDeleteModel: models.SoftDeleteModel{
 						ID: medication.ID + 1,
 					},
 					Name:                   "flagyl",
@@ -242,6 +247,9 @@ func Test_GetAllMedicationsService(t *testing.T) {
 					NextDosageTime:         medication.NextDosageTime.String(),
 					PurposeOfMedication:    "malaria treatment",
 					UserID:                 1,
+					Schedule:               models.DosageSchedule{Kind: models.ScheduleInterval, IntervalHours: 8},
+					Dose:                   models.DoseQuantity{Amount: 2},
+					Status:                 models.MedicationActive,
 				},
 				{
 					ID:                     medication.ID + 1,
@@ -258,11 +266,14 @@ func Test_GetAllMedicationsService(t *testing.T) {
 					NextDosageTime:         medication.NextDosageTime.String(),
 					PurposeOfMedication:    "stomach pain",
 					UserID:                 1,
+					Schedule:               models.DosageSchedule{Kind: models.ScheduleInterval, IntervalHours: 8},
+					Dose:                   models.DoseQuantity{Amount: 1},
+					Status:                 models.MedicationActive,
 				},
 			},
 			getAllMedError: nil,
 			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput uint, dbOutput []models.Medication, dbError error) {
-				repository.EXPECT().GetAllMedications(dbInput).Times(1).Return(dbOutput, dbError)
+				repository.EXPECT().ListMedications(dbInput, defaultPage(models.MedicationListSpec)).Times(1).Return(dbOutput, dbError)
 			},
 		},
 		{
@@ -273,7 +284,7 @@ func Test_GetAllMedicationsService(t *testing.T) {
 			getAllMedResponse: nil,
 			getAllMedError:    errors.ErrInternalServerError,
 			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput uint, dbOutput []models.Medication, dbError error) {
-				repository.EXPECT().GetAllMedications(dbInput).Times(1).Return(dbOutput, dbError)
+				repository.EXPECT().ListMedications(dbInput, defaultPage(models.MedicationListSpec)).Times(1).Return(dbOutput, dbError)
 			},
 		},
 	}
@@ -282,10 +293,13 @@ func Test_GetAllMedicationsService(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.buildStubs(mockMedicationRepository, tc.dbInput, tc.dbOutput, tc.dbError)
-			medicationResponse, err := testMedicationService.GetAllMedications(1)
+			medicationResponse, meta, err := testMedicationService.GetAllMedications(1, &models.PageQuery{})
 
 			require.Equal(t, tc.getAllMedResponse, medicationResponse)
 			require.Equal(t, tc.getAllMedError, err)
+			if err == nil {
+				require.Equal(t, &models.PageMeta{Limit: models.DefaultPageLimit}, meta)
+			}
 		})
 	}
 
@@ -352,11 +366,14 @@ func Test_GetNextMedicationService(t *testing.T) {
 					NextDosageTime:         medication.NextDosageTime.String(),
 					PurposeOfMedication:    "malaria treatment",
 					UserID:                 1,
+					Schedule:               models.DosageSchedule{Kind: models.ScheduleInterval, IntervalHours: 8},
+					Dose:                   models.DoseQuantity{Amount: 2},
+					Status:                 models.MedicationActive,
 				},
 			},
 			getNextMedError: nil,
 			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput uint, dbOutput []models.Medication, dbError error) {
-				repository.EXPECT().GetNextMedications(dbInput).Times(1).Return(dbOutput, dbError)
+				repository.EXPECT().GetNextMedications(dbInput, defaultPage(models.NextMedicationListSpec)).Times(1).Return(dbOutput, dbError)
 			},
 		},
 		{
@@ -367,7 +384,7 @@ func Test_GetNextMedicationService(t *testing.T) {
 			getNextMedResponse: nil,
 			getNextMedError:    errors.ErrInternalServerError,
 			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput uint, dbOutput []models.Medication, dbError error) {
-				repository.EXPECT().GetNextMedications(dbInput).Times(1).Return(dbOutput, dbError)
+				repository.EXPECT().GetNextMedications(dbInput, defaultPage(models.NextMedicationListSpec)).Times(1).Return(dbOutput, dbError)
 			},
 		},
 	}
@@ -376,7 +393,7 @@ func Test_GetNextMedicationService(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.buildStubs(mockMedicationRepository, tc.dbInput, tc.dbOutput, tc.dbError)
-			medicationResponse, err := testMedicationService.GetNextMedications(1)
+			medicationResponse, _, err := testMedicationService.GetNextMedications(1, &models.PageQuery{})
 
 			require.Equal(t, tc.getNextMedResponse, medicationResponse)
 			require.Equal(t, tc.getNextMedError, err)
@@ -387,6 +404,8 @@ func Test_GetNextMedicationService(t *testing.T) {
 }
 
 func Test_CronUpdateMedicationForNextTime(t *testing.T) {
+	// the history of the doses is created in the background
+	historyCreated := make(chan struct{}, 1)
 	startDate := time.Now().UTC()
 	stopDate := startDate.AddDate(0, 0, 7)
 	startTime := startDate
@@ -432,7 +451,8 @@ func Test_CronUpdateMedicationForNextTime(t *testing.T) {
 			dbError: nil,
 			buildStubs: func(repository *mocks.MockMedicationRepository, medHistoryRepo *mocks.MockMedicationHistoryRepository, dbInput *models.Medication, timeInput time.Time, dbOutput []models.Medication, dbError error) {
 				repository.EXPECT().GetAllNextMedicationsToUpdate().Times(1).Return(dbOutput, dbError)
-				medHistoryRepo.EXPECT().CreateMedicationHistory(models.NewMedicationHistory(dbOutput[0]))
+				medHistoryRepo.EXPECT().CreateMedicationHistory(models.NewMedicationHistory(dbOutput[0], models.DefaultMissedDoseGrace)).
+					Do(func(*models.MedicationHistory) { historyCreated <- struct{}{} })
 				repository.EXPECT().UpdateNextMedicationTime(dbInput, timeInput).Times(1).Return(nil)
 			},
 			checkResponse: func(t *testing.T, cronJobError error) {
@@ -472,7 +492,8 @@ func Test_CronUpdateMedicationForNextTime(t *testing.T) {
 			dbError: nil,
 			buildStubs: func(repository *mocks.MockMedicationRepository, medHistoryRepo *mocks.MockMedicationHistoryRepository, dbInput *models.Medication, timeInput time.Time, dbOutput []models.Medication, dbError error) {
 				repository.EXPECT().GetAllNextMedicationsToUpdate().Times(1).Return(dbOutput, dbError)
-				medHistoryRepo.EXPECT().CreateMedicationHistory(models.NewMedicationHistory(dbOutput[0]))
+				medHistoryRepo.EXPECT().CreateMedicationHistory(models.NewMedicationHistory(dbOutput[0], models.DefaultMissedDoseGrace)).
+					Do(func(*models.MedicationHistory) { historyCreated <- struct{}{} })
 				repository.EXPECT().UpdateMedicationDone(dbInput).Times(1).Return(nil)
 			},
 			checkResponse: func(t *testing.T, cronJobError error) {
@@ -538,7 +559,8 @@ func Test_CronUpdateMedicationForNextTime(t *testing.T) {
 			dbError: nil,
 			buildStubs: func(repository *mocks.MockMedicationRepository, medHistoryRepo *mocks.MockMedicationHistoryRepository, dbInput *models.Medication, timeInput time.Time, dbOutput []models.Medication, dbError error) {
 				repository.EXPECT().GetAllNextMedicationsToUpdate().Times(1).Return(dbOutput, dbError)
-				medHistoryRepo.EXPECT().CreateMedicationHistory(models.NewMedicationHistory(dbOutput[0]))
+				medHistoryRepo.EXPECT().CreateMedicationHistory(models.NewMedicationHistory(dbOutput[0], models.DefaultMissedDoseGrace)).
+					Do(func(*models.MedicationHistory) { historyCreated <- struct{}{} })
 				repository.EXPECT().UpdateNextMedicationTime(dbInput, timeInput).Times(1).Return(fmt.Errorf("could not update medication: %v", gorm.ErrInvalidDB))
 			},
 			checkResponse: func(t *testing.T, cronJobError error) {
@@ -578,7 +600,8 @@ func Test_CronUpdateMedicationForNextTime(t *testing.T) {
 			dbError: nil,
 			buildStubs: func(repository *mocks.MockMedicationRepository, medHistoryRepo *mocks.MockMedicationHistoryRepository, dbInput *models.Medication, timeInput time.Time, dbOutput []models.Medication, dbError error) {
 				repository.EXPECT().GetAllNextMedicationsToUpdate().Times(1).Return(dbOutput, dbError)
-				medHistoryRepo.EXPECT().CreateMedicationHistory(models.NewMedicationHistory(dbOutput[0]))
+				medHistoryRepo.EXPECT().CreateMedicationHistory(models.NewMedicationHistory(dbOutput[0], models.DefaultMissedDoseGrace)).
+					Do(func(*models.MedicationHistory) { historyCreated <- struct{}{} })
 				repository.EXPECT().UpdateMedicationDone(dbInput).Times(1).Return(fmt.Errorf("could not update medication: %v", gorm.ErrInvalidDB))
 			},
 			checkResponse: func(t *testing.T, cronJobError error) {
@@ -596,6 +619,13 @@ func Test_CronUpdateMedicationForNextTime(t *testing.T) {
 			err := testMedicationService.CronUpdateMedicationForNextTime()
 
 			tc.checkResponse(t, err)
+			if tc.dbError == nil {
+				select {
+				case <-historyCreated:
+				case <-time.After(time.Second):
+					t.Fatal("the medication history wasn't created")
+				}
+			}
 
 		})
 	}
@@ -656,7 +686,9 @@ func Test_UpdateMedicationService(t *testing.T) {
 			dbError:                nil,
 			updateMedResponseError: nil,
 			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput *models.Medication, medicationID uint, userID uint, dbError error) {
-				repository.EXPECT().UpdateMedication(dbInput, medicationID, userID).Times(1).Return(dbError)
+				repository.EXPECT().UpdateMedication(dbInput, medicationID, userID, uint(0)).Times(1).Return(dbError)
+				repository.EXPECT().GetMedicationDetail(medicationID, userID, uint(0)).Times(1).Return(dbInput, nil)
+				repository.EXPECT().GetAllMedications(userID).Times(1).Return([]models.Medication{}, nil)
 			},
 		},
 		{
@@ -675,7 +707,7 @@ func Test_UpdateMedicationService(t *testing.T) {
 			dbError:                nil,
 			updateMedResponseError: errors.New("wrong time format", http.StatusBadRequest),
 			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput *models.Medication, medicationID uint, userID uint, dbError error) {
-				repository.EXPECT().UpdateMedication(dbInput, medicationID, userID).Times(0).Return(dbError)
+				repository.EXPECT().UpdateMedication(dbInput, medicationID, userID, uint(0)).Times(0).Return(dbError)
 			},
 		},
 		{
@@ -705,7 +737,7 @@ func Test_UpdateMedicationService(t *testing.T) {
 			dbError:                gorm.ErrInvalidDB,
 			updateMedResponseError: errors.ErrInternalServerError,
 			buildStubs: func(repository *mocks.MockMedicationRepository, dbInput *models.Medication, medicationID uint, userID uint, dbError error) {
-				repository.EXPECT().UpdateMedication(dbInput, medicationID, userID).Times(1).Return(dbError)
+				repository.EXPECT().UpdateMedication(dbInput, medicationID, userID, uint(0)).Times(1).Return(dbError)
 			},
 		},
 	}
@@ -714,9 +746,309 @@ func Test_UpdateMedicationService(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.buildStubs(mockMedicationRepository, tc.dbInput, tc.medicationID, tc.userID, tc.dbError)
-			err := testMedicationService.UpdateMedication(&tc.input, tc.medicationID, tc.userID)
+			medicationResponse, err := testMedicationService.UpdateMedication(&tc.input, tc.medicationID, tc.userID, 0)
 
 			require.Equal(t, tc.updateMedResponseError, err)
+			if err == nil {
+				require.Equal(t, tc.dbInput.Name, medicationResponse.Name)
+			}
+		})
+	}
+}
+
+func Test_MedicationLifecycleService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	newMedication := func(status models.MedicationStatus) *models.Medication {
+		start := time.Now().Add(-48 * time.Hour)
+		return &models.Medication{
+			SoftDeleteModel:     models.SoftDeleteModel{ID: 1},
+			Name:                "paracetamol",
+			Dosage:              1,
+			Schedule:            models.DosageSchedule{Kind: models.ScheduleDaily, TimesOfDay: models.TimesOfDay{"08:00"}},
+			MedicationStartTime: start,
+			MedicationStopDate:  start.AddDate(0, 0, 7),
+			PausedAt:            start.Add(24 * time.Hour),
+			UserID:              1,
+			Status:              status,
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		medication *models.Medication
+		transition func() (*models.MedicationResponse, *errors.Error)
+		status     models.MedicationStatus
+		err        *errors.Error
+		check      func(t *testing.T, before, after *models.Medication)
+	}{
+		{
+			name:       "pause an active medication",
+			medication: newMedication(models.MedicationActive),
+			transition: func() (*models.MedicationResponse, *errors.Error) {
+				return testMedicationService.PauseMedication(1, 1, 0)
+			},
+			status: models.MedicationPaused,
+		},
+		{
+			name:       "resume extending the stop date by the paused time",
+			medication: newMedication(models.MedicationPaused),
+			transition: func() (*models.MedicationResponse, *errors.Error) {
+				return testMedicationService.ResumeMedication(1, 1, 0, &models.ResumeMedicationRequest{ExtendStopDate: true})
+			},
+			status: models.MedicationActive,
+			check: func(t *testing.T, before, after *models.Medication) {
+				require.True(t, after.PausedAt.IsZero())
+				require.InDelta(t, 24*time.Hour, after.MedicationStopDate.Sub(before.MedicationStopDate), float64(time.Minute))
+				require.True(t, after.NextDosageTime.After(time.Now()))
+			},
+		},
+		{
+			name:       "discontinue a paused medication with a reason",
+			medication: newMedication(models.MedicationPaused),
+			transition: func() (*models.MedicationResponse, *errors.Error) {
+				return testMedicationService.DiscontinueMedication(1, 1, 0, &models.DiscontinueMedicationRequest{Reason: "side effects"})
+			},
+			status: models.MedicationDiscontinued,
+			check: func(t *testing.T, before, after *models.Medication) {
+				require.Equal(t, "side effects", after.DiscontinuedReason)
+				require.False(t, after.DiscontinuedAt.IsZero())
+			},
+		},
+		{
+			name:       "a discontinued medication can't be resumed",
+			medication: newMedication(models.MedicationDiscontinued),
+			transition: func() (*models.MedicationResponse, *errors.Error) {
+				return testMedicationService.ResumeMedication(1, 1, 0, &models.ResumeMedicationRequest{})
+			},
+			err: errors.New("a discontinued medication can't be active", http.StatusConflict),
+		},
+		{
+			name:       "a completed medication can't be paused",
+			medication: &models.Medication{SoftDeleteModel: models.SoftDeleteModel{ID: 1}, UserID: 1, IsMedicationDone: true},
+			transition: func() (*models.MedicationResponse, *errors.Error) {
+				return testMedicationService.PauseMedication(1, 1, 0)
+			},
+			err: errors.New("a completed medication can't be paused", http.StatusConflict),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			before := *tc.medication
+			mockMedicationRepository.EXPECT().GetMedicationDetail(uint(1), uint(1), uint(0)).Return(tc.medication, nil)
+			var saved *models.Medication
+			if tc.err == nil {
+				mockMedicationRepository.EXPECT().UpdateMedicationStatus(gomock.Any()).DoAndReturn(func(medication *models.Medication) error {
+					saved = medication
+					return nil
+				})
+			}
+			response, err := tc.transition()
+			require.Equal(t, tc.err, err)
+			if tc.err != nil {
+				require.Nil(t, response)
+				return
+			}
+			require.Equal(t, tc.status, saved.Status)
+			require.Equal(t, tc.status, response.Status)
+			if tc.check != nil {
+				tc.check(t, &before, saved)
+			}
+		})
+	}
+}
+
+func Test_GetMedicationDetailService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	medication := &models.Medication{SoftDeleteModel: models.SoftDeleteModel{ID: 1}, UserID: 1, ProfileID: 4, Name: "amoxicillin"}
+	mockMedicationRepository.EXPECT().GetMedicationDetail(uint(1), uint(1), uint(4)).Return(medication, nil)
+	response, err := testMedicationService.GetMedicationDetail(1, 1, 4)
+	require.Nil(t, err)
+	require.Equal(t, uint(4), response.ProfileID)
+
+	// a medication of another profile isn't found
+	mockMedicationRepository.EXPECT().GetMedicationDetail(uint(1), uint(1), uint(0)).
+		Return(nil, fmt.Errorf("could not get medication: %w", gorm.ErrRecordNotFound))
+	_, err = testMedicationService.GetMedicationDetail(1, 1, 0)
+	require.Equal(t, errors.ErrNotFound, err)
+}
+
+func Test_PurgeArchiveService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	var purgedBefore time.Time
+	mockMedicationRepository.EXPECT().PurgeDeletedMedications(gomock.Any()).DoAndReturn(func(before time.Time) (int64, error) {
+		purgedBefore = before
+		return 2, nil
+	})
+	mockMedicationHistoryRepository.EXPECT().PurgeDeletedMedicationHistory(gomock.Any()).Return(int64(5), nil)
+	require.NoError(t, testMedicationService.PurgeArchive())
+	require.WithinDuration(t, time.Now().AddDate(0, 0, -defaultArchiveRetentionDays), purgedBefore, time.Minute)
+
+	mockMedicationRepository.EXPECT().PurgeDeletedMedications(gomock.Any()).Return(int64(0), fmt.Errorf("could not purge deleted medications"))
+	require.Error(t, testMedicationService.PurgeArchive())
+}
+
+func Test_MarkMissedDosesService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	var markedAt time.Time
+	doses := []models.MedicationHistory{{MedicationID: 1, UserID: 1, Status: models.DoseMissed}}
+	mockMedicationHistoryRepository.EXPECT().MarkMissedDoses(gomock.Any(), models.DefaultMissedDoseGrace).DoAndReturn(func(now time.Time, defaultGrace time.Duration) ([]models.MedicationHistory, error) {
+		markedAt = now
+		return doses, nil
+	})
+	missed, err := testMedicationService.MarkMissedDoses()
+	require.NoError(t, err)
+	require.Equal(t, doses, missed)
+	require.WithinDuration(t, time.Now(), markedAt, time.Minute)
+
+	mockMedicationHistoryRepository.EXPECT().MarkMissedDoses(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("could not mark missed doses"))
+	_, err = testMedicationService.MarkMissedDoses()
+	require.Error(t, err)
+}
+
+func Test_CheckInteractionsService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	userID := uint(1)
+	current := []models.Medication{
+		{SoftDeleteModel: models.SoftDeleteModel{ID: 1}, Name: "Coumadin", Status: models.MedicationActive},
+		{SoftDeleteModel: models.SoftDeleteModel{ID: 2}, Name: "naproxen", Status: models.MedicationDiscontinued},
+	}
+
+	mockMedicationRepository.EXPECT().GetAllMedications(userID).Times(1).Return(current, nil)
+	warnings, err := testMedicationService.CheckInteractions(userID, &models.InteractionCheckRequest{
+		Drugs:                     []string{"aspirin"},
+		IncludeCurrentMedications: true,
+	})
+	require.Nil(t, err)
+	require.Len(t, warnings, 1)
+	require.Equal(t, []string{"aspirin", "Coumadin"}, warnings[0].Drugs)
+	require.Equal(t, models.SeverityMajor, warnings[0].Severity)
+
+	warnings, err = testMedicationService.CheckInteractions(userID, &models.InteractionCheckRequest{Drugs: []string{"aspirin"}})
+	require.Nil(t, err)
+	require.Empty(t, warnings)
+
+	// the medications of a dependent are checked on their own
+	mockMedicationRepository.EXPECT().GetAllMedications(userID).Times(1).Return(current, nil)
+	warnings, err = testMedicationService.CheckInteractions(userID, &models.InteractionCheckRequest{
+		Drugs:                     []string{"aspirin"},
+		IncludeCurrentMedications: true,
+		ProfileID:                 4,
+	})
+	require.Nil(t, err)
+	require.Empty(t, warnings)
+
+	mockMedicationRepository.EXPECT().GetAllMedications(userID).Times(1).Return(nil, gorm.ErrInvalidDB)
+	_, err = testMedicationService.CheckInteractions(userID, &models.InteractionCheckRequest{
+		Drugs:                     []string{"aspirin"},
+		IncludeCurrentMedications: true,
+	})
+	require.Equal(t, errors.ErrInternalServerError, err)
+}
+
+func Test_SearchMedicationsService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	userID := uint(4)
+	startFrom, _ := time.Parse(time.RFC3339, "2022-01-01T00:00:00Z")
+	testCases := []struct {
+		name      string
+		query     models.MedicationSearchQuery
+		filter    *models.MedicationFilter
+		dbError   error
+		searchErr *errors.Error
+	}{
+		{
+			name:  "defaults",
+			query: models.MedicationSearchQuery{},
+			filter: &models.MedicationFilter{
+				UserID: userID,
+				Page:   defaultPage(models.MedicationSearchListSpec),
+			},
+		},
+		{
+			name: "every filter",
+			query: models.MedicationSearchQuery{
+				PageQuery:              models.PageQuery{Status: "done", Sort: "name", Limit: 500},
+				Name:                   " Para ",
+				MedicationPrescribedBy: "tolu",
+				PurposeOfMedication:    "malaria",
+				Dosage:                 2,
+				Duration:               7,
+				StartFrom:              "2022-01-01T00:00:00Z",
+			},
+			filter: &models.MedicationFilter{
+				UserID:                 userID,
+				Name:                   "Para",
+				MedicationPrescribedBy: "tolu",
+				PurposeOfMedication:    "malaria",
+				Dosage:                 2,
+				Duration:               7,
+				StartFrom:              startFrom,
+				Page: &models.Page{
+					Limit:      models.MaxPageLimit,
+					SortColumn: "name",
+					SortKind:   models.SortString,
+					Status:     "done",
+				},
+			},
+		},
+		{
+			name:      "invalid date",
+			query:     models.MedicationSearchQuery{StopTo: "2022-01-01"},
+			searchErr: errors.New("stop_to must be an RFC3339 date", http.StatusBadRequest),
+		},
+		{
+			name:      "inverted range",
+			query:     models.MedicationSearchQuery{StartFrom: "2022-02-01T00:00:00Z", StartTo: "2022-01-01T00:00:00Z"},
+			searchErr: errors.New("start_to is before start_from", http.StatusBadRequest),
+		},
+		{
+			name:      "unknown sort",
+			query:     models.MedicationSearchQuery{PageQuery: models.PageQuery{Sort: "-user_id"}},
+			searchErr: errors.New("can't sort by user_id", http.StatusBadRequest),
+		},
+		{
+			name:      "date range of the list",
+			query:     models.MedicationSearchQuery{PageQuery: models.PageQuery{From: "2022-01-01T00:00:00Z"}},
+			searchErr: errors.New("this list can't be filtered by date", http.StatusBadRequest),
+		},
+		{
+			name:  "db error",
+			query: models.MedicationSearchQuery{},
+			filter: &models.MedicationFilter{
+				UserID: userID,
+				Page:   defaultPage(models.MedicationSearchListSpec),
+			},
+			dbError:   gorm.ErrInvalidDB,
+			searchErr: errors.ErrInternalServerError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			medication := models.Medication{SoftDeleteModel: models.SoftDeleteModel{ID: 1}, Name: "Paracetamol", UserID: userID}
+			if tc.filter != nil {
+				mockMedicationRepository.EXPECT().SearchMedications(tc.filter).Times(1).
+					Return([]models.Medication{medication}, int64(1), tc.dbError)
+			}
+			medications, meta, err := testMedicationService.SearchMedications(userID, &tc.query)
+			require.Equal(t, tc.searchErr, err)
+			if err == nil {
+				require.Len(t, medications, 1)
+				require.Equal(t, "Paracetamol", medications[0].Name)
+				total := int64(1)
+				require.Equal(t, &models.PageMeta{Limit: tc.filter.Page.Limit, Total: &total}, meta)
+			}
 		})
 	}
 }
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	stderrors "errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/one_time_token_mock.go -package=mocks github.com/decagonhq/meddle-api/services OneTimeTokenService
+
+// OneTimeTokenService issues the tokens of the links we email, which are
+// random, bound to a purpose, short lived and can be used once
+type OneTimeTokenService interface {
+	IssueToken(userID uint, purpose models.TokenPurpose, data string) (string, *errors.Error)
+	CheckToken(token string, purpose models.TokenPurpose) (*models.OneTimeToken, *errors.Error)
+	ConsumeToken(token string, purpose models.TokenPurpose) (*models.OneTimeToken, *errors.Error)
+}
+
+var errInvalidLink = errors.New("invalid or expired link", http.StatusUnauthorized)
+
+type oneTimeTokenService struct {
+	Config    *config.Config
+	tokenRepo db.OneTimeTokenRepository
+}
+
+func NewOneTimeTokenService(tokenRepo db.OneTimeTokenRepository, conf *config.Config) OneTimeTokenService {
+	return &oneTimeTokenService{
+		Config:    conf,
+		tokenRepo: tokenRepo,
+	}
+}
+
+// IssueToken issues a token to the user for the purpose and data, the tokens
+// issued for them before stop working
+func (o *oneTimeTokenService) IssueToken(userID uint, purpose models.TokenPurpose, data string) (string, *errors.Error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("error generating token: %v", err)
+		return "", errors.ErrInternalServerError
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if err := o.tokenRepo.DeleteOneTimeTokens(userID, purpose, data); err != nil {
+		log.Printf("error deleting %s tokens of user %v: %v", purpose, userID, err)
+		return "", errors.ErrInternalServerError
+	}
+	err := o.tokenRepo.CreateOneTimeToken(&models.OneTimeToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashOneTimeToken(token),
+		Data:      data,
+		ExpiresAt: time.Now().Add(purpose.Validity()).Unix(),
+	})
+	if err != nil {
+		log.Printf("error creating %s token of user %v: %v", purpose, userID, err)
+		return "", errors.ErrInternalServerError
+	}
+	return token, nil
+}
+
+// CheckToken returns the token when it was issued for the purpose and is
+// still valid, leaving it for ConsumeToken
+func (o *oneTimeTokenService) CheckToken(token string, purpose models.TokenPurpose) (*models.OneTimeToken, *errors.Error) {
+	if token == "" {
+		return nil, errInvalidLink
+	}
+	oneTimeToken, err := o.tokenRepo.FindOneTimeToken(hashOneTimeToken(token), purpose, time.Now().Unix())
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvalidLink
+	}
+	if err != nil {
+		log.Printf("error finding %s token: %v", purpose, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return oneTimeToken, nil
+}
+
+// ConsumeToken uses up the token when it was issued for the purpose and is
+// still valid
+func (o *oneTimeTokenService) ConsumeToken(token string, purpose models.TokenPurpose) (*models.OneTimeToken, *errors.Error) {
+	if token == "" {
+		return nil, errInvalidLink
+	}
+	oneTimeToken, err := o.tokenRepo.ConsumeOneTimeToken(hashOneTimeToken(token), purpose, time.Now().Unix())
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvalidLink
+	}
+	if err != nil {
+		log.Printf("error consuming %s token: %v", purpose, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return oneTimeToken, nil
+}
+
+func hashOneTimeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var mockOneTimeTokenRepository *mocks.MockOneTimeTokenRepository
+var testOneTimeTokenService OneTimeTokenService
+
+func Test_IssueOneTimeToken(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	var stored *models.OneTimeToken
+	mockOneTimeTokenRepository.EXPECT().DeleteOneTimeTokens(uint(7), models.PurposePasswordReset, "").Return(nil)
+	mockOneTimeTokenRepository.EXPECT().CreateOneTimeToken(gomock.Any()).DoAndReturn(func(token *models.OneTimeToken) error {
+		stored = token
+		return nil
+	})
+	token, err := testOneTimeTokenService.IssueToken(7, models.PurposePasswordReset, "")
+	require.Nil(t, err)
+	require.NotEmpty(t, token)
+
+	// only the hash of the token is stored
+	require.NotEqual(t, token, stored.TokenHash)
+	require.Equal(t, hashOneTimeToken(token), stored.TokenHash)
+	require.Equal(t, models.PurposePasswordReset, stored.Purpose)
+	require.WithinDuration(t, time.Now().Add(time.Hour), time.Unix(stored.ExpiresAt, 0), time.Minute)
+}
+
+func Test_ConsumeOneTimeToken(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	issued := &models.OneTimeToken{UserID: 7, Purpose: models.PurposeEmailChange, Data: "new@gmail.com"}
+	mockOneTimeTokenRepository.EXPECT().ConsumeOneTimeToken(hashOneTimeToken("token"), models.PurposeEmailChange, gomock.Any()).Return(issued, nil)
+	consumed, err := testOneTimeTokenService.ConsumeToken("token", models.PurposeEmailChange)
+	require.Nil(t, err)
+	require.Equal(t, issued, consumed)
+
+	// a used, expired or unknown token, or one of another purpose
+	mockOneTimeTokenRepository.EXPECT().ConsumeOneTimeToken(hashOneTimeToken("token"), models.PurposePasswordReset, gomock.Any()).Return(nil, gorm.ErrRecordNotFound)
+	_, err = testOneTimeTokenService.ConsumeToken("token", models.PurposePasswordReset)
+	require.Equal(t, http.StatusUnauthorized, err.Status)
+
+	mockOneTimeTokenRepository.EXPECT().ConsumeOneTimeToken(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	_, err = testOneTimeTokenService.ConsumeToken("", models.PurposePasswordReset)
+	require.Equal(t, http.StatusUnauthorized, err.Status)
+}
+
+func Test_CheckOneTimeToken(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	issued := &models.OneTimeToken{UserID: 1, Purpose: models.PurposeCaregiverInvite, Data: "5"}
+	mockOneTimeTokenRepository.EXPECT().FindOneTimeToken(hashOneTimeToken("token"), models.PurposeCaregiverInvite, gomock.Any()).Return(issued, nil)
+	mockOneTimeTokenRepository.EXPECT().ConsumeOneTimeToken(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	checked, err := testOneTimeTokenService.CheckToken("token", models.PurposeCaregiverInvite)
+	require.Nil(t, err)
+	require.Equal(t, issued, checked)
+
+	mockOneTimeTokenRepository.EXPECT().FindOneTimeToken(hashOneTimeToken("token"), models.PurposeCaregiverInvite, gomock.Any()).Return(nil, gorm.ErrRecordNotFound)
+	_, err = testOneTimeTokenService.CheckToken("token", models.PurposeCaregiverInvite)
+	require.Equal(t, http.StatusUnauthorized, err.Status)
+}
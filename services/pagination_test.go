@@ -0,0 +1,96 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/stretchr/testify/require"
+)
+
+// defaultPage is the page a list endpoint runs without query parameters
+func defaultPage(spec models.ListSpec) *models.Page {
+	page, err := (&models.PageQuery{}).ToPage(spec)
+	if err != nil {
+		panic(err)
+	}
+	return page
+}
+
+func Test_MedicationsCursorPagination(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	userID := uint(1)
+	startDate := time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC)
+	medications := []models.Medication{
+		{SoftDeleteModel: models.SoftDeleteModel{ID: 7}, Name: "a", MedicationStartDate: startDate, UserID: userID},
+		{SoftDeleteModel: models.SoftDeleteModel{ID: 3}, Name: "b", MedicationStartDate: startDate.AddDate(0, 0, 1), UserID: userID},
+		{SoftDeleteModel: models.SoftDeleteModel{ID: 5}, Name: "c", MedicationStartDate: startDate.AddDate(0, 0, 2), UserID: userID},
+	}
+
+	query := &models.PageQuery{Limit: 2, Sort: "medication_start_date", Status: "active"}
+	firstPage := &models.Page{
+		Limit:      2,
+		SortColumn: "medication_start_date",
+		SortKind:   models.SortTime,
+		DateColumn: "medication_start_date",
+		Status:     "active",
+	}
+	mockMedicationRepository.EXPECT().ListMedications(userID, firstPage).Times(1).Return(medications, nil)
+	responses, meta, err := testMedicationService.GetAllMedications(userID, query)
+	require.Nil(t, err)
+	require.Len(t, responses, 2)
+	require.True(t, meta.HasMore)
+	require.NotEmpty(t, meta.NextCursor)
+
+	// the cursor points after the last medication of the first page
+	query.Cursor = meta.NextCursor
+	page, errr := query.ToPage(models.MedicationListSpec)
+	require.NoError(t, errr)
+	require.Equal(t, uint(3), page.After.ID)
+	value, errr := page.CursorValue()
+	require.NoError(t, errr)
+	require.True(t, startDate.AddDate(0, 0, 1).Equal(value.(time.Time)))
+
+	mockMedicationRepository.EXPECT().ListMedications(userID, page).Times(1).Return(medications[2:], nil)
+	responses, meta, err = testMedicationService.GetAllMedications(userID, query)
+	require.Nil(t, err)
+	require.Len(t, responses, 1)
+	require.Equal(t, &models.PageMeta{Limit: 2}, meta)
+
+	// a cursor only works with the sort it was made for
+	query.Sort = "-medication_start_date"
+	_, _, err = testMedicationService.GetAllMedications(userID, query)
+	require.Equal(t, errors.New("invalid cursor", http.StatusBadRequest), err)
+}
+
+func Test_PageQueryValidation(t *testing.T) {
+	testCases := []struct {
+		name  string
+		query models.PageQuery
+		spec  models.ListSpec
+		err   string
+	}{
+		{name: "unknown sort", query: models.PageQuery{Sort: "-dosage"}, spec: models.MedicationListSpec, err: "can't sort by dosage"},
+		{name: "unknown status", query: models.PageQuery{Status: "lost"}, spec: models.MedicationHistoryListSpec, err: "invalid status: lost"},
+		{name: "status not supported", query: models.PageQuery{Status: "active"}, spec: models.NextMedicationListSpec, err: "invalid status: active"},
+		{name: "invalid date", query: models.PageQuery{From: "monday"}, spec: models.MedicationHistoryListSpec, err: "from must be an RFC3339 date"},
+		{name: "inverted range", query: models.PageQuery{From: "2022-02-01T00:00:00Z", To: "2022-01-01T00:00:00Z"}, spec: models.MedicationListSpec, err: "to is before from"},
+		{name: "garbage cursor", query: models.PageQuery{Cursor: "not a cursor"}, spec: models.MedicationListSpec, err: "invalid cursor"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.query.ToPage(tc.spec)
+			require.EqualError(t, err, tc.err)
+		})
+	}
+
+	page, err := (&models.PageQuery{Limit: 1000}).ToPage(models.MedicationHistoryListSpec)
+	require.NoError(t, err)
+	require.Equal(t, models.MaxPageLimit, page.Limit)
+	require.Equal(t, "medication_time", page.SortColumn)
+	require.True(t, page.SortDescending)
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	stderrors "errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/profile_mock.go -package=mocks github.com/decagonhq/meddle-api/services ProfileService
+
+type ProfileService interface {
+	CreateProfile(userID uint, request *models.CreateProfileRequest) (*models.ProfileResponse, *errors.Error)
+	GetProfiles(userID uint) ([]models.ProfileResponse, *errors.Error)
+	GetProfile(profileID uint, userID uint) (*models.Profile, *errors.Error)
+	UpdateProfile(profileID uint, userID uint, request *models.UpdateProfileRequest) (*models.ProfileResponse, *errors.Error)
+	DeleteProfile(profileID uint, userID uint) *errors.Error
+}
+
+type profileService struct {
+	Config      *config.Config
+	profileRepo db.ProfileRepository
+}
+
+// NewProfileService instantiates a service managing the dependents of users
+func NewProfileService(profileRepo db.ProfileRepository, conf *config.Config) ProfileService {
+	return &profileService{
+		Config:      conf,
+		profileRepo: profileRepo,
+	}
+}
+
+func (p *profileService) CreateProfile(userID uint, request *models.CreateProfileRequest) (*models.ProfileResponse, *errors.Error) {
+	profile, errr := models.NewProfile(userID, request, time.Now())
+	if errr != nil {
+		return nil, errors.New(errr.Error(), http.StatusBadRequest)
+	}
+	profile, err := p.profileRepo.CreateProfile(profile)
+	if err != nil {
+		log.Printf("error creating profile: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	return profile.ToResponse(), nil
+}
+
+func (p *profileService) GetProfiles(userID uint) ([]models.ProfileResponse, *errors.Error) {
+	profiles, err := p.profileRepo.GetProfiles(userID)
+	if err != nil {
+		log.Printf("error getting profiles of user %v: %v", userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return models.ProfilesToResponse(profiles), nil
+}
+
+// GetProfile returns the dependent of the user, the routes selecting a
+// profile use it to check it is theirs
+func (p *profileService) GetProfile(profileID uint, userID uint) (*models.Profile, *errors.Error) {
+	profile, err := p.profileRepo.GetProfile(profileID, userID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error getting profile %v: %v", profileID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return profile, nil
+}
+
+func (p *profileService) UpdateProfile(profileID uint, userID uint, request *models.UpdateProfileRequest) (*models.ProfileResponse, *errors.Error) {
+	profile, err := p.GetProfile(profileID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if errr := profile.Apply(request, time.Now()); errr != nil {
+		return nil, errors.New(errr.Error(), http.StatusBadRequest)
+	}
+	if errr := p.profileRepo.UpdateProfile(profile); errr != nil {
+		log.Printf("error updating profile %v: %v", profileID, errr)
+		return nil, errors.ErrInternalServerError
+	}
+	return profile.ToResponse(), nil
+}
+
+// DeleteProfile deletes a dependent without medications, the ones in the
+// archive included, so that no medication is left without its dependent
+func (p *profileService) DeleteProfile(profileID uint, userID uint) *errors.Error {
+	count, err := p.profileRepo.CountProfileMedications(profileID, userID)
+	if err != nil {
+		log.Printf("error counting medications of profile %v: %v", profileID, err)
+		return errors.ErrInternalServerError
+	}
+	if count > 0 {
+		return errors.New("delete the medications of this profile first", http.StatusConflict)
+	}
+	err = p.profileRepo.DeleteProfile(profileID, userID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error deleting profile %v: %v", profileID, err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var mockProfileRepository *mocks.MockProfileRepository
+var testProfileService ProfileService
+
+func Test_CreateProfileService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	weight := 18.5
+	mockProfileRepository.EXPECT().CreateProfile(&models.Profile{
+		UserID: 1, Name: "Tobi", DateOfBirth: time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC), WeightKg: &weight,
+	}).DoAndReturn(func(profile *models.Profile) (*models.Profile, error) {
+		profile.ID = 4
+		return profile, nil
+	})
+	profile, err := testProfileService.CreateProfile(1, &models.CreateProfileRequest{Name: "Tobi", DateOfBirth: "2018-03-01", WeightKg: &weight})
+	require.Nil(t, err)
+	require.Equal(t, uint(4), profile.ID)
+	require.Equal(t, "2018-03-01", profile.DateOfBirth)
+
+	_, err = testProfileService.CreateProfile(1, &models.CreateProfileRequest{Name: "Tobi", DateOfBirth: "01/03/2018"})
+	require.Equal(t, http.StatusBadRequest, err.Status)
+
+	_, err = testProfileService.CreateProfile(1, &models.CreateProfileRequest{Name: "Tobi", DateOfBirth: time.Now().AddDate(0, 0, 2).Format("2006-01-02")})
+	require.Equal(t, errors.New("date_of_birth is in the future", http.StatusBadRequest), err)
+}
+
+func Test_UpdateProfileService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	mockProfileRepository.EXPECT().GetProfile(uint(4), uint(1)).Return(&models.Profile{
+		Model: models.Model{ID: 4}, UserID: 1, Name: "Tobi", DateOfBirth: time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC),
+	}, nil)
+	mockProfileRepository.EXPECT().UpdateProfile(gomock.Any()).DoAndReturn(func(profile *models.Profile) error {
+		require.Equal(t, "Tobiloba", profile.Name)
+		require.Equal(t, time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC), profile.DateOfBirth)
+		return nil
+	})
+	profile, err := testProfileService.UpdateProfile(4, 1, &models.UpdateProfileRequest{Name: "Tobiloba"})
+	require.Nil(t, err)
+	require.Equal(t, "Tobiloba", profile.Name)
+
+	mockProfileRepository.EXPECT().GetProfile(uint(5), uint(1)).Return(nil, gorm.ErrRecordNotFound)
+	_, err = testProfileService.UpdateProfile(5, 1, &models.UpdateProfileRequest{Name: "Kemi"})
+	require.Equal(t, errors.ErrNotFound, err)
+}
+
+func Test_DeleteProfileService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	mockProfileRepository.EXPECT().CountProfileMedications(uint(4), uint(1)).Return(int64(2), nil)
+	err := testProfileService.DeleteProfile(4, 1)
+	require.Equal(t, http.StatusConflict, err.Status)
+
+	mockProfileRepository.EXPECT().CountProfileMedications(uint(5), uint(1)).Return(int64(0), nil)
+	mockProfileRepository.EXPECT().DeleteProfile(uint(5), uint(1)).Return(nil)
+	require.Nil(t, testProfileService.DeleteProfile(5, 1))
+
+	mockProfileRepository.EXPECT().CountProfileMedications(uint(6), uint(1)).Return(int64(0), nil)
+	mockProfileRepository.EXPECT().DeleteProfile(uint(6), uint(1)).Return(gorm.ErrRecordNotFound)
+	require.Equal(t, errors.ErrNotFound, testProfileService.DeleteProfile(6, 1))
+}
+
+func Test_ProfileAge(t *testing.T) {
+	profile := &models.Profile{DateOfBirth: time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC)}
+	require.Equal(t, 5, profile.AgeAt(time.Date(2022, 2, 28, 12, 0, 0, 0, time.UTC)))
+	require.Equal(t, 6, profile.AgeAt(time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)))
+	require.Equal(t, 7, profile.AgeAt(time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)))
+}
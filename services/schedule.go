@@ -0,0 +1,189 @@
+package services
+
+import (
+	"time"
+
+	"github.com/decagonhq/meddle-api/models"
+)
+
+// maxScheduleLookahead bounds the number of days searched for the next dose
+const maxScheduleLookahead = 400
+
+// FirstDosageTime returns the first dose of a medication starting at start.
+// The boolean is false when the schedule has no fixed dose times (as needed)
+func FirstDosageTime(schedule models.DosageSchedule, start, now time.Time) (time.Time, bool) {
+	switch schedule.Kind {
+	case models.ScheduleAsNeeded:
+		return time.Time{}, false
+	case models.ScheduleInterval:
+		if start.After(now) {
+			return GetNextDosageTime(start, start), true
+		}
+		return GetNextDosageTime(start.Add(time.Hour*time.Duration(schedule.IntervalHours)), start), true
+	}
+	from := start
+	if now.After(from) {
+		from = now
+	}
+	return nextScheduledDosageTime(schedule, start, from, true)
+}
+
+// NextDosageTimeAfter returns the dose following the one due at previous
+func NextDosageTimeAfter(schedule models.DosageSchedule, start, previous time.Time) (time.Time, bool) {
+	switch schedule.Kind {
+	case models.ScheduleAsNeeded:
+		return time.Time{}, false
+	case models.ScheduleInterval:
+		return GetNextDosageTime(previous.Add(time.Hour*time.Duration(schedule.IntervalHours)), previous), true
+	}
+	return nextScheduledDosageTime(schedule, start, previous, false)
+}
+
+// nextScheduledDosageTime walks the days from `from` looking for the earliest
+// dose time of the schedule at (inclusive) or after `from`
+func nextScheduledDosageTime(schedule models.DosageSchedule, start, from time.Time, inclusive bool) (time.Time, bool) {
+	times := schedule.Times()
+	if len(times) == 0 {
+		times = models.TimesOfDay{start.Format("15:04")}
+	}
+	loc := start.Location()
+	from = from.In(loc)
+	startDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i < maxScheduleLookahead; i++ {
+		current := day.AddDate(0, 0, i)
+		if !isDosageDay(schedule, startDay, current) {
+			continue
+		}
+		for _, clock := range times {
+			hour, minute, err := models.ParseClock(clock)
+			if err != nil {
+				continue
+			}
+			candidate := wallClockTime(current, hour, minute, loc)
+			if candidate.Before(start) {
+				continue
+			}
+			if candidate.After(from) || (inclusive && candidate.Equal(from)) {
+				return candidate, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// wallClockTime returns hour:minute on day in loc. A time skipped when the
+// clocks go forward is moved forward by the length of the gap
+func wallClockTime(day time.Time, hour, minute int, loc *time.Location) time.Time {
+	t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+	if t.Hour() != hour || t.Minute() != minute {
+		_, before := t.Zone()
+		_, after := t.Add(2 * time.Hour).Zone()
+		if after > before {
+			t = t.Add(time.Duration(after-before) * time.Second)
+		}
+	}
+	return t
+}
+
+func isDosageDay(schedule models.DosageSchedule, startDay, day time.Time) bool {
+	elapsed := daysBetween(startDay, day)
+	if elapsed < 0 {
+		return false
+	}
+	switch schedule.Kind {
+	case models.ScheduleWeekly:
+		return schedule.Weekdays.Has(day.Weekday())
+	case models.ScheduleEveryNDays:
+		return elapsed%schedule.EveryNDays == 0
+	case models.ScheduleCyclic:
+		return elapsed%(schedule.CycleDaysOn+schedule.CycleDaysOff) < schedule.CycleDaysOn
+	}
+	return true
+}
+
+// daysBetween counts calendar days from a to b, both being midnights
+func daysBetween(a, b time.Time) int {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return int(time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC).Sub(time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+}
+
+// MedicationFirstDosageTime returns the first dose of the medication from now
+// on, following its phases and time zone
+func MedicationFirstDosageTime(medication *models.Medication, now time.Time) (time.Time, bool) {
+	loc := medication.Location()
+	start := medication.MedicationStartTime.In(loc)
+	if len(medication.Phases) == 0 {
+		return FirstDosageTime(medication.EffectiveSchedule(), start, now)
+	}
+	from := now.In(loc)
+	if from.Before(start) {
+		from = start
+	}
+	return nextPhasedDosageTime(medication, from, true)
+}
+
+// MedicationNextDosageTimeAfter returns the dose of the medication following
+// the one due at previous
+func MedicationNextDosageTimeAfter(medication *models.Medication, previous time.Time) (time.Time, bool) {
+	loc := medication.Location()
+	if len(medication.Phases) == 0 {
+		return NextDosageTimeAfter(medication.EffectiveSchedule(), medication.MedicationStartTime.In(loc), previous.In(loc))
+	}
+	return nextPhasedDosageTime(medication, previous.In(loc), false)
+}
+
+// nextPhasedDosageTime looks for the next dose in the phase running at from,
+// moving on to the following phases when that one ends first. Every phase
+// starts at the time of day the medication was started
+func nextPhasedDosageTime(medication *models.Medication, from time.Time, inclusive bool) (time.Time, bool) {
+	start := medication.MedicationStartTime.In(medication.Location())
+	days := 0
+	for i, phase := range medication.Phases {
+		anchor := start.AddDate(0, 0, days)
+		days += phase.DurationDays
+		_, phaseEnd := medication.PhaseBounds(i)
+		if !from.Before(phaseEnd) {
+			continue
+		}
+
+		schedule := medication.PhaseSchedule(i)
+		var next time.Time
+		var ok bool
+		if inclusive || from.Before(anchor) {
+			next, ok = FirstDosageTime(schedule, anchor, from)
+		} else {
+			next, ok = NextDosageTimeAfter(schedule, anchor, from)
+		}
+		if ok && next.Before(phaseEnd) {
+			return next, true
+		}
+		from = phaseEnd
+	}
+	return time.Time{}, false
+}
+
+// rescheduleInTimeZone returns the active medications whose next dose moves to
+// the time of day it is due at in timeZone, with their new next dose
+func rescheduleInTimeZone(medications []models.Medication, timeZone string, now time.Time) []models.Medication {
+	var rescheduled []models.Medication
+	for _, medication := range medications {
+		if medication.EffectiveStatus() != models.MedicationActive {
+			continue
+		}
+		// doses every few hours and as needed don't follow the time of day
+		kind := medication.EffectiveSchedule().Kind
+		if len(medication.Phases) == 0 && (kind == models.ScheduleInterval || kind == models.ScheduleAsNeeded) {
+			continue
+		}
+		medication.TimeZone = timeZone
+		next, ok := MedicationFirstDosageTime(&medication, now)
+		if !ok || !next.Before(medication.MedicationStopDate) || next.Equal(medication.NextDosageTime) {
+			continue
+		}
+		medication.NextDosageTime = next
+		rescheduled = append(rescheduled, medication)
+	}
+	return rescheduled
+}
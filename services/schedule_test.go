@@ -0,0 +1,249 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NextDosageTimeAfter(t *testing.T) {
+	// Monday 2022-08-01 07:30 UTC
+	start := time.Date(2022, 8, 1, 7, 30, 0, 0, time.UTC)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2022, 8, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	testCases := []struct {
+		name     string
+		schedule models.DosageSchedule
+		previous time.Time
+		expected time.Time
+		ok       bool
+	}{
+		{
+			name:     "interval schedule keeps the same day",
+			schedule: models.DosageSchedule{Kind: models.ScheduleInterval, IntervalHours: 8},
+			previous: at(1, 7, 30),
+			expected: at(1, 15, 30),
+			ok:       true,
+		},
+		{
+			name:     "interval schedule rolls over to nine the next day",
+			schedule: models.DosageSchedule{Kind: models.ScheduleInterval, IntervalHours: 8},
+			previous: at(1, 20, 0),
+			expected: at(2, 9, 0),
+			ok:       true,
+		},
+		{
+			name:     "daily schedule picks the next time of day",
+			schedule: models.DosageSchedule{Kind: models.ScheduleDaily, TimesOfDay: models.TimesOfDay{"20:00", "08:00"}},
+			previous: at(1, 8, 0),
+			expected: at(1, 20, 0),
+			ok:       true,
+		},
+		{
+			name:     "daily schedule moves to the next day",
+			schedule: models.DosageSchedule{Kind: models.ScheduleDaily, TimesOfDay: models.TimesOfDay{"08:00", "20:00"}},
+			previous: at(1, 20, 0),
+			expected: at(2, 8, 0),
+			ok:       true,
+		},
+		{
+			name: "weekly schedule skips to the next weekday",
+			schedule: models.DosageSchedule{
+				Kind:       models.ScheduleWeekly,
+				TimesOfDay: models.TimesOfDay{"09:00"},
+				Weekdays:   1<<time.Monday | 1<<time.Wednesday | 1<<time.Friday,
+			},
+			previous: at(1, 9, 0),
+			expected: at(3, 9, 0),
+			ok:       true,
+		},
+		{
+			name:     "every other day",
+			schedule: models.DosageSchedule{Kind: models.ScheduleEveryNDays, EveryNDays: 2, TimesOfDay: models.TimesOfDay{"09:00"}},
+			previous: at(1, 9, 0),
+			expected: at(3, 9, 0),
+			ok:       true,
+		},
+		{
+			name: "cyclic schedule skips the days off",
+			schedule: models.DosageSchedule{
+				Kind:         models.ScheduleCyclic,
+				CycleDaysOn:  2,
+				CycleDaysOff: 3,
+				TimesOfDay:   models.TimesOfDay{"09:00"},
+			},
+			previous: at(2, 9, 0),
+			expected: at(6, 9, 0),
+			ok:       true,
+		},
+		{
+			name:     "meal schedule uses the default meal times",
+			schedule: models.DosageSchedule{Kind: models.ScheduleDaily, MealTiming: models.MealTimingWith},
+			previous: at(1, 8, 0),
+			expected: at(1, 13, 0),
+			ok:       true,
+		},
+		{
+			name:     "as needed schedule has no next dose",
+			schedule: models.DosageSchedule{Kind: models.ScheduleAsNeeded, MaxDosesPerDay: 4},
+			previous: at(1, 8, 0),
+			ok:       false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			next, ok := NextDosageTimeAfter(tc.schedule, start, tc.previous)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.expected, next)
+		})
+	}
+}
+
+func Test_FirstDosageTime(t *testing.T) {
+	start := time.Date(2022, 8, 1, 7, 30, 0, 0, time.UTC)
+	now := time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	daily := models.DosageSchedule{Kind: models.ScheduleDaily, TimesOfDay: models.TimesOfDay{"08:00", "20:00"}}
+	next, ok := FirstDosageTime(daily, start, now)
+	require.True(t, ok)
+	require.Equal(t, time.Date(2022, 8, 1, 20, 0, 0, 0, time.UTC), next)
+
+	next, ok = FirstDosageTime(daily, start, start.AddDate(0, 0, -1))
+	require.True(t, ok)
+	require.Equal(t, time.Date(2022, 8, 1, 8, 0, 0, 0, time.UTC), next)
+}
+
+func Test_DosageScheduleValidate(t *testing.T) {
+	require.NoError(t, models.DosageSchedule{Kind: models.ScheduleInterval, IntervalHours: 6}.Validate())
+	require.NoError(t, models.DosageSchedule{Kind: models.ScheduleAsNeeded, MaxDosesPerDay: 3}.Validate())
+	require.Error(t, models.DosageSchedule{Kind: models.ScheduleDaily}.Validate())
+	require.Error(t, models.DosageSchedule{Kind: models.ScheduleWeekly, TimesOfDay: models.TimesOfDay{"08:00"}}.Validate())
+	require.Error(t, models.DosageSchedule{Kind: models.ScheduleDaily, TimesOfDay: models.TimesOfDay{"8pm"}}.Validate())
+	require.Error(t, models.DosageSchedule{Kind: "hourly"}.Validate())
+}
+
+func Test_DosageTimesInUserTimeZone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	lagos, err := time.LoadLocation("Africa/Lagos")
+	require.NoError(t, err)
+
+	daily := models.DosageSchedule{Kind: models.ScheduleDaily, TimesOfDay: models.TimesOfDay{"02:30", "08:00"}}
+	start := time.Date(2022, 3, 10, 8, 0, 0, 0, newYork)
+
+	t.Run("local clock time is kept when clocks spring forward", func(t *testing.T) {
+		next, ok := NextDosageTimeAfter(daily, start, time.Date(2022, 3, 12, 8, 0, 0, 0, newYork))
+		require.True(t, ok)
+		// 02:30 doesn't exist on 2022-03-13 in New York, the dose moves to 03:30 EDT
+		require.Equal(t, time.Date(2022, 3, 13, 7, 30, 0, 0, time.UTC), next.UTC())
+
+		next, ok = NextDosageTimeAfter(daily, start, next)
+		require.True(t, ok)
+		require.Equal(t, "08:00 EDT", next.Format("15:04 MST"))
+		require.Equal(t, time.Date(2022, 3, 13, 12, 0, 0, 0, time.UTC), next.UTC())
+	})
+
+	t.Run("local clock time is kept when clocks fall back", func(t *testing.T) {
+		next, ok := NextDosageTimeAfter(daily, start, time.Date(2022, 11, 6, 2, 30, 0, 0, newYork))
+		require.True(t, ok)
+		require.Equal(t, "08:00 EST", next.Format("15:04 MST"))
+		require.Equal(t, time.Date(2022, 11, 6, 13, 0, 0, 0, time.UTC), next.UTC())
+	})
+
+	t.Run("interval rollover happens at nine in the user's time zone", func(t *testing.T) {
+		interval := models.DosageSchedule{Kind: models.ScheduleInterval, IntervalHours: 8}
+		previous := time.Date(2022, 8, 1, 20, 0, 0, 0, lagos)
+		next, ok := NextDosageTimeAfter(interval, previous, previous)
+		require.True(t, ok)
+		require.Equal(t, time.Date(2022, 8, 2, 9, 0, 0, 0, lagos), next)
+		require.Equal(t, time.Date(2022, 8, 2, 8, 0, 0, 0, time.UTC), next.UTC())
+	})
+
+	t.Run("interval rollover is counted across months", func(t *testing.T) {
+		previous := time.Date(2022, 8, 31, 20, 0, 0, 0, time.UTC)
+		require.Equal(t, time.Date(2022, 9, 1, 9, 0, 0, 0, time.UTC), GetNextDosageTime(previous.Add(8*time.Hour), previous))
+	})
+}
+
+func Test_TaperingPhases(t *testing.T) {
+	start := time.Date(2022, 8, 1, 8, 0, 0, 0, time.UTC)
+	at := func(day, hour int) time.Time {
+		return time.Date(2022, 8, day, hour, 0, 0, 0, time.UTC)
+	}
+	daily := models.DosageSchedule{Kind: models.ScheduleDaily, TimesOfDay: models.TimesOfDay{"08:00"}}
+	medication := &models.Medication{
+		Dosage:              40,
+		MedicationStartTime: start,
+		Schedule:            daily,
+		Phases: []models.MedicationPhase{
+			{Position: 1, Dosage: 40, DurationDays: 2},
+			{Position: 2, Dosage: 30, DurationDays: 2, Schedule: models.DosageSchedule{Kind: models.ScheduleDaily, TimesOfDay: models.TimesOfDay{"08:00", "20:00"}}},
+			{Position: 3, Dosage: 20, DurationDays: 1},
+		},
+	}
+
+	next, ok := MedicationFirstDosageTime(medication, start.Add(-time.Hour))
+	require.True(t, ok)
+	require.Equal(t, at(1, 8), next)
+	require.Equal(t, 40, medication.DosageAt(next))
+
+	expected := []struct {
+		at     time.Time
+		dosage int
+	}{
+		{at(2, 8), 40},
+		{at(3, 8), 30},
+		{at(3, 20), 30},
+		{at(4, 8), 30},
+		{at(4, 20), 30},
+		{at(5, 8), 20},
+	}
+	for _, e := range expected {
+		next, ok = MedicationNextDosageTimeAfter(medication, next)
+		require.True(t, ok)
+		require.Equal(t, e.at, next)
+		require.Equal(t, e.dosage, medication.DosageAt(next))
+		require.Equal(t, e.dosage, models.NewMedicationHistory(models.Medication{
+			Dosage:              medication.Dosage,
+			MedicationStartTime: medication.MedicationStartTime,
+			Phases:              medication.Phases,
+			NextDosageTime:      next,
+		}, models.DefaultMissedDoseGrace).MedicationDosage)
+	}
+
+	_, ok = MedicationNextDosageTimeAfter(medication, next)
+	require.False(t, ok)
+}
+
+func Test_MedicationDoses(t *testing.T) {
+	require.Error(t, models.ValidateDose(0, nil, nil, ""))
+	require.NoError(t, models.ValidateDose(2, nil, nil, ""))
+	require.NoError(t, models.ValidateDose(0, &models.DoseQuantity{Amount: 0.5, Unit: models.DoseUnitTablet}, &models.DoseQuantity{Amount: 500, Unit: models.DoseUnitMilligram}, models.DosageFormTablet))
+	require.Error(t, models.ValidateDose(0, &models.DoseQuantity{Amount: 1, Unit: "cup"}, nil, ""))
+	require.Error(t, models.ValidateDose(0, &models.DoseQuantity{Amount: 1, Unit: models.DoseUnitTablet}, &models.DoseQuantity{Amount: 1, Unit: models.DoseUnitTablet}, ""))
+	require.Error(t, models.ValidateDose(1, nil, nil, "gummy"))
+
+	medication := &models.Medication{
+		Name:           "paracetamol",
+		Dosage:         2,
+		NextDosageTime: time.Date(2022, 8, 1, 8, 0, 0, 0, time.UTC),
+		Strength:       models.DoseQuantity{Amount: 500, Unit: models.DoseUnitMilligram},
+		Dose:           models.DoseQuantity{Amount: 2, Unit: models.DoseUnitTablet},
+	}
+	require.Equal(t, "'paracetamol 500 mg' is due at 08:00, take 2 tablets", medicationNotificationBody(medication))
+
+	medication.Strength = models.DoseQuantity{}
+	medication.Dose = models.DoseQuantity{}
+	require.Equal(t, "'paracetamol' is due at 08:00, take 2", medicationNotificationBody(medication))
+
+	medication.ProfileName = "Tobi"
+	require.Equal(t, "'paracetamol' is due for Tobi at 08:00, give 2", medicationNotificationBody(medication))
+	require.Equal(t, "paracetamol for Tobi", medicationNotificationTitle(medication))
+
+	syrup := models.DoseQuantity{Amount: 2.5, Unit: models.DoseUnitMillilitre}
+	require.Equal(t, "2.5 ml", syrup.String())
+}
@@ -18,6 +18,7 @@ func TestMain(m *testing.M) {
 	}
 
 	testConfig = c
+	testConfig.JWTSecret = "testSecret"
 	fmt.Println(testConfig)
 	exitCode := m.Run()
 	os.Exit(exitCode)
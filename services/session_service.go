@@ -0,0 +1,195 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	stderrors "errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/session_mock.go -package=mocks github.com/decagonhq/meddle-api/services SessionService
+
+type SessionService interface {
+	StartSession(user *models.User, client models.SessionClient) (*models.TokenPair, *errors.Error)
+	RefreshSession(request *models.RefreshRequest) (*models.TokenPair, *errors.Error)
+	CheckSession(sessionID uint, userID uint) *errors.Error
+	GetSessions(userID uint, currentSessionID uint) ([]models.SessionResponse, *errors.Error)
+	RevokeSession(sessionID uint, userID uint) *errors.Error
+	RevokeSessions(userID uint) *errors.Error
+}
+
+var errInvalidRefreshToken = errors.New("invalid refresh token, sign in again", http.StatusUnauthorized)
+
+type sessionService struct {
+	Config      *config.Config
+	sessionRepo db.SessionRepository
+}
+
+// NewSessionService instantiates a service managing the logins of users
+func NewSessionService(sessionRepo db.SessionRepository, conf *config.Config) SessionService {
+	return &sessionService{
+		Config:      conf,
+		sessionRepo: sessionRepo,
+	}
+}
+
+// StartSession starts a session for the user signing in from client
+func (s *sessionService) StartSession(user *models.User, client models.SessionClient) (*models.TokenPair, *errors.Error) {
+	if user.Deactivated() {
+		return nil, errors.ErrAccountDeactivated
+	}
+	refreshToken, tokenHash, err := newRefreshToken()
+	if err != nil {
+		log.Printf("error generating refresh token: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	now := time.Now()
+	session, err := s.sessionRepo.CreateSession(&models.Session{
+		UserID:     user.ID,
+		Device:     client.Device,
+		IP:         client.IP,
+		LastSeenAt: now.Unix(),
+		ExpiresAt:  now.Add(jwt.RefreshTokenValidity).Unix(),
+	}, tokenHash)
+	if err != nil {
+		log.Printf("error creating session of user %v: %v", user.ID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return s.tokenPair(user.Email, session.ID, refreshToken)
+}
+
+// RefreshSession trades a refresh token for a new pair of tokens. A refresh
+// token already traded is taken as stolen and revokes its session, so that
+// neither the thief nor the user can go on with it
+func (s *sessionService) RefreshSession(request *models.RefreshRequest) (*models.TokenPair, *errors.Error) {
+	token, err := s.sessionRepo.FindRefreshToken(hashRefreshToken(request.RefreshToken))
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvalidRefreshToken
+	}
+	if err != nil {
+		log.Printf("error finding refresh token: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	session := token.Session
+	now := time.Now()
+	if !session.Active(now) {
+		return nil, errInvalidRefreshToken
+	}
+	if token.UsedAt != 0 {
+		return nil, s.revokeReusedSession(session, now)
+	}
+
+	refreshToken, tokenHash, err := newRefreshToken()
+	if err != nil {
+		log.Printf("error generating refresh token: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	session.Device = request.Client.Device
+	session.IP = request.Client.IP
+	session.LastSeenAt = now.Unix()
+	session.ExpiresAt = now.Add(jwt.RefreshTokenValidity).Unix()
+	err = s.sessionRepo.RotateRefreshToken(token, tokenHash)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		// another request traded the token first
+		return nil, s.revokeReusedSession(session, now)
+	}
+	if err != nil {
+		log.Printf("error rotating refresh token of session %v: %v", session.ID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return s.tokenPair(session.Email, session.ID, refreshToken)
+}
+
+func (s *sessionService) revokeReusedSession(session *models.Session, now time.Time) *errors.Error {
+	log.Printf("refresh token of session %v of user %v reused, revoking the session", session.ID, session.UserID)
+	err := s.sessionRepo.RevokeSession(session.ID, session.UserID, now.Unix())
+	if err != nil && !stderrors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("error revoking session %v: %v", session.ID, err)
+		return errors.ErrInternalServerError
+	}
+	return errInvalidRefreshToken
+}
+
+// CheckSession checks the session of an access token is still active
+func (s *sessionService) CheckSession(sessionID uint, userID uint) *errors.Error {
+	session, err := s.sessionRepo.GetSession(sessionID, userID)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("session expired", http.StatusUnauthorized)
+	}
+	if err != nil {
+		log.Printf("error getting session %v: %v", sessionID, err)
+		return errors.ErrInternalServerError
+	}
+	if !session.Active(time.Now()) {
+		return errors.New("session expired", http.StatusUnauthorized)
+	}
+	return nil
+}
+
+func (s *sessionService) GetSessions(userID uint, currentSessionID uint) ([]models.SessionResponse, *errors.Error) {
+	sessions, err := s.sessionRepo.GetActiveSessions(userID, time.Now().Unix())
+	if err != nil {
+		log.Printf("error getting sessions of user %v: %v", userID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return models.SessionsToResponse(sessions, currentSessionID), nil
+}
+
+func (s *sessionService) RevokeSession(sessionID uint, userID uint) *errors.Error {
+	err := s.sessionRepo.RevokeSession(sessionID, userID, time.Now().Unix())
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.ErrNotFound
+	}
+	if err != nil {
+		log.Printf("error revoking session %v: %v", sessionID, err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+func (s *sessionService) RevokeSessions(userID uint) *errors.Error {
+	if err := s.sessionRepo.RevokeSessions(userID, time.Now().Unix()); err != nil {
+		log.Printf("error revoking sessions of user %v: %v", userID, err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+func (s *sessionService) tokenPair(email string, sessionID uint, refreshToken string) (*models.TokenPair, *errors.Error) {
+	accessToken, err := jwt.GenerateAccessToken(email, sessionID, s.Config.JWTSecret)
+	if err != nil {
+		log.Printf("error generating token %s", err)
+		return nil, errors.ErrInternalServerError
+	}
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(jwt.AccessTokenValidity.Seconds()),
+	}, nil
+}
+
+// newRefreshToken returns a random refresh token and the hash it is stored as
+func newRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
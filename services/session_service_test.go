@@ -0,0 +1,140 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var mockSessionRepository *mocks.MockSessionRepository
+var testSessionService SessionService
+
+func Test_StartSessionService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user := &models.User{Model: models.Model{ID: 1}, Email: "ken@gmail.com"}
+	var tokenHash string
+	mockSessionRepository.EXPECT().CreateSession(gomock.Any(), gomock.Any()).DoAndReturn(func(session *models.Session, hash string) (*models.Session, error) {
+		require.Equal(t, uint(1), session.UserID)
+		require.Equal(t, "okhttp/4.9", session.Device)
+		require.Equal(t, "10.0.0.1", session.IP)
+		tokenHash = hash
+		session.ID = 7
+		return session, nil
+	})
+	tokens, err := testSessionService.StartSession(user, models.SessionClient{Device: "okhttp/4.9", IP: "10.0.0.1"})
+	require.Nil(t, err)
+	require.Equal(t, hashRefreshToken(tokens.RefreshToken), tokenHash)
+	require.Equal(t, int64(jwt.AccessTokenValidity.Seconds()), tokens.ExpiresIn)
+
+	claims, errr := jwt.ValidateAndGetClaims(tokens.AccessToken, "testSecret")
+	require.NoError(t, errr)
+	require.Equal(t, "ken@gmail.com", claims["email"])
+	sessionID, ok := jwt.GetSessionID(claims)
+	require.True(t, ok)
+	require.Equal(t, uint(7), sessionID)
+
+	user.DeactivatedAt = 1
+	_, err = testSessionService.StartSession(user, models.SessionClient{})
+	require.Equal(t, errors.ErrAccountDeactivated, err)
+}
+
+func Test_RefreshSessionService(t *testing.T) {
+	now := time.Now()
+	activeSession := func() *models.Session {
+		return &models.Session{Model: models.Model{ID: 7}, UserID: 1, Email: "ken@gmail.com", ExpiresAt: now.Add(time.Hour).Unix()}
+	}
+	client := models.SessionClient{Device: "okhttp/4.9", IP: "10.0.0.2"}
+
+	testCases := []struct {
+		name       string
+		buildStubs func(repo *mocks.MockSessionRepository)
+		wantError  *errors.Error
+	}{
+		{
+			name: "rotates the token",
+			buildStubs: func(repo *mocks.MockSessionRepository) {
+				token := &models.RefreshToken{Model: models.Model{ID: 3}, SessionID: 7, Session: activeSession()}
+				repo.EXPECT().FindRefreshToken(hashRefreshToken("refresh")).Return(token, nil)
+				repo.EXPECT().RotateRefreshToken(token, gomock.Any()).DoAndReturn(func(token *models.RefreshToken, hash string) error {
+					require.Equal(t, "10.0.0.2", token.Session.IP)
+					require.NotEqual(t, hashRefreshToken("refresh"), hash)
+					return nil
+				})
+			},
+		},
+		{
+			name: "unknown token",
+			buildStubs: func(repo *mocks.MockSessionRepository) {
+				repo.EXPECT().FindRefreshToken(gomock.Any()).Return(nil, gorm.ErrRecordNotFound)
+			},
+			wantError: errInvalidRefreshToken,
+		},
+		{
+			name: "revoked session",
+			buildStubs: func(repo *mocks.MockSessionRepository) {
+				session := activeSession()
+				session.RevokedAt = now.Add(-time.Minute).Unix()
+				repo.EXPECT().FindRefreshToken(gomock.Any()).Return(&models.RefreshToken{SessionID: 7, Session: session}, nil)
+			},
+			wantError: errInvalidRefreshToken,
+		},
+		{
+			name: "reused token revokes the session",
+			buildStubs: func(repo *mocks.MockSessionRepository) {
+				token := &models.RefreshToken{SessionID: 7, UsedAt: now.Add(-time.Hour).Unix(), Session: activeSession()}
+				repo.EXPECT().FindRefreshToken(gomock.Any()).Return(token, nil)
+				repo.EXPECT().RevokeSession(uint(7), uint(1), gomock.Any()).Return(nil)
+			},
+			wantError: errInvalidRefreshToken,
+		},
+		{
+			name: "token used up by a concurrent refresh",
+			buildStubs: func(repo *mocks.MockSessionRepository) {
+				token := &models.RefreshToken{SessionID: 7, Session: activeSession()}
+				repo.EXPECT().FindRefreshToken(gomock.Any()).Return(token, nil)
+				repo.EXPECT().RotateRefreshToken(token, gomock.Any()).Return(gorm.ErrRecordNotFound)
+				repo.EXPECT().RevokeSession(uint(7), uint(1), gomock.Any()).Return(nil)
+			},
+			wantError: errInvalidRefreshToken,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			teardown := setup(t)
+			defer teardown()
+			tc.buildStubs(mockSessionRepository)
+
+			tokens, err := testSessionService.RefreshSession(&models.RefreshRequest{RefreshToken: "refresh", Client: client})
+			require.Equal(t, tc.wantError, err)
+			if tc.wantError == nil {
+				require.NotEqual(t, "refresh", tokens.RefreshToken)
+				require.NotEmpty(t, tokens.AccessToken)
+			}
+		})
+	}
+}
+
+func Test_CheckSessionService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	mockSessionRepository.EXPECT().GetSession(uint(7), uint(1)).Return(&models.Session{ExpiresAt: time.Now().Add(time.Hour).Unix()}, nil)
+	require.Nil(t, testSessionService.CheckSession(7, 1))
+
+	mockSessionRepository.EXPECT().GetSession(uint(8), uint(1)).Return(&models.Session{ExpiresAt: time.Now().Add(time.Hour).Unix(), RevokedAt: 1}, nil)
+	require.Equal(t, http.StatusUnauthorized, testSessionService.CheckSession(8, 1).Status)
+
+	mockSessionRepository.EXPECT().GetSession(uint(9), uint(1)).Return(nil, gorm.ErrRecordNotFound)
+	require.Equal(t, http.StatusUnauthorized, testSessionService.CheckSession(9, 1).Status)
+}
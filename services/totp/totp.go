@@ -0,0 +1,94 @@
+// Package totp implements the time-based one-time passwords of RFC 6238 that
+// authenticator apps show, with their defaults: SHA-1, 6 digits, 30 seconds
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+	// Skew is the number of periods before and after now a code is accepted
+	// in, for the clock of the phone being off
+	Skew = 1
+
+	secretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret generates a random secret, base32 encoded as the apps take it
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// ProvisioningURI returns the otpauth URI that the apps scan as a QR code
+func ProvisioningURI(secret, account, issuer string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period.Seconds())))
+	label := url.PathEscape(issuer + ":" + account)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, query.Encode())
+}
+
+// Step returns the period t is in
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the code of the secret for the period step
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid totp secret: %v", err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%modulo), nil
+}
+
+// Validate checks the code against the periods around now and returns the
+// period it is for, so that the caller can refuse the same code twice
+func Validate(code, secret string, now time.Time) (int64, bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Step(now)
+	for step := current - Skew; step <= current+Skew; step++ {
+		expected, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,57 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA-1 secret of the test vectors of RFC 6238
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func Test_Code(t *testing.T) {
+	// the last 6 of the 8 digits of the RFC test vectors
+	testCases := []struct {
+		unix     int64
+		expected string
+	}{
+		{unix: 59, expected: "287082"},
+		{unix: 1111111109, expected: "081804"},
+		{unix: 1234567890, expected: "005924"},
+		{unix: 2000000000, expected: "279037"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			code, err := Code(rfcSecret, Step(time.Unix(tc.unix, 0)))
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, code)
+		})
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step, ok := Validate("081804", rfcSecret, now)
+	require.True(t, ok)
+	require.Equal(t, Step(now), step)
+
+	// the code of the previous period is still accepted, not older ones
+	_, ok = Validate("081804", rfcSecret, now.Add(Period))
+	require.True(t, ok)
+	_, ok = Validate("081804", rfcSecret, now.Add(2*Period))
+	require.False(t, ok)
+
+	_, ok = Validate("81804", rfcSecret, now)
+	require.False(t, ok)
+}
+
+func Test_ProvisioningURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	uri := ProvisioningURI(secret, "ken@gmail.com", "Meddle")
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/Meddle:ken@gmail.com?"))
+	require.Contains(t, uri, "secret="+secret)
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	stderrors "errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/decagonhq/meddle-api/services/totp"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/two_factor_mock.go -package=mocks github.com/decagonhq/meddle-api/services TwoFactorService
+
+type TwoFactorService interface {
+	GetTwoFactorStatus(user *models.User) (*models.TwoFactorStatusResponse, *errors.Error)
+	EnrolTwoFactor(user *models.User) (*models.TwoFactorEnrolmentResponse, *errors.Error)
+	ConfirmTwoFactor(user *models.User, code string) (*models.RecoveryCodesResponse, *errors.Error)
+	RegenerateRecoveryCodes(user *models.User, code string) (*models.RecoveryCodesResponse, *errors.Error)
+	DisableTwoFactor(user *models.User, code string) *errors.Error
+	LoginWithTwoFactor(request *models.TwoFactorLoginRequest) (*models.LoginResponse, *errors.Error)
+}
+
+const (
+	totpIssuer         = "Meddle"
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+var (
+	errInvalidTwoFactorCode  = errors.New("invalid code", http.StatusUnauthorized)
+	errInvalidChallengeToken = errors.New("invalid or expired login, sign in again", http.StatusUnauthorized)
+	errTwoFactorEnabled      = errors.New("two-factor authentication is already enabled", http.StatusConflict)
+	errTwoFactorNotEnabled   = errors.New("two-factor authentication is not enabled", http.StatusBadRequest)
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type twoFactorService struct {
+	Config        *config.Config
+	twoFactorRepo db.TwoFactorRepository
+	authRepo      db.AuthRepository
+	sessions      SessionService
+	throttle      LoginThrottleService
+}
+
+// NewTwoFactorService instantiates a service for the two-factor authentication
+// of users with an authenticator app
+func NewTwoFactorService(twoFactorRepo db.TwoFactorRepository, authRepo db.AuthRepository, sessions SessionService, throttle LoginThrottleService, conf *config.Config) TwoFactorService {
+	return &twoFactorService{
+		Config:        conf,
+		twoFactorRepo: twoFactorRepo,
+		authRepo:      authRepo,
+		sessions:      sessions,
+		throttle:      throttle,
+	}
+}
+
+func (t *twoFactorService) GetTwoFactorStatus(user *models.User) (*models.TwoFactorStatusResponse, *errors.Error) {
+	if !user.TwoFactor.Enabled {
+		return &models.TwoFactorStatusResponse{}, nil
+	}
+	count, err := t.twoFactorRepo.CountRecoveryCodes(user.ID)
+	if err != nil {
+		log.Printf("error counting recovery codes of user %v: %v", user.ID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return &models.TwoFactorStatusResponse{Enabled: true, RecoveryCodesLeft: count}, nil
+}
+
+// EnrolTwoFactor gives the user a new secret to add to their authenticator
+// app, two-factor authentication is enabled once they confirm it with a code
+func (t *twoFactorService) EnrolTwoFactor(user *models.User) (*models.TwoFactorEnrolmentResponse, *errors.Error) {
+	if user.TwoFactor.Enabled {
+		return nil, errTwoFactorEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Printf("error generating totp secret: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	err = t.twoFactorRepo.SaveTwoFactorSecret(user.ID, secret)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errTwoFactorEnabled
+	}
+	if err != nil {
+		log.Printf("error saving totp secret of user %v: %v", user.ID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return &models.TwoFactorEnrolmentResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(secret, user.Email, totpIssuer),
+	}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication with a code of the app
+// and returns the recovery codes, the only time they are shown
+func (t *twoFactorService) ConfirmTwoFactor(user *models.User, code string) (*models.RecoveryCodesResponse, *errors.Error) {
+	if user.TwoFactor.Enabled {
+		return nil, errTwoFactorEnabled
+	}
+	if user.TwoFactor.Secret == "" {
+		return nil, errors.New("start the two-factor enrolment first", http.StatusBadRequest)
+	}
+	step, ok := totp.Validate(normalizeCode(code), user.TwoFactor.Secret, time.Now())
+	if !ok {
+		return nil, errInvalidTwoFactorCode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("error generating recovery codes: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	if err := t.twoFactorRepo.EnableTwoFactor(user.ID, step, hashes); err != nil {
+		log.Printf("error enabling two-factor authentication of user %v: %v", user.ID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return &models.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user
+func (t *twoFactorService) RegenerateRecoveryCodes(user *models.User, code string) (*models.RecoveryCodesResponse, *errors.Error) {
+	if !user.TwoFactor.Enabled {
+		return nil, errTwoFactorNotEnabled
+	}
+	if err := t.verifyCode(user, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("error generating recovery codes: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	if err := t.twoFactorRepo.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		log.Printf("error replacing recovery codes of user %v: %v", user.ID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return &models.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (t *twoFactorService) DisableTwoFactor(user *models.User, code string) *errors.Error {
+	if !user.TwoFactor.Enabled {
+		return errTwoFactorNotEnabled
+	}
+	if err := t.verifyCode(user, code); err != nil {
+		return err
+	}
+	if err := t.twoFactorRepo.DisableTwoFactor(user.ID); err != nil {
+		log.Printf("error disabling two-factor authentication of user %v: %v", user.ID, err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+// LoginWithTwoFactor ends the login the password started, trading its
+// challenge token and a code for the tokens of a new session
+func (t *twoFactorService) LoginWithTwoFactor(request *models.TwoFactorLoginRequest) (*models.LoginResponse, *errors.Error) {
+	claims, err := jwt.ValidateAndGetClaims(request.ChallengeToken, t.Config.JWTSecret)
+	if err != nil || jwt.GetPurpose(claims) != jwt.PurposeTwoFactor {
+		return nil, errInvalidChallengeToken
+	}
+	email, _ := claims["email"].(string)
+	user, err := t.authRepo.FindUserByEmail(email)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvalidChallengeToken
+	}
+	if err != nil {
+		log.Printf("error finding user: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	if !user.TwoFactor.Enabled {
+		return nil, errInvalidChallengeToken
+	}
+	// the account may have been deactivated or reset since the password
+	if user.Deactivated() {
+		return nil, errors.ErrAccountDeactivated
+	}
+	if user.PasswordResetRequired {
+		return nil, errPasswordResetRequired
+	}
+	if err := t.throttle.CheckLogin(user.Email, request.Client.IP); err != nil {
+		return nil, err
+	}
+	if err := t.verifyCode(user, request.Code); err != nil {
+		if err == errInvalidTwoFactorCode {
+			t.throttle.LoginFailed(user.Email, request.Client.IP, user)
+		}
+		return nil, err
+	}
+	tokens, errr := t.sessions.StartSession(user, request.Client)
+	if errr != nil {
+		return nil, errr
+	}
+	t.throttle.LoginSucceeded(user.Email)
+	return user.LoginUserToDto(tokens), nil
+}
+
+// verifyCode checks a code of the app of the user, or one of their recovery
+// codes, and uses it up
+func (t *twoFactorService) verifyCode(user *models.User, code string) *errors.Error {
+	code = normalizeCode(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(code, user.TwoFactor.Secret, time.Now())
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+		err := t.twoFactorRepo.UseTwoFactorStep(user.ID, step)
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidTwoFactorCode
+		}
+		if err != nil {
+			log.Printf("error using totp code of user %v: %v", user.ID, err)
+			return errors.ErrInternalServerError
+		}
+		return nil
+	}
+
+	err := t.twoFactorRepo.UseRecoveryCode(user.ID, hashRecoveryCode(code), time.Now().Unix())
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errInvalidTwoFactorCode
+	}
+	if err != nil {
+		log.Printf("error using recovery code of user %v: %v", user.ID, err)
+		return errors.ErrInternalServerError
+	}
+	return nil
+}
+
+// normalizeCode drops the spaces and dashes users type codes with
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// newRecoveryCodes returns new recovery codes, as xxxxx-xxxxx, and their hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeLength*5/8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeCode(code)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/mocks"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/decagonhq/meddle-api/services/jwt"
+	"github.com/decagonhq/meddle-api/services/totp"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var mockTwoFactorRepository *mocks.MockTwoFactorRepository
+var testTwoFactorService TwoFactorService
+
+func twoFactorUser(t *testing.T, enabled bool) (*models.User, string) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	user := &models.User{Model: models.Model{ID: 1}, Email: "ken@gmail.com", IsEmailActive: true}
+	user.TwoFactor = models.TwoFactor{Enabled: enabled, Secret: secret}
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	require.NoError(t, err)
+	return user, code
+}
+
+func Test_EnrolTwoFactorService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user := &models.User{Model: models.Model{ID: 1}, Email: "ken@gmail.com"}
+	mockTwoFactorRepository.EXPECT().SaveTwoFactorSecret(uint(1), gomock.Any()).Return(nil)
+	enrolment, err := testTwoFactorService.EnrolTwoFactor(user)
+	require.Nil(t, err)
+	require.Contains(t, enrolment.ProvisioningURI, "secret="+enrolment.Secret)
+
+	enabled, _ := twoFactorUser(t, true)
+	_, err = testTwoFactorService.EnrolTwoFactor(enabled)
+	require.Equal(t, errTwoFactorEnabled, err)
+}
+
+func Test_ConfirmTwoFactorService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user, code := twoFactorUser(t, false)
+	mockTwoFactorRepository.EXPECT().EnableTwoFactor(uint(1), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(userID uint, step int64, hashes []string) error {
+			require.Len(t, hashes, recoveryCodeCount)
+			return nil
+		})
+	codes, err := testTwoFactorService.ConfirmTwoFactor(user, code)
+	require.Nil(t, err)
+	require.Len(t, codes.RecoveryCodes, recoveryCodeCount)
+	require.Len(t, codes.RecoveryCodes[0], recoveryCodeLength+1)
+
+	_, err = testTwoFactorService.ConfirmTwoFactor(user, "000000")
+	if code != "000000" {
+		require.Equal(t, errInvalidTwoFactorCode, err)
+	}
+
+	_, err = testTwoFactorService.ConfirmTwoFactor(&models.User{}, code)
+	require.Equal(t, http.StatusBadRequest, err.Status)
+}
+
+func Test_LoginWithTwoFactorService(t *testing.T) {
+	user, code := twoFactorUser(t, true)
+	challengeToken, errr := jwt.GenerateChallengeToken(user.Email, "testSecret")
+	require.NoError(t, errr)
+	accessToken, errr := jwt.GenerateAccessToken(user.Email, 7, "testSecret")
+	require.NoError(t, errr)
+	tokens := &models.TokenPair{AccessToken: "access", RefreshToken: "refresh"}
+	errTooManyCodes := errors.New("too many failed logins, try again in 8s", http.StatusTooManyRequests)
+
+	testCases := []struct {
+		name       string
+		request    models.TwoFactorLoginRequest
+		buildStubs func()
+		wantError  *errors.Error
+	}{
+		{
+			name:    "code of the app",
+			request: models.TwoFactorLoginRequest{ChallengeToken: challengeToken, Code: code[:3] + " " + code[3:]},
+			buildStubs: func() {
+				mockRepository.EXPECT().FindUserByEmail(user.Email).Return(user, nil)
+				mockLoginThrottle.EXPECT().CheckLogin(user.Email, "").Return(nil)
+				mockTwoFactorRepository.EXPECT().UseTwoFactorStep(uint(1), gomock.Any()).Return(nil)
+				mockSessionService.EXPECT().StartSession(user, models.SessionClient{}).Return(tokens, nil)
+				mockLoginThrottle.EXPECT().LoginSucceeded(user.Email)
+			},
+		},
+		{
+			name:    "code of the app used already",
+			request: models.TwoFactorLoginRequest{ChallengeToken: challengeToken, Code: code},
+			buildStubs: func() {
+				mockRepository.EXPECT().FindUserByEmail(user.Email).Return(user, nil)
+				mockLoginThrottle.EXPECT().CheckLogin(user.Email, "").Return(nil)
+				mockTwoFactorRepository.EXPECT().UseTwoFactorStep(uint(1), gomock.Any()).Return(gorm.ErrRecordNotFound)
+				mockLoginThrottle.EXPECT().LoginFailed(user.Email, "", user)
+			},
+			wantError: errInvalidTwoFactorCode,
+		},
+		{
+			name:    "recovery code",
+			request: models.TwoFactorLoginRequest{ChallengeToken: challengeToken, Code: "ABCDE-FGHIJ"},
+			buildStubs: func() {
+				mockRepository.EXPECT().FindUserByEmail(user.Email).Return(user, nil)
+				mockLoginThrottle.EXPECT().CheckLogin(user.Email, "").Return(nil)
+				mockTwoFactorRepository.EXPECT().UseRecoveryCode(uint(1), hashRecoveryCode("abcdefghij"), gomock.Any()).Return(nil)
+				mockSessionService.EXPECT().StartSession(user, models.SessionClient{}).Return(tokens, nil)
+				mockLoginThrottle.EXPECT().LoginSucceeded(user.Email)
+			},
+		},
+		{
+			name:    "unknown recovery code",
+			request: models.TwoFactorLoginRequest{ChallengeToken: challengeToken, Code: "abcde-fghij"},
+			buildStubs: func() {
+				mockRepository.EXPECT().FindUserByEmail(user.Email).Return(user, nil)
+				mockLoginThrottle.EXPECT().CheckLogin(user.Email, "").Return(nil)
+				mockTwoFactorRepository.EXPECT().UseRecoveryCode(uint(1), gomock.Any(), gomock.Any()).Return(gorm.ErrRecordNotFound)
+				mockLoginThrottle.EXPECT().LoginFailed(user.Email, "", user)
+			},
+			wantError: errInvalidTwoFactorCode,
+		},
+		{
+			name:    "too many wrong codes",
+			request: models.TwoFactorLoginRequest{ChallengeToken: challengeToken, Code: code},
+			buildStubs: func() {
+				mockRepository.EXPECT().FindUserByEmail(user.Email).Return(user, nil)
+				mockLoginThrottle.EXPECT().CheckLogin(user.Email, "").Return(errTooManyCodes)
+			},
+			wantError: errTooManyCodes,
+		},
+		{
+			name:    "password reset forced after the challenge",
+			request: models.TwoFactorLoginRequest{ChallengeToken: challengeToken, Code: code},
+			buildStubs: func() {
+				reset := *user
+				reset.PasswordResetRequired = true
+				mockRepository.EXPECT().FindUserByEmail(user.Email).Return(&reset, nil)
+			},
+			wantError: errPasswordResetRequired,
+		},
+		{
+			name:    "deactivated after the challenge",
+			request: models.TwoFactorLoginRequest{ChallengeToken: challengeToken, Code: code},
+			buildStubs: func() {
+				deactivated := *user
+				deactivated.DeactivatedAt = time.Now().Unix()
+				mockRepository.EXPECT().FindUserByEmail(user.Email).Return(&deactivated, nil)
+			},
+			wantError: errors.ErrAccountDeactivated,
+		},
+		{
+			name:       "access token instead of a challenge",
+			request:    models.TwoFactorLoginRequest{ChallengeToken: accessToken, Code: code},
+			buildStubs: func() {},
+			wantError:  errInvalidChallengeToken,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			teardown := setup(t)
+			defer teardown()
+			tc.buildStubs()
+
+			response, err := testTwoFactorService.LoginWithTwoFactor(&tc.request)
+			require.Equal(t, tc.wantError, err)
+			if tc.wantError == nil {
+				require.Equal(t, "refresh", response.RefreshToken)
+			}
+		})
+	}
+}
+
+func Test_RecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	require.NoError(t, err)
+	seen := map[string]bool{}
+	for i, code := range codes {
+		require.Equal(t, hashes[i], hashRecoveryCode(strings.ToUpper(code)))
+		require.False(t, seen[code])
+		seen[code] = true
+	}
+}
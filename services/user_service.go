@@ -0,0 +1,165 @@
+package services
+
+import (
+	stderrors "errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/decagonhq/meddle-api/config"
+	"github.com/decagonhq/meddle-api/db"
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"gorm.io/gorm"
+)
+
+//go:generate mockgen -destination=../mocks/user_mock.go -package=mocks github.com/decagonhq/meddle-api/services UserService
+
+// UserService lets users change their own account
+type UserService interface {
+	UpdateUser(user *models.User, request *models.UpdateUserRequest) (*models.UserProfileResponse, *errors.Error)
+	ChangePassword(user *models.User, request *models.ChangePasswordRequest, client models.SessionClient) (*models.TokenPair, *errors.Error)
+	RequestEmailChange(user *models.User, request *models.ChangeEmailRequest) *errors.Error
+	ConfirmEmailChange(token string) *errors.Error
+}
+
+var (
+	errWrongCurrentPassword = errors.New("the current password is wrong", http.StatusBadRequest)
+	errInvalidEmailLink     = errors.New("invalid or expired link", http.StatusBadRequest)
+)
+
+type userService struct {
+	Config         *config.Config
+	authRepo       db.AuthRepository
+	medicationRepo db.MedicationRepository
+	sessions       SessionService
+	tokens         OneTimeTokenService
+	mail           Mailer
+}
+
+func NewUserService(authRepo db.AuthRepository, medicationRepo db.MedicationRepository, sessions SessionService, tokens OneTimeTokenService, conf *config.Config, mailer Mailer) UserService {
+	return &userService{
+		Config:         conf,
+		authRepo:       authRepo,
+		medicationRepo: medicationRepo,
+		sessions:       sessions,
+		tokens:         tokens,
+		mail:           mailer,
+	}
+}
+
+func (u *userService) UpdateUser(user *models.User, request *models.UpdateUserRequest) (*models.UserProfileResponse, *errors.Error) {
+	if request.PhoneNumber != "" && request.PhoneNumber != user.PhoneNumber {
+		if err := u.authRepo.IsPhoneExist(request.PhoneNumber); err != nil {
+			return nil, errors.New("phone already exist", http.StatusBadRequest)
+		}
+	}
+	// the doses follow the time of day of the user, wherever they are
+	var rescheduled []models.Medication
+	if request.TimeZone != "" && request.TimeZone != user.TimeZone {
+		medications, err := u.medicationRepo.GetAllMedications(user.ID)
+		if err != nil {
+			log.Printf("error getting medications of user %v: %v", user.ID, err)
+			return nil, errors.ErrInternalServerError
+		}
+		rescheduled = rescheduleInTimeZone(medications, request.TimeZone, time.Now())
+	}
+	user.Apply(request)
+	if err := u.authRepo.UpdateUser(user, rescheduled); err != nil {
+		log.Printf("error updating user %v: %v", user.ID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	return user.ToProfileResponse(), nil
+}
+
+// ChangePassword changes the password of the user and signs them out
+// everywhere, handing the client the tokens of a new session
+func (u *userService) ChangePassword(user *models.User, request *models.ChangePasswordRequest, client models.SessionClient) (*models.TokenPair, *errors.Error) {
+	if err := user.VerifyPassword(request.CurrentPassword); err != nil {
+		return nil, errWrongCurrentPassword
+	}
+	if err := models.ValidatePassword(request.NewPassword); err != nil {
+		return nil, errors.New(err.Error(), http.StatusBadRequest)
+	}
+	if request.NewPassword != request.ConfirmPassword {
+		return nil, errors.New("password does not match", http.StatusBadRequest)
+	}
+	hashedPassword, err := GenerateHashPassword(request.NewPassword)
+	if err != nil {
+		log.Printf("error hashing password: %v", err)
+		return nil, errors.ErrInternalServerError
+	}
+	if err := u.authRepo.UpdatePassword(hashedPassword, user.Email); err != nil {
+		log.Printf("error updating password of user %v: %v", user.ID, err)
+		return nil, errors.ErrInternalServerError
+	}
+	user.HashedPassword = hashedPassword
+	if err := u.sessions.RevokeSessions(user.ID); err != nil {
+		return nil, err
+	}
+	return u.sessions.StartSession(user, client)
+}
+
+// RequestEmailChange emails a link to the new address of the user, their
+// email changes once they follow it
+func (u *userService) RequestEmailChange(user *models.User, request *models.ChangeEmailRequest) *errors.Error {
+	if err := user.VerifyPassword(request.Password); err != nil {
+		return errors.ErrInvalidPassword
+	}
+	if request.Email == user.Email {
+		return errors.New("this is your email already", http.StatusBadRequest)
+	}
+	if err := u.authRepo.IsEmailExist(request.Email); err != nil {
+		return errors.New("email already exist", http.StatusBadRequest)
+	}
+	if err := u.authRepo.SetPendingEmail(user.ID, request.Email); err != nil {
+		log.Printf("error setting pending email of user %v: %v", user.ID, err)
+		return errors.ErrInternalServerError
+	}
+	token, err := u.tokens.IssueToken(user.ID, models.PurposeEmailChange, request.Email)
+	if err != nil {
+		return err
+	}
+	value := map[string]interface{}{
+		"link": fmt.Sprintf("%s/email/verify/%s", u.Config.BaseUrl, token),
+	}
+	body := "Please click the link below to verify your new email"
+	if err := u.mail.SendMail(request.Email, "Verify your new email", body, "emailchange", value); err != nil {
+		log.Printf("error sending email change link: %v", err)
+		return errors.New("mail couldn't be sent", http.StatusServiceUnavailable)
+	}
+	return nil
+}
+
+// ConfirmEmailChange changes the email of the user to the address the link
+// was sent to, when it is still the one they last asked for
+func (u *userService) ConfirmEmailChange(token string) *errors.Error {
+	change, errr := u.tokens.ConsumeToken(token, models.PurposeEmailChange)
+	if errr == errInvalidLink {
+		return errInvalidEmailLink
+	}
+	if errr != nil {
+		return errr
+	}
+	user, email, newEmail := change.User, change.User.Email, change.Data
+	if err := u.authRepo.IsEmailExist(newEmail); err != nil {
+		return errors.New("email already exist", http.StatusBadRequest)
+	}
+	err := u.authRepo.ChangeEmail(user.ID, newEmail)
+	if stderrors.Is(err, gorm.ErrRecordNotFound) {
+		return errInvalidEmailLink
+	}
+	if err != nil {
+		log.Printf("error changing email of user %v: %v", user.ID, err)
+		return errors.ErrInternalServerError
+	}
+
+	// the old address hears of it, in case the change wasn't the user's
+	value := map[string]interface{}{"name": user.Name, "new_email": newEmail}
+	body := fmt.Sprintf("The email of your account changed to %s", newEmail)
+	if err := u.mail.SendMail(email, "Your email changed", body, "emailchanged", value); err != nil {
+		log.Printf("error sending email changed notice: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/decagonhq/meddle-api/errors"
+	"github.com/decagonhq/meddle-api/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var testUserService UserService
+
+func passwordUser(t *testing.T) *models.User {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	return &models.User{
+		Model:          models.Model{ID: 1},
+		Name:           "Ken",
+		Email:          "ken@gmail.com",
+		PhoneNumber:    "+2348163608141",
+		HashedPassword: string(hashedPassword),
+		IsEmailActive:  true,
+	}
+}
+
+func Test_UpdateUserService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user := passwordUser(t)
+	refillReminders := false
+	mockMedicationRepository.EXPECT().GetAllMedications(user.ID).Return(nil, nil)
+	mockRepository.EXPECT().UpdateUser(user, nil).Return(nil)
+	profile, err := testUserService.UpdateUser(user, &models.UpdateUserRequest{
+		TimeZone:      "Africa/Lagos",
+		PhoneNumber:   user.PhoneNumber,
+		Notifications: &models.UpdateNotificationPreferencesRequest{RefillReminders: &refillReminders},
+	})
+	require.Nil(t, err)
+	require.Equal(t, "Africa/Lagos", profile.TimeZone)
+	require.Equal(t, "Ken", profile.Name)
+	require.True(t, profile.Notifications.DoseReminders)
+	require.False(t, profile.Notifications.RefillReminders)
+
+	mockRepository.EXPECT().IsPhoneExist("+2348000000000").Return(errors.New("phone number already in use", http.StatusBadRequest))
+	_, err = testUserService.UpdateUser(user, &models.UpdateUserRequest{PhoneNumber: "+2348000000000"})
+	require.Equal(t, http.StatusBadRequest, err.Status)
+	require.Equal(t, "+2348163608141", user.PhoneNumber)
+}
+
+func Test_UpdateTimeZoneService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user := passwordUser(t)
+	user.TimeZone = "Africa/Lagos"
+	lagos, _ := time.LoadLocation("Africa/Lagos")
+	start := time.Now().In(lagos).AddDate(0, 0, -3)
+	start = time.Date(start.Year(), start.Month(), start.Day(), 8, 0, 0, 0, lagos)
+	newMedication := func(id uint, schedule models.DosageSchedule, status models.MedicationStatus) models.Medication {
+		return models.Medication{
+			SoftDeleteModel:     models.SoftDeleteModel{ID: id},
+			UserID:              user.ID,
+			Schedule:            schedule,
+			Status:              status,
+			MedicationStartTime: start,
+			MedicationStopDate:  start.AddDate(0, 0, 30),
+			NextDosageTime:      start.AddDate(0, 0, 4),
+			TimeZone:            "Africa/Lagos",
+		}
+	}
+	daily := models.DosageSchedule{Kind: models.ScheduleDaily, TimesOfDay: models.TimesOfDay{"08:00"}}
+	medications := []models.Medication{
+		newMedication(1, daily, models.MedicationActive),
+		newMedication(2, models.DosageSchedule{Kind: models.ScheduleInterval, IntervalHours: 8}, models.MedicationActive),
+		newMedication(3, daily, models.MedicationPaused),
+	}
+
+	mockMedicationRepository.EXPECT().GetAllMedications(user.ID).Return(medications, nil)
+	mockRepository.EXPECT().UpdateUser(user, gomock.Any()).DoAndReturn(func(user *models.User, rescheduled []models.Medication) error {
+		require.Equal(t, "America/New_York", user.TimeZone)
+		// only the active medication taken at a time of day moves
+		require.Len(t, rescheduled, 1)
+		require.Equal(t, uint(1), rescheduled[0].ID)
+		newYork, _ := time.LoadLocation("America/New_York")
+		next := rescheduled[0].NextDosageTime.In(newYork)
+		require.Equal(t, 8, next.Hour())
+		require.Equal(t, 0, next.Minute())
+		require.True(t, next.After(time.Now()))
+		require.True(t, next.Before(time.Now().Add(24*time.Hour)))
+		return nil
+	})
+	_, err := testUserService.UpdateUser(user, &models.UpdateUserRequest{TimeZone: "America/New_York"})
+	require.Nil(t, err)
+
+	// the same time zone leaves the medications alone
+	mockRepository.EXPECT().UpdateUser(user, nil).Return(nil)
+	_, err = testUserService.UpdateUser(user, &models.UpdateUserRequest{TimeZone: "America/New_York"})
+	require.Nil(t, err)
+}
+
+func Test_ChangePasswordService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user := passwordUser(t)
+	_, err := testUserService.ChangePassword(user, &models.ChangePasswordRequest{CurrentPassword: "wrong", NewPassword: "newpassword", ConfirmPassword: "newpassword"}, models.SessionClient{})
+	require.Equal(t, errWrongCurrentPassword, err)
+
+	_, err = testUserService.ChangePassword(user, &models.ChangePasswordRequest{CurrentPassword: "password", NewPassword: "newpassword", ConfirmPassword: "other"}, models.SessionClient{})
+	require.Equal(t, http.StatusBadRequest, err.Status)
+
+	tokens := &models.TokenPair{AccessToken: "access", RefreshToken: "refresh"}
+	mockRepository.EXPECT().UpdatePassword(gomock.Any(), user.Email).Return(nil)
+	mockSessionService.EXPECT().RevokeSessions(user.ID).Return(nil)
+	mockSessionService.EXPECT().StartSession(user, models.SessionClient{IP: "10.0.0.1"}).Return(tokens, nil)
+	got, err := testUserService.ChangePassword(user, &models.ChangePasswordRequest{CurrentPassword: "password", NewPassword: "newpassword", ConfirmPassword: "newpassword"}, models.SessionClient{IP: "10.0.0.1"})
+	require.Nil(t, err)
+	require.Equal(t, tokens, got)
+	require.NoError(t, user.VerifyPassword("newpassword"))
+}
+
+func Test_RequestEmailChangeService(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+
+	user := passwordUser(t)
+	err := testUserService.RequestEmailChange(user, &models.ChangeEmailRequest{Email: "new@gmail.com", Password: "wrong"})
+	require.Equal(t, errors.ErrInvalidPassword, err)
+
+	mockRepository.EXPECT().IsEmailExist("taken@gmail.com").Return(errors.New("email already in use", http.StatusBadRequest))
+	err = testUserService.RequestEmailChange(user, &models.ChangeEmailRequest{Email: "taken@gmail.com", Password: "password"})
+	require.Equal(t, http.StatusBadRequest, err.Status)
+
+	mockRepository.EXPECT().IsEmailExist("new@gmail.com").Return(nil)
+	mockRepository.EXPECT().SetPendingEmail(user.ID, "new@gmail.com").Return(nil)
+	mockOneTimeTokens.EXPECT().IssueToken(user.ID, models.PurposeEmailChange, "new@gmail.com").Return("token", nil)
+	mockMailer.EXPECT().SendMail("new@gmail.com", gomock.Any(), gomock.Any(), "emailchange", map[string]interface{}{
+		"link": testConfig.BaseUrl + "/email/verify/token",
+	}).Return(nil)
+	err = testUserService.RequestEmailChange(user, &models.ChangeEmailRequest{Email: "new@gmail.com", Password: "password"})
+	require.Nil(t, err)
+}
+
+func Test_ConfirmEmailChangeService(t *testing.T) {
+	user := passwordUser(t)
+	token := "token"
+	change := &models.OneTimeToken{UserID: user.ID, Purpose: models.PurposeEmailChange, Data: "new@gmail.com", User: user}
+
+	testCases := []struct {
+		name       string
+		token      string
+		buildStubs func()
+		wantError  *errors.Error
+	}{
+		{
+			name:  "changes the email",
+			token: token,
+			buildStubs: func() {
+				mockOneTimeTokens.EXPECT().ConsumeToken(token, models.PurposeEmailChange).Return(change, nil)
+				mockRepository.EXPECT().IsEmailExist("new@gmail.com").Return(nil)
+				mockRepository.EXPECT().ChangeEmail(user.ID, "new@gmail.com").Return(nil)
+				mockMailer.EXPECT().SendMail(user.Email, gomock.Any(), gomock.Any(), "emailchanged", gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name:  "link used already",
+			token: token,
+			buildStubs: func() {
+				mockOneTimeTokens.EXPECT().ConsumeToken(token, models.PurposeEmailChange).Return(nil, errInvalidLink)
+			},
+			wantError: errInvalidEmailLink,
+		},
+		{
+			name:  "another change asked since",
+			token: token,
+			buildStubs: func() {
+				mockOneTimeTokens.EXPECT().ConsumeToken(token, models.PurposeEmailChange).Return(change, nil)
+				mockRepository.EXPECT().IsEmailExist("new@gmail.com").Return(nil)
+				mockRepository.EXPECT().ChangeEmail(user.ID, "new@gmail.com").Return(gorm.ErrRecordNotFound)
+			},
+			wantError: errInvalidEmailLink,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			teardown := setup(t)
+			defer teardown()
+			tc.buildStubs()
+
+			require.Equal(t, tc.wantError, testUserService.ConfirmEmailChange(tc.token))
+		})
+	}
+}